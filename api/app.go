@@ -17,6 +17,7 @@ import (
 	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
@@ -821,10 +822,13 @@ func getEnv(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 			return permission.ErrUnauthorized
 		}
 	}
-	return writeEnvVars(w, &a, variables...)
+	return writeEnvVars(w, &a, t.IsAppToken(), variables...)
 }
 
-func writeEnvVars(w http.ResponseWriter, a *app.App, variables ...string) error {
+// writeEnvVars encodes the app environment variables. Private variables are
+// only revealed, decrypting the ones stored as secrets, when reveal is true,
+// i.e. for app units, other clients get a masked value.
+func writeEnvVars(w http.ResponseWriter, a *app.App, reveal bool, variables ...string) error {
 	var result []bind.EnvVar
 	w.Header().Set("Content-Type", "application/json")
 	if len(variables) > 0 {
@@ -838,6 +842,20 @@ func writeEnvVars(w http.ResponseWriter, a *app.App, variables ...string) error
 			result = append(result, v)
 		}
 	}
+	for i := range result {
+		if result[i].Public {
+			continue
+		}
+		if !reveal {
+			result[i].Value = app.MaskedEnvValue
+			continue
+		}
+		value, err := secret.Open(result[i].Value)
+		if err != nil {
+			return err
+		}
+		result[i].Value = value
+	}
 	return json.NewEncoder(w).Encode(result)
 }
 
@@ -912,6 +930,7 @@ func setEnv(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 			Envs:          variables,
 			PublicOnly:    true,
 			ShouldRestart: !e.NoRestart,
+			Owner:         t.GetUserName(),
 		}, writer,
 	)
 }
@@ -968,10 +987,222 @@ func unsetEnv(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 			VariableNames: variables,
 			PublicOnly:    true,
 			ShouldRestart: !noRestart,
+			Owner:         t.GetUserName(),
 		}, writer,
 	)
 }
 
+// title: env history
+// path: /apps/{app}/env/history
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func envHistory(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppReadEnv,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	var limit int
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid limit"}
+		}
+	}
+	history, err := a.EnvHistory(limit)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(history)
+}
+
+// title: restore envs
+// path: /apps/{app}/env/history/{version}/restore
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Envs restored
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App or version not found
+func restoreEnvVersion(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	version, err := strconv.Atoi(r.URL.Query().Get(":version"))
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid version"}
+	}
+	noRestart, _ := strconv.ParseBool(r.FormValue("noRestart"))
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateEnvRestore,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateEnvRestore,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	err = a.RestoreEnvs(version, t.GetUserName(), !noRestart, writer)
+	if err == app.ErrEnvVersionNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: list units autoscale policies
+// path: /apps/{app}/autoscale
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func listUnitsAutoScale(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppRead,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	policies, err := a.AutoScalePolicies()
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(policies)
+}
+
+// title: set units autoscale policy
+// path: /apps/{app}/autoscale
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func setUnitsAutoScale(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateAutoscale,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	var policy app.AutoScalePolicy
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	err = dec.DecodeValues(&policy, r.Form)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateAutoscale,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = a.SetAutoScalePolicy(policy)
+	if _, ok := err.(*app.InvalidAutoScalePolicyError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// title: remove units autoscale policy
+// path: /apps/{app}/autoscale
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: App or policy not found
+func removeUnitsAutoScale(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateAutoscale,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateAutoscale,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = a.RemoveAutoScalePolicy(r.URL.Query().Get("process"))
+	if err == app.ErrAutoScalePolicyNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
 // title: set cname
 // path: /apps/{app}/cname
 // method: POST
@@ -1180,6 +1411,7 @@ func getServiceInstance(serviceName, instanceName, appName string) (*service.Ser
 //   400: Invalid data
 //   401: Unauthorized
 //   404: App not found
+//   412: Service instance not ready
 func bindServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	instanceName := r.URL.Query().Get(":instance")
 	appName := r.URL.Query().Get(":app")
@@ -1203,6 +1435,10 @@ func bindServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) (
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
+	err = instance.CheckReady()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
 	evt, err := event.New(&event.Opts{
 		Target:     appTarget(appName),
 		Kind:       permission.PermAppUpdateBind,
@@ -1288,6 +1524,76 @@ func unbindServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	return nil
 }
 
+// title: rotate service instance credentials
+// path: /services/{service}/instances/{instance}/{app}/rotate
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+//   412: Service instance not ready
+func rotateServiceInstanceCredentials(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	instanceName, appName, serviceName := r.URL.Query().Get(":instance"), r.URL.Query().Get(":app"),
+		r.URL.Query().Get(":service")
+	noRestart, _ := strconv.ParseBool(r.FormValue("noRestart"))
+	grace := service.DefaultRotationGracePeriod
+	if value := r.FormValue("grace-period"); value != "" {
+		seconds, parseErr := strconv.Atoi(value)
+		if parseErr != nil || seconds < 0 {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "grace-period must be a non-negative number of seconds"}
+		}
+		grace = time.Duration(seconds) * time.Second
+	}
+	instance, a, err := getServiceInstance(serviceName, instanceName, appName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateRotate,
+		contextsForServiceInstance(instance, serviceName)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	allowed = permission.Check(t, permission.PermAppUpdateBind,
+		contextsForApp(a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	err = instance.CheckReady()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
+	if instance.FindApp(appName) == -1 {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: service.ErrAppNotBound.Error()}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:       appTarget(appName),
+		ExtraTargets: []event.Target{serviceInstanceTarget(serviceName, instanceName)},
+		Kind:         permission.PermServiceInstanceUpdateRotate,
+		Owner:        t,
+		CustomData:   event.FormToCustomData(r.Form),
+		Allowed:      event.Allowed(permission.PermAppReadEvents, contextsForApp(a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	err = instance.RotateCredentials(a, !noRestart, grace, writer)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(writer, "\nCredentials of instance %q for the app %q were rotated.\n", instanceName, appName)
+	return nil
+}
+
 // title: app restart
 // path: /apps/{app}/restart
 // method: POST
@@ -1681,7 +1987,7 @@ func registerUnit(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		}
 		return err
 	}
-	return writeEnvVars(w, a)
+	return writeEnvVars(w, a, true)
 }
 
 // title: metric envs
@@ -24,9 +24,13 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/app/secret/secrettest"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
@@ -2631,18 +2635,15 @@ func (s *S) TestGetEnvAllEnvs(c *check.C) {
 	expected := []bind.EnvVar{
 		{Name: "DATABASE_HOST", Value: "localhost", Public: true},
 		{Name: "DATABASE_USER", Value: "root", Public: true},
-		{Name: "TSURU_APPNAME", Value: "everything-i-want", Public: false},
-		{Name: "TSURU_APPDIR", Value: "/home/application/current", Public: false},
-		{Name: "TSURU_APP_TOKEN", Value: "123", Public: false},
+		{Name: "TSURU_APPNAME", Value: app.MaskedEnvValue, Public: false},
+		{Name: "TSURU_APPDIR", Value: app.MaskedEnvValue, Public: false},
+		{Name: "TSURU_APP_TOKEN", Value: app.MaskedEnvValue, Public: false},
 	}
 	result := []bind.EnvVar{}
 	err = json.Unmarshal(recorder.Body.Bytes(), &result)
 	c.Assert(err, check.IsNil)
 	c.Assert(len(result), check.Equals, len(expected))
 	for _, r := range result {
-		if r.Name == "TSURU_APP_TOKEN" {
-			continue
-		}
 		for _, e := range expected {
 			if e.Name == r.Name {
 				c.Check(e.Public, check.Equals, r.Public)
@@ -5573,3 +5574,482 @@ func (s *S) TestListCertificates(c *check.C) {
 		"myapp.fakerouter.com": "",
 	})
 }
+
+func (s *S) TestBindHandlerInstanceNotReady(c *check.C) {
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": "http://localhost:1234"}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	instance := service.ServiceInstance{
+		Name:        "my-mysql",
+		ServiceName: "mysql",
+		Teams:       []string{s.team.Name},
+		State:       service.InstanceStatePending,
+	}
+	err = instance.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "painkiller", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/services/%s/instances/%s/%s", instance.ServiceName, instance.Name, a.Name)
+	request, err := http.NewRequest("PUT", u, strings.NewReader("noRestart=false"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusPreconditionFailed)
+	c.Assert(recorder.Body.String(), check.Equals, service.ErrInstanceNotReady.Error()+"\n")
+}
+
+func (s *S) TestRotateServiceInstanceCredentialsHandler(c *check.C) {
+	var revoked string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/resources/my-mysql/bind-app/credentials" && r.Method == "POST":
+			w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"n3w"}`))
+		case r.URL.Path == "/resources/my-mysql/bind-app/credentials" && r.Method == "DELETE":
+			r.ParseForm()
+			revoked = r.Form.Get("binding-id")
+		default:
+			w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"s3cr3t"}`))
+		}
+	}))
+	defer ts.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	instance := service.ServiceInstance{
+		Name:        "my-mysql",
+		ServiceName: "mysql",
+		Teams:       []string{s.team.Name},
+	}
+	err = instance.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{
+		Name:      "painkiller",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+		Env:       map[string]bind.EnvVar{},
+	}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = instance.BindApp(&a, false, nil)
+	c.Assert(err, check.IsNil)
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, check.IsNil)
+	oldID := instance.BindingFor(a.Name).ID
+	u := fmt.Sprintf("/services/%s/instances/%s/%s/rotate", instance.ServiceName, instance.Name, a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader("noRestart=true&grace-period=0"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Matches, `(?s).*Credentials of instance \\"my-mysql\\" for the app \\"painkiller\\" were rotated.*`)
+	c.Assert(revoked, check.Equals, oldID)
+	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&a)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.Env["DATABASE_PASSWORD"].Value, check.Equals, "n3w")
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, check.IsNil)
+	c.Assert(instance.Apps, check.DeepEquals, []string{a.Name})
+	c.Assert(instance.BindingFor(a.Name).Rotated, check.HasLen, 1)
+	c.Assert(eventtest.EventDesc{
+		Target:       appTarget(a.Name),
+		ExtraTargets: []event.Target{serviceInstanceTarget(instance.ServiceName, instance.Name)},
+		Owner:        s.token.GetUserName(),
+		Kind:         "service-instance.update.rotate",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": ":instance", "value": instance.Name},
+			{"name": ":service", "value": instance.ServiceName},
+			{"name": "noRestart", "value": "true"},
+			{"name": "grace-period", "value": "0"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRotateServiceInstanceCredentialsHandlerAppNotBound(c *check.C) {
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": "http://localhost:1234"}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	instance := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err = instance.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "painkiller", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/services/%s/instances/%s/%s/rotate", instance.ServiceName, instance.Name, a.Name)
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, service.ErrAppNotBound.Error()+"\n")
+}
+
+func (s *S) TestRotateServiceInstanceCredentialsHandlerInvalidGracePeriod(c *check.C) {
+	u := "/services/mysql/instances/my-mysql/painkiller/rotate"
+	request, err := http.NewRequest("POST", u, strings.NewReader("grace-period=soon"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "grace-period must be a non-negative number of seconds\n")
+}
+
+func (s *S) TestGetEnvMasksSecretValues(c *check.C) {
+	cleanup, err := secrettest.EnableLocalKey()
+	c.Assert(err, check.IsNil)
+	defer cleanup()
+	sealed, err := secret.Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	a := app.App{
+		Name:      "everything-i-want",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+		Env: map[string]bind.EnvVar{
+			"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: sealed, Public: false},
+		},
+	}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env?env=DATABASE_PASSWORD", a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	result := []bind.EnvVar{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []bind.EnvVar{
+		{Name: "DATABASE_PASSWORD", Value: "*** (private variable)", Public: false},
+	})
+}
+
+func (s *S) TestGetEnvMasksPrivateValues(c *check.C) {
+	a := app.App{
+		Name:      "everything-i-want",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+		Env: map[string]bind.EnvVar{
+			"DATABASE_HOST":     {Name: "DATABASE_HOST", Value: "localhost", Public: true},
+			"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: "secret", Public: false},
+		},
+	}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env?env=DATABASE_HOST&env=DATABASE_PASSWORD", a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	result := []bind.EnvVar{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []bind.EnvVar{
+		{Name: "DATABASE_HOST", Value: "localhost", Public: true},
+		{Name: "DATABASE_PASSWORD", Value: app.MaskedEnvValue, Public: false},
+	})
+}
+
+func (s *S) TestGetEnvWithAppTokenDecryptsSecretValues(c *check.C) {
+	cleanup, err := secrettest.EnableLocalKey()
+	c.Assert(err, check.IsNil)
+	defer cleanup()
+	sealed, err := secret.Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	a := app.App{
+		Name:      "everything-i-want",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+		Env: map[string]bind.EnvVar{
+			"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: sealed, Public: false},
+		},
+	}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env?env=DATABASE_PASSWORD", a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	token, err := nativeScheme.AppLogin(a.Name)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	result := []bind.EnvVar{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []bind.EnvVar{
+		{Name: "DATABASE_PASSWORD", Value: "s3cr3t", Public: false},
+	})
+}
+
+func (s *S) TestEnvHistory(c *check.C) {
+	a := app.App{Name: "history-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{
+			{Name: "DATABASE_HOST", Value: "localhost", Public: true},
+			{Name: "DATABASE_PASSWORD", Value: "secret", Public: false},
+		},
+		Owner: s.token.GetUserName(),
+	}, nil)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env/history?limit=1", a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var history []app.EnvHistoryEntry
+	err = json.Unmarshal(recorder.Body.Bytes(), &history)
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 1)
+	c.Assert(history[0].Version, check.Equals, 2)
+	c.Assert(history[0].Owner, check.Equals, s.token.GetUserName())
+	c.Assert(history[0].Changes, check.DeepEquals, []app.EnvChange{
+		{Name: "DATABASE_HOST", Action: app.EnvChangeAdded, NewValue: "localhost", Public: true},
+		{Name: "DATABASE_PASSWORD", Action: app.EnvChangeAdded, NewValue: app.MaskedEnvValue},
+	})
+}
+
+func (s *S) TestEnvHistoryNoContent(c *check.C) {
+	a := app.App{Name: "history-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env/history", a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestEnvHistoryInvalidLimit(c *check.C) {
+	a := app.App{Name: "history-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env/history?limit=many", a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestRestoreEnvVersion(c *check.C) {
+	a := app.App{Name: "history-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	for _, value := range []string{"localhost", "remotehost"} {
+		err = a.SetEnvs(bind.SetEnvApp{
+			Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: value, Public: true}},
+		}, nil)
+		c.Assert(err, check.IsNil)
+	}
+	url := fmt.Sprintf("/apps/%s/env/history/2/restore", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("noRestart=true"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Equals,
+		`{"Message":"---- Restoring environment variables from version 2 ----\n"}
+`)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.env.restore",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": ":version", "value": "2"},
+			{"name": "noRestart", "value": "true"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRestoreEnvVersionNotFound(c *check.C) {
+	a := app.App{Name: "history-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env/history/42/restore", a.Name)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestRestoreEnvVersionUserDoesNotHaveAccessToTheApp(c *check.C) {
+	a := app.App{Name: "history-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateEnvRestore,
+		Context: permission.Context(permission.CtxApp, "-invalid-"),
+	})
+	url := fmt.Sprintf("/apps/%s/env/history/1/restore", a.Name)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestSetUnitsAutoScale(c *check.C) {
+	a := app.App{Name: "scaled-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = image.SaveImageCustomData("tsuru/app-scaled-app:v1", map[string]interface{}{
+		"processes": map[string]interface{}{"web": "python app.py"},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "tsuru/app-scaled-app:v1")
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("Process=web&MinUnits=1&MaxUnits=4&TargetCPU=70")
+	request, err := http.NewRequest("POST", "/apps/scaled-app/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	policies, err := a.AutoScalePolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.DeepEquals, []app.AutoScalePolicy{
+		{App: "scaled-app", Process: "web", MinUnits: 1, MaxUnits: 4, TargetCPU: 70},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.autoscale",
+		StartCustomData: []map[string]interface{}{
+			{"name": "Process", "value": "web"},
+			{"name": "MaxUnits", "value": "4"},
+		},
+	}, eventtest.HasEvent)
+	request, err = http.NewRequest("GET", "/apps/scaled-app/autoscale", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result []app.AutoScalePolicy
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, policies)
+}
+
+func (s *S) TestSetUnitsAutoScaleInvalid(c *check.C) {
+	a := app.App{Name: "scaled-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("Process=web&MinUnits=1&MaxUnits=4")
+	request, err := http.NewRequest("POST", "/apps/scaled-app/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid auto scale policy: either target cpu or target memory must be set\n")
+}
+
+func (s *S) TestListUnitsAutoScaleNoContent(c *check.C) {
+	a := app.App{Name: "scaled-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/scaled-app/autoscale", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestRemoveUnitsAutoScale(c *check.C) {
+	a := app.App{Name: "scaled-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = image.SaveImageCustomData("tsuru/app-scaled-app:v1", map[string]interface{}{
+		"processes": map[string]interface{}{"web": "python app.py"},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "tsuru/app-scaled-app:v1")
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScalePolicy(app.AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 2, TargetCPU: 50})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/scaled-app/autoscale?process=web", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	policies, err := a.AutoScalePolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.HasLen, 0)
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestSetUnitsAutoScaleUnauthorized(c *check.C) {
+	a := app.App{Name: "scaled-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	body := strings.NewReader("Process=web&MinUnits=1&MaxUnits=4&TargetCPU=70")
+	request, err := http.NewRequest("POST", "/apps/scaled-app/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
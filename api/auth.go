@@ -8,6 +8,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
@@ -22,6 +24,7 @@ import (
 const (
 	nonManagedSchemeMsg = "Authentication scheme does not allow this operation."
 	createDisabledMsg   = "User registration is disabled for non-admin users."
+	defaultInactiveDays = 90
 )
 
 var createDisabledErr = &errors.HTTP{Code: http.StatusUnauthorized, Message: createDisabledMsg}
@@ -126,6 +129,15 @@ func login(w http.ResponseWriter, r *http.Request) (err error) {
 	if err != nil {
 		return handleAuthError(err)
 	}
+	if u, errUser := token.User(); errUser == nil {
+		if err = u.CheckEnabled(); err != nil {
+			app.AuthScheme.Logout(token.GetValue())
+			return handleAuthError(err)
+		}
+		if err = u.RecordLogin(); err != nil {
+			log.Errorf("unable to record login for %q: %s", u.Email, err)
+		}
+	}
 	return json.NewEncoder(w).Encode(map[string]string{"token": token.GetValue()})
 }
 
@@ -261,9 +273,15 @@ func createTeam(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 	if err != nil {
 		return err
 	}
-	err = auth.CreateTeam(name, u)
+	team := auth.Team{
+		Name:         name,
+		Description:  r.FormValue("description"),
+		Tags:         r.Form["tag"],
+		ContactEmail: r.FormValue("contact_email"),
+	}
+	err = auth.CreateTeamWithInfo(team, u)
 	switch err {
-	case auth.ErrInvalidTeamName:
+	case auth.ErrInvalidTeamName, auth.ErrInvalidTeamContact:
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	case auth.ErrTeamAlreadyExists:
 		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
@@ -274,6 +292,104 @@ func createTeam(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 	return err
 }
 
+func getTeamForHandler(name string, t auth.Token, perm *permission.PermissionScheme) (*auth.Team, error) {
+	allowed := permission.Check(t, perm, permission.Context(permission.CtxTeam, name))
+	if !allowed {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf(`Team "%s" not found.`, name)}
+	}
+	team, err := auth.GetTeam(name)
+	if err == auth.ErrTeamNotFound {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf(`Team "%s" not found.`, name)}
+	}
+	return team, err
+}
+
+// title: team info
+// path: /teams/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Not found
+func teamInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	team, err := getTeamForHandler(r.URL.Query().Get(":name"), t, permission.PermTeamRead)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(team)
+}
+
+// title: update team
+// path: /teams/{name}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Team updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func updateTeam(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	team, err := getTeamForHandler(name, t, permission.PermTeamUpdate)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamUpdate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, name)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	if _, ok := r.Form["description"]; ok {
+		team.Description = r.FormValue("description")
+	}
+	if _, ok := r.Form["tag"]; ok {
+		team.Tags = r.Form["tag"]
+	}
+	if _, ok := r.Form["contact_email"]; ok {
+		team.ContactEmail = r.FormValue("contact_email")
+	}
+	err = team.Update()
+	if err == auth.ErrInvalidTeamContact {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// title: team users
+// path: /teams/{name}/users
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: Not found
+func teamUsers(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	team, err := getTeamForHandler(r.URL.Query().Get(":name"), t, permission.PermTeamRead)
+	if err != nil {
+		return err
+	}
+	members, err := team.Members()
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(members)
+}
+
 // title: remove team
 // path: /teams/{name}
 // method: DELETE
@@ -534,6 +650,120 @@ func removeUser(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 	return app.AuthScheme.Remove(u)
 }
 
+func changeUserStatus(r *http.Request, t auth.Token, perm *permission.PermissionScheme, change func(*auth.User) error) (err error) {
+	r.ParseForm()
+	email := r.URL.Query().Get(":email")
+	allowed := permission.Check(t, perm, permission.Context(permission.CtxUser, email))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	u, err := auth.GetUserByEmail(email)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     userTarget(email),
+		Kind:       perm,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermUserReadEvents, permission.Context(permission.CtxUser, email)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return change(u)
+}
+
+// title: disable user
+// path: /users/{email}/disable
+// method: POST
+// responses:
+//   200: User disabled
+//   401: Unauthorized
+//   404: Not found
+func disableUser(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	return changeUserStatus(r, t, permission.PermUserUpdateDisable, func(u *auth.User) error {
+		if u.Email == t.GetUserName() {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "You cannot disable yourself."}
+		}
+		return u.SetDisabled(true)
+	})
+}
+
+// title: enable user
+// path: /users/{email}/enable
+// method: POST
+// responses:
+//   200: User enabled
+//   401: Unauthorized
+//   404: Not found
+func enableUser(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	return changeUserStatus(r, t, permission.PermUserUpdateEnable, func(u *auth.User) error {
+		return u.SetDisabled(false)
+	})
+}
+
+// title: unlock user
+// path: /users/{email}/unlock
+// method: POST
+// responses:
+//   200: User unlocked
+//   401: Unauthorized
+//   404: Not found
+func unlockUser(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	return changeUserStatus(r, t, permission.PermUserUpdateUnlock, func(u *auth.User) error {
+		return u.Unlock()
+	})
+}
+
+type inactiveUser struct {
+	Email     string     `json:"email"`
+	LastLogin *time.Time `json:"lastLogin,omitempty"`
+	Disabled  bool       `json:"disabled"`
+}
+
+// title: inactive users
+// path: /users/inactive
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   400: Invalid data
+//   401: Unauthorized
+func inactiveUsers(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermUserReadInactive) {
+		return permission.ErrUnauthorized
+	}
+	days := defaultInactiveDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		var err error
+		days, err = strconv.Atoi(v)
+		if err != nil || days < 0 {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid number of days"}
+		}
+	}
+	users, err := auth.ListInactiveUsers(time.Now().UTC().AddDate(0, 0, -days))
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	result := make([]inactiveUser, len(users))
+	for i, u := range users {
+		result[i] = inactiveUser{Email: u.Email, Disabled: u.Disabled}
+		if !u.LastLogin.IsZero() {
+			lastLogin := u.LastLogin
+			result[i].LastLogin = &lastLogin
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(result)
+}
+
 type schemeData struct {
 	Name string          `json:"name"`
 	Data auth.SchemeInfo `json:"data"`
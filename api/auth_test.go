@@ -306,6 +306,56 @@ func (s *AuthSuite) TestLoginShouldCreateTokenInTheDatabaseAndReturnItWithinTheR
 	c.Assert(n, check.Equals, 1)
 }
 
+func (s *AuthSuite) TestLoginRecordsLastLogin(c *check.C) {
+	u := auth.User{Email: "nobody@globo.com", Password: "123456"}
+	_, err := nativeScheme.Create(&u)
+	c.Assert(err, check.IsNil)
+	b := strings.NewReader("password=123456")
+	request, err := http.NewRequest("POST", "/users/nobody@globo.com/tokens", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	user, err := auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(user.LastLogin.IsZero(), check.Equals, false)
+}
+
+func (s *AuthSuite) TestLoginDisabledUser(c *check.C) {
+	u := auth.User{Email: "nobody@globo.com", Password: "123456"}
+	_, err := nativeScheme.Create(&u)
+	c.Assert(err, check.IsNil)
+	err = u.SetDisabled(true)
+	c.Assert(err, check.IsNil)
+	b := strings.NewReader("password=123456")
+	request, err := http.NewRequest("POST", "/users/nobody@globo.com/tokens", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrUserDisabled.Error()+"\n")
+}
+
+func (s *AuthSuite) TestDisabledUserTokenIsRejected(c *check.C) {
+	token := customUserWithPermission(c, "disableduser")
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = u.SetDisabled(true)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/users/info", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrUserDisabled.Error()+"\n")
+}
+
 func (s *AuthSuite) TestLoginPasswordMissing(c *check.C) {
 	b := strings.NewReader("")
 	request, err := http.NewRequest("POST", "/users/nobody@globo.com/tokens", b)
@@ -447,6 +497,149 @@ func (s *AuthSuite) TestCreateTeamAlreadyExists(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Equals, "team already exists\n")
 }
 
+func (s *AuthSuite) TestCreateTeamWithInfo(c *check.C) {
+	b := strings.NewReader("name=timeredbull&description=red+bull&tag=energy&tag=drinks&contact_email=bull@globo.com")
+	request, err := http.NewRequest("POST", "/teams", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	team, err := auth.GetTeam("timeredbull")
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Description, check.Equals, "red bull")
+	c.Assert(team.Tags, check.DeepEquals, []string{"energy", "drinks"})
+	c.Assert(team.ContactEmail, check.Equals, "bull@globo.com")
+}
+
+func (s *AuthSuite) TestCreateTeamInvalidContact(c *check.C) {
+	b := strings.NewReader("name=timeredbull&contact_email=bull")
+	request, err := http.NewRequest("POST", "/teams", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrInvalidTeamContact.Error()+"\n")
+}
+
+func (s *AuthSuite) TestTeamInfo(c *check.C) {
+	s.team.Description = "the team"
+	err := s.team.Update()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/teams/tsuruteam", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var team auth.Team
+	err = json.NewDecoder(recorder.Body).Decode(&team)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Name, check.Equals, "tsuruteam")
+	c.Assert(team.Description, check.Equals, "the team")
+}
+
+func (s *AuthSuite) TestTeamInfoNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/teams/unknown", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *AuthSuite) TestTeamInfoWithoutPermission(c *check.C) {
+	token := customUserWithPermission(c, "otherteamuser", permission.Permission{
+		Scheme:  permission.PermTeamRead,
+		Context: permission.Context(permission.CtxTeam, s.team2.Name),
+	})
+	request, err := http.NewRequest("GET", "/teams/tsuruteam", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *AuthSuite) TestUpdateTeam(c *check.C) {
+	b := strings.NewReader("description=new+description&tag=a&tag=b&contact_email=team@globo.com")
+	request, err := http.NewRequest("PUT", "/teams/tsuruteam", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam("tsuruteam")
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Description, check.Equals, "new description")
+	c.Assert(team.Tags, check.DeepEquals, []string{"a", "b"})
+	c.Assert(team.ContactEmail, check.Equals, "team@globo.com")
+	c.Assert(eventtest.EventDesc{
+		Target: teamTarget("tsuruteam"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "team.update",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": "tsuruteam"},
+			{"name": "description", "value": "new description"},
+			{"name": "tag", "value": []string{"a", "b"}},
+			{"name": "contact_email", "value": "team@globo.com"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *AuthSuite) TestUpdateTeamInvalidContact(c *check.C) {
+	b := strings.NewReader("contact_email=team")
+	request, err := http.NewRequest("PUT", "/teams/tsuruteam", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *AuthSuite) TestTeamUsers(c *check.C) {
+	customUserWithPermission(c, "teammember", permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/teams/tsuruteam/users", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var members []auth.TeamMember
+	err = json.NewDecoder(recorder.Body).Decode(&members)
+	c.Assert(err, check.IsNil)
+	c.Assert(members, check.DeepEquals, []auth.TeamMember{
+		{Email: "teammember@groundcontrol.com", Roles: []string{"teammemberapp.deploytsuruteam"}},
+	})
+}
+
+func (s *AuthSuite) TestTeamUsersNoContent(c *check.C) {
+	request, err := http.NewRequest("GET", "/teams/tsuruteam2/users", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
 func (s *AuthSuite) TestRemoveTeam(c *check.C) {
 	conn, _ := db.Conn()
 	defer conn.Close()
@@ -1740,3 +1933,114 @@ func (s *AuthSuite) BenchmarkListUsersManyUsers(c *check.C) {
 	sort.Strings(expectedNames)
 	c.Assert(names, check.DeepEquals, expectedNames)
 }
+
+func (s *AuthSuite) TestDisableUser(c *check.C) {
+	u := auth.User{Email: "offboarded@globo.com", Password: "123456"}
+	_, err := nativeScheme.Create(&u)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/users/offboarded@globo.com/disable", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	user, err := auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Disabled, check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: userTarget(u.Email),
+		Owner:  s.token.GetUserName(),
+		Kind:   "user.update.disable",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":email", "value": u.Email},
+		},
+	}, eventtest.HasEvent)
+	request, err = http.NewRequest("POST", "/users/offboarded@globo.com/enable", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	user, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Disabled, check.Equals, false)
+}
+
+func (s *AuthSuite) TestDisableUserSelf(c *check.C) {
+	request, err := http.NewRequest("POST", "/users/"+s.user.Email+"/disable", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *AuthSuite) TestDisableUserWithoutPermission(c *check.C) {
+	token := userWithPermission(c)
+	request, err := http.NewRequest("POST", "/users/"+s.user.Email+"/disable", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *AuthSuite) TestUnlockUser(c *check.C) {
+	config.Set("auth:max-failed-logins", 1)
+	defer config.Unset("auth:max-failed-logins")
+	u := auth.User{Email: "locked@globo.com", Password: "123456"}
+	_, err := nativeScheme.Create(&u)
+	c.Assert(err, check.IsNil)
+	err = u.RecordFailedLogin()
+	c.Assert(err, check.IsNil)
+	c.Assert(u.IsLocked(), check.Equals, true)
+	request, err := http.NewRequest("POST", "/users/locked@globo.com/unlock", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	user, err := auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(user.IsLocked(), check.Equals, false)
+}
+
+func (s *AuthSuite) TestInactiveUsers(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	lastLogin := time.Now().UTC().AddDate(0, 0, -60).Truncate(time.Millisecond)
+	err = conn.Users().Insert(auth.User{Email: "old@globo.com", LastLogin: lastLogin, Disabled: true})
+	c.Assert(err, check.IsNil)
+	err = conn.Users().Update(bson.M{"email": s.user.Email}, bson.M{"$set": bson.M{"lastlogin": time.Now().UTC()}})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/users/inactive?days=30", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result []inactiveUser
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].Email, check.Equals, "old@globo.com")
+	c.Assert(result[0].Disabled, check.Equals, true)
+	c.Assert(result[0].LastLogin.Equal(lastLogin), check.Equals, true)
+}
+
+func (s *AuthSuite) TestInactiveUsersInvalidDays(c *check.C) {
+	request, err := http.NewRequest("GET", "/users/inactive?days=abc", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
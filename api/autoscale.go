@@ -102,6 +102,51 @@ func autoScaleSetRule(w http.ResponseWriter, r *http.Request, t auth.Token) (err
 	return rule.Update()
 }
 
+// title: autoscale simulate
+// path: /node/autoscale/simulate
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Pool or rule not found
+func autoScaleSimulate(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermNodeAutoscaleRead) {
+		return permission.ErrUnauthorized
+	}
+	err := r.ParseForm()
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var opts struct {
+		Pool string
+		Rule *autoscale.Rule
+	}
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	err = dec.DecodeValues(&opts, r.Form)
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if opts.Pool == "" {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "pool is required"}
+	}
+	sim, err := autoscale.Simulate(opts.Pool, opts.Rule)
+	if err != nil {
+		if err == autoscale.ErrNoNodesInPool || err == autoscale.ErrNoRuleForPool {
+			return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+		}
+		if _, ok := err.(*autoscale.InvalidRuleError); ok {
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(sim)
+}
+
 // title: delete autoscale rule
 // path: /autoscale/rules/{id}
 // method: DELETE
@@ -114,6 +114,85 @@ func (s *S) TestAutoScaleRunHandler(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestAutoScaleSimulateHandler(c *check.C) {
+	provision.Unregister("fake-extensible")
+	defer provision.Register("fake-extensible", func() (provision.Provisioner, error) {
+		return provisiontest.ExtensibleInstance, nil
+	})
+	s.provisioner.AddNode(provision.AddNodeOptions{
+		Address:  "localhost:1999",
+		Metadata: map[string]string{"pool": "pool1"},
+	})
+	config.Set("docker:auto-scale:max-container-count", 2)
+	defer config.Unset("docker:auto-scale:max-container-count")
+	body := strings.NewReader("Pool=pool1")
+	request, err := http.NewRequest("POST", "/node/autoscale/simulate", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var sim autoscale.Simulation
+	err = json.NewDecoder(recorder.Body).Decode(&sim)
+	c.Assert(err, check.IsNil)
+	c.Assert(sim.Pool, check.Equals, "pool1")
+	c.Assert(sim.Scaler, check.Equals, autoscale.ScalerCount)
+	c.Assert(sim.Rule.MaxContainerCount, check.Equals, 2)
+	c.Assert(sim.Nodes, check.HasLen, 1)
+	c.Assert(sim.Result.ToAdd, check.Equals, 0)
+	c.Assert(sim.Result.ToRebalance, check.Equals, true)
+	c.Assert(sim.RebalanceLog, check.Equals, "rebalancing - dry: true, force: false\nfiltering metadata: map[pool:pool1]\n")
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) TestAutoScaleSimulateHandlerInvalidRule(c *check.C) {
+	s.provisioner.AddNode(provision.AddNodeOptions{
+		Address:  "localhost:1999",
+		Metadata: map[string]string{"pool": "pool1"},
+	})
+	body := strings.NewReader("Pool=pool1&Rule.ScaleDownRatio=0.5")
+	request, err := http.NewRequest("POST", "/node/autoscale/simulate", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid rule, scale down ratio needs to be greater than 1.0, got 0.500000\n")
+}
+
+func (s *S) TestAutoScaleSimulateHandlerPoolWithoutNodes(c *check.C) {
+	body := strings.NewReader("Pool=pool1")
+	request, err := http.NewRequest("POST", "/node/autoscale/simulate", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, "no nodes found in pool\n")
+}
+
+func (s *S) TestAutoScaleSimulateHandlerUnauthorized(c *check.C) {
+	token := userWithPermission(c)
+	body := strings.NewReader("Pool=pool1")
+	request, err := http.NewRequest("POST", "/node/autoscale/simulate", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestAutoScaleConfigHandler(c *check.C) {
 	config.Set("docker:auto-scale:enabled", true)
 	defer config.Unset("docker:auto-scale:enabled")
@@ -8,6 +8,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/ajg/form"
 	"github.com/tsuru/tsuru/auth"
@@ -15,9 +17,14 @@ import (
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/iaas"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
 	"gopkg.in/mgo.v2"
 )
 
+// defaultUsageDays is the length of the period reported by the machine usage
+// endpoint when no start is informed.
+const defaultUsageDays = 30
+
 // title: machine list
 // path: /iaas/machines
 // method: GET
@@ -51,6 +58,82 @@ func machinesList(w http.ResponseWriter, r *http.Request, token auth.Token) erro
 	return json.NewEncoder(w).Encode(machines)
 }
 
+// title: machine audit
+// path: /iaas/machines/audit
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+func machinesAudit(w http.ResponseWriter, r *http.Request, token auth.Token) error {
+	iaases, err := permission.ListContextValues(token, permission.PermMachineRead, true)
+	if err != nil {
+		return err
+	}
+	provs, err := provision.Registry()
+	if err != nil {
+		return err
+	}
+	var nodes []iaas.NodeRef
+	for _, prov := range provs {
+		nodeProv, ok := prov.(provision.NodeProvisioner)
+		if !ok {
+			continue
+		}
+		provNodes, err := nodeProv.ListNodes(nil)
+		if err != nil {
+			return err
+		}
+		for _, n := range provNodes {
+			nodes = append(nodes, iaas.NodeRef{Address: n.Address(), IaaSID: n.Metadata()["iaas-id"]})
+		}
+	}
+	audits, err := iaas.AuditMachines(nodes, iaases)
+	if err != nil {
+		return err
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(audits)
+}
+
+// title: machine usage
+// path: /iaas/usage
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid period
+//   401: Unauthorized
+func machinesUsage(w http.ResponseWriter, r *http.Request, token auth.Token) error {
+	iaases, err := permission.ListContextValues(token, permission.PermMachineRead, true)
+	if err != nil {
+		return err
+	}
+	until := time.Now().UTC()
+	if value := r.URL.Query().Get("until"); value != "" {
+		until, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid until: %s", err)}
+		}
+	}
+	since := until.AddDate(0, 0, -defaultUsageDays)
+	if value := r.URL.Query().Get("since"); value != "" {
+		since, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid since: %s", err)}
+		}
+	}
+	if !since.Before(until) {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "since must be before until"}
+	}
+	report, err := iaas.Usage(since, until, iaases)
+	if err != nil {
+		return err
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(report)
+}
+
 // title: machine destroy
 // path: /iaas/machines/{machine_id}
 // method: DELETE
@@ -103,6 +186,13 @@ func templatesList(w http.ResponseWriter, r *http.Request, token auth.Token) err
 	if err != nil {
 		return err
 	}
+	for i := range templates {
+		iaasName, err := templates[i].ResolveIaaSName()
+		if err != nil {
+			return err
+		}
+		templates[i].IaaSName = iaasName
+	}
 	contexts := permission.ContextsForPermission(token, permission.PermMachineTemplateRead)
 	allowedIaaS := map[string]struct{}{}
 	for _, c := range contexts {
@@ -145,13 +235,17 @@ func templateCreate(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 	if err != nil {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	}
-	iaasCtx := permission.Context(permission.CtxIaaS, paramTemplate.IaaSName)
+	iaasName, err := templateIaaSName(&paramTemplate, token, permission.PermMachineTemplateCreate)
+	if err != nil {
+		return err
+	}
+	iaasCtx := permission.Context(permission.CtxIaaS, iaasName)
 	allowed := permission.Check(token, permission.PermMachineTemplateCreate, iaasCtx)
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
 	evt, err := event.New(&event.Opts{
-		Target:     event.Target{Type: event.TargetTypeIaas, Value: paramTemplate.IaaSName},
+		Target:     event.Target{Type: event.TargetTypeIaas, Value: iaasName},
 		Kind:       permission.PermMachineTemplateCreate,
 		Owner:      token,
 		CustomData: event.FormToCustomData(r.Form),
@@ -176,6 +270,59 @@ func templateCreate(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 	return nil
 }
 
+// templateIaaSName returns the IaaS permissions on the template are checked
+// against, inherited from its parent when not informed. Parents are only
+// looked up for tokens with perm in some context.
+func templateIaaSName(tpl *iaas.Template, token auth.Token, perm *permission.PermissionScheme) (string, error) {
+	if tpl.IaaSName != "" || tpl.Parent == "" {
+		return tpl.IaaSName, nil
+	}
+	if len(permission.ContextsForPermission(token, perm)) == 0 {
+		return "", permission.ErrUnauthorized
+	}
+	iaasName, err := tpl.ResolveIaaSName()
+	if err != nil {
+		return "", &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return iaasName, nil
+}
+
+// title: template validate
+// path: /iaas/templates/validate
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Valid template
+//   400: Invalid template
+//   401: Unauthorized
+func templateValidate(w http.ResponseWriter, r *http.Request, token auth.Token) error {
+	err := r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var paramTemplate iaas.Template
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	err = dec.DecodeValues(&paramTemplate, r.Form)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	iaasName, err := templateIaaSName(&paramTemplate, token, permission.PermMachineTemplateCreate)
+	if err != nil {
+		return err
+	}
+	iaasCtx := permission.Context(permission.CtxIaaS, iaasName)
+	allowed := permission.Check(token, permission.PermMachineTemplateCreate, iaasCtx)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	err = paramTemplate.Validate()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return nil
+}
+
 // title: template destroy
 // path: /iaas/templates/{template_name}
 // method: DELETE
@@ -193,13 +340,17 @@ func templateDestroy(w http.ResponseWriter, r *http.Request, token auth.Token) (
 		}
 		return err
 	}
-	iaasCtx := permission.Context(permission.CtxIaaS, t.IaaSName)
+	iaasName, err := templateIaaSName(t, token, permission.PermMachineTemplateDelete)
+	if err != nil {
+		return err
+	}
+	iaasCtx := permission.Context(permission.CtxIaaS, iaasName)
 	allowed := permission.Check(token, permission.PermMachineTemplateDelete, iaasCtx)
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
 	evt, err := event.New(&event.Opts{
-		Target:     event.Target{Type: event.TargetTypeIaas, Value: t.IaaSName},
+		Target:     event.Target{Type: event.TargetTypeIaas, Value: iaasName},
 		Kind:       permission.PermMachineTemplateDelete,
 		Owner:      token,
 		CustomData: event.FormToCustomData(r.Form),
@@ -244,13 +395,17 @@ func templateUpdate(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 	if r.Form.Get("IaaSName") != "" {
 		dbTpl.IaaSName = r.Form.Get("IaaSName")
 	}
-	iaasCtx := permission.Context(permission.CtxIaaS, dbTpl.IaaSName)
+	iaasName, err := templateIaaSName(dbTpl, token, permission.PermMachineTemplateUpdate)
+	if err != nil {
+		return err
+	}
+	iaasCtx := permission.Context(permission.CtxIaaS, iaasName)
 	allowed := permission.Check(token, permission.PermMachineTemplateUpdate, iaasCtx)
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
 	evt, err := event.New(&event.Opts{
-		Target:     event.Target{Type: event.TargetTypeIaas, Value: dbTpl.IaaSName},
+		Target:     event.Target{Type: event.TargetTypeIaas, Value: iaasName},
 		Kind:       permission.PermMachineTemplateUpdate,
 		Owner:      token,
 		CustomData: event.FormToCustomData(r.Form),
@@ -260,5 +415,11 @@ func templateUpdate(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 		return err
 	}
 	defer func() { evt.Done(err) }()
-	return dbTpl.Update(&paramTemplate)
+	// besides the template fields, ClearParent=true removes the template
+	// parent and each RemoveParams value removes a param declaration.
+	clearParent, _ := strconv.ParseBool(r.FormValue("ClearParent"))
+	return dbTpl.UpdateWithOptions(&paramTemplate, iaas.TemplateUpdateOptions{
+		ClearParent:  clearParent,
+		RemoveParams: r.Form["RemoveParams"],
+	})
 }
@@ -8,14 +8,19 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ajg/form"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
 	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2"
 )
 
 type TestIaaS struct{}
@@ -246,6 +251,132 @@ func (s *S) TestTemplateCreateBadRequest(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
 }
 
+func (s *S) TestTemplateCreateWithParent(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	base := iaas.Template{
+		Name:     "base",
+		IaaSName: "my-iaas",
+		Data:     iaas.TemplateDataList{{Name: "type", Value: "small"}},
+	}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("base")
+	data := iaas.Template{
+		Name:   "large",
+		Parent: "base",
+		Data:   iaas.TemplateDataList{{Name: "type", Value: "large"}},
+		Params: iaas.TemplateParamList{{Name: "pool", Required: true}},
+	}
+	defer iaas.DestroyTemplate("large")
+	v, err := form.EncodeToValues(&data)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	tpl, err := iaas.FindTemplate("large")
+	c.Assert(err, check.IsNil)
+	c.Assert(tpl.IaaSName, check.Equals, "")
+	c.Assert(tpl.Parent, check.Equals, "base")
+	c.Assert(tpl.Params, check.DeepEquals, iaas.TemplateParamList{{Name: "pool", Required: true}})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeIaas, Value: "my-iaas"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "machine.template.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "Name", "value": "large"},
+			{"name": "Parent", "value": "base"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestTemplateListResolvesInheritedIaaS(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	base := iaas.Template{Name: "base", IaaSName: "my-iaas"}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("base")
+	child := iaas.Template{Name: "child", Parent: "base"}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("child")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/iaas/templates", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var templates []iaas.Template
+	err = json.Unmarshal(recorder.Body.Bytes(), &templates)
+	c.Assert(err, check.IsNil)
+	c.Assert(templates, check.HasLen, 2)
+	c.Assert(templates[1].Name, check.Equals, "child")
+	c.Assert(templates[1].IaaSName, check.Equals, "my-iaas")
+}
+
+func (s *S) TestTemplateValidate(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	data := iaas.Template{
+		Name:     "my-tpl",
+		IaaSName: "my-iaas",
+		Data:     iaas.TemplateDataList{{Name: "count", Value: "1"}},
+		Params:   iaas.TemplateParamList{{Name: "count", Type: iaas.TemplateParamInt}},
+	}
+	v, err := form.EncodeToValues(&data)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates/validate", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = iaas.FindTemplate("my-tpl")
+	c.Assert(err, check.Equals, mgo.ErrNotFound)
+}
+
+func (s *S) TestTemplateValidateInvalid(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	data := iaas.Template{
+		Name:     "my-tpl",
+		IaaSName: "my-iaas",
+		Data:     iaas.TemplateDataList{{Name: "count", Value: "many"}},
+		Params:   iaas.TemplateParamList{{Name: "count", Type: iaas.TemplateParamInt}},
+	}
+	v, err := form.EncodeToValues(&data)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates/validate", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "param \"count\" must be of type int, got \"many\"\n")
+}
+
+func (s *S) TestTemplateValidateParentNotFound(c *check.C) {
+	data := iaas.Template{Name: "my-tpl", Parent: "unknown"}
+	v, err := form.EncodeToValues(&data)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates/validate", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "parent template \"unknown\" of \"my-tpl\" not found\n")
+}
+
 func (s *S) TestTemplateDestroy(c *check.C) {
 	iaas.RegisterIaasProvider("ec2", newTestIaaS)
 	tpl1 := iaas.Template{
@@ -358,6 +489,53 @@ func (s *S) TestTemplateUpdateNotFound(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Equals, "template not found\n")
 }
 
+func (s *S) TestTemplateUpdateClearParentAndRemoveParams(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	base := iaas.Template{Name: "base", IaaSName: "my-iaas"}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("base")
+	tpl := iaas.Template{
+		Name:   "my-tpl",
+		Parent: "base",
+		Params: iaas.TemplateParamList{{Name: "pool", Required: true}, {Name: "zone"}},
+	}
+	err = tpl.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("my-tpl")
+	v := url.Values{}
+	v.Set("ClearParent", "true")
+	v.Add("RemoveParams", "pool")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("PUT", "/iaas/templates/my-tpl", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbTpl, err := iaas.FindTemplate("my-tpl")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbTpl.Parent, check.Equals, "")
+	c.Assert(dbTpl.IaaSName, check.Equals, "my-iaas")
+	c.Assert(dbTpl.Params, check.DeepEquals, iaas.TemplateParamList{{Name: "zone"}})
+}
+
+func (s *S) TestTemplateCreateWithParentChecksPermissionFirst(c *check.C) {
+	data := iaas.Template{Name: "large", Parent: "unknown"}
+	v, err := form.EncodeToValues(&data)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+}
+
 func (s *S) TestTemplateUpdateBadRequest(c *check.C) {
 	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
 	recorder := httptest.NewRecorder()
@@ -448,3 +626,135 @@ func (s *S) TestTemplateUpdateNotRegistered(c *check.C) {
 	m.ServeHTTP(recorder, request)
 	c.Assert(recorder.Body.String(), check.Equals, "IaaS provider \"not-registered\" based on \"not-registered\" not registered\n")
 }
+
+func (s *S) TestMachinesAudit(c *check.C) {
+	iaas.RegisterIaasProvider("test-iaas", newTestIaaS)
+	_, err := iaas.CreateMachineForIaaS("test-iaas", map[string]string{"id": "myid1"})
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	c.Assert(err, check.IsNil)
+	_, err = iaas.CreateMachineForIaaS("test-iaas", map[string]string{"id": "myid2"})
+	defer (&iaas.Machine{Id: "myid2"}).Destroy()
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddNode(provision.AddNodeOptions{Address: "http://myid1.somewhere.com:2375"})
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/iaas/machines/audit", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var audits []iaas.MachineAudit
+	err = json.NewDecoder(recorder.Body).Decode(&audits)
+	c.Assert(err, check.IsNil)
+	var audit *iaas.MachineAudit
+	for i := range audits {
+		if audits[i].IaaS == "test-iaas" {
+			audit = &audits[i]
+		}
+	}
+	c.Assert(audit, check.NotNil)
+	c.Assert(audit.Listable, check.Equals, false)
+	c.Assert(audit.Unregistered, check.HasLen, 1)
+	c.Assert(audit.Unregistered[0].Id, check.Equals, "myid2")
+}
+
+func (s *S) TestMachinesAuditFiltersByPermission(c *check.C) {
+	iaas.RegisterIaasProvider("test-iaas", newTestIaaS)
+	_, err := iaas.CreateMachineForIaaS("test-iaas", map[string]string{"id": "myid1"})
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermMachineRead,
+		Context: permission.Context(permission.CtxIaaS, "other-iaas"),
+	})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/iaas/machines/audit", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var audits []iaas.MachineAudit
+	err = json.NewDecoder(recorder.Body).Decode(&audits)
+	c.Assert(err, check.IsNil)
+	c.Assert(audits, check.HasLen, 0)
+}
+
+func (s *S) TestMachinesAuditUnauthorized(c *check.C) {
+	token := userWithPermission(c)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/iaas/machines/audit", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestMachinesUsage(c *check.C) {
+	iaas.RegisterIaasProvider("test-iaas", newTestIaaS)
+	_, err := iaas.CreateMachineForIaaS("test-iaas", map[string]string{"id": "myid1", "pool": "pool1"})
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/iaas/usage", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var report iaas.UsageReport
+	err = json.NewDecoder(recorder.Body).Decode(&report)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Until.Sub(report.Since), check.Equals, 30*24*time.Hour)
+	var pool *iaas.UsageSummary
+	for i := range report.Pools {
+		if report.Pools[i].Name == "pool1" {
+			pool = &report.Pools[i]
+		}
+	}
+	c.Assert(pool, check.NotNil)
+	c.Assert(pool.Machines, check.Equals, 1)
+}
+
+func (s *S) TestMachinesUsageFiltersByPermission(c *check.C) {
+	iaas.RegisterIaasProvider("test-iaas", newTestIaaS)
+	_, err := iaas.CreateMachineForIaaS("test-iaas", map[string]string{"id": "myid1", "pool": "pool1"})
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermMachineRead,
+		Context: permission.Context(permission.CtxIaaS, "other-iaas"),
+	})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/iaas/usage", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var report iaas.UsageReport
+	err = json.NewDecoder(recorder.Body).Decode(&report)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Pools, check.HasLen, 0)
+}
+
+func (s *S) TestMachinesUsageInvalidPeriod(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/iaas/usage?since=2017-05-02T00:00:00Z&until=2017-05-01T00:00:00Z", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "since must be before until\n")
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("GET", "/iaas/usage?since=yesterday", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"regexp"
 	"time"
 
 	"github.com/codegangsta/negroni"
@@ -31,6 +32,10 @@ const (
 	tsuruAdminMin = "1.0.0"
 )
 
+// twoFactorEnrollmentPath matches the routes available to tokens issued to
+// users who still have to enroll in a required two-factor authentication.
+var twoFactorEnrollmentPath = regexp.MustCompile(`^(/[0-9.]+)?/users/(2fa(/.*)?|tokens)$`)
+
 func validate(token string, r *http.Request) (auth.Token, error) {
 	t, err := app.AuthScheme.Auth(token)
 	if err != nil {
@@ -39,6 +44,14 @@ func validate(token string, r *http.Request) (auth.Token, error) {
 			return nil, err
 		}
 	}
+	if pending, ok := t.(auth.TwoFactorPendingToken); ok && pending.IsTwoFactorPending() {
+		if !twoFactorEnrollmentPath.MatchString(r.URL.Path) {
+			return nil, &tsuruErrors.HTTP{
+				Code:    http.StatusForbidden,
+				Message: "two-factor authentication enrollment is required before using this token",
+			}
+		}
+	}
 	if t.IsAppToken() {
 		if q := r.URL.Query().Get(":app"); q != "" && t.GetAppName() != q {
 			return nil, &tsuruErrors.HTTP{
@@ -47,6 +60,9 @@ func validate(token string, r *http.Request) (auth.Token, error) {
 			}
 		}
 	} else {
+		if err = auth.CheckUserEnabled(t.GetUserName()); err == auth.ErrUserDisabled {
+			return nil, &tsuruErrors.HTTP{Code: http.StatusUnauthorized, Message: err.Error()}
+		}
 		if q := r.URL.Query().Get(":app"); q != "" {
 			_, err = getAppFromContext(q, r)
 			if err != nil {
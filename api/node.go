@@ -15,6 +15,7 @@ import (
 
 	"github.com/ajg/form"
 	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/api/shutdown"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
@@ -22,10 +23,12 @@ import (
 	"github.com/tsuru/tsuru/healer"
 	"github.com/tsuru/tsuru/iaas"
 	tsuruIo "github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func validateNodeAddress(address string) error {
@@ -45,7 +48,7 @@ func validateNodeAddress(address string) error {
 	return nil
 }
 
-func addNodeForParams(p provision.NodeProvisioner, params provision.AddNodeOptions) (string, map[string]string, error) {
+func addNodeForParams(p provision.NodeProvisioner, params provision.AddNodeOptions, evt *event.Event) (string, map[string]string, error) {
 	response := make(map[string]string)
 	var address string
 	if params.Register {
@@ -54,10 +57,20 @@ func addNodeForParams(p provision.NodeProvisioner, params provision.AddNodeOptio
 	} else {
 		desc, _ := iaas.Describe(params.Metadata["iaas"])
 		response["description"] = desc
-		m, err := iaas.CreateMachine(params.Metadata)
+		m, err := iaas.CreateMachineWithOptions(iaas.CreateMachineOptions{
+			Params:     params.Metadata,
+			Writer:     evt,
+			RequestID:  evt.UniqueID.Hex(),
+			KeepLocked: true,
+		})
 		if err != nil {
 			return address, response, err
 		}
+		defer func() {
+			if unlockErr := m.Unlock(); unlockErr != nil {
+				log.Errorf("unable to unlock machine %s: %s", m.Id, unlockErr)
+			}
+		}()
 		address = m.FormatNodeAddress()
 		params.CaCert = m.CaCert
 		params.ClientCert = m.ClientCert
@@ -86,6 +99,7 @@ func addNodeForParams(p provision.NodeProvisioner, params provision.AddNodeOptio
 // produce: application/x-json-stream
 // responses:
 //   201: Ok
+//   202: Node creation started
 //   401: Unauthorized
 //   404: Not found
 func addNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
@@ -105,6 +119,7 @@ func addNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 		if err != nil {
 			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 		}
+		params.Metadata[iaas.TemplateMetadataName] = templateName
 	}
 	poolName := params.Metadata["pool"]
 	if poolName == "" {
@@ -120,6 +135,8 @@ func addNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 			return permission.ErrUnauthorized
 		}
 	}
+	async, _ := strconv.ParseBool(r.FormValue("async"))
+	async = async && !params.Register
 	evt, err := event.New(&event.Opts{
 		Target:      event.Target{Type: event.TargetTypeNode},
 		Kind:        permission.PermNodeCreate,
@@ -131,7 +148,11 @@ func addNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 	if err != nil {
 		return err
 	}
-	defer func() { evt.Done(err) }()
+	defer func() {
+		if !async || err != nil {
+			evt.Done(err)
+		}
+	}()
 	pool, err := provision.GetPoolByName(poolName)
 	if err != nil {
 		return err
@@ -144,11 +165,88 @@ func addNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 	if !ok {
 		return provision.ProvisionerNotSupported{Prov: prov, Action: "node operations"}
 	}
+	if async {
+		go func() {
+			evt.Done(addNodeWithEvent(evt, nodeProv, params))
+		}()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		// the event is now owned by the goroutine above, encoding errors
+		// must not mark it as done.
+		json.NewEncoder(w).Encode(map[string]string{"eventID": evt.UniqueID.Hex()})
+		return nil
+	}
 	w.Header().Set("Content-Type", "application/x-json-stream")
 	w.WriteHeader(http.StatusCreated)
 	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 15*time.Second, "")
 	defer keepAliveWriter.Stop()
-	addr, response, err := addNodeForParams(nodeProv, params)
+	return addNodeWithEvent(evt, nodeProv, params)
+}
+
+var interruptedNodeCreationsInterval = time.Minute
+
+// interruptedNodeCreationsChecker periodically fails the node creations
+// interrupted by a restart of the process running them.
+type interruptedNodeCreationsChecker struct {
+	done chan bool
+}
+
+func initializeInterruptedNodeCreationsChecker() {
+	checker := &interruptedNodeCreationsChecker{done: make(chan bool)}
+	shutdown.Register(checker)
+	go checker.run()
+}
+
+func (c *interruptedNodeCreationsChecker) run() {
+	for {
+		err := failInterruptedNodeCreations()
+		if err != nil {
+			log.Errorf("[interrupted node creations] %s", err)
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(interruptedNodeCreationsInterval):
+		}
+	}
+}
+
+func (c *interruptedNodeCreationsChecker) Shutdown() {
+	c.done <- true
+}
+
+func (c *interruptedNodeCreationsChecker) String() string {
+	return "interrupted node creations checker"
+}
+
+// failInterruptedNodeCreations finishes the events of the node creations
+// interrupted by a restart, either while creating the machine or while
+// adding it as a node.
+func failInterruptedNodeCreations() error {
+	machines, err := iaas.FailInterruptedCreations()
+	if err != nil {
+		return err
+	}
+	for _, m := range machines {
+		if !bson.IsObjectIdHex(m.RequestID) {
+			continue
+		}
+		evt, err := event.GetByID(bson.ObjectIdHex(m.RequestID))
+		if err == event.ErrEventNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if evt.Running {
+			evt.Done(errors.Errorf("machine %s: %s", m.Id, m.Error))
+		}
+	}
+	return nil
+}
+
+func addNodeWithEvent(evt *event.Event, nodeProv provision.NodeProvisioner, params provision.AddNodeOptions) error {
+	addr, response, err := addNodeForParams(nodeProv, params, evt)
 	evt.Target.Value = addr
 	if err != nil {
 		if desc := response["description"]; desc != "" {
@@ -510,6 +608,7 @@ func nodeHealingRead(w http.ResponseWriter, r *http.Request, t auth.Token) error
 // consume: application/x-www-form-urlencoded
 // responses:
 //   200: Ok
+//   400: Invalid data
 //   401: Unauthorized
 func nodeHealingUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	err = r.ParseForm()
@@ -544,7 +643,11 @@ func nodeHealingUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (er
 	if err != nil {
 		return err
 	}
-	return healer.UpdateConfig(poolName, config)
+	err = healer.UpdateConfig(poolName, config)
+	if _, ok := err.(*healer.InvalidRemediationActionError); ok {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
 }
 
 // title: remove node healing
@@ -13,6 +13,7 @@ import (
 	"net/http/httptest"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ajg/form"
 	"github.com/tsuru/tsuru/app"
@@ -25,6 +26,7 @@ import (
 	"github.com/tsuru/tsuru/provision"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func (s *S) TestValidateNodeAddress(c *check.C) {
@@ -163,6 +165,121 @@ func (s *S) TestAddNodeHandlerCreatingAnIaasMachine(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestAddNodeHandlerCreatingAnIaasMachineAsync(c *check.C) {
+	iaas.RegisterIaasProvider("test-iaas", newTestIaaS)
+	opts := provision.AddPoolOptions{Name: "pool1"}
+	err := provision.AddPool(opts)
+	c.Assert(err, check.IsNil)
+	defer provision.RemovePool("pool1")
+	params := provision.AddNodeOptions{
+		Register: false,
+		Metadata: map[string]string{
+			"id":   "test1",
+			"pool": "pool1",
+			"iaas": "test-iaas",
+		},
+	}
+	v, err := form.EncodeToValues(&params)
+	c.Assert(err, check.IsNil)
+	v.Set("async", "true")
+	b := strings.NewReader(v.Encode())
+	req, err := http.NewRequest("POST", "/node", b)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", s.token.GetValue())
+	rec := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusAccepted)
+	c.Assert(rec.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result map[string]string
+	err = json.Unmarshal(rec.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(bson.IsObjectIdHex(result["eventID"]), check.Equals, true)
+	timeout := time.After(5 * time.Second)
+	for {
+		evt, err := event.GetByID(bson.ObjectIdHex(result["eventID"]))
+		c.Assert(err, check.IsNil)
+		if !evt.Running {
+			c.Assert(evt.Error, check.Equals, "")
+			c.Assert(evt.Target, check.DeepEquals, event.Target{Type: event.TargetTypeNode, Value: "http://test1.somewhere.com:2375"})
+			c.Assert(evt.Log, check.Matches, "(?s).*machine test1 in iaas test-iaas: creating -> running.*")
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for node creation")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	nodes, err := s.provisioner.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	c.Assert(nodes[0].Address(), check.Equals, "http://test1.somewhere.com:2375")
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+	c.Assert(machines[0].RequestID, check.Equals, result["eventID"])
+}
+
+func (s *S) TestFailInterruptedNodeCreations(c *check.C) {
+	evt, err := event.New(&event.Opts{
+		Target:      event.Target{Type: event.TargetTypeNode},
+		Kind:        permission.PermNodeCreate,
+		Owner:       s.token,
+		DisableLock: true,
+		Allowed:     event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = s.conn.Collection("iaas_machines").Insert(iaas.Machine{
+		Id:             "pending-1",
+		Address:        "pending-1",
+		Iaas:           "test-iaas",
+		State:          iaas.MachineStateCreating,
+		RequestID:      evt.UniqueID.Hex(),
+		LockUpdateTime: time.Now().UTC().Add(-time.Hour),
+	})
+	c.Assert(err, check.IsNil)
+	err = failInterruptedNodeCreations()
+	c.Assert(err, check.IsNil)
+	evt, err = event.GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Running, check.Equals, false)
+	c.Assert(evt.Error, check.Matches, "machine pending-1: creation interrupted, no update since .*")
+	m, err := iaas.FindMachineById("pending-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(m.State, check.Equals, iaas.MachineStateFailed)
+}
+
+func (s *S) TestFailInterruptedNodeCreationsAfterMachineCreated(c *check.C) {
+	evt, err := event.New(&event.Opts{
+		Target:      event.Target{Type: event.TargetTypeNode},
+		Kind:        permission.PermNodeCreate,
+		Owner:       s.token,
+		DisableLock: true,
+		Allowed:     event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = s.conn.Collection("iaas_machines").Insert(iaas.Machine{
+		Id:             "m1",
+		Address:        "m1",
+		Iaas:           "test-iaas",
+		State:          iaas.MachineStateRunning,
+		RequestID:      evt.UniqueID.Hex(),
+		LockUpdateTime: time.Now().UTC().Add(-time.Hour),
+	})
+	c.Assert(err, check.IsNil)
+	err = failInterruptedNodeCreations()
+	c.Assert(err, check.IsNil)
+	evt, err = event.GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Running, check.Equals, false)
+	c.Assert(evt.Error, check.Matches, "machine m1: interrupted after creation, no update since .*")
+	m, err := iaas.FindMachineById("m1")
+	c.Assert(err, check.IsNil)
+	c.Assert(m.State, check.Equals, iaas.MachineStateRunning)
+}
+
 func (s *S) TestAddNodeHandlerWithoutAddress(c *check.C) {
 	opts := provision.AddPoolOptions{Name: "pool1"}
 	err := provision.AddPool(opts)
@@ -814,27 +931,27 @@ func (s *S) TestNodeHealingUpdateRead(c *check.C) {
 		}},
 		{"pool=p1&Enabled=false", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true},
+			"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true, RemediationActionsInherited: true},
 		}},
 		{"pool=p1&Enabled=true", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true},
+			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true, RemediationActionsInherited: true},
 		}},
 		{"pool=p1", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true},
+			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true, RemediationActionsInherited: true},
 		}},
 		{"pool=p1&MaxUnresponsiveTime=30", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(30), MaxUnresponsiveTimeInherited: false},
+			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(30), MaxUnresponsiveTimeInherited: false, RemediationActionsInherited: true},
 		}},
 		{"pool=p1&MaxUnresponsiveTime=0", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(0), MaxUnresponsiveTimeInherited: false},
+			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(0), MaxUnresponsiveTimeInherited: false, RemediationActionsInherited: true},
 		}},
 		{"pool=p1&Enabled=false", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(0), MaxUnresponsiveTimeInherited: false},
+			"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(0), MaxUnresponsiveTimeInherited: false, RemediationActionsInherited: true},
 		}},
 	}
 	for i, t := range tests {
@@ -868,7 +985,7 @@ func (s *S) TestNodeHealingUpdateRead(c *check.C) {
 	configMap := doRequest("")
 	c.Assert(configMap, check.DeepEquals, map[string]healer.NodeHealerConfig{
 		"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-		"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true},
+		"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true, RemediationActionsInherited: true},
 	})
 	request, err = http.NewRequest("DELETE", "/docker/healing/node", nil)
 	c.Assert(err, check.IsNil)
@@ -879,7 +996,7 @@ func (s *S) TestNodeHealingUpdateRead(c *check.C) {
 	configMap = doRequest("")
 	c.Assert(configMap, check.DeepEquals, map[string]healer.NodeHealerConfig{
 		"":   {},
-		"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTimeInherited: true},
+		"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTimeInherited: true, RemediationActionsInherited: true},
 	})
 	request, err = http.NewRequest("DELETE", "/docker/healing/node?pool=p1&name=Enabled", nil)
 	c.Assert(err, check.IsNil)
@@ -890,10 +1007,38 @@ func (s *S) TestNodeHealingUpdateRead(c *check.C) {
 	configMap = doRequest("")
 	c.Assert(configMap, check.DeepEquals, map[string]healer.NodeHealerConfig{
 		"":   {},
-		"p1": {EnabledInherited: true, MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTimeInherited: true},
+		"p1": {EnabledInherited: true, MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTimeInherited: true, RemediationActionsInherited: true},
 	})
 }
 
+func (s *S) TestNodeHealingUpdateRemediationActions(c *check.C) {
+	body := bytes.NewBufferString("pool=p1&RemediationActions.0=restart-node-containers&RemediationActions.1=reboot&RemediationActions.2=replace")
+	request, err := http.NewRequest("POST", "/docker/healing/node", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	config, err := healer.GetConfig()
+	c.Assert(err, check.IsNil)
+	c.Assert(config["p1"].RemediationActions, check.DeepEquals, []string{"restart-node-containers", "reboot", "replace"})
+}
+
+func (s *S) TestNodeHealingUpdateInvalidRemediationAction(c *check.C) {
+	body := bytes.NewBufferString("pool=p1&RemediationActions.0=restart-node-containers&RemediationActions.1=pray")
+	request, err := http.NewRequest("POST", "/docker/healing/node", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, `invalid remediation action "pray", valid actions are "restart-node-containers", "reboot" and "replace"`+"\n")
+}
+
 func (s *S) TestNodeHealingConfigUpdateReadLimited(c *check.C) {
 	doRequest := func(t auth.Token, code int, str string) map[string]healer.NodeHealerConfig {
 		body := bytes.NewBufferString(str)
@@ -937,7 +1082,7 @@ func (s *S) TestNodeHealingConfigUpdateReadLimited(c *check.C) {
 	data = doRequest(t, http.StatusOK, "pool=p2&Enabled=true&MaxTimeSinceSuccess=20")
 	c.Assert(data, check.DeepEquals, map[string]healer.NodeHealerConfig{
 		"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60)},
-		"p2": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(20), MaxUnresponsiveTimeInherited: true},
+		"p2": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(20), MaxUnresponsiveTimeInherited: true, RemediationActionsInherited: true},
 	})
 }
 
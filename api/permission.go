@@ -638,3 +638,91 @@ func listDefaultRoles(w http.ResponseWriter, r *http.Request, t auth.Token) erro
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(roles)
 }
+
+// permissionAuditQuery reads the permission and the context from the query
+// string. Apps are expanded to the contexts used when checking permissions
+// for them, which include their teams and pool.
+func permissionAuditQuery(r *http.Request) (*permission.PermissionScheme, []permission.PermissionContext, error) {
+	permName := r.URL.Query().Get("permission")
+	if permName == "" {
+		return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "permission is required"}
+	}
+	scheme, err := permission.SafeGet(permName)
+	if err != nil {
+		return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	ctxType := r.URL.Query().Get("context")
+	ctxValue := r.URL.Query().Get("value")
+	if ctxType == "" {
+		ctxType = string(permission.CtxGlobal)
+	}
+	ctx, err := permission.ParseContext(ctxType, ctxValue)
+	if err != nil {
+		return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if ctx.CtxType == permission.CtxApp {
+		a, err := app.GetByName(ctxValue)
+		if err != nil {
+			return nil, nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+		}
+		return scheme, contextsForApp(a), nil
+	}
+	return scheme, []permission.PermissionContext{ctx}, nil
+}
+
+// title: permission holders
+// path: /permissions/holders
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func permissionHolders(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermRoleReadAudit) {
+		return permission.ErrUnauthorized
+	}
+	scheme, contexts, err := permissionAuditQuery(r)
+	if err != nil {
+		return err
+	}
+	holders, err := auth.ListPermissionHolders(scheme, contexts...)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(holders)
+}
+
+// title: explain permission
+// path: /permissions/explain
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: User or app not found
+func explainPermission(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	email := r.URL.Query().Get("user")
+	if email == "" {
+		email = t.GetUserName()
+	} else if email != t.GetUserName() && !permission.Check(t, permission.PermRoleReadAudit) {
+		return permission.ErrUnauthorized
+	}
+	scheme, contexts, err := permissionAuditQuery(r)
+	if err != nil {
+		return err
+	}
+	u, err := auth.GetUserByEmail(email)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	explanation, err := u.ExplainPermission(scheme, contexts...)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(explanation)
+}
@@ -861,3 +861,99 @@ func (s *S) BenchmarkAddPermissionToRoleWithoutDeploy(c *check.C) {
 	sort.Strings(users)
 	c.Assert(users, check.DeepEquals, []string{s.user.Email})
 }
+
+func (s *S) TestPermissionHolders(c *check.C) {
+	a := app.App{Name: "myapp", Teams: []string{s.team.Name}, Pool: "test1"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	customUserWithPermission(c, "deployer", permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	customUserWithPermission(c, "otherdeployer", permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/holders?permission=app.deploy&context=app&value=myapp", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get("Content-Type"), check.Equals, "application/json")
+	var holders []auth.PermissionHolder
+	err = json.Unmarshal(rec.Body.Bytes(), &holders)
+	c.Assert(err, check.IsNil)
+	c.Assert(holders, check.DeepEquals, []auth.PermissionHolder{
+		{
+			Email: "deployer@groundcontrol.com",
+			Grants: []auth.PermissionGrant{
+				{Role: "deployerapp.deploytsuruteam", Permission: "app.deploy", ContextType: "team", ContextValue: s.team.Name},
+			},
+		},
+		{
+			Email: s.user.Email,
+			Grants: []auth.PermissionGrant{
+				{Role: "super-root-toremove", Permission: "*", ContextType: "global", ContextValue: ""},
+			},
+		},
+	})
+}
+
+func (s *S) TestPermissionHoldersRequiresPermission(c *check.C) {
+	token := userWithPermission(c)
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/holders?permission=app.deploy", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestPermissionHoldersInvalidPermission(c *check.C) {
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/holders?permission=app.fly", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestExplainPermission(c *check.C) {
+	token := customUserWithPermission(c, "otherdeployer", permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/explain?permission=app.deploy&context=team&value=tsuruteam", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	var explanation auth.PermissionExplanation
+	err = json.Unmarshal(rec.Body.Bytes(), &explanation)
+	c.Assert(err, check.IsNil)
+	c.Assert(explanation, check.DeepEquals, auth.PermissionExplanation{
+		Email:   "otherdeployer@groundcontrol.com",
+		Allowed: false,
+		Grants:  []auth.PermissionGrant{},
+		Mismatches: []auth.PermissionGrant{
+			{Role: "otherdeployerapp.deployotherteam", Permission: "app.deploy", ContextType: "team", ContextValue: "otherteam"},
+		},
+	})
+}
+
+func (s *S) TestExplainPermissionOtherUserRequiresPermission(c *check.C) {
+	token := userWithPermission(c)
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/explain?permission=app.deploy&user="+s.user.Email, nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusForbidden)
+}
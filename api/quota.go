@@ -14,6 +14,7 @@ import (
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/quota"
 )
 
 // title: user quota
@@ -151,3 +152,70 @@ func changeAppQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 	}
 	return app.ChangeQuota(&a, limit)
 }
+
+// title: team quota
+// path: /teams/{name}/quota
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Team not found
+func getTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	team, err := getTeamForHandler(r.URL.Query().Get(":name"), t, permission.PermTeamRead)
+	if err != nil {
+		return err
+	}
+	q := team.Quota
+	if q == nil {
+		q = &auth.TeamQuota{Apps: quota.Unlimited, Units: quota.Unlimited}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(q)
+}
+
+// title: update team quota
+// path: /teams/{name}/quota
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Quota updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Team not found
+func changeTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	team, err := getTeamForHandler(name, t, permission.PermTeamUpdateQuota)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamUpdateQuota,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, name)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	appsLimit, unitsLimit := -1, -1
+	if team.Quota != nil {
+		appsLimit, unitsLimit = team.Quota.Apps.Limit, team.Quota.Units.Limit
+	}
+	if v := r.FormValue("apps"); v != "" {
+		appsLimit, err = strconv.Atoi(v)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid apps limit"}
+		}
+	}
+	if v := r.FormValue("units"); v != "" {
+		unitsLimit, err = strconv.Atoi(v)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid units limit"}
+		}
+	}
+	return handleAuthError(auth.ChangeTeamQuota(team, appsLimit, unitsLimit))
+}
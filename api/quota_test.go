@@ -394,3 +394,108 @@ func (s *QuotaSuite) TestChangeAppQuotaAppNotFound(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
 	c.Assert(recorder.Body.String(), check.Equals, app.ErrAppNotFound.Error()+"\n")
 }
+
+func (s *QuotaSuite) TestGetTeamQuota(c *check.C) {
+	token := customUserWithPermission(c, "teamreader", permission.Permission{
+		Scheme:  permission.PermTeamRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	err := auth.ChangeTeamQuota(s.team, 5, 20)
+	c.Assert(err, check.IsNil)
+	request, _ := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var q auth.TeamQuota
+	err = json.NewDecoder(recorder.Body).Decode(&q)
+	c.Assert(err, check.IsNil)
+	c.Assert(q, check.DeepEquals, auth.TeamQuota{Apps: quota.Quota{Limit: 5}, Units: quota.Quota{Limit: 20}})
+}
+
+func (s *QuotaSuite) TestGetTeamQuotaUnlimited(c *check.C) {
+	token := customUserWithPermission(c, "teamreader", permission.Permission{
+		Scheme:  permission.PermTeamRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, _ := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var q auth.TeamQuota
+	err := json.NewDecoder(recorder.Body).Decode(&q)
+	c.Assert(err, check.IsNil)
+	c.Assert(q, check.DeepEquals, auth.TeamQuota{Apps: quota.Unlimited, Units: quota.Unlimited})
+}
+
+func (s *QuotaSuite) TestChangeTeamQuota(c *check.C) {
+	token := customUserWithPermission(c, "teamquota", permission.Permission{
+		Scheme:  permission.PermTeamUpdateQuota,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(app.App{Name: "shangrila", TeamOwner: s.team.Name, Quota: quota.Quota{Limit: -1, InUse: 3}})
+	c.Assert(err, check.IsNil)
+	body := bytes.NewBufferString("apps=2&units=10")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(*team.Quota, check.DeepEquals, auth.TeamQuota{
+		Apps:  quota.Quota{Limit: 2, InUse: 1},
+		Units: quota.Quota{Limit: 10, InUse: 3},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: teamTarget(s.team.Name),
+		Owner:  token.GetUserName(),
+		Kind:   "team.update.quota",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": s.team.Name},
+			{"name": "apps", "value": "2"},
+			{"name": "units", "value": "10"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaLesserThanUsage(c *check.C) {
+	token := customUserWithPermission(c, "teamquota", permission.Permission{
+		Scheme:  permission.PermTeamUpdateQuota,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(app.App{Name: "shangrila", TeamOwner: s.team.Name, Quota: quota.Quota{Limit: -1, InUse: 3}})
+	c.Assert(err, check.IsNil)
+	body := bytes.NewBufferString("units=2")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "new units limit is lesser than the current allocated value\n")
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaRequiresPermission(c *check.C) {
+	body := bytes.NewBufferString("apps=2")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
@@ -20,9 +20,11 @@ import (
 	apiRouter "github.com/tsuru/tsuru/api/router"
 	"github.com/tsuru/tsuru/api/shutdown"
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/bind"
 	"github.com/tsuru/tsuru/auth"
 	_ "github.com/tsuru/tsuru/auth/native"
 	_ "github.com/tsuru/tsuru/auth/oauth"
+	_ "github.com/tsuru/tsuru/auth/oidc"
 	_ "github.com/tsuru/tsuru/auth/saml"
 	"github.com/tsuru/tsuru/autoscale"
 	"github.com/tsuru/tsuru/db"
@@ -33,6 +35,7 @@ import (
 	"github.com/tsuru/tsuru/provision/nodecontainer"
 	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/rebuild"
+	"github.com/tsuru/tsuru/service"
 	"golang.org/x/net/websocket"
 	"gopkg.in/tylerb/graceful.v1"
 )
@@ -104,7 +107,12 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Put", "/services/{service}/instances/{instance}", AuthorizationRequiredHandler(updateServiceInstance))
 	m.Add("1.0", "Put", "/services/{service}/instances/{instance}/{app}", AuthorizationRequiredHandler(bindServiceInstance))
 	m.Add("1.0", "Delete", "/services/{service}/instances/{instance}/{app}", AuthorizationRequiredHandler(unbindServiceInstance))
+	m.Add("1.4", "Post", "/services/{service}/instances/{instance}/{app}/rotate", AuthorizationRequiredHandler(rotateServiceInstanceCredentials))
 	m.Add("1.0", "Get", "/services/{service}/instances/{instance}/status", AuthorizationRequiredHandler(serviceInstanceStatus))
+	m.Add("1.4", "Get", "/services/{service}/instances/{instance}/bindings", AuthorizationRequiredHandler(serviceInstanceBindings))
+	m.Add("1.4", "Get", "/services/{service}/instances/{instance}/backups", AuthorizationRequiredHandler(serviceInstanceBackups))
+	m.Add("1.4", "Post", "/services/{service}/instances/{instance}/backups", AuthorizationRequiredHandler(createServiceInstanceBackup))
+	m.Add("1.4", "Post", "/services/{service}/instances/{instance}/backups/{backup}/restore", AuthorizationRequiredHandler(restoreServiceInstanceBackup))
 	m.Add("1.0", "Put", "/services/{service}/instances/permission/{instance}/{team}", AuthorizationRequiredHandler(serviceInstanceGrantTeam))
 	m.Add("1.0", "Delete", "/services/{service}/instances/permission/{instance}/{team}", AuthorizationRequiredHandler(serviceInstanceRevokeTeam))
 
@@ -117,8 +125,10 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/services/{name}", AuthorizationRequiredHandler(serviceDelete))
 	m.Add("1.0", "Get", "/services/{name}", AuthorizationRequiredHandler(serviceInfo))
 	m.Add("1.0", "Get", "/services/{name}/plans", AuthorizationRequiredHandler(servicePlans))
+	m.Add("1.4", "Get", "/services/{name}/parameters", AuthorizationRequiredHandler(serviceParameters))
 	m.Add("1.0", "Get", "/services/{name}/doc", AuthorizationRequiredHandler(serviceDoc))
 	m.Add("1.0", "Put", "/services/{name}/doc", AuthorizationRequiredHandler(serviceAddDoc))
+	m.Add("1.4", "Put", "/services/{name}/catalog", AuthorizationRequiredHandler(serviceUpdateCatalog))
 	m.Add("1.0", "Put", "/services/{service}/team/{team}", AuthorizationRequiredHandler(grantServiceAccess))
 	m.Add("1.0", "Delete", "/services/{service}/team/{team}", AuthorizationRequiredHandler(revokeServiceAccess))
 
@@ -138,6 +148,11 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/apps/{app}/env", AuthorizationRequiredHandler(getEnv))
 	m.Add("1.0", "Post", "/apps/{app}/env", AuthorizationRequiredHandler(setEnv))
 	m.Add("1.0", "Delete", "/apps/{app}/env", AuthorizationRequiredHandler(unsetEnv))
+	m.Add("1.4", "Get", "/apps/{app}/env/history", AuthorizationRequiredHandler(envHistory))
+	m.Add("1.4", "Post", "/apps/{app}/env/history/{version}/restore", AuthorizationRequiredHandler(restoreEnvVersion))
+	m.Add("1.4", "Get", "/apps/{app}/autoscale", AuthorizationRequiredHandler(listUnitsAutoScale))
+	m.Add("1.4", "Post", "/apps/{app}/autoscale", AuthorizationRequiredHandler(setUnitsAutoScale))
+	m.Add("1.4", "Delete", "/apps/{app}/autoscale", AuthorizationRequiredHandler(removeUnitsAutoScale))
 	m.Add("1.0", "Get", "/apps", AuthorizationRequiredHandler(appList))
 	m.Add("1.0", "Post", "/apps", AuthorizationRequiredHandler(createApp))
 	forceDeleteLockHandler := AuthorizationRequiredHandler(forceDeleteLock)
@@ -194,6 +209,7 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/users", AuthorizationRequiredHandler(listUsers))
 	m.Add("1.0", "Post", "/users", Handler(createUser))
 	m.Add("1.0", "Get", "/users/info", AuthorizationRequiredHandler(userInfo))
+	m.Add("1.4", "Get", "/users/inactive", AuthorizationRequiredHandler(inactiveUsers))
 	m.Add("1.0", "Get", "/auth/scheme", Handler(authScheme))
 	m.Add("1.0", "Post", "/auth/login", Handler(login))
 
@@ -204,8 +220,16 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Post", "/users/{email}/tokens", Handler(login))
 	m.Add("1.0", "Get", "/users/{email}/quota", AuthorizationRequiredHandler(getUserQuota))
 	m.Add("1.0", "Put", "/users/{email}/quota", AuthorizationRequiredHandler(changeUserQuota))
+	m.Add("1.4", "Post", "/users/{email}/disable", AuthorizationRequiredHandler(disableUser))
+	m.Add("1.4", "Post", "/users/{email}/enable", AuthorizationRequiredHandler(enableUser))
+	m.Add("1.4", "Post", "/users/{email}/unlock", AuthorizationRequiredHandler(unlockUser))
 	m.Add("1.0", "Delete", "/users/tokens", AuthorizationRequiredHandler(logout))
 	m.Add("1.0", "Put", "/users/password", AuthorizationRequiredHandler(changePassword))
+	m.Add("1.4", "Get", "/users/2fa", AuthorizationRequiredHandler(twoFactorInfo))
+	m.Add("1.4", "Post", "/users/2fa", AuthorizationRequiredHandler(twoFactorEnroll))
+	m.Add("1.4", "Put", "/users/2fa", AuthorizationRequiredHandler(twoFactorConfirm))
+	m.Add("1.4", "Delete", "/users/2fa", AuthorizationRequiredHandler(twoFactorDisable))
+	m.Add("1.4", "Post", "/users/2fa/recovery-codes", AuthorizationRequiredHandler(twoFactorRecoveryCodes))
 	m.Add("1.0", "Delete", "/users", AuthorizationRequiredHandler(removeUser))
 	m.Add("1.0", "Get", "/users/keys", AuthorizationRequiredHandler(listKeys))
 	m.Add("1.0", "Post", "/users/keys", AuthorizationRequiredHandler(addKeyToUser))
@@ -218,6 +242,11 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/teams", AuthorizationRequiredHandler(teamList))
 	m.Add("1.0", "Post", "/teams", AuthorizationRequiredHandler(createTeam))
 	m.Add("1.0", "Delete", "/teams/{name}", AuthorizationRequiredHandler(removeTeam))
+	m.Add("1.4", "Get", "/teams/{name}", AuthorizationRequiredHandler(teamInfo))
+	m.Add("1.4", "Put", "/teams/{name}", AuthorizationRequiredHandler(updateTeam))
+	m.Add("1.4", "Get", "/teams/{name}/users", AuthorizationRequiredHandler(teamUsers))
+	m.Add("1.4", "Get", "/teams/{name}/quota", AuthorizationRequiredHandler(getTeamQuota))
+	m.Add("1.4", "Put", "/teams/{name}/quota", AuthorizationRequiredHandler(changeTeamQuota))
 
 	m.Add("1.0", "Post", "/swap", AuthorizationRequiredHandler(swap))
 
@@ -225,9 +254,12 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/healthcheck", http.HandlerFunc(healthcheck))
 
 	m.Add("1.0", "Get", "/iaas/machines", AuthorizationRequiredHandler(machinesList))
+	m.Add("1.4", "Get", "/iaas/machines/audit", AuthorizationRequiredHandler(machinesAudit))
+	m.Add("1.4", "Get", "/iaas/usage", AuthorizationRequiredHandler(machinesUsage))
 	m.Add("1.0", "Delete", "/iaas/machines/{machine_id}", AuthorizationRequiredHandler(machineDestroy))
 	m.Add("1.0", "Get", "/iaas/templates", AuthorizationRequiredHandler(templatesList))
 	m.Add("1.0", "Post", "/iaas/templates", AuthorizationRequiredHandler(templateCreate))
+	m.Add("1.4", "Post", "/iaas/templates/validate", AuthorizationRequiredHandler(templateValidate))
 	m.Add("1.0", "Put", "/iaas/templates/{template_name}", AuthorizationRequiredHandler(templateUpdate))
 	m.Add("1.0", "Delete", "/iaas/templates/{template_name}", AuthorizationRequiredHandler(templateDestroy))
 
@@ -257,6 +289,8 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Post", "/role/default", AuthorizationRequiredHandler(addDefaultRole))
 	m.Add("1.0", "Delete", "/role/default", AuthorizationRequiredHandler(removeDefaultRole))
 	m.Add("1.0", "Get", "/permissions", AuthorizationRequiredHandler(listPermissions))
+	m.Add("1.4", "Get", "/permissions/holders", AuthorizationRequiredHandler(permissionHolders))
+	m.Add("1.4", "Get", "/permissions/explain", AuthorizationRequiredHandler(explainPermission))
 
 	m.Add("1.0", "Get", "/debug/goroutines", AuthorizationRequiredHandler(dumpGoroutines))
 	m.Add("1.0", "Get", "/debug/pprof/", AuthorizationRequiredHandler(indexHandler))
@@ -272,6 +306,7 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.3", "GET", "/node/autoscale", AuthorizationRequiredHandler(autoScaleHistoryHandler))
 	m.Add("1.3", "GET", "/node/autoscale/config", AuthorizationRequiredHandler(autoScaleGetConfig))
 	m.Add("1.3", "POST", "/node/autoscale/run", AuthorizationRequiredHandler(autoScaleRunHandler))
+	m.Add("1.4", "POST", "/node/autoscale/simulate", AuthorizationRequiredHandler(autoScaleSimulate))
 	m.Add("1.3", "GET", "/node/autoscale/rules", AuthorizationRequiredHandler(autoScaleListRules))
 	m.Add("1.3", "POST", "/node/autoscale/rules", AuthorizationRequiredHandler(autoScaleSetRule))
 	m.Add("1.3", "DELETE", "/node/autoscale/rules", AuthorizationRequiredHandler(autoScaleDeleteRule))
@@ -476,6 +511,16 @@ func startServer(handler http.Handler) {
 	if err != nil {
 		fatal(err)
 	}
+	initializeServiceInstancesProvisioningResumer()
+	initializeInterruptedNodeCreationsChecker()
+	service.InitializeCredentialsRevoker(func(appName string) (bind.App, error) {
+		a, err := app.GetByName(appName)
+		if err != nil {
+			return nil, err
+		}
+		return a, nil
+	})
+	app.InitializeUnitsAutoScale()
 	err = autoscale.Initialize()
 	if err != nil {
 		fatal(err)
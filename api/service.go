@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/ajg/form"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
@@ -30,6 +31,9 @@ func serviceValidate(s service.Service) error {
 	if endpoint, ok := s.Endpoint["production"]; !ok || endpoint == "" {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Service production endpoint is required"}
 	}
+	if err := service.ValidateAPIType(s.APIType); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
 	return nil
 }
 
@@ -59,6 +63,7 @@ func serviceList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	results := make([]service.ServiceModel, len(services))
 	for i, s := range services {
 		results[i].Service = s.Name
+		results[i].Catalog = s.Catalog
 		for _, si := range sInstances {
 			if si.ServiceName == s.Name {
 				results[i].Instances = append(results[i].Instances, si.Name)
@@ -90,6 +95,7 @@ func serviceCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err er
 		Username: r.FormValue("username"),
 		Endpoint: map[string]string{"production": r.FormValue("endpoint")},
 		Password: r.FormValue("password"),
+		APIType:  r.FormValue("api-type"),
 	}
 	team := r.FormValue("team")
 	if team == "" {
@@ -406,6 +412,58 @@ func serviceAddDoc(w http.ResponseWriter, r *http.Request, t auth.Token) (err er
 	return s.Update()
 }
 
+// title: service update catalog
+// path: /services/{name}/catalog
+// consume: application/x-www-form-urlencoded
+// method: PUT
+// responses:
+//   200: Catalog updated
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden (team is not the owner)
+//   404: Service not found
+func serviceUpdateCatalog(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	serviceName := r.URL.Query().Get(":name")
+	s, err := getService(serviceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceUpdateCatalog,
+		contextsForServiceProvision(&s)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	var catalog service.Catalog
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	err = dec.DecodeValues(&catalog, r.Form)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	err = catalog.Validate()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceTarget(s.Name),
+		Kind:       permission.PermServiceUpdateCatalog,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermServiceReadEvents, contextsForServiceProvision(&s)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	s.Catalog = &catalog
+	return s.Update()
+}
+
 func getService(name string) (service.Service, error) {
 	s := service.Service{Name: name}
 	err := s.Get()
@@ -17,10 +17,12 @@ import (
 	"github.com/pkg/errors"
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/context"
+	"github.com/tsuru/tsuru/api/shutdown"
 	"github.com/tsuru/tsuru/auth"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	tsuruIo "github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/service"
 )
@@ -44,6 +46,7 @@ func serviceIntancePermName(serviceName, instanceName string) string {
 // consume: application/x-www-form-urlencoded
 // responses:
 //   201: Service created
+//   202: Service being provisioned
 //   400: Invalid data
 //   401: Unauthorized
 //   409: Service already exists
@@ -68,6 +71,14 @@ func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 		Description: r.FormValue("description"),
 		Tags:        r.Form["tag"],
 	}
+	for key, values := range r.Form {
+		if strings.HasPrefix(key, service.ParametersPrefix) && len(values) > 0 {
+			if instance.Parameters == nil {
+				instance.Parameters = make(map[string]string)
+			}
+			instance.Parameters[strings.TrimPrefix(key, service.ParametersPrefix)] = values[0]
+		}
+	}
 	var teamOwner string
 	if instance.TeamOwner == "" {
 		teamOwner, err = permission.TeamForPermission(t, permission.PermServiceInstanceCreate)
@@ -101,7 +112,12 @@ func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	if err != nil {
 		return err
 	}
-	defer func() { evt.Done(err) }()
+	provisioning := false
+	defer func() {
+		if !provisioning {
+			evt.Done(err)
+		}
+	}()
 	requestIDHeader, _ := config.GetString("request-id-header")
 	requestID := context.GetRequestID(r, requestIDHeader)
 	err = service.CreateServiceInstance(instance, &srv, user, requestID)
@@ -117,10 +133,91 @@ func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 			Message: err.Error(),
 		}
 	}
-	if err == nil {
-		w.WriteHeader(http.StatusCreated)
+	if e, ok := err.(*tsuruErrors.ValidationError); ok {
+		return &tsuruErrors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: e.Message,
+		}
+	}
+	if err != nil {
+		return err
+	}
+	si, err := service.GetServiceInstance(serviceName, instance.Name)
+	if err != nil {
+		return err
+	}
+	if si.State == service.InstanceStatePending {
+		provisioning = true
+		go func() {
+			evt.Done(service.WaitProvisioning(si, evt, requestID))
+		}()
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+var serviceInstancesProvisioningInterval = time.Minute
+
+type serviceInstancesProvisioningResumer struct {
+	done chan bool
+}
+
+func initializeServiceInstancesProvisioningResumer() {
+	resumer := &serviceInstancesProvisioningResumer{done: make(chan bool)}
+	shutdown.Register(resumer)
+	go resumer.run()
+}
+
+func (r *serviceInstancesProvisioningResumer) run() {
+	for {
+		err := resumeServiceInstancesProvisioning()
+		if err != nil {
+			log.Errorf("[resume service instances provisioning] %s", err)
+		}
+		select {
+		case <-r.done:
+			return
+		case <-time.After(serviceInstancesProvisioningInterval):
+		}
+	}
+}
+
+func (r *serviceInstancesProvisioningResumer) Shutdown() {
+	r.done <- true
+}
+
+func (r *serviceInstancesProvisioningResumer) String() string {
+	return "service instances provisioning resumer"
+}
+
+// resumeServiceInstancesProvisioning resumes polling the service APIs for
+// the instances left pending by a stopped API process, finishing their
+// creation events once the provisioning is over. Each instance is claimed
+// atomically, so it's resumed by a single API process.
+func resumeServiceInstancesProvisioning() error {
+	for {
+		si, err := service.ClaimPendingServiceInstance()
+		if err != nil {
+			return err
+		}
+		if si == nil {
+			return nil
+		}
+		evt, err := event.GetRunning(serviceInstanceTarget(si.ServiceName, si.Name), permission.PermServiceInstanceCreate.FullName())
+		if err != nil && err != event.ErrEventNotFound {
+			log.Errorf("[resume service instances provisioning] unable to get creation event of %s/%s: %s", si.ServiceName, si.Name, err)
+		}
+		if evt == nil {
+			go service.WaitProvisioning(si, nil, "")
+			continue
+		}
+		evt.ResumeLock()
+		go func() {
+			evt.Done(service.WaitProvisioning(si, evt, ""))
+		}()
 	}
-	return err
 }
 
 // title: service instance update
@@ -132,6 +229,7 @@ func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 //   400: Invalid data
 //   401: Unauthorized
 //   404: Service instance not found
+//   412: Service instance not ready
 func updateServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	err = r.ParseForm()
 	if err != nil {
@@ -140,11 +238,13 @@ func updateServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	serviceName := r.URL.Query().Get(":service")
 	instanceName := r.URL.Query().Get(":instance")
 	description := r.FormValue("description")
+	plan := r.FormValue("plan")
 	tags := r.Form["tag"]
 	si, err := getServiceInstanceOrError(serviceName, instanceName)
 	if err != nil {
 		return err
 	}
+	kind := permission.PermServiceInstanceUpdateDescription
 	var wantedPerms []*permission.PermissionScheme
 	if description != "" {
 		wantedPerms = append(wantedPerms, permission.PermServiceInstanceUpdateDescription)
@@ -152,10 +252,14 @@ func updateServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	if tags != nil {
 		wantedPerms = append(wantedPerms, permission.PermServiceInstanceUpdateTags)
 	}
+	if plan != "" {
+		kind = permission.PermServiceInstanceUpdatePlan
+		wantedPerms = append(wantedPerms, permission.PermServiceInstanceUpdatePlan)
+	}
 	if len(wantedPerms) == 0 {
 		return &tsuruErrors.HTTP{
 			Code:    http.StatusBadRequest,
-			Message: "Neither the description or tags were set. You must define at least one.",
+			Message: "Neither the description, tags or plan were set. You must define at least one.",
 		}
 	}
 	for _, perm := range wantedPerms {
@@ -168,7 +272,7 @@ func updateServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	}
 	evt, err := event.New(&event.Opts{
 		Target:     serviceInstanceTarget(serviceName, instanceName),
-		Kind:       permission.PermServiceInstanceUpdateDescription,
+		Kind:       kind,
 		Owner:      t,
 		CustomData: event.FormToCustomData(r.Form),
 		Allowed: event.Allowed(permission.PermServiceInstanceReadEvents,
@@ -178,6 +282,20 @@ func updateServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 		return err
 	}
 	defer func() { evt.Done(err) }()
+	if plan != "" && plan != si.PlanName {
+		requestIDHeader, _ := config.GetString("request-id-header")
+		requestID := context.GetRequestID(r, requestIDHeader)
+		err = si.ChangePlan(plan, requestID)
+		switch err {
+		case nil:
+		case service.ErrInvalidPlan:
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		case service.ErrInstanceNotReady, service.ErrInstanceProvisionFailed:
+			return &tsuruErrors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+		default:
+			return err
+		}
+	}
 	if description != "" {
 		si.Description = description
 	}
@@ -385,6 +503,178 @@ func serviceInstanceStatus(w http.ResponseWriter, r *http.Request, t auth.Token)
 	return err
 }
 
+// title: service instance bindings
+// path: /services/{service}/instances/{instance}/bindings
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: Service instance not found
+func serviceInstanceBindings(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	serviceInstance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceReadBindings,
+		contextsForServiceInstance(serviceInstance, serviceName)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	if len(serviceInstance.Bindings) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(serviceInstance.Bindings)
+}
+
+// title: service instance backups
+// path: /services/{service}/instances/{instance}/backups
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   400: Service does not support backups
+//   401: Unauthorized
+//   404: Service instance not found
+func serviceInstanceBackups(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	serviceInstance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceReadBackups,
+		contextsForServiceInstance(serviceInstance, serviceName)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	requestIDHeader, _ := config.GetString("request-id-header")
+	requestID := context.GetRequestID(r, requestIDHeader)
+	backups, err := serviceInstance.ListBackups(requestID)
+	if err != nil {
+		return backupError(err)
+	}
+	if len(backups) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(backups)
+}
+
+// title: service instance backup create
+// path: /services/{service}/instances/{instance}/backups
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Backup created
+//   400: Service does not support backups
+//   401: Unauthorized
+//   404: Service instance not found
+//   412: Service instance not ready
+func createServiceInstanceBackup(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	description := r.FormValue("description")
+	serviceInstance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateBackup,
+		contextsForServiceInstance(serviceInstance, serviceName)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceInstanceTarget(serviceName, instanceName),
+		Kind:       permission.PermServiceInstanceUpdateBackup,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed: event.Allowed(permission.PermServiceInstanceReadEvents,
+			contextsForServiceInstance(serviceInstance, serviceName)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	requestIDHeader, _ := config.GetString("request-id-header")
+	requestID := context.GetRequestID(r, requestIDHeader)
+	backup, err := serviceInstance.CreateBackup(description, requestID)
+	if err != nil {
+		return backupError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(backup)
+}
+
+// title: service instance backup restore
+// path: /services/{service}/instances/{instance}/backups/{backup}/restore
+// method: POST
+// responses:
+//   200: Backup restored
+//   400: Service does not support backups
+//   401: Unauthorized
+//   404: Service instance or backup not found
+//   412: Service instance not ready
+func restoreServiceInstanceBackup(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	backupID := r.URL.Query().Get(":backup")
+	serviceInstance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateRestore,
+		contextsForServiceInstance(serviceInstance, serviceName)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceInstanceTarget(serviceName, instanceName),
+		Kind:       permission.PermServiceInstanceUpdateRestore,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed: event.Allowed(permission.PermServiceInstanceReadEvents,
+			contextsForServiceInstance(serviceInstance, serviceName)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	requestIDHeader, _ := config.GetString("request-id-header")
+	requestID := context.GetRequestID(r, requestIDHeader)
+	err = serviceInstance.RestoreBackup(backupID, requestID)
+	if err != nil {
+		return backupError(err)
+	}
+	return nil
+}
+
+func backupError(err error) error {
+	switch err {
+	case service.ErrBackupNotSupported:
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case service.ErrBackupNotFound:
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case service.ErrInstanceNotReady, service.ErrInstanceProvisionFailed:
+		return &tsuruErrors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
+	return err
+}
+
 type serviceInstanceInfo struct {
 	Apps            []string
 	Teams           []string
@@ -534,6 +824,43 @@ func servicePlans(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return json.NewEncoder(w).Encode(plans)
 }
 
+// title: service parameters
+// path: /services/{name}/parameters
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: Service not found
+func serviceParameters(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	serviceName := r.URL.Query().Get(":name")
+	s, err := getService(serviceName)
+	if err != nil {
+		return err
+	}
+	if s.IsRestricted {
+		allowed := permission.Check(t, permission.PermServiceReadPlans,
+			contextsForService(&s)...,
+		)
+		if !allowed {
+			return permission.ErrUnauthorized
+		}
+	}
+	requestIDHeader, _ := config.GetString("request-id-header")
+	requestID := context.GetRequestID(r, requestIDHeader)
+	params, err := service.GetParametersByServiceName(serviceName, requestID)
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(params)
+}
+
 func parseFormPreserveBody(r *http.Request) {
 	var buf bytes.Buffer
 	var readCloser struct {
@@ -14,6 +14,7 @@ import (
 	"sort"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/context"
@@ -22,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/permission"
@@ -75,6 +77,10 @@ func (s *ServiceInstanceSuite) SetUpTest(c *check.C) {
 	provision.DefaultProvisioner = "fake"
 	s.provisioner.Reset()
 	s.ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.Write([]byte(`{"DATABASE_HOST":"localhost"}`))
 	}))
 	s.service = &service.Service{
@@ -130,6 +136,10 @@ func (s *ServiceInstanceSuite) TestCreateInstanceWithPlan(c *check.C) {
 	config.Set("request-id-header", requestIDHeader)
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c.Assert(r.Header.Get(requestIDHeader), check.Equals, "test")
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.Write([]byte(`{"DATABASE_HOST":"localhost"}`))
 	}))
 	defer ts.Close()
@@ -166,6 +176,10 @@ func (s *ServiceInstanceSuite) TestCreateInstanceWithPlan(c *check.C) {
 
 func (s *ServiceInstanceSuite) TestCreateInstanceWithPlanImplicitTeam(c *check.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.Write([]byte(`{"DATABASE_HOST":"localhost"}`))
 	}))
 	defer ts.Close()
@@ -369,6 +383,10 @@ func (s *ServiceInstanceSuite) TestCreateServiceInstanceReturnsErrorWhenServiceD
 
 func (s *ServiceInstanceSuite) TestCreateServiceInstanceReturnErrorIfTheServiceAPICallFailAndDoesNotSaveTheInstanceInTheDatabase(c *check.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 	}))
 	defer ts.Close()
@@ -400,6 +418,10 @@ func (s *ServiceInstanceSuite) TestCreateServiceInstanceReturnErrorIfTheServiceA
 
 func (s *ServiceInstanceSuite) TestCreateInstanceWithDescription(c *check.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.Write([]byte(`{"DATABASE_HOST":"localhost"}`))
 	}))
 	defer ts.Close()
@@ -436,6 +458,10 @@ func (s *ServiceInstanceSuite) TestCreateInstanceWithDescription(c *check.C) {
 
 func (s *ServiceInstanceSuite) TestCreateServiceInstanceWithTags(c *check.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.Write([]byte(`{"DATABASE_HOST":"localhost"}`))
 	}))
 	defer ts.Close()
@@ -660,7 +686,7 @@ func (s *ServiceInstanceSuite) TestUpdateServiceInstanceEmptyDescription(c *chec
 	m := RunServer(true)
 	m.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
-	c.Assert(recorder.Body.String(), check.Equals, "Neither the description or tags were set. You must define at least one.\n")
+	c.Assert(recorder.Body.String(), check.Equals, "Neither the description, tags or plan were set. You must define at least one.\n")
 }
 
 func makeRequestToRemoveServiceInstance(service, instance string, c *check.C) (*httptest.ResponseRecorder, *http.Request) {
@@ -1537,6 +1563,37 @@ func (s *ServiceInstanceSuite) TestServicePlans(c *check.C) {
 	c.Assert(plans, check.DeepEquals, expected)
 }
 
+func (s *ServiceInstanceSuite) TestServicePlansWithCatalogCosts(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content := `[{"name": "ignite", "description": "some value"}, {"name": "small", "description": "not space left for you"}]`
+		w.Write([]byte(content))
+	}))
+	defer ts.Close()
+	srvc := service.Service{
+		Name:     "mysqlplan",
+		Endpoint: map[string]string{"production": ts.URL},
+		Catalog: &service.Catalog{
+			Costs: []service.PlanCost{{Plan: "small", Amount: 5, Currency: "USD", Period: "month"}},
+		},
+	}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/services/mysqlplan/plans", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var plans []service.Plan
+	err = json.Unmarshal(recorder.Body.Bytes(), &plans)
+	c.Assert(err, check.IsNil)
+	expected := []service.Plan{
+		{Name: "ignite", Description: "some value"},
+		{Name: "small", Description: "not space left for you", Cost: &service.PlanCost{Plan: "small", Amount: 5, Currency: "USD", Period: "month"}},
+	}
+	c.Assert(plans, check.DeepEquals, expected)
+}
+
 type closeNotifierResponseRecorder struct {
 	*httptest.ResponseRecorder
 }
@@ -1821,3 +1878,459 @@ func (s *ServiceInstanceSuite) TestGrantRevokeServiceToTeamWithManyInstanceName(
 	c.Assert(err, check.IsNil)
 	c.Assert(sinst.Teams, check.DeepEquals, []string{s.team.Name})
 }
+
+func (s *ServiceInstanceSuite) TestCreateInstanceAsync(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	srv := service.Service{
+		Name:     "asyncsql",
+		Teams:    []string{s.team.Name},
+		Endpoint: map[string]string{"production": ts.URL},
+	}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	params := map[string]interface{}{
+		"name":         "brainSQL",
+		"service_name": "asyncsql",
+		"owner":        s.team.Name,
+		"token":        "bearer " + s.token.GetValue(),
+	}
+	recorder, request := makeRequestToCreateServiceInstance(params, c)
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusAccepted)
+	timeout := time.After(5 * time.Second)
+	for {
+		si, err := service.GetServiceInstance("asyncsql", "brainSQL")
+		c.Assert(err, check.IsNil)
+		if si.State == service.InstanceStateReady {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("timeout waiting for instance provisioning, state: %q", si.State)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	timeout = time.After(5 * time.Second)
+	desc := eventtest.EventDesc{
+		Target: serviceInstanceTarget("asyncsql", "brainSQL"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "brainSQL"},
+			{"name": ":service", "value": "asyncsql"},
+			{"name": "owner", "value": s.team.Name},
+		},
+	}
+	for {
+		if ok, _ := eventtest.HasEvent.Check([]interface{}{desc}, nil); ok {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for the create event to finish")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (s *ServiceInstanceSuite) TestResumeServiceInstancesProvisioning(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	srv := service.Service{Name: "asyncsql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "asyncsql", State: service.InstanceStatePending}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:  serviceInstanceTarget("asyncsql", "brainSQL"),
+		Kind:    permission.PermServiceInstanceCreate,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermServiceInstanceReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Running, check.Equals, true)
+	err = resumeServiceInstancesProvisioning()
+	c.Assert(err, check.IsNil)
+	timeout := time.After(5 * time.Second)
+	for {
+		dbInstance, err := service.GetServiceInstance("asyncsql", "brainSQL")
+		c.Assert(err, check.IsNil)
+		_, err = event.GetRunning(serviceInstanceTarget("asyncsql", "brainSQL"), "service-instance.create")
+		if dbInstance.State == service.InstanceStateReady && err == event.ErrEventNotFound {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("timeout waiting for resumed provisioning, state: %q, event error: %v", dbInstance.State, err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (s *ServiceInstanceSuite) TestResumeServiceInstancesProvisioningSkipsLockedInstances(c *check.C) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	srv := service.Service{Name: "asyncsql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	si := service.ServiceInstance{
+		Name:                    "brainSQL",
+		ServiceName:             "asyncsql",
+		State:                   service.InstanceStatePending,
+		ProvisionLockUpdateTime: time.Now().UTC(),
+	}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	err = resumeServiceInstancesProvisioning()
+	c.Assert(err, check.IsNil)
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(0))
+	dbInstance, err := service.GetServiceInstance("asyncsql", "brainSQL")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.State, check.Equals, service.InstanceStatePending)
+}
+
+func (s *ServiceInstanceSuite) TestUpdateServiceInstanceWithPlan(c *check.C) {
+	var updateBody string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/plans" {
+			w.Write([]byte(`[{"name": "small"}, {"name": "large"}]`))
+			return
+		}
+		if r.Method == "PUT" && r.URL.Path == "/resources/brainSQL/plan" {
+			r.ParseForm()
+			updateBody = r.Form.Get("plan")
+		}
+	}))
+	defer ts.Close()
+	s.service.Endpoint = map[string]string{"production": ts.URL}
+	err := s.service.Update()
+	c.Assert(err, check.IsNil)
+	si := service.ServiceInstance{
+		Name:        "brainSQL",
+		ServiceName: "mysql",
+		PlanName:    "small",
+		Teams:       []string{s.team.Name},
+		Description: "desc",
+	}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	params := map[string]interface{}{
+		"plan": "large",
+	}
+	recorder, request := makeRequestToUpdateServiceInstance(params, "mysql", "brainSQL", s.token.GetValue(), c)
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(updateBody, check.Equals, "large")
+	var instance service.ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": "brainSQL", "service_name": "mysql"}).One(&instance)
+	c.Assert(err, check.IsNil)
+	c.Assert(instance.PlanName, check.Equals, "large")
+	c.Assert(instance.Description, check.Equals, "desc")
+	c.Assert(eventtest.EventDesc{
+		Target: serviceInstanceTarget("mysql", "brainSQL"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.update.plan",
+		StartCustomData: []map[string]interface{}{
+			{"name": "plan", "value": "large"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *ServiceInstanceSuite) TestUpdateServiceInstanceWithInvalidPlan(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name": "small"}]`))
+	}))
+	defer ts.Close()
+	s.service.Endpoint = map[string]string{"production": ts.URL}
+	err := s.service.Update()
+	c.Assert(err, check.IsNil)
+	si := service.ServiceInstance{
+		Name:        "brainSQL",
+		ServiceName: "mysql",
+		PlanName:    "small",
+		Teams:       []string{s.team.Name},
+	}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	params := map[string]interface{}{
+		"plan": "huge",
+	}
+	recorder, request := makeRequestToUpdateServiceInstance(params, "mysql", "brainSQL", s.token.GetValue(), c)
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, service.ErrInvalidPlan.Error()+"\n")
+	var instance service.ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": "brainSQL", "service_name": "mysql"}).One(&instance)
+	c.Assert(err, check.IsNil)
+	c.Assert(instance.PlanName, check.Equals, "small")
+}
+
+func (s *ServiceInstanceSuite) TestCreateInstanceWithParameters(c *check.C) {
+	var created url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.Write([]byte(`[{"name": "engine-version", "required": true, "values": ["5.6", "5.7"]}, {"name": "region", "default": "us-east"}]`))
+			return
+		}
+		r.ParseForm()
+		created = r.Form
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	s.service.Endpoint = map[string]string{"production": ts.URL}
+	err := s.service.Update()
+	c.Assert(err, check.IsNil)
+	params := map[string]interface{}{
+		"name":                      "brainSQL",
+		"service_name":              "mysql",
+		"owner":                     s.team.Name,
+		"parameters.engine-version": "5.7",
+		"token":                     "bearer " + s.token.GetValue(),
+	}
+	recorder, request := makeRequestToCreateServiceInstance(params, c)
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	c.Assert(created.Get("parameters.engine-version"), check.Equals, "5.7")
+	c.Assert(created.Get("parameters.region"), check.Equals, "us-east")
+	si, err := service.GetServiceInstance("mysql", "brainSQL")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.Parameters, check.DeepEquals, map[string]string{"engine-version": "5.7", "region": "us-east"})
+}
+
+func (s *ServiceInstanceSuite) TestCreateInstanceWithInvalidParameters(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.Write([]byte(`[{"name": "engine-version", "values": ["5.6", "5.7"]}]`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	s.service.Endpoint = map[string]string{"production": ts.URL}
+	err := s.service.Update()
+	c.Assert(err, check.IsNil)
+	params := map[string]interface{}{
+		"name":                      "brainSQL",
+		"service_name":              "mysql",
+		"owner":                     s.team.Name,
+		"parameters.engine-version": "8.0",
+		"token":                     "bearer " + s.token.GetValue(),
+	}
+	recorder, request := makeRequestToCreateServiceInstance(params, c)
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid value \"8.0\" for parameter \"engine-version\", accepted values: 5.6, 5.7\n")
+	_, err = service.GetServiceInstance("mysql", "brainSQL")
+	c.Assert(err, check.Equals, service.ErrServiceInstanceNotFound)
+}
+
+func (s *ServiceInstanceSuite) TestServiceParameters(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name": "region", "default": "us-east"}]`))
+	}))
+	defer ts.Close()
+	s.service.Endpoint = map[string]string{"production": ts.URL}
+	err := s.service.Update()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/services/mysql/parameters", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var params []service.Parameter
+	err = json.Unmarshal(recorder.Body.Bytes(), &params)
+	c.Assert(err, check.IsNil)
+	c.Assert(params, check.DeepEquals, []service.Parameter{{Name: "region", Default: "us-east"}})
+}
+
+func (s *ServiceInstanceSuite) TestServiceInstanceBindings(c *check.C) {
+	si := service.ServiceInstance{
+		Name:        "my-mysql",
+		ServiceName: "mysql",
+		Teams:       []string{s.team.Name},
+		Apps:        []string{"painkiller"},
+		Bindings: []service.Binding{
+			{ID: "b1", App: "painkiller", Credentials: []string{"DATABASE_USER"}, Fingerprint: "abc"},
+		},
+	}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/services/mysql/instances/my-mysql/bindings", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var bindings []service.Binding
+	err = json.Unmarshal(recorder.Body.Bytes(), &bindings)
+	c.Assert(err, check.IsNil)
+	c.Assert(bindings, check.HasLen, 1)
+	c.Assert(bindings[0].ID, check.Equals, "b1")
+	c.Assert(bindings[0].App, check.Equals, "painkiller")
+	c.Assert(bindings[0].Credentials, check.DeepEquals, []string{"DATABASE_USER"})
+}
+
+func (s *ServiceInstanceSuite) TestServiceInstanceBindingsWithoutPermission(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "bindingsuser")
+	request, err := http.NewRequest("GET", "/services/mysql/instances/my-mysql/bindings", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *ServiceInstanceSuite) createBackupService(c *check.C, handler http.HandlerFunc) func() {
+	ts := httptest.NewServer(handler)
+	srvc := service.Service{Name: "redis", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	si := service.ServiceInstance{Name: "my-redis", ServiceName: "redis", Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	return ts.Close
+}
+
+func (s *ServiceInstanceSuite) TestServiceInstanceBackups(c *check.C) {
+	defer s.createBackupService(c, func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Path, check.Equals, "/resources/my-redis/backups")
+		w.Write([]byte(`[{"id": "b1", "status": "done"}, {"id": "b2", "status": "running"}]`))
+	})()
+	request, err := http.NewRequest("GET", "/services/redis/instances/my-redis/backups", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var backups []service.Backup
+	err = json.Unmarshal(recorder.Body.Bytes(), &backups)
+	c.Assert(err, check.IsNil)
+	c.Assert(backups, check.DeepEquals, []service.Backup{
+		{ID: "b1", Status: "done"},
+		{ID: "b2", Status: "running"},
+	})
+}
+
+func (s *ServiceInstanceSuite) TestServiceInstanceBackupsNotSupported(c *check.C) {
+	defer s.createBackupService(c, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})()
+	request, err := http.NewRequest("GET", "/services/redis/instances/my-redis/backups", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, service.ErrBackupNotSupported.Error()+"\n")
+}
+
+func (s *ServiceInstanceSuite) TestServiceInstanceBackupsWithoutPermission(c *check.C) {
+	defer s.createBackupService(c, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})()
+	token := customUserWithPermission(c, "backupsuser")
+	request, err := http.NewRequest("GET", "/services/redis/instances/my-redis/backups", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *ServiceInstanceSuite) TestCreateServiceInstanceBackup(c *check.C) {
+	var description string
+	defer s.createBackupService(c, func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, check.Equals, "POST")
+		c.Assert(r.URL.Path, check.Equals, "/resources/my-redis/backups")
+		description = r.FormValue("description")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "b3", "description": "before deploy", "status": "running"}`))
+	})()
+	body := strings.NewReader("description=before+deploy")
+	request, err := http.NewRequest("POST", "/services/redis/instances/my-redis/backups", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	c.Assert(description, check.Equals, "before deploy")
+	var backup service.Backup
+	err = json.Unmarshal(recorder.Body.Bytes(), &backup)
+	c.Assert(err, check.IsNil)
+	c.Assert(backup, check.DeepEquals, service.Backup{ID: "b3", Description: "before deploy", Status: "running"})
+	c.Assert(eventtest.EventDesc{
+		Target: serviceInstanceTarget("redis", "my-redis"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.update.backup",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":service", "value": "redis"},
+			{"name": ":instance", "value": "my-redis"},
+			{"name": "description", "value": "before deploy"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *ServiceInstanceSuite) TestRestoreServiceInstanceBackup(c *check.C) {
+	var restored string
+	defer s.createBackupService(c, func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, check.Equals, "POST")
+		restored = r.URL.Path
+	})()
+	request, err := http.NewRequest("POST", "/services/redis/instances/my-redis/backups/b1/restore", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(restored, check.Equals, "/resources/my-redis/backups/b1/restore")
+	c.Assert(eventtest.EventDesc{
+		Target: serviceInstanceTarget("redis", "my-redis"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.update.restore",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":service", "value": "redis"},
+			{"name": ":instance", "value": "my-redis"},
+			{"name": ":backup", "value": "b1"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *ServiceInstanceSuite) TestRestoreServiceInstanceBackupNotFound(c *check.C) {
+	defer s.createBackupService(c, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})()
+	request, err := http.NewRequest("POST", "/services/redis/instances/my-redis/backups/b9/restore", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, service.ErrBackupNotFound.Error()+"\n")
+}
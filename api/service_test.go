@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/ajg/form"
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
@@ -157,6 +158,37 @@ func (s *ProvisionSuite) TestServiceCreate(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *ProvisionSuite) TestServiceCreateBrokerAPIType(c *check.C) {
+	v := url.Values{}
+	v.Set("id", "some_service")
+	v.Set("password", "xxxx")
+	v.Set("team", "tsuruteam")
+	v.Set("endpoint", "broker.com")
+	v.Set("api-type", "osb")
+	recorder, request := s.makeRequest("POST", "/services", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var rService service.Service
+	err := s.conn.Services().FindId("some_service").One(&rService)
+	c.Assert(err, check.IsNil)
+	c.Assert(rService.APIType, check.Equals, service.BrokerAPIType)
+}
+
+func (s *ProvisionSuite) TestServiceCreateInvalidAPIType(c *check.C) {
+	v := url.Values{}
+	v.Set("id", "some_service")
+	v.Set("password", "xxxx")
+	v.Set("team", "tsuruteam")
+	v.Set("endpoint", "broker.com")
+	v.Set("api-type", "soap")
+	recorder, request := s.makeRequest("POST", "/services", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, service.ErrInvalidAPIType.Error()+"\n")
+}
+
 func (s *ProvisionSuite) TestServiceCreateNameExists(c *check.C) {
 	recorder, request := s.makeRequestToCreateHandler(c)
 	s.m.ServeHTTP(recorder, request)
@@ -789,6 +821,79 @@ func (s *ProvisionSuite) TestAddDoc(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *ProvisionSuite) TestUpdateCatalog(c *check.C) {
+	se := service.Service{Name: "mysql", OwnerTeams: []string{s.team.Name}, Doc: "some doc"}
+	se.Create()
+	catalog := service.Catalog{
+		DisplayName: "MySQL",
+		Categories:  []string{"database", "sql"},
+		IconURL:     "https://example.com/mysql.png",
+		SLA:         "99.9% monthly uptime",
+		Costs: []service.PlanCost{
+			{Plan: "small", Amount: 10.5, Currency: "USD", Period: "month"},
+		},
+	}
+	v, err := form.EncodeToValues(&catalog)
+	c.Assert(err, check.IsNil)
+	recorder, request := s.makeRequest("PUT", "/services/mysql/catalog", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var serv service.Service
+	err = s.conn.Services().FindId("mysql").One(&serv)
+	c.Assert(err, check.IsNil)
+	c.Assert(serv.Catalog, check.DeepEquals, &catalog)
+	c.Assert(serv.Doc, check.Equals, "some doc")
+	c.Assert(eventtest.EventDesc{
+		Target: serviceTarget("mysql"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service.update.catalog",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": "mysql"},
+			{"name": "DisplayName", "value": "MySQL"},
+			{"name": "SLA", "value": "99.9% monthly uptime"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *ProvisionSuite) TestUpdateCatalogInvalid(c *check.C) {
+	se := service.Service{Name: "mysql", OwnerTeams: []string{s.team.Name}}
+	se.Create()
+	v := url.Values{}
+	v.Set("IconURL", "mysql.png")
+	recorder, request := s.makeRequest("PUT", "/services/mysql/catalog", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid icon URL \"mysql.png\"\n")
+}
+
+func (s *ProvisionSuite) TestUpdateCatalogUserHasNoAccess(c *check.C) {
+	se := service.Service{Name: "mysql"}
+	se.Create()
+	v := url.Values{}
+	v.Set("DisplayName", "MySQL")
+	recorder, request := s.makeRequest("PUT", "/services/mysql/catalog", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *ProvisionSuite) TestServiceListIncludesCatalog(c *check.C) {
+	catalog := &service.Catalog{DisplayName: "MongoDB", Categories: []string{"database"}}
+	srv := service.Service{Name: "mongodb", OwnerTeams: []string{s.team.Name}, Catalog: catalog}
+	srv.Create()
+	recorder, request := s.makeRequestToServicesHandler(c)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var services []service.ServiceModel
+	err := json.Unmarshal(recorder.Body.Bytes(), &services)
+	c.Assert(err, check.IsNil)
+	c.Assert(services, check.HasLen, 1)
+	c.Assert(services[0].Catalog, check.DeepEquals, catalog)
+}
+
 func (s *ProvisionSuite) TestAddDocUserHasNoAccess(c *check.C) {
 	se := service.Service{Name: "Mysql"}
 	se.Create()
@@ -0,0 +1,183 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const nonTwoFactorSchemeMsg = "Authentication scheme does not support two-factor authentication."
+
+func twoFactorScheme() (auth.TwoFactorScheme, error) {
+	scheme, ok := app.AuthScheme.(auth.TwoFactorScheme)
+	if !ok {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: nonTwoFactorSchemeMsg}
+	}
+	return scheme, nil
+}
+
+func twoFactorEvent(t auth.Token, r *http.Request) (*event.Event, error) {
+	r.ParseForm()
+	delete(r.Form, "code")
+	return event.New(&event.Opts{
+		Target:     userTarget(t.GetUserName()),
+		Kind:       permission.PermUserUpdateTwoFactor,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermUserReadEvents, permission.Context(permission.CtxUser, t.GetUserName())),
+	})
+}
+
+// title: two-factor status
+// path: /users/2fa
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+func twoFactorInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	enabled, err := scheme.TwoFactorEnabled(u)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]bool{"enabled": enabled})
+}
+
+// title: two-factor enroll
+// path: /users/2fa
+// method: POST
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Already enabled
+func twoFactorEnroll(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	enrollment, err := scheme.EnrollTwoFactor(u)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(enrollment)
+}
+
+// title: two-factor confirm
+// path: /users/2fa
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Already enabled
+func twoFactorConfirm(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	code := r.FormValue("code")
+	evt, err := twoFactorEvent(t, r)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	codes, err := scheme.ConfirmTwoFactor(u, t, code)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// title: two-factor disable
+// path: /users/2fa
+// method: DELETE
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+func twoFactorDisable(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		code = r.FormValue("code")
+	}
+	evt, err := twoFactorEvent(t, r)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	return handleAuthError(scheme.DisableTwoFactor(u, code))
+}
+
+// title: two-factor recovery codes
+// path: /users/2fa/recovery-codes
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+func twoFactorRecoveryCodes(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	code := r.FormValue("code")
+	evt, err := twoFactorEvent(t, r)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	codes, err := scheme.RegenerateRecoveryCodes(u, code)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
@@ -0,0 +1,184 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/native"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"gopkg.in/check.v1"
+)
+
+func totpNow(c *check.C, secret string, offset int64) string {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	c.Assert(err, check.IsNil)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30+offset))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0xf
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[off:off+4])&0x7fffffff)%1000000)
+}
+
+func (s *AuthSuite) twoFactorRequest(c *check.C, method, url, body string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *AuthSuite) enrollTwoFactor(c *check.C) string {
+	recorder := s.twoFactorRequest(c, "POST", "/users/2fa", "")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var enrollment auth.TwoFactorEnrollment
+	err := json.NewDecoder(recorder.Body).Decode(&enrollment)
+	c.Assert(err, check.IsNil)
+	return enrollment.Secret
+}
+
+func (s *AuthSuite) TestTwoFactorEnroll(c *check.C) {
+	recorder := s.twoFactorRequest(c, "POST", "/users/2fa", "")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var enrollment auth.TwoFactorEnrollment
+	err := json.NewDecoder(recorder.Body).Decode(&enrollment)
+	c.Assert(err, check.IsNil)
+	c.Assert(enrollment.Secret, check.Not(check.Equals), "")
+	c.Assert(enrollment.URI, check.Matches, "otpauth://totp/.*")
+}
+
+func (s *AuthSuite) TestTwoFactorConfirm(c *check.C) {
+	secret := s.enrollTwoFactor(c)
+	recorder := s.twoFactorRequest(c, "PUT", "/users/2fa", "code="+totpNow(c, secret, 0))
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result map[string][]string
+	err := json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["recovery_codes"], check.HasLen, 10)
+	c.Assert(eventtest.EventDesc{
+		Target: userTarget(s.user.Email),
+		Owner:  s.token.GetUserName(),
+		Kind:   "user.update.two-factor",
+	}, eventtest.HasEvent)
+	recorder = s.twoFactorRequest(c, "GET", "/users/2fa", "")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "{\"enabled\":true}\n")
+}
+
+func (s *AuthSuite) TestTwoFactorConfirmInvalidCode(c *check.C) {
+	s.enrollTwoFactor(c)
+	recorder := s.twoFactorRequest(c, "PUT", "/users/2fa", "code=000000")
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+}
+
+func (s *AuthSuite) TestTwoFactorInfoNotEnrolled(c *check.C) {
+	recorder := s.twoFactorRequest(c, "GET", "/users/2fa", "")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "{\"enabled\":false}\n")
+}
+
+func (s *AuthSuite) TestTwoFactorDisable(c *check.C) {
+	secret := s.enrollTwoFactor(c)
+	recorder := s.twoFactorRequest(c, "PUT", "/users/2fa", "code="+totpNow(c, secret, -1))
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	recorder = s.twoFactorRequest(c, "DELETE", "/users/2fa?code="+totpNow(c, secret, 0), "")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	enabled, err := native.NativeScheme{}.TwoFactorEnabled(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(enabled, check.Equals, false)
+}
+
+func (s *AuthSuite) TestTwoFactorRecoveryCodes(c *check.C) {
+	secret := s.enrollTwoFactor(c)
+	recorder := s.twoFactorRequest(c, "PUT", "/users/2fa", "code="+totpNow(c, secret, -1))
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	recorder = s.twoFactorRequest(c, "POST", "/users/2fa/recovery-codes", "code="+totpNow(c, secret, 0))
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result map[string][]string
+	err := json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["recovery_codes"], check.HasLen, 10)
+}
+
+func (s *AuthSuite) TestTwoFactorUnsupportedScheme(c *check.C) {
+	oldScheme := app.AuthScheme
+	app.AuthScheme = TestScheme{}
+	defer func() { app.AuthScheme = oldScheme }()
+	request, err := http.NewRequest("POST", "/users/2fa", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = twoFactorEnroll(recorder, request, s.token)
+	c.Assert(err, check.ErrorMatches, nonTwoFactorSchemeMsg)
+}
+
+func (s *AuthSuite) TestLoginWithTwoFactorCode(c *check.C) {
+	secret := s.enrollTwoFactor(c)
+	recorder := s.twoFactorRequest(c, "PUT", "/users/2fa", "code="+totpNow(c, secret, -1))
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	request, err := http.NewRequest("POST", "/users/"+s.user.Email+"/tokens", strings.NewReader("password=123456"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, native.ErrTwoFactorCodeRequired.Error()+"\n")
+	body := strings.NewReader("password=123456&otp=" + totpNow(c, secret, 0))
+	request, err = http.NewRequest("POST", "/users/"+s.user.Email+"/tokens", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+}
+
+func (s *AuthSuite) TestTwoFactorPendingTokenOnlyEnrolls(c *check.C) {
+	c.Assert(s.user.Roles, check.Not(check.HasLen), 0)
+	config.Set("auth:two-factor:required-roles", []interface{}{s.user.Roles[0].Name})
+	defer config.Unset("auth:two-factor:required-roles")
+	request, err := http.NewRequest("POST", "/users/"+s.user.Email+"/tokens", strings.NewReader("password=123456"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var loginData map[string]interface{}
+	err = json.NewDecoder(recorder.Body).Decode(&loginData)
+	c.Assert(err, check.IsNil)
+	pendingToken := loginData["token"].(string)
+	for _, method := range []string{"GET", "POST"} {
+		request, err = http.NewRequest(method, "/users/api-key", nil)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+pendingToken)
+		recorder = httptest.NewRecorder()
+		m.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	}
+	request, err = http.NewRequest("GET", "/users/2fa", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+pendingToken)
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+}
@@ -70,6 +70,29 @@ var reserveUserApp = action.Action{
 	MinParams: 2,
 }
 
+// reserveTeamApp reserves the app in the quota of the team owner. Teams
+// without a quota are not limited.
+var reserveTeamApp = action.Action{
+	Name: "reserve-team-app",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app, ok := ctx.Params[0].(*App)
+		if !ok {
+			return nil, errors.New("First parameter must be *App.")
+		}
+		if err := auth.ReserveTeamApp(app.TeamOwner); err != nil {
+			return nil, err
+		}
+		return app.TeamOwner, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		team := ctx.FWResult.(string)
+		if err := auth.ReleaseTeamApp(team); err != nil {
+			log.Errorf("Failed to rollback reserveTeamApp: %s", err)
+		}
+	},
+	MinParams: 1,
+}
+
 // insertApp is an action that inserts an app in the database in Forward and
 // removes it in the Backward.
 //
@@ -145,7 +168,7 @@ var exportEnvironmentsAction = action.Action{
 	},
 	Backward: func(ctx action.BWContext) {
 		app := ctx.Params[0].(*App)
-		AuthScheme.Logout(app.Env["TSURU_APP_TOKEN"].Value)
+		AuthScheme.Logout(app.envValue("TSURU_APP_TOKEN"))
 		app, err := GetByName(app.Name)
 		if err == nil {
 			vars := []string{"TSURU_APPNAME", "TSURU_APPDIR", "TSURU_APP_TOKEN"}
@@ -19,6 +19,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/tsuru/tsuru/action"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
@@ -319,6 +320,7 @@ func CreateApp(app *App, user *auth.User) error {
 	}
 	actions := []*action.Action{
 		&reserveUserApp,
+		&reserveTeamApp,
 		&insertApp,
 		&exportEnvironmentsAction,
 		&createRepository,
@@ -354,6 +356,7 @@ func (app *App) Update(updateData App, w io.Writer) (err error) {
 	}
 	oldPlan := app.Plan
 	oldRouter := app.Router
+	oldTeamOwner := app.TeamOwner
 	if routerName != "" {
 		_, err = router.Get(routerName)
 		if err != nil {
@@ -387,6 +390,17 @@ func (app *App) Update(updateData App, w io.Writer) (err error) {
 	if err != nil {
 		return err
 	}
+	if app.TeamOwner != oldTeamOwner {
+		err = moveTeamQuota(app, oldTeamOwner, app.TeamOwner)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				moveTeamQuota(app, app.TeamOwner, oldTeamOwner)
+			}
+		}()
+	}
 	if app.Router != oldRouter || app.Plan != oldPlan {
 		actions := []*action.Action{
 			&moveRouterUnits,
@@ -505,7 +519,7 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		logErr("Unable to remove app from repository manager", err)
 	}
-	token := app.Env["TSURU_APP_TOKEN"].Value
+	token := app.envValue("TSURU_APP_TOKEN")
 	err = AuthScheme.AppLogout(token)
 	if err != nil {
 		logErr("Unable to remove app token in destroy", err)
@@ -517,6 +531,13 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		logErr("Unable to release app quota", err)
 	}
+	err = auth.ReleaseTeamApp(app.TeamOwner)
+	if err == nil {
+		err = auth.ReleaseTeamUnits(app.TeamOwner, app.Quota.InUse)
+	}
+	if err != nil {
+		logErr("Unable to release team quota", err)
+	}
 	logConn, err := db.LogConn()
 	if err == nil {
 		defer logConn.Close()
@@ -529,6 +550,12 @@ func Delete(app *App, w io.Writer) error {
 	if err == nil {
 		defer conn.Close()
 		err = conn.Apps().Remove(bson.M{"name": appName})
+		if _, envErr := conn.AppEnvVersions().RemoveAll(bson.M{"app": appName}); envErr != nil {
+			logErr("Unable to remove env history", envErr)
+		}
+		if _, policyErr := conn.AppAutoScalePolicies().RemoveAll(bson.M{"app": appName}); policyErr != nil {
+			logErr("Unable to remove auto scale policies", policyErr)
+		}
 	}
 	if err != nil {
 		logErr("Unable to remove app from db", err)
@@ -635,6 +662,10 @@ func (app *App) RemoveUnits(n uint, process string, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	err = updateTeamUnits(app, len(units))
+	if err != nil {
+		log.Errorf("unable to release units from quota of team %q: %s", app.TeamOwner, err)
+	}
 	return conn.Apps().Update(
 		bson.M{"name": app.Name},
 		bson.M{
@@ -700,6 +731,12 @@ func UpdateNodeStatus(nodeData provision.NodeStatusData) ([]UpdateUnitsResult, e
 			log.Errorf("unable to set node status in healer: %s", err)
 		}
 	}
+	if nodeData.Metrics != nil {
+		err = provision.UpdateNodeMetrics(node.Address(), *nodeData.Metrics)
+		if err != nil {
+			log.Errorf("unable to set node metrics: %s", err)
+		}
+	}
 	unitProv, ok := node.Provisioner().(provision.UnitStatusProvisioner)
 	if !ok {
 		return []UpdateUnitsResult{}, nil
@@ -1166,7 +1203,7 @@ func (app *App) GetQuota() quota.Quota {
 	return app.Quota
 }
 
-func (app *App) SetQuotaInUse(inUse int) error {
+func (app *App) SetQuotaInUse(inUse int) (err error) {
 	if inUse < 0 {
 		return errors.New("invalid value, cannot be lesser than 0")
 	}
@@ -1176,6 +1213,17 @@ func (app *App) SetQuotaInUse(inUse int) error {
 			Available: uint(app.Quota.Limit),
 		}
 	}
+	err = updateTeamUnits(app, inUse)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := revertTeamUnits(app, inUse); rollbackErr != nil {
+				log.Errorf("unable to revert quota of team %q: %s", app.TeamOwner, rollbackErr)
+			}
+		}
+	}()
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -1185,7 +1233,11 @@ func (app *App) SetQuotaInUse(inUse int) error {
 	if err == mgo.ErrNotFound {
 		return ErrAppNotFound
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	app.Quota.InUse = inUse
+	return nil
 }
 
 // GetCname returns the cnames of the app.
@@ -1213,6 +1265,17 @@ func (app *App) Envs() map[string]bind.EnvVar {
 	return app.Env
 }
 
+// envValue returns the value of the given environment variable, decrypting
+// it when stored as a secret.
+func (app *App) envValue(name string) string {
+	value, err := secret.Open(app.Env[name].Value)
+	if err != nil {
+		log.Errorf("unable to decrypt env %s of app %s: %s", name, app.Name, err)
+		return ""
+	}
+	return value
+}
+
 // SetEnvs saves a list of environment variables in the app. The publicOnly
 // parameter indicates whether only public variables can be overridden (if set
 // to false, SetEnvs may override a private variable).
@@ -1253,6 +1316,13 @@ func (app *App) setEnvsToApp(setEnvs bind.SetEnvApp, w io.Writer) error {
 			}
 		}
 		if set {
+			if !env.Public {
+				var err error
+				env.Value, err = secret.Seal(env.Value)
+				if err != nil {
+					return err
+				}
+			}
 			app.setEnv(env)
 		}
 	}
@@ -1265,6 +1335,7 @@ func (app *App) setEnvsToApp(setEnvs bind.SetEnvApp, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	app.recordEnvVersion(setEnvs.Owner, 0)
 	if !setEnvs.ShouldRestart {
 		return nil
 	}
@@ -1319,6 +1390,7 @@ func (app *App) unsetEnvsToApp(unsetEnvs bind.UnsetEnvApp, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	app.recordEnvVersion(unsetEnvs.Owner, 0)
 	if !unsetEnvs.ShouldRestart {
 		return nil
 	}
@@ -1359,8 +1431,8 @@ func (app *App) RemoveCName(cnames ...string) error {
 
 func (app *App) parsedTsuruServices() map[string][]bind.ServiceInstance {
 	var tsuruServices map[string][]bind.ServiceInstance
-	if servicesEnv, ok := app.Env[TsuruServicesEnvVar]; ok {
-		json.Unmarshal([]byte(servicesEnv.Value), &tsuruServices)
+	if _, ok := app.Env[TsuruServicesEnvVar]; ok {
+		json.Unmarshal([]byte(app.envValue(TsuruServicesEnvVar)), &tsuruServices)
 	} else {
 		tsuruServices = make(map[string][]bind.ServiceInstance)
 	}
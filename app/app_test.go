@@ -21,6 +21,8 @@ import (
 	"github.com/fsouza/go-dockerclient"
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/app/secret/secrettest"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
@@ -298,6 +300,36 @@ func (s *S) TestCreateAppUserQuotaExceeded(c *check.C) {
 	c.Assert(ok, check.Equals, true)
 }
 
+func (s *S) TestCreateAppTeamQuotaExceeded(c *check.C) {
+	err := auth.ChangeTeamQuota(&s.team, 0, -1)
+	c.Assert(err, check.IsNil)
+	app := App{Name: "america", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&app, s.user)
+	e, ok := err.(*AppCreationError)
+	c.Assert(ok, check.Equals, true)
+	_, ok = e.Err.(*quota.QuotaExceededError)
+	c.Assert(ok, check.Equals, true)
+	user, err := auth.GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Quota.InUse, check.Equals, 0)
+}
+
+func (s *S) TestCreateAppReservesTeamQuota(c *check.C) {
+	err := auth.ChangeTeamQuota(&s.team, 2, -1)
+	c.Assert(err, check.IsNil)
+	app := App{Name: "america", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota.Apps.InUse, check.Equals, 1)
+	err = Delete(&app, nil)
+	c.Assert(err, check.IsNil)
+	team, err = auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota.Apps.InUse, check.Equals, 0)
+}
+
 func (s *S) TestCreateAppTeamOwner(c *check.C) {
 	app := App{Name: "america", Platform: "python", TeamOwner: "tsuruteam"}
 	err := CreateApp(&app, s.user)
@@ -570,6 +602,27 @@ func (s *S) TestAddUnitsQuotaExceeded(c *check.C) {
 	c.Assert(units, check.HasLen, 0)
 }
 
+func (s *S) TestAddUnitsTeamQuotaExceeded(c *check.C) {
+	app := App{Name: "warpaint", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	err = auth.ChangeTeamQuota(&s.team, -1, 3)
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(2, "web", nil)
+	e, ok := err.(*quota.QuotaExceededError)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Available, check.Equals, uint(1))
+	c.Assert(e.Requested, check.Equals, uint(2))
+	dbApp, err := GetByName(app.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Quota.InUse, check.Equals, 2)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota.Units.InUse, check.Equals, 2)
+}
+
 func (s *S) TestAddUnitsMultiple(c *check.C) {
 	app := App{
 		Name: "warpaint", Platform: "ruby",
@@ -786,6 +839,21 @@ func (s *S) TestUpdateNodeStatus(c *check.C) {
 	c.Assert(result, check.DeepEquals, expected)
 }
 
+func (s *S) TestUpdateNodeStatusWithMetrics(c *check.C) {
+	err := s.provisioner.AddNode(provision.AddNodeOptions{
+		Address: "addr1",
+	})
+	c.Assert(err, check.IsNil)
+	_, err = UpdateNodeStatus(provision.NodeStatusData{
+		Addrs:   []string{"addr1"},
+		Metrics: &provision.NodeMetrics{CPU: 75},
+	})
+	c.Assert(err, check.IsNil)
+	metrics, err := provision.NodeMetricsSince([]string{"addr1"}, time.Now().Add(-time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics["addr1"].CPU, check.Equals, 75.0)
+}
+
 func (s *S) TestUpdateNodeStatusNotFound(c *check.C) {
 	a := App{Name: "lapname", Platform: "python", TeamOwner: s.team.Name}
 	err := CreateApp(&a, s.user)
@@ -3224,6 +3292,17 @@ func (s *S) TestSetQuotaInUseNotFound(c *check.C) {
 	c.Assert(err, check.Equals, ErrAppNotFound)
 }
 
+func (s *S) TestSetQuotaInUseNotFoundReleasesTeamQuota(c *check.C) {
+	err := auth.ChangeTeamQuota(&s.team, -1, 10)
+	c.Assert(err, check.IsNil)
+	app := App{Name: "someapp", TeamOwner: s.team.Name, Quota: quota.Quota{Limit: 5}}
+	err = app.SetQuotaInUse(3)
+	c.Assert(err, check.Equals, ErrAppNotFound)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota.Units.InUse, check.Equals, 0)
+}
+
 func (s *S) TestSetQuotaInUseUnlimited(c *check.C) {
 	app := App{Name: "someapp", Quota: quota.Unlimited, TeamOwner: s.team.Name}
 	err := CreateApp(&app, s.user)
@@ -4312,3 +4391,61 @@ func (s *S) TestAppUpdateRouterNotAvailableForPool(c *check.C) {
 		Message: "router \"fake-tls\" is not available for pool \"pool1\"",
 	})
 }
+
+func (s *S) TestSetEnvEncryptsPrivateVariables(c *check.C) {
+	cleanup, err := secrettest.EnableLocalKey()
+	c.Assert(err, check.IsNil)
+	defer cleanup()
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.setEnvsToApp(
+		bind.SetEnvApp{
+			Envs: []bind.EnvVar{
+				{Name: "DATABASE_PASSWORD", Value: "s3cr3t", Public: false},
+				{Name: "DATABASE_HOST", Value: "localhost", Public: true},
+			},
+		}, nil)
+	c.Assert(err, check.IsNil)
+	var dbApp App
+	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&dbApp)
+	c.Assert(err, check.IsNil)
+	password := dbApp.Env["DATABASE_PASSWORD"].Value
+	c.Assert(secret.IsSealed(password), check.Equals, true)
+	value, err := secret.Open(password)
+	c.Assert(err, check.IsNil)
+	c.Assert(value, check.Equals, "s3cr3t")
+	c.Assert(dbApp.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	c.Assert(dbApp.envValue("DATABASE_PASSWORD"), check.Equals, "s3cr3t")
+}
+
+func (s *S) TestAddAndRemoveInstanceWithEncryptedEnvs(c *check.C) {
+	cleanup, err := secrettest.EnableLocalKey()
+	c.Assert(err, check.IsNil)
+	defer cleanup()
+	a := &App{Name: "dark", TeamOwner: s.team.Name}
+	err = CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	instance1 := bind.ServiceInstance{Name: "myinstance", Envs: map[string]string{"DATABASE_HOST": "localhost"}}
+	instance2 := bind.ServiceInstance{Name: "otherinstance", Envs: map[string]string{"DATABASE_USER": "root"}}
+	for _, instance := range []bind.ServiceInstance{instance1, instance2} {
+		err = a.AddInstance(bind.InstanceApp{ServiceName: "myservice", Instance: instance}, nil)
+		c.Assert(err, check.IsNil)
+	}
+	a, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(secret.IsSealed(a.Env[TsuruServicesEnvVar].Value), check.Equals, true)
+	c.Assert(a.parsedTsuruServices(), check.DeepEquals, map[string][]bind.ServiceInstance{
+		"myservice": {instance1, instance2},
+	})
+	err = a.RemoveInstance(bind.InstanceApp{ServiceName: "myservice", Instance: instance1}, nil)
+	c.Assert(err, check.IsNil)
+	a, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.parsedTsuruServices(), check.DeepEquals, map[string][]bind.ServiceInstance{
+		"myservice": {instance2},
+	})
+	_, ok := a.Env["DATABASE_HOST"]
+	c.Assert(ok, check.Equals, false)
+	c.Assert(a.envValue("DATABASE_USER"), check.Equals, "root")
+}
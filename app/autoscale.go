@@ -0,0 +1,405 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	UnitsAutoScaleEventKind = "units-autoscale"
+
+	defaultScaleUpCooldown   = 3 * time.Minute
+	defaultScaleDownCooldown = 5 * time.Minute
+
+	// autoScaleTolerance is how far from the target the utilization may be
+	// before the number of units is changed.
+	autoScaleTolerance = 0.1
+)
+
+var ErrAutoScalePolicyNotFound = errors.New("auto scale policy not found")
+
+// AutoScalePolicy controls the number of units of a process of an app,
+// keeping it between MinUnits and MaxUnits while trying to keep the average
+// utilization of the units near the targets. TargetCPU is the percentage of
+// a CPU core used by each unit, and TargetMemory the percentage of the plan
+// memory. Cooldowns are in seconds.
+type AutoScalePolicy struct {
+	App               string
+	Process           string
+	MinUnits          int
+	MaxUnits          int
+	TargetCPU         float64
+	TargetMemory      float64
+	ScaleUpCooldown   int
+	ScaleDownCooldown int
+	LastScale         time.Time `bson:",omitempty"`
+}
+
+// UnitsAutoScaleResult is the outcome of evaluating an auto scale policy,
+// stored in the auto scale events.
+type UnitsAutoScaleResult struct {
+	Process   string
+	FromUnits int
+	ToUnits   int
+	CPU       float64
+	Memory    float64
+	Reason    string
+}
+
+func (p *AutoScalePolicy) validate(app *App) error {
+	if p.MinUnits < 1 {
+		return errors.New("min units must be greater than 0")
+	}
+	if p.MaxUnits < p.MinUnits {
+		return errors.New("max units must be greater than or equal to min units")
+	}
+	if p.TargetCPU < 0 || p.TargetMemory < 0 {
+		return errors.New("targets must not be negative")
+	}
+	if p.TargetCPU == 0 && p.TargetMemory == 0 {
+		return errors.New("either target cpu or target memory must be set")
+	}
+	if p.TargetMemory > 0 && app.Plan.Memory <= 0 {
+		return errors.New("target memory requires the app plan to have a memory limit")
+	}
+	if p.ScaleUpCooldown < 0 || p.ScaleDownCooldown < 0 {
+		return errors.New("cooldowns must not be negative")
+	}
+	return nil
+}
+
+func (p *AutoScalePolicy) cooldown(scaleUp bool) time.Duration {
+	if scaleUp {
+		if p.ScaleUpCooldown > 0 {
+			return time.Duration(p.ScaleUpCooldown) * time.Second
+		}
+		return defaultScaleUpCooldown
+	}
+	if p.ScaleDownCooldown > 0 {
+		return time.Duration(p.ScaleDownCooldown) * time.Second
+	}
+	return defaultScaleDownCooldown
+}
+
+// desiredUnits returns the number of units needed for the average
+// utilization to reach the targets, limited by the policy.
+func (p *AutoScalePolicy) desiredUnits(current int, cpu, memory float64) (int, string) {
+	desired, reason := current, ""
+	if current > 0 {
+		desired = 0
+		for _, m := range []struct {
+			name          string
+			value, target float64
+		}{{"cpu", cpu, p.TargetCPU}, {"memory", memory, p.TargetMemory}} {
+			if m.target <= 0 {
+				continue
+			}
+			n := current
+			ratio := m.value / m.target
+			if math.Abs(ratio-1) > autoScaleTolerance {
+				n = int(math.Ceil(float64(current) * ratio))
+			}
+			if n > desired {
+				desired = n
+				reason = fmt.Sprintf("%s usage is %.2f%%, target is %.2f%%", m.name, m.value, m.target)
+			}
+		}
+	}
+	if desired < p.MinUnits {
+		return p.MinUnits, fmt.Sprintf("min units is %d", p.MinUnits)
+	}
+	if desired > p.MaxUnits {
+		return p.MaxUnits, fmt.Sprintf("%s, max units is %d", reason, p.MaxUnits)
+	}
+	return desired, reason
+}
+
+// SetAutoScalePolicy creates or replaces the auto scale policy of a process
+// of the app. The process must exist in the current image of the app and
+// the app provisioner must report the units metrics.
+func (app *App) SetAutoScalePolicy(policy AutoScalePolicy) error {
+	policy.App = app.Name
+	policy.LastScale = time.Time{}
+	err := policy.validate(app)
+	if err != nil {
+		return &InvalidAutoScalePolicyError{Msg: err.Error()}
+	}
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	if _, ok := prov.(provision.MetricsProvisioner); !ok {
+		return &InvalidAutoScalePolicyError{Msg: fmt.Sprintf("provisioner %q doesn't report units metrics", prov.GetName())}
+	}
+	if policy.Process == "" {
+		return &InvalidAutoScalePolicyError{Msg: "process must be set"}
+	}
+	processes, err := image.AllAppProcesses(app.Name)
+	if err != nil {
+		return &InvalidAutoScalePolicyError{Msg: "unable to list the app processes, the app must be deployed first"}
+	}
+	found := false
+	for _, process := range processes {
+		if process == policy.Process {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return &InvalidAutoScalePolicyError{Msg: fmt.Sprintf("process %q not found in app", policy.Process)}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.AppAutoScalePolicies().Upsert(bson.M{"app": app.Name, "process": policy.Process}, policy)
+	return err
+}
+
+// AutoScalePolicies returns the auto scale policies of the app.
+func (app *App) AutoScalePolicies() ([]AutoScalePolicy, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var policies []AutoScalePolicy
+	err = conn.AppAutoScalePolicies().Find(bson.M{"app": app.Name}).Sort("process").All(&policies)
+	return policies, err
+}
+
+// RemoveAutoScalePolicy removes the auto scale policy of a process of the app.
+func (app *App) RemoveAutoScalePolicy(process string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.AppAutoScalePolicies().Remove(bson.M{"app": app.Name, "process": process})
+	if err == mgo.ErrNotFound {
+		return ErrAutoScalePolicyNotFound
+	}
+	return err
+}
+
+type InvalidAutoScalePolicyError struct {
+	Msg string
+}
+
+func (e *InvalidAutoScalePolicyError) Error() string {
+	return fmt.Sprintf("invalid auto scale policy: %s", e.Msg)
+}
+
+// UnitsAutoScaler periodically evaluates the auto scale policies of all
+// apps, adding and removing units as needed.
+type UnitsAutoScaler struct {
+	RunInterval time.Duration
+	done        chan bool
+}
+
+// InitializeUnitsAutoScale starts the units auto scaler, when enabled by the
+// units-autoscale:enabled setting.
+func InitializeUnitsAutoScale() {
+	enabled, _ := config.GetBool("units-autoscale:enabled")
+	if !enabled {
+		return
+	}
+	runInterval, _ := config.GetInt("units-autoscale:run-interval")
+	scaler := &UnitsAutoScaler{
+		RunInterval: time.Duration(runInterval) * time.Second,
+		done:        make(chan bool),
+	}
+	if scaler.RunInterval == 0 {
+		scaler.RunInterval = time.Minute
+	}
+	shutdown.Register(scaler)
+	go scaler.run()
+}
+
+func (s *UnitsAutoScaler) run() {
+	for {
+		err := RunUnitsAutoScaleOnce()
+		if err != nil {
+			log.Errorf("[units autoscale] %s", err)
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.RunInterval):
+		}
+	}
+}
+
+func (s *UnitsAutoScaler) Shutdown() {
+	s.done <- true
+}
+
+func (s *UnitsAutoScaler) String() string {
+	return "units auto scale"
+}
+
+// RunUnitsAutoScaleOnce evaluates the auto scale policies of all apps once.
+func RunUnitsAutoScaleOnce() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	var policies []AutoScalePolicy
+	err = conn.AppAutoScalePolicies().Find(nil).All(&policies)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	for i := range policies {
+		err = runAutoScalePolicy(&policies[i])
+		if err != nil {
+			log.Errorf("[units autoscale] unable to scale process %q of app %q: %s", policies[i].Process, policies[i].App, err)
+		}
+	}
+	return nil
+}
+
+func runAutoScalePolicy(policy *AutoScalePolicy) error {
+	app, err := GetByName(policy.App)
+	if err != nil {
+		return err
+	}
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	metricsProv, ok := prov.(provision.MetricsProvisioner)
+	if !ok {
+		return errors.Errorf("provisioner %q doesn't report units metrics", prov.GetName())
+	}
+	result, err := evaluateAutoScalePolicy(app, metricsProv, policy)
+	if err != nil || result == nil {
+		return err
+	}
+	locked, err := AcquireApplicationLock(app.Name, InternalAppName, "units auto scale")
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer ReleaseApplicationLock(app.Name)
+	// The policy, the units and the metrics are loaded again with the app
+	// locked, as another instance of the auto scaler may have scaled the
+	// process since they were read.
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.AppAutoScalePolicies().Find(bson.M{"app": policy.App, "process": policy.Process}).One(policy)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	result, err = evaluateAutoScalePolicy(app, metricsProv, policy)
+	if err != nil || result == nil {
+		return err
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: app.Name},
+		InternalKind: UnitsAutoScaleEventKind,
+		CustomData:   policy,
+		Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permission.CtxTeam, app.Teams),
+			permission.Context(permission.CtxApp, app.Name),
+			permission.Context(permission.CtxPool, app.Pool),
+		)...),
+	})
+	if err != nil {
+		return err
+	}
+	evt.Logf("scaling process %q from %d to %d units: %s", policy.Process, result.FromUnits, result.ToUnits, result.Reason)
+	if result.ToUnits > result.FromUnits {
+		err = app.AddUnits(uint(result.ToUnits-result.FromUnits), policy.Process, evt)
+	} else {
+		err = app.RemoveUnits(uint(result.FromUnits-result.ToUnits), policy.Process, evt)
+	}
+	if doneErr := evt.DoneCustomData(err, result); doneErr != nil {
+		log.Errorf("[units autoscale] unable to finish event: %s", doneErr)
+	}
+	if err != nil {
+		return err
+	}
+	return conn.AppAutoScalePolicies().Update(
+		bson.M{"app": policy.App, "process": policy.Process},
+		bson.M{"$set": bson.M{"lastscale": time.Now().UTC()}},
+	)
+}
+
+// evaluateAutoScalePolicy returns the change in the number of units of the
+// process required by the policy, or nil when no change is needed or the
+// policy is in cooldown.
+func evaluateAutoScalePolicy(app *App, metricsProv provision.MetricsProvisioner, policy *AutoScalePolicy) (*UnitsAutoScaleResult, error) {
+	units, err := app.Units()
+	if err != nil {
+		return nil, err
+	}
+	current := 0
+	for _, u := range units {
+		if u.ProcessName == policy.Process {
+			current++
+		}
+	}
+	metrics, err := metricsProv.UnitsMetrics(app)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get units metrics")
+	}
+	var cpu, memory float64
+	var count int
+	for _, m := range metrics {
+		if m.Process != policy.Process {
+			continue
+		}
+		count++
+		cpu += m.CPU
+		if app.Plan.Memory > 0 {
+			memory += float64(m.Memory) / float64(app.Plan.Memory) * 100
+		}
+	}
+	if count > 0 {
+		cpu /= float64(count)
+		memory /= float64(count)
+	} else if current >= policy.MinUnits {
+		return nil, nil
+	}
+	desired, reason := policy.desiredUnits(current, cpu, memory)
+	if desired == current {
+		return nil, nil
+	}
+	if time.Since(policy.LastScale) < policy.cooldown(desired > current) {
+		return nil, nil
+	}
+	return &UnitsAutoScaleResult{
+		Process:   policy.Process,
+		FromUnits: current,
+		ToUnits:   desired,
+		CPU:       cpu,
+		Memory:    memory,
+		Reason:    reason,
+	}, nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+)
+
+func saveAppProcesses(c *check.C, appName string, processes ...string) {
+	procs := map[string]interface{}{}
+	for _, p := range processes {
+		procs[p] = "run " + p
+	}
+	imgName := "tsuru/app-" + appName + ":v1"
+	err := image.SaveImageCustomData(imgName, map[string]interface{}{"processes": procs})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(appName, imgName)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAutoScalePolicyDesiredUnits(c *check.C) {
+	policy := AutoScalePolicy{MinUnits: 2, MaxUnits: 10, TargetCPU: 50}
+	desired, reason := policy.desiredUnits(4, 100, 0)
+	c.Assert(desired, check.Equals, 8)
+	c.Assert(reason, check.Equals, "cpu usage is 100.00%, target is 50.00%")
+	desired, _ = policy.desiredUnits(4, 52, 0)
+	c.Assert(desired, check.Equals, 4)
+	desired, _ = policy.desiredUnits(4, 20, 0)
+	c.Assert(desired, check.Equals, 2)
+	desired, reason = policy.desiredUnits(4, 5, 0)
+	c.Assert(desired, check.Equals, 2)
+	c.Assert(reason, check.Equals, "min units is 2")
+	desired, reason = policy.desiredUnits(8, 100, 0)
+	c.Assert(desired, check.Equals, 10)
+	c.Assert(reason, check.Equals, "cpu usage is 100.00%, target is 50.00%, max units is 10")
+	desired, _ = policy.desiredUnits(0, 0, 0)
+	c.Assert(desired, check.Equals, 2)
+	policy.TargetMemory = 50
+	desired, reason = policy.desiredUnits(4, 50, 75)
+	c.Assert(desired, check.Equals, 6)
+	c.Assert(reason, check.Equals, "memory usage is 75.00%, target is 50.00%")
+}
+
+func (s *S) TestSetAutoScalePolicy(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	saveAppProcesses(c, a.Name, "web", "worker")
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "worker", MinUnits: 1, MaxUnits: 2, TargetMemory: 80})
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "web", MinUnits: 2, MaxUnits: 6, TargetCPU: 60})
+	c.Assert(err, check.IsNil)
+	policies, err := a.AutoScalePolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.DeepEquals, []AutoScalePolicy{
+		{App: "myapp", Process: "web", MinUnits: 2, MaxUnits: 6, TargetCPU: 60},
+		{App: "myapp", Process: "worker", MinUnits: 1, MaxUnits: 2, TargetMemory: 80},
+	})
+	err = a.RemoveAutoScalePolicy("worker")
+	c.Assert(err, check.IsNil)
+	err = a.RemoveAutoScalePolicy("worker")
+	c.Assert(err, check.Equals, ErrAutoScalePolicyNotFound)
+	policies, err = a.AutoScalePolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.HasLen, 1)
+}
+
+func (s *S) TestSetAutoScalePolicyInvalid(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	saveAppProcesses(c, a.Name, "web", "worker")
+	tests := []struct {
+		policy AutoScalePolicy
+		msg    string
+	}{
+		{AutoScalePolicy{MaxUnits: 2, TargetCPU: 50}, "min units must be greater than 0"},
+		{AutoScalePolicy{MinUnits: 3, MaxUnits: 2, TargetCPU: 50}, "max units must be greater than or equal to min units"},
+		{AutoScalePolicy{MinUnits: 1, MaxUnits: 2}, "either target cpu or target memory must be set"},
+		{AutoScalePolicy{MinUnits: 1, MaxUnits: 2, TargetCPU: 50, ScaleUpCooldown: -1}, "cooldowns must not be negative"},
+		{AutoScalePolicy{MinUnits: 1, MaxUnits: 2, TargetCPU: 50}, "process must be set"},
+		{AutoScalePolicy{Process: "other", MinUnits: 1, MaxUnits: 2, TargetCPU: 50}, `process "other" not found in app`},
+	}
+	for _, tt := range tests {
+		err = a.SetAutoScalePolicy(tt.policy)
+		c.Assert(err, check.FitsTypeOf, &InvalidAutoScalePolicyError{})
+		c.Assert(err, check.ErrorMatches, "invalid auto scale policy: "+tt.msg)
+	}
+	a.Plan.Memory = 0
+	err = a.SetAutoScalePolicy(AutoScalePolicy{MinUnits: 1, MaxUnits: 2, TargetMemory: 50})
+	c.Assert(err, check.ErrorMatches, "invalid auto scale policy: target memory requires the app plan to have a memory limit")
+}
+
+func (s *S) TestSetAutoScalePolicyNotDeployed(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 2, TargetCPU: 50})
+	c.Assert(err, check.FitsTypeOf, &InvalidAutoScalePolicyError{})
+	c.Assert(err, check.ErrorMatches, "invalid auto scale policy: unable to list the app processes, the app must be deployed first")
+}
+
+type noMetricsProvisioner struct {
+	provision.Provisioner
+}
+
+func (s *S) TestSetAutoScalePolicyProvisionerWithoutMetrics(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	saveAppProcesses(c, a.Name, "web")
+	a.provisioner = noMetricsProvisioner{Provisioner: s.provisioner}
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 2, TargetCPU: 50})
+	c.Assert(err, check.FitsTypeOf, &InvalidAutoScalePolicyError{})
+	c.Assert(err, check.ErrorMatches, `invalid auto scale policy: provisioner "fake" doesn't report units metrics`)
+}
+
+func (s *S) TestRunUnitsAutoScaleOnce(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	saveAppProcesses(c, a.Name, "web", "worker")
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareUnitsMetrics(&a, []provision.UnitMetrics{
+		{ID: units[0].ID, Process: "web", CPU: 90},
+		{ID: units[1].ID, Process: "web", CPU: 110},
+		{ID: "other", Process: "worker", CPU: 5},
+	})
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50})
+	c.Assert(err, check.IsNil)
+	err = RunUnitsAutoScaleOnce()
+	c.Assert(err, check.IsNil)
+	units, err = a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 4)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:   UnitsAutoScaleEventKind,
+		EndCustomData: map[string]interface{}{
+			"process":   "web",
+			"fromunits": 2,
+			"tounits":   4,
+			"reason":    "cpu usage is 100.00%, target is 50.00%",
+		},
+	}, eventtest.HasEvent)
+	policies, err := a.AutoScalePolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies[0].LastScale.IsZero(), check.Equals, false)
+	err = RunUnitsAutoScaleOnce()
+	c.Assert(err, check.IsNil)
+	units, err = a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 4)
+}
+
+func (s *S) TestRunUnitsAutoScaleOnceScaleDown(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	saveAppProcesses(c, a.Name, "web", "worker")
+	err = a.AddUnits(4, "web", nil)
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareUnitsMetrics(&a, []provision.UnitMetrics{
+		{Process: "web", Memory: 128},
+		{Process: "web", Memory: 128},
+		{Process: "web", Memory: 128},
+		{Process: "web", Memory: 128},
+	})
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 5, TargetMemory: 50})
+	c.Assert(err, check.IsNil)
+	err = RunUnitsAutoScaleOnce()
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 1)
+}
+
+func (s *S) TestRunUnitsAutoScaleOnceRespectsCooldown(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	saveAppProcesses(c, a.Name, "web", "worker")
+	err = a.AddUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareUnitsMetrics(&a, []provision.UnitMetrics{{Process: "web", CPU: 100}})
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50})
+	c.Assert(err, check.IsNil)
+	err = s.conn.AppAutoScalePolicies().Update(map[string]interface{}{"app": "myapp"},
+		map[string]interface{}{"$set": map[string]interface{}{"lastscale": time.Now().UTC()}})
+	c.Assert(err, check.IsNil)
+	err = RunUnitsAutoScaleOnce()
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 1)
+}
+
+func (s *S) TestRunAutoScalePolicyReloadsPolicyAfterLocking(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	saveAppProcesses(c, a.Name, "web")
+	err = a.AddUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareUnitsMetrics(&a, []provision.UnitMetrics{{Process: "web", CPU: 100}})
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50})
+	c.Assert(err, check.IsNil)
+	policies, err := a.AutoScalePolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.HasLen, 1)
+	err = s.conn.AppAutoScalePolicies().Update(map[string]interface{}{"app": "myapp"},
+		map[string]interface{}{"$set": map[string]interface{}{"lastscale": time.Now().UTC()}})
+	c.Assert(err, check.IsNil)
+	err = runAutoScalePolicy(&policies[0])
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 1)
+}
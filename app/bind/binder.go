@@ -57,12 +57,14 @@ type SetEnvApp struct {
 	Envs          []EnvVar
 	PublicOnly    bool
 	ShouldRestart bool
+	Owner         string
 }
 
 type UnsetEnvApp struct {
 	VariableNames []string
 	PublicOnly    bool
 	ShouldRestart bool
+	Owner         string
 }
 
 type InstanceApp struct {
@@ -0,0 +1,338 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MaskedEnvValue replaces the value of private environment variables
+// whenever they're displayed to users.
+const MaskedEnvValue = "*** (private variable)"
+
+const (
+	EnvChangeAdded   = "added"
+	EnvChangeChanged = "changed"
+	EnvChangeRemoved = "removed"
+
+	maxEnvVersionRetries = 3
+
+	// redactedEnvValue replaces the value of private variables in the
+	// history when there's no key provider configured to seal them.
+	redactedEnvValue = "*** (redacted)"
+)
+
+var ErrEnvVersionNotFound = errors.New("environment version not found")
+
+// internalEnvs are managed by tsuru itself and are never touched when
+// restoring a previous version of the environment variables.
+var internalEnvs = map[string]bool{
+	"TSURU_APPNAME":     true,
+	"TSURU_APPDIR":      true,
+	"TSURU_APP_TOKEN":   true,
+	TsuruServicesEnvVar: true,
+}
+
+// EnvVersion is a snapshot of the environment variables of an app, saved
+// every time they're changed. Variables managed by tsuru or injected by
+// service instances are not part of the snapshot and private values are
+// sealed, or redacted when no key provider is configured.
+type EnvVersion struct {
+	App          string
+	Version      int
+	Envs         map[string]bind.EnvVar
+	Owner        string
+	Timestamp    time.Time
+	RestoredFrom int `bson:",omitempty"`
+}
+
+// EnvChange describes the change of a single environment variable between
+// two versions. Values of private variables are masked.
+type EnvChange struct {
+	Name     string
+	Action   string
+	OldValue string `json:",omitempty"`
+	NewValue string `json:",omitempty"`
+	Public   bool
+}
+
+// EnvHistoryEntry is a version of the environment variables of an app along
+// with the changes it introduced over the previous version.
+type EnvHistoryEntry struct {
+	Version      int
+	Owner        string
+	Timestamp    time.Time
+	RestoredFrom int `json:",omitempty"`
+	Changes      []EnvChange
+}
+
+// saveEnvVersion records the current environment variables of the app as a
+// new version. Nothing is saved when they match the latest version, which
+// happens when only variables left out of the history were changed.
+func (app *App) saveEnvVersion(owner string, restoredFrom int) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	envs, err := historyEnvs(app.Env)
+	if err != nil {
+		return err
+	}
+	coll := conn.AppEnvVersions()
+	for i := 0; ; i++ {
+		var last EnvVersion
+		err = coll.Find(bson.M{"app": app.Name}).Sort("-version").One(&last)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		if err == nil && len(diffEnvs(last.Envs, envs)) == 0 {
+			return nil
+		}
+		err = coll.Insert(EnvVersion{
+			App:          app.Name,
+			Version:      last.Version + 1,
+			Envs:         envs,
+			Owner:        owner,
+			Timestamp:    time.Now().UTC(),
+			RestoredFrom: restoredFrom,
+		})
+		if !mgo.IsDup(err) || i == maxEnvVersionRetries {
+			return err
+		}
+	}
+}
+
+// historyEnvs returns the variables kept in the environment history. The ones
+// managed by tsuru or injected by service instances hold credentials that
+// are rotated and never restored, so they're left out.
+func historyEnvs(envs map[string]bind.EnvVar) (map[string]bind.EnvVar, error) {
+	result := make(map[string]bind.EnvVar, len(envs))
+	for name, env := range envs {
+		if internalEnvs[name] || env.InstanceName != "" {
+			continue
+		}
+		if !env.Public && !secret.IsSealed(env.Value) {
+			if secret.Enabled() {
+				value, err := secret.Seal(env.Value)
+				if err != nil {
+					return nil, err
+				}
+				env.Value = value
+			} else {
+				env.Value = redactedEnvValue
+			}
+		}
+		result[name] = env
+	}
+	return result, nil
+}
+
+// recordEnvVersion saves a new version of the app environment variables,
+// logging failures instead of returning them, as the variables are already
+// saved at this point.
+func (app *App) recordEnvVersion(owner string, restoredFrom int) {
+	err := app.saveEnvVersion(owner, restoredFrom)
+	if err != nil {
+		log.Errorf("unable to save env version for app %s: %s", app.Name, err)
+	}
+}
+
+// EnvVersion returns the given version of the app environment variables.
+func (app *App) EnvVersion(version int) (*EnvVersion, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var envVersion EnvVersion
+	err = conn.AppEnvVersions().Find(bson.M{"app": app.Name, "version": version}).One(&envVersion)
+	if err == mgo.ErrNotFound {
+		return nil, ErrEnvVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &envVersion, nil
+}
+
+// EnvHistory returns the latest versions of the app environment variables,
+// newest first, each one with the changes it made over the previous version.
+// A limit lower than or equal to zero returns the whole history.
+func (app *App) EnvHistory(limit int) ([]EnvHistoryEntry, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := conn.AppEnvVersions().Find(bson.M{"app": app.Name}).Sort("-version")
+	if limit > 0 {
+		query = query.Limit(limit + 1)
+	}
+	var versions []EnvVersion
+	err = query.All(&versions)
+	if err != nil {
+		return nil, err
+	}
+	var history []EnvHistoryEntry
+	for i, v := range versions {
+		if limit > 0 && i == limit {
+			break
+		}
+		var previous map[string]bind.EnvVar
+		if i+1 < len(versions) {
+			previous = versions[i+1].Envs
+		}
+		history = append(history, EnvHistoryEntry{
+			Version:      v.Version,
+			Owner:        v.Owner,
+			Timestamp:    v.Timestamp,
+			RestoredFrom: v.RestoredFrom,
+			Changes:      diffEnvs(previous, v.Envs),
+		})
+	}
+	return history, nil
+}
+
+// diffEnvs returns the changes between two sets of environment variables,
+// sorted by name. Sealed values are compared by their plain content, as
+// sealing the same value twice yields different ciphertexts. Changes to
+// redacted values can't be detected.
+func diffEnvs(old, new map[string]bind.EnvVar) []EnvChange {
+	var changes []EnvChange
+	for name, newEnv := range new {
+		oldEnv, ok := old[name]
+		if !ok {
+			changes = append(changes, EnvChange{
+				Name:     name,
+				Action:   EnvChangeAdded,
+				NewValue: displayEnvValue(newEnv),
+				Public:   newEnv.Public,
+			})
+			continue
+		}
+		if oldEnv.Public == newEnv.Public && openEnvValue(oldEnv) == openEnvValue(newEnv) {
+			continue
+		}
+		changes = append(changes, EnvChange{
+			Name:     name,
+			Action:   EnvChangeChanged,
+			OldValue: displayEnvValue(oldEnv),
+			NewValue: displayEnvValue(newEnv),
+			Public:   newEnv.Public,
+		})
+	}
+	for name, oldEnv := range old {
+		if _, ok := new[name]; !ok {
+			changes = append(changes, EnvChange{
+				Name:     name,
+				Action:   EnvChangeRemoved,
+				OldValue: displayEnvValue(oldEnv),
+				Public:   oldEnv.Public,
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+func openEnvValue(env bind.EnvVar) string {
+	value, err := secret.Open(env.Value)
+	if err != nil {
+		return env.Value
+	}
+	return value
+}
+
+func displayEnvValue(env bind.EnvVar) string {
+	if env.Public {
+		return env.Value
+	}
+	return MaskedEnvValue
+}
+
+// RestoreEnvs replaces the environment variables of the app with the ones
+// saved in the given version, recording the result as a new version.
+// Variables managed by tsuru or injected by service instances are kept
+// as they currently are, since bindings may have changed since then.
+// Redacted private variables keep their current value and are not restored
+// when they've been removed since then.
+func (app *App) RestoreEnvs(version int, owner string, shouldRestart bool, w io.Writer) error {
+	envVersion, err := app.EnvVersion(version)
+	if err != nil {
+		return err
+	}
+	envs := make(map[string]bind.EnvVar)
+	var skipped []string
+	for name, env := range app.Env {
+		if internalEnvs[name] || env.InstanceName != "" {
+			envs[name] = env
+		}
+	}
+	for name, env := range envVersion.Envs {
+		if internalEnvs[name] || env.InstanceName != "" {
+			continue
+		}
+		if _, ok := envs[name]; ok {
+			continue
+		}
+		if env.Value == redactedEnvValue {
+			current, ok := app.Env[name]
+			if !ok {
+				skipped = append(skipped, name)
+				continue
+			}
+			env.Value = current.Value
+		}
+		envs[name] = env
+	}
+	if w != nil {
+		fmt.Fprintf(w, "---- Restoring environment variables from version %d ----\n", version)
+		if len(skipped) > 0 {
+			sort.Strings(skipped)
+			fmt.Fprintf(w, "  ---> Private variables not stored in the history were not restored: %s\n", strings.Join(skipped, ", "))
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"env": envs}})
+	if err != nil {
+		return err
+	}
+	app.Env = envs
+	app.recordEnvVersion(owner, version)
+	if !shouldRestart {
+		return nil
+	}
+	units, err := app.GetUnits()
+	if err != nil {
+		return err
+	}
+	if len(units) == 0 {
+		return nil
+	}
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	return prov.Restart(app, "", w)
+}
@@ -0,0 +1,226 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/app/secret/secrettest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetAndUnsetEnvsRecordEnvVersions(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{
+			{Name: "DATABASE_HOST", Value: "localhost", Public: true},
+			{Name: "DATABASE_PASSWORD", Value: "secret", Public: false},
+		},
+		Owner: "someone@tsuru.io",
+	}, nil)
+	c.Assert(err, check.IsNil)
+	err = a.UnsetEnvs(bind.UnsetEnvApp{
+		VariableNames: []string{"DATABASE_HOST"},
+		Owner:         "other@tsuru.io",
+	}, nil)
+	c.Assert(err, check.IsNil)
+	history, err := a.EnvHistory(0)
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 3)
+	c.Assert(history[0].Version, check.Equals, 3)
+	c.Assert(history[0].Owner, check.Equals, "other@tsuru.io")
+	c.Assert(history[0].Changes, check.DeepEquals, []EnvChange{
+		{Name: "DATABASE_HOST", Action: EnvChangeRemoved, OldValue: "localhost", Public: true},
+	})
+	c.Assert(history[1].Version, check.Equals, 2)
+	c.Assert(history[1].Owner, check.Equals, "someone@tsuru.io")
+	c.Assert(history[1].Changes, check.DeepEquals, []EnvChange{
+		{Name: "DATABASE_HOST", Action: EnvChangeAdded, NewValue: "localhost", Public: true},
+		{Name: "DATABASE_PASSWORD", Action: EnvChangeAdded, NewValue: MaskedEnvValue},
+	})
+	c.Assert(history[2].Version, check.Equals, 1)
+	c.Assert(history[2].Changes, check.HasLen, 0)
+}
+
+func (s *S) TestSetEnvsSkipsUnchangedEnvVersions(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "MYSQL_PASSWORD", Value: "s3cr3t", InstanceName: "mydb"}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	history, err := a.EnvHistory(0)
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 2)
+	c.Assert(history[0].Version, check.Equals, 2)
+}
+
+func (s *S) TestEnvVersionLeavesOutManagedAndRedactsPrivateEnvs(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{
+			{Name: "DATABASE_HOST", Value: "localhost", Public: true},
+			{Name: "DATABASE_PASSWORD", Value: "secret", Public: false},
+			{Name: "MYSQL_PASSWORD", Value: "s3cr3t", InstanceName: "mydb"},
+		},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	version, err := a.EnvVersion(2)
+	c.Assert(err, check.IsNil)
+	c.Assert(version.Envs, check.DeepEquals, map[string]bind.EnvVar{
+		"DATABASE_HOST":     {Name: "DATABASE_HOST", Value: "localhost", Public: true},
+		"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: redactedEnvValue},
+	})
+}
+
+func (s *S) TestEnvVersionSealsPrivateEnvs(c *check.C) {
+	cleanup, err := secrettest.EnableLocalKey()
+	c.Assert(err, check.IsNil)
+	defer cleanup()
+	envs, err := historyEnvs(map[string]bind.EnvVar{
+		"TSURU_APP_TOKEN":   {Name: "TSURU_APP_TOKEN", Value: "123"},
+		"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: "secret"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(envs, check.HasLen, 1)
+	value := envs["DATABASE_PASSWORD"].Value
+	c.Assert(secret.IsSealed(value), check.Equals, true)
+	plain, err := secret.Open(value)
+	c.Assert(err, check.IsNil)
+	c.Assert(plain, check.Equals, "secret")
+}
+
+func (s *S) TestEnvHistoryLimit(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	for _, value := range []string{"1", "2", "3"} {
+		err = a.SetEnvs(bind.SetEnvApp{
+			Envs: []bind.EnvVar{{Name: "COUNTER", Value: value, Public: true}},
+		}, nil)
+		c.Assert(err, check.IsNil)
+	}
+	history, err := a.EnvHistory(2)
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 2)
+	c.Assert(history[0].Version, check.Equals, 4)
+	c.Assert(history[0].Changes, check.DeepEquals, []EnvChange{
+		{Name: "COUNTER", Action: EnvChangeChanged, OldValue: "2", NewValue: "3", Public: true},
+	})
+	c.Assert(history[1].Version, check.Equals, 3)
+	c.Assert(history[1].Changes, check.DeepEquals, []EnvChange{
+		{Name: "COUNTER", Action: EnvChangeChanged, OldValue: "1", NewValue: "2", Public: true},
+	})
+}
+
+func (s *S) TestRestoreEnvs(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{
+			{Name: "DATABASE_HOST", Value: "remotehost", Public: true},
+			{Name: "DEBUG", Value: "1", Public: true},
+			{Name: "MYSQL_HOST", Value: "mysql.tsuru.io", InstanceName: "mydb"},
+		},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	err = a.RestoreEnvs(2, "someone@tsuru.io", false, nil)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	c.Assert(dbApp.Env["MYSQL_HOST"].Value, check.Equals, "mysql.tsuru.io")
+	c.Assert(dbApp.Env["TSURU_APPNAME"].Value, check.Equals, "myapp")
+	_, ok := dbApp.Env["DEBUG"]
+	c.Assert(ok, check.Equals, false)
+	history, err := a.EnvHistory(1)
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 1)
+	c.Assert(history[0].Version, check.Equals, 4)
+	c.Assert(history[0].RestoredFrom, check.Equals, 2)
+	c.Assert(history[0].Owner, check.Equals, "someone@tsuru.io")
+	c.Assert(history[0].Changes, check.DeepEquals, []EnvChange{
+		{Name: "DATABASE_HOST", Action: EnvChangeChanged, OldValue: "remotehost", NewValue: "localhost", Public: true},
+		{Name: "DEBUG", Action: EnvChangeRemoved, OldValue: "1", Public: true},
+	})
+}
+
+func (s *S) TestRestoreEnvsKeepsRedactedPrivateEnvs(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{
+			{Name: "PASSWORD", Value: "old"},
+			{Name: "TOKEN", Value: "abc"},
+		},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "PASSWORD", Value: "new"}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	err = a.UnsetEnvs(bind.UnsetEnvApp{VariableNames: []string{"TOKEN"}}, nil)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = a.RestoreEnvs(2, "someone@tsuru.io", false, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, `(?s).*not restored: TOKEN\n`)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["PASSWORD"].Value, check.Equals, "new")
+	_, ok := dbApp.Env["TOKEN"]
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestRestoreEnvsVersionNotFound(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.RestoreEnvs(42, "someone@tsuru.io", false, nil)
+	c.Assert(err, check.Equals, ErrEnvVersionNotFound)
+}
+
+func (s *S) TestDiffEnvsComparesSealedValues(c *check.C) {
+	cleanup, err := secrettest.EnableLocalKey()
+	c.Assert(err, check.IsNil)
+	defer cleanup()
+	sealed := func(value string) string {
+		v, sealErr := secret.Seal(value)
+		c.Assert(sealErr, check.IsNil)
+		return v
+	}
+	old := map[string]bind.EnvVar{
+		"PASSWORD": {Name: "PASSWORD", Value: sealed("123")},
+		"TOKEN":    {Name: "TOKEN", Value: sealed("abc")},
+	}
+	new := map[string]bind.EnvVar{
+		"PASSWORD": {Name: "PASSWORD", Value: sealed("123")},
+		"TOKEN":    {Name: "TOKEN", Value: sealed("xyz")},
+	}
+	c.Assert(diffEnvs(old, new), check.DeepEquals, []EnvChange{
+		{Name: "TOKEN", Action: EnvChangeChanged, OldValue: MaskedEnvValue, NewValue: MaskedEnvValue},
+	})
+}
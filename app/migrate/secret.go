@@ -0,0 +1,55 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package migrate
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type appWithEnvs struct {
+	Name string
+	Env  map[string]bind.EnvVar
+}
+
+// MigrateEncryptPrivateEnvs encrypts the private environment variables of
+// apps stored before a secret key provider was configured.
+func MigrateEncryptPrivateEnvs() error {
+	if !secret.Enabled() {
+		return errors.New(`no secret key provider configured, a key provider must be set in "env-secrets:key-provider" to run this migration`)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	iter := conn.Apps().Find(nil).Select(bson.M{"name": 1, "env": 1}).Iter()
+	var app appWithEnvs
+	for iter.Next(&app) {
+		changed := false
+		for name, env := range app.Env {
+			if env.Public || secret.IsSealed(env.Value) {
+				continue
+			}
+			env.Value, err = secret.Seal(env.Value)
+			if err != nil {
+				return err
+			}
+			app.Env[name] = env
+			changed = true
+		}
+		if changed {
+			err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"env": app.Env}})
+			if err != nil {
+				return err
+			}
+		}
+		app = appWithEnvs{}
+	}
+	return iter.Close()
+}
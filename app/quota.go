@@ -6,17 +6,28 @@ package app
 
 import (
 	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/quota"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
-func reserveUnits(app *App, quantity int) error {
-	app, err := checkAppLimit(app.Name, quantity)
+func reserveUnits(app *App, quantity int) (err error) {
+	app, err = checkAppLimit(app.Name, quantity)
 	if err != nil {
 		return err
 	}
+	err = auth.ReserveTeamUnits(app.TeamOwner, quantity)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			auth.ReleaseTeamUnits(app.TeamOwner, quantity)
+		}
+	}()
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -77,7 +88,71 @@ func releaseUnits(app *App, quantity int) error {
 			bson.M{"$inc": bson.M{"quota.inuse": -1 * quantity}},
 		)
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	return auth.ReleaseTeamUnits(app.TeamOwner, quantity)
+}
+
+// updateTeamUnits reserves or releases units in the quota of the team owner
+// of the app, according to the difference between the new and the current
+// number of units in use.
+func updateTeamUnits(app *App, inUse int) error {
+	diff := inUse - app.Quota.InUse
+	if diff > 0 {
+		return auth.ReserveTeamUnits(app.TeamOwner, diff)
+	}
+	return auth.ReleaseTeamUnits(app.TeamOwner, -diff)
+}
+
+// revertTeamUnits undoes a previous call to updateTeamUnits with the same
+// arguments.
+func revertTeamUnits(app *App, inUse int) error {
+	diff := inUse - app.Quota.InUse
+	if diff > 0 {
+		return auth.ReleaseTeamUnits(app.TeamOwner, diff)
+	}
+	return auth.ReserveTeamUnits(app.TeamOwner, -diff)
+}
+
+// moveTeamQuota moves the app and its units from the quota of oldTeam to the
+// quota of newTeam.
+func moveTeamQuota(app *App, oldTeam, newTeam string) error {
+	err := auth.ReserveTeamApp(newTeam)
+	if err != nil {
+		return err
+	}
+	err = auth.ReserveTeamUnits(newTeam, app.Quota.InUse)
+	if err != nil {
+		auth.ReleaseTeamApp(newTeam)
+		return err
+	}
+	err = auth.ReleaseTeamApp(oldTeam)
+	if err != nil {
+		releaseTeamQuota(app, newTeam)
+		return errors.Wrapf(err, "unable to release quota of team %q", oldTeam)
+	}
+	err = auth.ReleaseTeamUnits(oldTeam, app.Quota.InUse)
+	if err != nil {
+		if reserveErr := auth.ReserveTeamApp(oldTeam); reserveErr != nil {
+			log.Errorf("unable to restore quota of team %q: %s", oldTeam, reserveErr)
+		}
+		releaseTeamQuota(app, newTeam)
+		return errors.Wrapf(err, "unable to release quota of team %q", oldTeam)
+	}
+	return nil
+}
+
+// releaseTeamQuota releases the app and its units from the quota of the team,
+// logging failures, used to roll back reservations.
+func releaseTeamQuota(app *App, team string) {
+	err := auth.ReleaseTeamUnits(team, app.Quota.InUse)
+	if err == nil {
+		err = auth.ReleaseTeamApp(team)
+	}
+	if err != nil {
+		log.Errorf("unable to release quota of team %q: %s", team, err)
+	}
 }
 
 func checkAppUsage(name string, quantity int) (*App, error) {
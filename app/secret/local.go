@@ -0,0 +1,38 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secret
+
+import (
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+)
+
+func init() {
+	Register("local", newLocalProvider)
+}
+
+// localProvider reads the key from a file in the local filesystem, holding
+// the base64 encoded key.
+type localProvider struct {
+	path string
+}
+
+func newLocalProvider() (KeyProvider, error) {
+	path, err := config.GetString("env-secrets:local:key-file")
+	if err != nil {
+		return nil, errors.New("env-secrets:local:key-file is required by the local key provider")
+	}
+	return &localProvider{path: path}, nil
+}
+
+func (p *localProvider) Key() ([]byte, error) {
+	data, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKey(string(data))
+}
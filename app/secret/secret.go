@@ -0,0 +1,159 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package secret provides encryption at rest for private environment
+// variables of apps. The encryption key is obtained from a pluggable key
+// provider, configured with the "env-secrets:key-provider" setting. When no
+// provider is configured values are stored as is.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+)
+
+const sealedPrefix = "tsuru-secret:v1:"
+
+// KeySize is the size, in bytes, of the keys returned by key providers.
+const KeySize = 32
+
+var ErrNoKeyProvider = errors.New("no key provider configured to decrypt secret values")
+
+// KeyProvider provides the key used to encrypt and decrypt secret values.
+type KeyProvider interface {
+	Key() ([]byte, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]func() (KeyProvider, error))
+)
+
+// Register registers a new key provider, available to be selected in the
+// "env-secrets:key-provider" setting.
+func Register(name string, fn func() (KeyProvider, error)) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = fn
+}
+
+func currentProvider() (KeyProvider, error) {
+	name, _ := config.GetString("env-secrets:key-provider")
+	if name == "" {
+		return nil, nil
+	}
+	providersMu.RLock()
+	fn, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown secret key provider: %q", name)
+	}
+	return fn()
+}
+
+func currentKey() ([]byte, error) {
+	provider, err := currentProvider()
+	if err != nil || provider == nil {
+		return nil, err
+	}
+	key, err := provider.Key()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get secret key")
+	}
+	if len(key) != KeySize {
+		return nil, errors.Errorf("invalid secret key size: expected %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Enabled returns whether a key provider is configured, meaning new secret
+// values are encrypted.
+func Enabled() bool {
+	name, _ := config.GetString("env-secrets:key-provider")
+	return name != ""
+}
+
+// IsSealed returns whether the value was encrypted by Seal.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// Seal encrypts the value with the key of the configured provider. The value
+// is returned unchanged when no provider is configured or when it's already
+// sealed.
+func Seal(value string) (string, error) {
+	if IsSealed(value) {
+		return value, nil
+	}
+	key, err := currentKey()
+	if err != nil || key == nil {
+		return value, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	data := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Open decrypts a value encrypted by Seal. Values that are not sealed are
+// returned unchanged.
+func Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	key, err := currentKey()
+	if err != nil {
+		return "", err
+	}
+	if key == nil {
+		return "", ErrNoKeyProvider
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil {
+		return "", errors.Wrap(err, "invalid secret value")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid secret value: too short")
+	}
+	nonce, data := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to decrypt secret value")
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.Wrap(err, "secret key must be base64 encoded")
+	}
+	return key, nil
+}
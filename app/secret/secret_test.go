@@ -0,0 +1,86 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secret
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSealAndOpen(c *check.C) {
+	sealed, err := Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	c.Assert(IsSealed(sealed), check.Equals, true)
+	c.Assert(strings.Contains(sealed, "s3cr3t"), check.Equals, false)
+	other, err := Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	c.Assert(other, check.Not(check.Equals), sealed)
+	value, err := Open(sealed)
+	c.Assert(err, check.IsNil)
+	c.Assert(value, check.Equals, "s3cr3t")
+}
+
+func (s *S) TestSealAlreadySealed(c *check.C) {
+	sealed, err := Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	again, err := Seal(sealed)
+	c.Assert(err, check.IsNil)
+	c.Assert(again, check.Equals, sealed)
+}
+
+func (s *S) TestSealWithoutProvider(c *check.C) {
+	config.Unset("env-secrets:key-provider")
+	c.Assert(Enabled(), check.Equals, false)
+	value, err := Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	c.Assert(value, check.Equals, "s3cr3t")
+}
+
+func (s *S) TestOpenPlainValue(c *check.C) {
+	value, err := Open("plain")
+	c.Assert(err, check.IsNil)
+	c.Assert(value, check.Equals, "plain")
+}
+
+func (s *S) TestOpenWithoutProvider(c *check.C) {
+	sealed, err := Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	config.Unset("env-secrets:key-provider")
+	_, err = Open(sealed)
+	c.Assert(err, check.Equals, ErrNoKeyProvider)
+}
+
+func (s *S) TestOpenWithWrongKey(c *check.C) {
+	sealed, err := Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	otherKey := base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+	err = ioutil.WriteFile(s.keyFile, []byte(otherKey), 0600)
+	c.Assert(err, check.IsNil)
+	_, err = Open(sealed)
+	c.Assert(err, check.ErrorMatches, "unable to decrypt secret value: .*")
+}
+
+func (s *S) TestInvalidKeySize(c *check.C) {
+	err := ioutil.WriteFile(s.keyFile, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0600)
+	c.Assert(err, check.IsNil)
+	_, err = Seal("s3cr3t")
+	c.Assert(err, check.ErrorMatches, "invalid secret key size: expected 32 bytes, got 5")
+}
+
+func (s *S) TestUnknownProvider(c *check.C) {
+	config.Set("env-secrets:key-provider", "hsm")
+	_, err := Seal("s3cr3t")
+	c.Assert(err, check.ErrorMatches, `unknown secret key provider: "hsm"`)
+}
+
+func (s *S) TestLocalProviderRequiresKeyFile(c *check.C) {
+	config.Unset("env-secrets:local:key-file")
+	_, err := Seal("s3cr3t")
+	c.Assert(err, check.ErrorMatches, "env-secrets:local:key-file is required by the local key provider")
+}
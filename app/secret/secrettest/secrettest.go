@@ -0,0 +1,36 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package secrettest provides helpers for testing code that stores secret
+// values.
+package secrettest
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+
+	"github.com/tsuru/config"
+)
+
+// EnableLocalKey configures the local key provider with a test key stored
+// in a temporary file. The returned function restores the previous state.
+func EnableLocalKey() (func(), error) {
+	f, err := ioutil.TempFile("", "tsuru-secret")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	_, err = f.WriteString(base64.StdEncoding.EncodeToString([]byte("tsuru-secrettest-key-32-bytes!!!")))
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	config.Set("env-secrets:key-provider", "local")
+	config.Set("env-secrets:local:key-file", f.Name())
+	return func() {
+		config.Unset("env-secrets")
+		os.Remove(f.Name())
+	}, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secret
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+type S struct {
+	dir     string
+	keyFile string
+	key     []byte
+}
+
+var _ = check.Suite(&S{})
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+func (s *S) SetUpTest(c *check.C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "secret")
+	c.Assert(err, check.IsNil)
+	s.key = []byte("0123456789abcdef0123456789abcdef")
+	s.keyFile = filepath.Join(s.dir, "key")
+	err = ioutil.WriteFile(s.keyFile, []byte(base64.StdEncoding.EncodeToString(s.key)+"\n"), 0600)
+	c.Assert(err, check.IsNil)
+	config.Set("env-secrets:key-provider", "local")
+	config.Set("env-secrets:local:key-file", s.keyFile)
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	config.Unset("env-secrets")
+	os.RemoveAll(s.dir)
+	vaultCache.Lock()
+	vaultCache.keys = make(map[string]cachedKey)
+	vaultCache.Unlock()
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/net"
+)
+
+const defaultVaultField = "key"
+
+// vaultCacheTTL is how long keys read from the KV backend are kept in memory.
+var vaultCacheTTL = 5 * time.Minute
+
+var vaultCache = struct {
+	sync.Mutex
+	keys map[string]cachedKey
+}{keys: make(map[string]cachedKey)}
+
+type cachedKey struct {
+	key     []byte
+	expires time.Time
+}
+
+func init() {
+	Register("vault", newVaultProvider)
+}
+
+// vaultProvider reads the key from a Vault compatible HTTP key/value
+// backend. The secret at the configured path must hold the base64 encoded
+// key in the configured field. Both version 1 and version 2 of the KV API are
+// supported.
+type vaultProvider struct {
+	address string
+	token   string
+	path    string
+	field   string
+}
+
+func newVaultProvider() (KeyProvider, error) {
+	address, _ := config.GetString("env-secrets:vault:address")
+	path, _ := config.GetString("env-secrets:vault:path")
+	if address == "" || path == "" {
+		return nil, errors.New("env-secrets:vault:address and env-secrets:vault:path are required by the vault key provider")
+	}
+	token, _ := config.GetString("env-secrets:vault:token")
+	field, _ := config.GetString("env-secrets:vault:field")
+	if field == "" {
+		field = defaultVaultField
+	}
+	return &vaultProvider{
+		address: strings.TrimRight(address, "/"),
+		token:   token,
+		path:    strings.Trim(path, "/"),
+		field:   field,
+	}, nil
+}
+
+func (p *vaultProvider) url() string {
+	return fmt.Sprintf("%s/v1/%s", p.address, p.path)
+}
+
+func (p *vaultProvider) Key() ([]byte, error) {
+	cacheKey := p.url() + "#" + p.field
+	vaultCache.Lock()
+	defer vaultCache.Unlock()
+	if cached, ok := vaultCache.keys[cacheKey]; ok && time.Now().Before(cached.expires) {
+		return cached.key, nil
+	}
+	key, err := p.fetchKey()
+	if err != nil {
+		return nil, err
+	}
+	vaultCache.keys[cacheKey] = cachedKey{key: key, expires: time.Now().Add(vaultCacheTTL)}
+	return key, nil
+}
+
+func (p *vaultProvider) fetchKey() ([]byte, error) {
+	req, err := http.NewRequest("GET", p.url(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		req.Header.Set("X-Vault-Token", p.token)
+	}
+	resp, err := net.Dial5Full60ClientNoKeepAlive.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("invalid response from key/value backend (%d): %s", resp.StatusCode, string(body))
+	}
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid response from key/value backend")
+	}
+	data := result.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	encoded, _ := data[p.field].(string)
+	if encoded == "" {
+		return nil, errors.Errorf("field %q not found in secret %q", p.field, p.path)
+	}
+	return decodeKey(encoded)
+}
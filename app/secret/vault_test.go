@@ -0,0 +1,91 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secret
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) vaultServer(c *check.C, body string, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.Header.Get("X-Vault-Token") != "my-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		c.Check(r.URL.Path, check.Equals, "/v1/secret/tsuru")
+		w.Write([]byte(body))
+	}))
+}
+
+func (s *S) setVaultConfig(address string) {
+	config.Set("env-secrets:key-provider", "vault")
+	config.Set("env-secrets:vault:address", address)
+	config.Set("env-secrets:vault:path", "/secret/tsuru")
+	config.Set("env-secrets:vault:token", "my-token")
+}
+
+func (s *S) TestVaultProvider(c *check.C) {
+	var requests int
+	encoded := base64.StdEncoding.EncodeToString(s.key)
+	ts := s.vaultServer(c, fmt.Sprintf(`{"data": {"key": %q}}`, encoded), &requests)
+	defer ts.Close()
+	s.setVaultConfig(ts.URL)
+	sealed, err := Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	value, err := Open(sealed)
+	c.Assert(err, check.IsNil)
+	c.Assert(value, check.Equals, "s3cr3t")
+	c.Assert(requests, check.Equals, 1)
+	config.Set("env-secrets:key-provider", "local")
+	value, err = Open(sealed)
+	c.Assert(err, check.IsNil)
+	c.Assert(value, check.Equals, "s3cr3t")
+}
+
+func (s *S) TestVaultProviderKVVersion2(c *check.C) {
+	var requests int
+	encoded := base64.StdEncoding.EncodeToString(s.key)
+	ts := s.vaultServer(c, fmt.Sprintf(`{"data": {"data": {"tsuru-key": %q}, "metadata": {"version": 1}}}`, encoded), &requests)
+	defer ts.Close()
+	s.setVaultConfig(ts.URL)
+	config.Set("env-secrets:vault:field", "tsuru-key")
+	provider, err := currentProvider()
+	c.Assert(err, check.IsNil)
+	key, err := provider.Key()
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.DeepEquals, s.key)
+}
+
+func (s *S) TestVaultProviderFieldNotFound(c *check.C) {
+	var requests int
+	ts := s.vaultServer(c, `{"data": {"other": "value"}}`, &requests)
+	defer ts.Close()
+	s.setVaultConfig(ts.URL)
+	_, err := Seal("s3cr3t")
+	c.Assert(err, check.ErrorMatches, `unable to get secret key: field "key" not found in secret "secret/tsuru"`)
+}
+
+func (s *S) TestVaultProviderForbidden(c *check.C) {
+	var requests int
+	ts := s.vaultServer(c, `{}`, &requests)
+	defer ts.Close()
+	s.setVaultConfig(ts.URL)
+	config.Set("env-secrets:vault:token", "wrong-token")
+	_, err := Seal("s3cr3t")
+	c.Assert(err, check.ErrorMatches, `unable to get secret key: invalid response from key/value backend \(403\): `)
+}
+
+func (s *S) TestVaultProviderRequiresAddress(c *check.C) {
+	config.Set("env-secrets:key-provider", "vault")
+	_, err := Seal("s3cr3t")
+	c.Assert(err, check.ErrorMatches, "env-secrets:vault:address and env-secrets:vault:path are required by the vault key provider")
+}
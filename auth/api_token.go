@@ -53,7 +53,7 @@ func getAPIToken(header string) (*APIToken, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = conn.Users().Find(bson.M{"apikey": token}).One(&t)
+	err = conn.Users().Find(bson.M{"apikey": token, "disabled": bson.M{"$ne": true}}).One(&t)
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			return nil, ErrInvalidToken
@@ -36,3 +36,17 @@ func (s *S) TestGetAPITokenInvalid(c *check.C) {
 	c.Assert(t, check.IsNil)
 	c.Assert(err, check.Equals, ErrInvalidToken)
 }
+
+func (s *S) TestGetAPITokenDisabledUser(c *check.C) {
+	user := User{Email: "para@xmen.com"}
+	err := user.Create()
+	c.Assert(err, check.IsNil)
+	defer user.Delete()
+	APIKey, err := user.RegenerateAPIKey()
+	c.Assert(err, check.IsNil)
+	err = user.SetDisabled(true)
+	c.Assert(err, check.IsNil)
+	t, err := getAPIToken("bearer " + APIKey)
+	c.Assert(t, check.IsNil)
+	c.Assert(err, check.Equals, ErrInvalidToken)
+}
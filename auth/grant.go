@@ -0,0 +1,159 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"sort"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// PermissionGrant describes a role assigned to a user that holds a
+// permission in a context.
+type PermissionGrant struct {
+	Role         string `json:"role"`
+	Permission   string `json:"permission"`
+	ContextType  string `json:"contextType"`
+	ContextValue string `json:"contextValue"`
+}
+
+// PermissionHolder is a user or an app token holding a permission, along
+// with the grants responsible for it. When HasAPIKey is true, the API key of
+// the user holds the same permission. Disabled users are listed as well, as
+// they regain their permissions when enabled again.
+type PermissionHolder struct {
+	Email     string            `json:"email,omitempty"`
+	App       string            `json:"app,omitempty"`
+	Disabled  bool              `json:"disabled"`
+	HasAPIKey bool              `json:"hasAPIKey"`
+	Grants    []PermissionGrant `json:"grants"`
+}
+
+// PermissionExplanation explains whether a user is allowed to use a
+// permission in the given contexts. Grants lists the roles allowing it, while
+// Mismatches lists the roles holding the permission in other contexts.
+type PermissionExplanation struct {
+	Email      string            `json:"email"`
+	Allowed    bool              `json:"allowed"`
+	Grants     []PermissionGrant `json:"grants"`
+	Mismatches []PermissionGrant `json:"mismatches"`
+}
+
+// ExplainPermission returns which roles of the user allow or would allow the
+// usage of the permission scheme in any of the contexts.
+func (u *User) ExplainPermission(scheme *permission.PermissionScheme, contexts ...permission.PermissionContext) (*PermissionExplanation, error) {
+	return u.explainPermission(scheme, contexts, map[string]*permission.Role{})
+}
+
+func (u *User) explainPermission(scheme *permission.PermissionScheme, contexts []permission.PermissionContext, roles map[string]*permission.Role) (*PermissionExplanation, error) {
+	explanation := PermissionExplanation{
+		Email:      u.Email,
+		Grants:     []PermissionGrant{},
+		Mismatches: []PermissionGrant{},
+	}
+	implicit := permission.Permission{Scheme: permission.PermUser, Context: permission.Context(permission.CtxUser, u.Email)}
+	if permission.CheckFromPermList([]permission.Permission{implicit}, scheme, contexts...) {
+		explanation.Grants = append(explanation.Grants, newPermissionGrant("", implicit))
+	}
+	for _, roleData := range u.Roles {
+		role := roles[roleData.Name]
+		if role == nil {
+			foundRole, err := permission.FindRole(roleData.Name)
+			if err != nil && err != permission.ErrRoleNotFound {
+				return nil, err
+			}
+			role = &foundRole
+			roles[roleData.Name] = role
+		}
+		for _, perm := range role.PermissionsFor(roleData.ContextValue) {
+			if !perm.Scheme.IsParent(scheme) {
+				continue
+			}
+			grant := newPermissionGrant(roleData.Name, perm)
+			if permission.CheckFromPermList([]permission.Permission{perm}, scheme, contexts...) {
+				explanation.Grants = append(explanation.Grants, grant)
+			} else {
+				explanation.Mismatches = append(explanation.Mismatches, grant)
+			}
+		}
+	}
+	explanation.Allowed = len(explanation.Grants) > 0
+	return &explanation, nil
+}
+
+func newPermissionGrant(role string, perm permission.Permission) PermissionGrant {
+	name := perm.Scheme.FullName()
+	if name == "" {
+		name = "*"
+	}
+	return PermissionGrant{
+		Role:         role,
+		Permission:   name,
+		ContextType:  string(perm.Context.CtxType),
+		ContextValue: perm.Context.Value,
+	}
+}
+
+// ListPermissionHolders returns every user and app token allowed to use the
+// permission scheme in any of the contexts. Users are sorted by email and
+// come before app tokens, which are sorted by app name.
+func ListPermissionHolders(scheme *permission.PermissionScheme, contexts ...permission.PermissionContext) ([]PermissionHolder, error) {
+	wantedPerms := make([]permission.Permission, len(contexts))
+	for i, ctx := range contexts {
+		wantedPerms[i] = permission.Permission{Scheme: scheme, Context: ctx}
+	}
+	users, err := ListUsersWithPermissions(wantedPerms...)
+	if err != nil {
+		return nil, err
+	}
+	roles := map[string]*permission.Role{}
+	holders := []PermissionHolder{}
+	for i := range users {
+		explanation, err := users[i].explainPermission(scheme, contexts, roles)
+		if err != nil {
+			return nil, err
+		}
+		holders = append(holders, PermissionHolder{
+			Email:     users[i].Email,
+			Disabled:  users[i].Disabled,
+			HasAPIKey: users[i].APIKey != "",
+			Grants:    explanation.Grants,
+		})
+	}
+	sort.Slice(holders, func(i, j int) bool { return holders[i].Email < holders[j].Email })
+	apps, err := listAppsWithTokens()
+	if err != nil {
+		return nil, err
+	}
+	for _, appName := range apps {
+		grants := []PermissionGrant{}
+		for _, perm := range appTokenPermissions(appName) {
+			if permission.CheckFromPermList([]permission.Permission{perm}, scheme, contexts...) {
+				grants = append(grants, newPermissionGrant("", perm))
+			}
+		}
+		if len(grants) > 0 {
+			holders = append(holders, PermissionHolder{App: appName, Grants: grants})
+		}
+	}
+	return holders, nil
+}
+
+func listAppsWithTokens() ([]string, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var apps []string
+	err = conn.Tokens().Find(bson.M{"appname": bson.M{"$nin": []interface{}{"", nil}}}).Distinct("appname", &apps)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(apps)
+	return apps, nil
+}
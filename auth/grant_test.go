@@ -0,0 +1,124 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestUserExplainPermission(c *check.C) {
+	r1, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	r2, err := permission.NewRole("reader", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r2.AddPermissions("app.read")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("deployer", "team1")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("deployer", "team2")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("reader", "team1")
+	c.Assert(err, check.IsNil)
+	explanation, err := s.user.ExplainPermission(permission.PermAppDeploy, permission.Context(permission.CtxTeam, "team1"))
+	c.Assert(err, check.IsNil)
+	c.Assert(explanation, check.DeepEquals, &PermissionExplanation{
+		Email:   s.user.Email,
+		Allowed: true,
+		Grants: []PermissionGrant{
+			{Role: "deployer", Permission: "app.deploy", ContextType: "team", ContextValue: "team1"},
+		},
+		Mismatches: []PermissionGrant{
+			{Role: "deployer", Permission: "app.deploy", ContextType: "team", ContextValue: "team2"},
+		},
+	})
+	explanation, err = s.user.ExplainPermission(permission.PermAppDeploy, permission.Context(permission.CtxTeam, "team3"))
+	c.Assert(err, check.IsNil)
+	c.Assert(explanation.Allowed, check.Equals, false)
+	c.Assert(explanation.Grants, check.HasLen, 0)
+	c.Assert(explanation.Mismatches, check.HasLen, 2)
+}
+
+func (s *S) TestUserExplainPermissionImplicitUserPermission(c *check.C) {
+	explanation, err := s.user.ExplainPermission(permission.PermUserUpdateToken, permission.Context(permission.CtxUser, s.user.Email))
+	c.Assert(err, check.IsNil)
+	c.Assert(explanation.Allowed, check.Equals, true)
+	c.Assert(explanation.Grants, check.DeepEquals, []PermissionGrant{
+		{Role: "", Permission: "user", ContextType: "user", ContextValue: s.user.Email},
+	})
+}
+
+func (s *S) TestListPermissionHolders(c *check.C) {
+	r1, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	r2, err := permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	err = r2.AddPermissions("*")
+	c.Assert(err, check.IsNil)
+	u1 := User{Email: "zz@tsuru.com", Password: "123456", APIKey: "abc"}
+	err = u1.Create()
+	c.Assert(err, check.IsNil)
+	err = u1.AddRole("deployer", "team1")
+	c.Assert(err, check.IsNil)
+	u2 := User{Email: "aa@tsuru.com", Password: "123456"}
+	err = u2.Create()
+	c.Assert(err, check.IsNil)
+	err = u2.AddRole("admin", "")
+	c.Assert(err, check.IsNil)
+	u3 := User{Email: "mm@tsuru.com", Password: "123456"}
+	err = u3.Create()
+	c.Assert(err, check.IsNil)
+	err = u3.AddRole("deployer", "team2")
+	c.Assert(err, check.IsNil)
+	holders, err := ListPermissionHolders(permission.PermAppDeploy, permission.Context(permission.CtxTeam, "team1"))
+	c.Assert(err, check.IsNil)
+	c.Assert(holders, check.DeepEquals, []PermissionHolder{
+		{
+			Email:  "aa@tsuru.com",
+			Grants: []PermissionGrant{{Role: "admin", Permission: "*", ContextType: "global"}},
+		},
+		{
+			Email:     "zz@tsuru.com",
+			HasAPIKey: true,
+			Grants:    []PermissionGrant{{Role: "deployer", Permission: "app", ContextType: "team", ContextValue: "team1"}},
+		},
+	})
+}
+
+func (s *S) TestListPermissionHoldersIncludesAppTokensAndDisabledUsers(c *check.C) {
+	r, err := permission.NewRole("reader", "app", "")
+	c.Assert(err, check.IsNil)
+	err = r.AddPermissions("app.read")
+	c.Assert(err, check.IsNil)
+	u := User{Email: "disabled@tsuru.com", Password: "123456", Disabled: true}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole("reader", "myapp")
+	c.Assert(err, check.IsNil)
+	err = s.conn.Tokens().Insert(bson.M{"token": "apptoken", "appname": "myapp"})
+	c.Assert(err, check.IsNil)
+	err = s.conn.Tokens().Insert(bson.M{"token": "otherapptoken", "appname": "otherapp"})
+	c.Assert(err, check.IsNil)
+	err = s.conn.Tokens().Insert(bson.M{"token": "usertoken", "useremail": u.Email})
+	c.Assert(err, check.IsNil)
+	holders, err := ListPermissionHolders(permission.PermAppReadDeploy, permission.Context(permission.CtxApp, "myapp"))
+	c.Assert(err, check.IsNil)
+	c.Assert(holders, check.DeepEquals, []PermissionHolder{
+		{
+			Email:    "disabled@tsuru.com",
+			Disabled: true,
+			Grants:   []PermissionGrant{{Role: "reader", Permission: "app.read", ContextType: "app", ContextValue: "myapp"}},
+		},
+		{
+			App:    "myapp",
+			Grants: []PermissionGrant{{Permission: "app.read.deploy", ContextType: "app", ContextValue: "myapp"}},
+		},
+	})
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/validation"
+	"gopkg.in/mgo.v2"
 )
 
 var (
@@ -39,11 +41,30 @@ func (s NativeScheme) Login(params map[string]string) (auth.Token, error) {
 	if err != nil {
 		return nil, err
 	}
-	token, err := createToken(user, password)
-	if err != nil {
-		return nil, err
-	}
-	return token, nil
+	// Every attempt is rejected the same way while the user is locked, so
+	// the lockout can't be used to keep guessing the password.
+	if user.IsLocked() {
+		return nil, auth.ErrUserLocked
+	}
+	// The password is checked before the account status so it's only
+	// disclosed to whoever knows it.
+	err = checkPassword(user.Password, password)
+	if err == nil {
+		if err = user.CheckEnabled(); err != nil {
+			return nil, err
+		}
+		var pending bool
+		pending, err = checkTwoFactor(user, params["otp"])
+		if err == nil {
+			return insertToken(user, pending)
+		}
+	}
+	if _, ok := err.(auth.AuthenticationFailure); ok {
+		if failErr := user.RecordFailedLogin(); failErr != nil {
+			log.Errorf("unable to record failed login for %q: %s", user.Email, failErr)
+		}
+	}
+	return nil, err
 }
 
 func (s NativeScheme) Auth(token string) (auth.Token, error) {
@@ -139,6 +160,15 @@ func (s NativeScheme) Remove(u *auth.User) error {
 	if err != nil {
 		return err
 	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.TwoFactorSecrets().RemoveId(u.Email)
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
 	return u.Delete()
 }
 
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/auth/authtest"
 	"github.com/tsuru/tsuru/db"
@@ -17,6 +18,48 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
+func (s *S) TestNativeLoginDisabledUser(c *check.C) {
+	err := s.user.SetDisabled(true)
+	c.Assert(err, check.IsNil)
+	scheme := NativeScheme{}
+	_, err = scheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.Equals, auth.ErrUserDisabled)
+}
+
+func (s *S) TestNativeLoginLockout(c *check.C) {
+	config.Set("auth:max-failed-logins", 2)
+	defer config.Unset("auth:max-failed-logins")
+	scheme := NativeScheme{}
+	for i := 0; i < 2; i++ {
+		_, err := scheme.Login(map[string]string{"email": s.user.Email, "password": "wrongpass"})
+		_, ok := err.(auth.AuthenticationFailure)
+		c.Assert(ok, check.Equals, true)
+	}
+	_, err := scheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.Equals, auth.ErrUserLocked)
+	_, err = scheme.Login(map[string]string{"email": s.user.Email, "password": "wrongpass"})
+	c.Assert(err, check.Equals, auth.ErrUserLocked)
+	err = s.user.Unlock()
+	c.Assert(err, check.IsNil)
+	_, err = scheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestNativeLoginLockedSameResponseForAnyPassword(c *check.C) {
+	config.Set("auth:max-failed-logins", 1)
+	defer config.Unset("auth:max-failed-logins")
+	scheme := NativeScheme{}
+	_, err := scheme.Login(map[string]string{"email": s.user.Email, "password": "wrongpass"})
+	c.Assert(err, check.Not(check.Equals), auth.ErrUserLocked)
+	_, rightErr := scheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	_, wrongErr := scheme.Login(map[string]string{"email": s.user.Email, "password": "otherwrongpass"})
+	c.Assert(rightErr, check.DeepEquals, wrongErr)
+	c.Assert(rightErr, check.Equals, auth.ErrUserLocked)
+	user, err := auth.GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(user.IsLocked(), check.Equals, true)
+}
+
 func (s *S) TestNativeLoginWithoutEmail(c *check.C) {
 	scheme := NativeScheme{}
 	params := make(map[string]string)
@@ -260,3 +303,13 @@ func (s *S) TestNativeRemove(c *check.C) {
 	_, err = auth.GetUserByEmail("timeredbull@globo.com")
 	c.Assert(err, check.Equals, auth.ErrUserNotFound)
 }
+
+func (s *S) TestNativeLoginDisabledUserWrongPassword(c *check.C) {
+	err := s.user.SetDisabled(true)
+	c.Assert(err, check.IsNil)
+	scheme := NativeScheme{}
+	_, err = scheme.Login(map[string]string{"email": s.user.Email, "password": "wrongpass"})
+	c.Assert(err, check.Not(check.Equals), auth.ErrUserDisabled)
+	_, ok := err.(auth.AuthenticationFailure)
+	c.Assert(ok, check.Equals, true)
+}
@@ -36,11 +36,16 @@ var (
 )
 
 type Token struct {
-	Token     string        `json:"token"`
-	Creation  time.Time     `json:"creation"`
-	Expires   time.Duration `json:"expires"`
-	UserEmail string        `json:"email"`
-	AppName   string        `json:"app"`
+	Token            string        `json:"token"`
+	Creation         time.Time     `json:"creation"`
+	Expires          time.Duration `json:"expires"`
+	UserEmail        string        `json:"email"`
+	AppName          string        `json:"app"`
+	TwoFactorPending bool          `json:"-"`
+}
+
+func (t *Token) IsTwoFactorPending() bool {
+	return t.TwoFactorPending
 }
 
 func (t *Token) GetValue() string {
@@ -63,7 +68,13 @@ func (t *Token) GetAppName() string {
 	return t.AppName
 }
 
+// Permissions returns the permissions of the token owner. Tokens issued to
+// users who must enroll in two-factor authentication have no permissions
+// until the enrollment is confirmed.
 func (t *Token) Permissions() ([]permission.Permission, error) {
+	if t.TwoFactorPending {
+		return []permission.Permission{}, nil
+	}
 	return auth.BaseTokenPermission(t)
 }
 
@@ -176,6 +187,17 @@ func createToken(u *auth.User, password string) (*Token, error) {
 	if err := checkPassword(u.Password, password); err != nil {
 		return nil, err
 	}
+	return insertToken(u, false)
+}
+
+// CreateUserToken creates a session token for the user without checking any
+// credentials. It's used by schemes that authenticate users elsewhere, like
+// oidc, and store their sessions as native tokens.
+func CreateUserToken(u *auth.User) (*Token, error) {
+	return insertToken(u, false)
+}
+
+func insertToken(u *auth.User, twoFactorPending bool) (*Token, error) {
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
@@ -185,6 +207,7 @@ func createToken(u *auth.User, password string) (*Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	token.TwoFactorPending = twoFactorPending
 	err = conn.Tokens().Insert(token)
 	go removeOldTokens(u.Email)
 	return token, err
@@ -210,6 +210,20 @@ func (s *S) TestCreateTokenShouldSaveTheTokenInTheDatabase(c *check.C) {
 	c.Assert(result.Token, check.NotNil)
 }
 
+func (s *S) TestCreateUserToken(c *check.C) {
+	u := auth.User{Email: "wolverine@xmen.com"}
+	err := u.Create()
+	c.Assert(err, check.IsNil)
+	defer u.Delete()
+	t, err := CreateUserToken(&u)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.UserEmail, check.Equals, u.Email)
+	c.Assert(t.TwoFactorPending, check.Equals, false)
+	dbToken, err := getToken("bearer " + t.Token)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbToken.UserEmail, check.Equals, u.Email)
+}
+
 func (s *S) TestCreateTokenRemoveOldTokens(c *check.C) {
 	config.Set("auth:max-simultaneous-sessions", 2)
 	u := auth.User{Email: "para@xmen.com", Password: "123456"}
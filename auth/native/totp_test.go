@@ -0,0 +1,69 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+// rfc6238Secret is the base32 encoding of the SHA1 seed used by the test
+// vectors in RFC 6238, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func (s *S) TestTOTPCodeRFCVectors(c *check.C) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, v := range vectors {
+		code, err := totpCode(rfc6238Secret, totpStep(time.Unix(v.unix, 0)))
+		c.Assert(err, check.IsNil)
+		c.Check(code, check.Equals, v.code, check.Commentf("time %d", v.unix))
+	}
+}
+
+func (s *S) TestValidateTOTP(c *check.C) {
+	now := time.Unix(1111111109, 0)
+	step, ok := validateTOTP(rfc6238Secret, "081804", now, 0)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(step, check.Equals, totpStep(now))
+	_, ok = validateTOTP(rfc6238Secret, "081804", now.Add(totpPeriod*time.Second), 0)
+	c.Assert(ok, check.Equals, true)
+	_, ok = validateTOTP(rfc6238Secret, "081804", now.Add(3*totpPeriod*time.Second), 0)
+	c.Assert(ok, check.Equals, false)
+	_, ok = validateTOTP(rfc6238Secret, "000000", now, 0)
+	c.Assert(ok, check.Equals, false)
+	_, ok = validateTOTP(rfc6238Secret, "81804", now, 0)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestValidateTOTPRejectsReplay(c *check.C) {
+	now := time.Unix(1111111109, 0)
+	step, ok := validateTOTP(rfc6238Secret, "081804", now, 0)
+	c.Assert(ok, check.Equals, true)
+	_, ok = validateTOTP(rfc6238Secret, "081804", now, step)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestGenerateTOTPSecret(c *check.C) {
+	secret, err := generateTOTPSecret()
+	c.Assert(err, check.IsNil)
+	c.Assert(secret, check.HasLen, 32)
+	_, err = totpCode(secret, 1)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestTOTPURI(c *check.C) {
+	uri := totpURI("tsuru", "me@tsuru.io", "ABCDEF")
+	c.Assert(uri, check.Equals, "otpauth://totp/tsuru:me@tsuru.io?digits=6&issuer=tsuru&period=30&secret=ABCDEF")
+}
@@ -0,0 +1,265 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	recoveryCodesCount = 10
+	twoFactorIssuer    = "tsuru"
+)
+
+var (
+	ErrTwoFactorCodeRequired   = &tsuruErrors.ValidationError{Message: "two-factor authentication code required"}
+	ErrTwoFactorNotEnrolled    = &tsuruErrors.ValidationError{Message: "two-factor authentication is not enrolled"}
+	ErrTwoFactorAlreadyEnabled = &tsuruErrors.ConflictError{Message: "two-factor authentication is already enabled"}
+	ErrTwoFactorRequired       = &tsuruErrors.NotAuthorizedError{Message: "two-factor authentication is required for your roles and cannot be disabled"}
+	errInvalidTwoFactorCode    = auth.AuthenticationFailure{Message: "Authentication failed, invalid two-factor code."}
+)
+
+type twoFactor struct {
+	UserEmail     string `bson:"_id"`
+	Secret        string
+	Enabled       bool
+	LastStep      int64
+	RecoveryCodes []string
+}
+
+func getTwoFactor(email string) (*twoFactor, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var tf twoFactor
+	err = conn.TwoFactorSecrets().FindId(email).One(&tf)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		return nil, err
+	}
+	return &tf, nil
+}
+
+func (tf *twoFactor) save() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.TwoFactorSecrets().UpsertId(tf.UserEmail, tf)
+	return err
+}
+
+// verify accepts either a TOTP code or one of the unused recovery codes,
+// recovery codes are consumed when used.
+func (tf *twoFactor) verify(code string) error {
+	if code == "" {
+		return ErrTwoFactorCodeRequired
+	}
+	if step, ok := validateTOTP(tf.Secret, code, time.Now(), tf.LastStep); ok {
+		tf.LastStep = step
+		return tf.save()
+	}
+	hashed := hashRecoveryCode(code)
+	for i, rc := range tf.RecoveryCodes {
+		if rc == hashed {
+			tf.RecoveryCodes = append(tf.RecoveryCodes[:i], tf.RecoveryCodes[i+1:]...)
+			return tf.save()
+		}
+	}
+	return errInvalidTwoFactorCode
+}
+
+func (tf *twoFactor) newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashed := make([]string, recoveryCodesCount)
+	for i := range codes {
+		var buf [5]byte
+		_, err := rand.Read(buf[:])
+		if err != nil {
+			return nil, err
+		}
+		encoded := hex.EncodeToString(buf[:])
+		codes[i] = fmt.Sprintf("%s-%s", encoded[:5], encoded[5:])
+		hashed[i] = hashRecoveryCode(codes[i])
+	}
+	tf.RecoveryCodes = hashed
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// twoFactorRequired returns whether the user holds any of the roles listed in
+// auth:two-factor:required-roles.
+func twoFactorRequired(user *auth.User) bool {
+	roles, _ := config.GetList("auth:two-factor:required-roles")
+	for _, required := range roles {
+		for _, r := range user.Roles {
+			if r.Name == required {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkTwoFactor validates the second factor for a user who already provided
+// a valid password. It returns true when the user is required to use
+// two-factor authentication but has not enabled it yet, in which case the
+// created token should only be used to enroll.
+func checkTwoFactor(user *auth.User, code string) (bool, error) {
+	tf, err := getTwoFactor(user.Email)
+	if err != nil && err != ErrTwoFactorNotEnrolled {
+		return false, err
+	}
+	if tf == nil || !tf.Enabled {
+		return twoFactorRequired(user), nil
+	}
+	return false, tf.verify(code)
+}
+
+func (s NativeScheme) EnrollTwoFactor(user *auth.User) (*auth.TwoFactorEnrollment, error) {
+	tf, err := getTwoFactor(user.Email)
+	if err != nil && err != ErrTwoFactorNotEnrolled {
+		return nil, err
+	}
+	if tf != nil && tf.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	tf = &twoFactor{UserEmail: user.Email, Secret: secret}
+	err = tf.save()
+	if err != nil {
+		return nil, err
+	}
+	return &auth.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totpURI(twoFactorIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables the two-factor authentication enrolled by the
+// user. When token was issued pending the enrollment it becomes a regular
+// token, other pending tokens of the user are removed.
+func (s NativeScheme) ConfirmTwoFactor(user *auth.User, token auth.Token, code string) ([]string, error) {
+	tf, err := getTwoFactor(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if tf.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if code == "" {
+		return nil, ErrTwoFactorCodeRequired
+	}
+	step, ok := validateTOTP(tf.Secret, code, time.Now(), tf.LastStep)
+	if !ok {
+		return nil, errInvalidTwoFactorCode
+	}
+	codes, err := tf.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	tf.Enabled = true
+	tf.LastStep = step
+	err = tf.save()
+	if err != nil {
+		return nil, err
+	}
+	return codes, clearTwoFactorPending(user.Email, token)
+}
+
+func (s NativeScheme) DisableTwoFactor(user *auth.User, code string) error {
+	if twoFactorRequired(user) {
+		return ErrTwoFactorRequired
+	}
+	tf, err := getTwoFactor(user.Email)
+	if err != nil {
+		return err
+	}
+	if tf.Enabled {
+		err = tf.verify(code)
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.TwoFactorSecrets().RemoveId(user.Email)
+}
+
+func (s NativeScheme) RegenerateRecoveryCodes(user *auth.User, code string) ([]string, error) {
+	tf, err := getTwoFactor(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if !tf.Enabled {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	err = tf.verify(code)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := tf.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	return codes, tf.save()
+}
+
+func (s NativeScheme) TwoFactorEnabled(user *auth.User) (bool, error) {
+	tf, err := getTwoFactor(user.Email)
+	if err == ErrTwoFactorNotEnrolled {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return tf.Enabled, nil
+}
+
+func clearTwoFactorPending(email string, token auth.Token) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if token != nil {
+		err = conn.Tokens().Update(
+			bson.M{"token": token.GetValue(), "useremail": email, "twofactorpending": true},
+			bson.M{"$set": bson.M{"twofactorpending": false}},
+		)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	_, err = conn.Tokens().RemoveAll(bson.M{"useremail": email, "twofactorpending": true})
+	return err
+}
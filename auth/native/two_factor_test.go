@@ -0,0 +1,189 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) currentCode(c *check.C, secret string, offset int64) string {
+	code, err := totpCode(secret, totpStep(time.Now())+offset)
+	c.Assert(err, check.IsNil)
+	return code
+}
+
+func (s *S) enableTwoFactor(c *check.C) (string, []string) {
+	enrollment, err := nativeScheme.EnrollTwoFactor(s.user)
+	c.Assert(err, check.IsNil)
+	codes, err := nativeScheme.ConfirmTwoFactor(s.user, s.token, s.currentCode(c, enrollment.Secret, -1))
+	c.Assert(err, check.IsNil)
+	return enrollment.Secret, codes
+}
+
+func (s *S) TestEnrollTwoFactor(c *check.C) {
+	enrollment, err := nativeScheme.EnrollTwoFactor(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(enrollment.Secret, check.HasLen, 32)
+	c.Assert(enrollment.URI, check.Matches, "otpauth://totp/tsuru:timeredbull@globo.com\\?.*secret="+enrollment.Secret+".*")
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf.Enabled, check.Equals, false)
+	enabled, err := nativeScheme.TwoFactorEnabled(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(enabled, check.Equals, false)
+}
+
+func (s *S) TestConfirmTwoFactor(c *check.C) {
+	secret, codes := s.enableTwoFactor(c)
+	c.Assert(codes, check.HasLen, recoveryCodesCount)
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf.Enabled, check.Equals, true)
+	c.Assert(tf.Secret, check.Equals, secret)
+	c.Assert(tf.RecoveryCodes, check.HasLen, recoveryCodesCount)
+	c.Assert(tf.RecoveryCodes[0], check.Equals, hashRecoveryCode(codes[0]))
+	enabled, err := nativeScheme.TwoFactorEnabled(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(enabled, check.Equals, true)
+}
+
+func (s *S) TestConfirmTwoFactorInvalidCode(c *check.C) {
+	_, err := nativeScheme.EnrollTwoFactor(s.user)
+	c.Assert(err, check.IsNil)
+	_, err = nativeScheme.ConfirmTwoFactor(s.user, s.token, "000000")
+	c.Assert(err, check.Equals, errInvalidTwoFactorCode)
+	_, err = nativeScheme.ConfirmTwoFactor(s.user, s.token, "")
+	c.Assert(err, check.Equals, ErrTwoFactorCodeRequired)
+}
+
+func (s *S) TestConfirmTwoFactorNotEnrolled(c *check.C) {
+	_, err := nativeScheme.ConfirmTwoFactor(s.user, s.token, "123456")
+	c.Assert(err, check.Equals, ErrTwoFactorNotEnrolled)
+}
+
+func (s *S) TestEnrollTwoFactorAlreadyEnabled(c *check.C) {
+	s.enableTwoFactor(c)
+	_, err := nativeScheme.EnrollTwoFactor(s.user)
+	c.Assert(err, check.Equals, ErrTwoFactorAlreadyEnabled)
+}
+
+func (s *S) TestNativeLoginTwoFactorCodeRequired(c *check.C) {
+	s.enableTwoFactor(c)
+	_, err := nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.Equals, ErrTwoFactorCodeRequired)
+}
+
+func (s *S) TestNativeLoginTwoFactorWrongPasswordFirst(c *check.C) {
+	s.enableTwoFactor(c)
+	_, err := nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "wrongpass"})
+	_, isAuthFail := err.(auth.AuthenticationFailure)
+	c.Assert(isAuthFail, check.Equals, true)
+}
+
+func (s *S) TestNativeLoginTwoFactor(c *check.C) {
+	secret, _ := s.enableTwoFactor(c)
+	code := s.currentCode(c, secret, 0)
+	token, err := nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456", "otp": code})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetUserName(), check.Equals, s.user.Email)
+	_, err = nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456", "otp": code})
+	c.Assert(err, check.Equals, errInvalidTwoFactorCode)
+}
+
+func (s *S) TestNativeLoginTwoFactorRecoveryCode(c *check.C) {
+	_, codes := s.enableTwoFactor(c)
+	params := map[string]string{"email": s.user.Email, "password": "123456", "otp": codes[3]}
+	_, err := nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.Equals, errInvalidTwoFactorCode)
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf.RecoveryCodes, check.HasLen, recoveryCodesCount-1)
+}
+
+func (s *S) TestNativeLoginTwoFactorRequiredByRole(c *check.C) {
+	_, err := permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("admin", "")
+	c.Assert(err, check.IsNil)
+	config.Set("auth:two-factor:required-roles", []string{"admin"})
+	defer config.Unset("auth:two-factor:required-roles")
+	token, err := nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+	perms, err := token.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.HasLen, 0)
+	s.enableTwoFactor(c)
+	dbToken, err := nativeScheme.Auth(token.GetValue())
+	c.Assert(err, check.IsNil)
+	perms, err = dbToken.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(len(perms) > 0, check.Equals, true)
+}
+
+func (s *S) TestDisableTwoFactor(c *check.C) {
+	secret, _ := s.enableTwoFactor(c)
+	err := nativeScheme.DisableTwoFactor(s.user, "")
+	c.Assert(err, check.Equals, ErrTwoFactorCodeRequired)
+	err = nativeScheme.DisableTwoFactor(s.user, s.currentCode(c, secret, 0))
+	c.Assert(err, check.IsNil)
+	_, err = getTwoFactor(s.user.Email)
+	c.Assert(err, check.Equals, ErrTwoFactorNotEnrolled)
+	_, err = nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestDisableTwoFactorRequiredByRole(c *check.C) {
+	_, err := permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("admin", "")
+	c.Assert(err, check.IsNil)
+	config.Set("auth:two-factor:required-roles", []string{"admin"})
+	defer config.Unset("auth:two-factor:required-roles")
+	secret, _ := s.enableTwoFactor(c)
+	err = nativeScheme.DisableTwoFactor(s.user, s.currentCode(c, secret, 0))
+	c.Assert(err, check.Equals, ErrTwoFactorRequired)
+}
+
+func (s *S) TestRegenerateRecoveryCodes(c *check.C) {
+	secret, codes := s.enableTwoFactor(c)
+	newCodes, err := nativeScheme.RegenerateRecoveryCodes(s.user, s.currentCode(c, secret, 0))
+	c.Assert(err, check.IsNil)
+	c.Assert(newCodes, check.HasLen, recoveryCodesCount)
+	_, err = nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456", "otp": codes[0]})
+	c.Assert(err, check.Equals, errInvalidTwoFactorCode)
+	_, err = nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456", "otp": newCodes[0]})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestNativeRemoveClearsTwoFactor(c *check.C) {
+	s.enableTwoFactor(c)
+	err := nativeScheme.Remove(s.user)
+	c.Assert(err, check.IsNil)
+	_, err = getTwoFactor(s.user.Email)
+	c.Assert(err, check.Equals, ErrTwoFactorNotEnrolled)
+}
+
+func (s *S) TestConfirmTwoFactorUpgradesOnlyConfirmingToken(c *check.C) {
+	confirming, err := insertToken(s.user, true)
+	c.Assert(err, check.IsNil)
+	other, err := insertToken(s.user, true)
+	c.Assert(err, check.IsNil)
+	enrollment, err := nativeScheme.EnrollTwoFactor(s.user)
+	c.Assert(err, check.IsNil)
+	_, err = nativeScheme.ConfirmTwoFactor(s.user, confirming, s.currentCode(c, enrollment.Secret, -1))
+	c.Assert(err, check.IsNil)
+	t, err := getToken("bearer " + confirming.Token)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.IsTwoFactorPending(), check.Equals, false)
+	_, err = getToken("bearer " + other.Token)
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+)
+
+// RoleMapping grants a role to every user whose groups claim contains Group.
+// When Team is set it is used as the role context value and must reference
+// an existing team.
+type RoleMapping struct {
+	Group        string
+	Role         string
+	ContextValue string
+	Team         string
+}
+
+func (m *RoleMapping) contextValue() string {
+	if m.Team != "" {
+		return m.Team
+	}
+	return m.ContextValue
+}
+
+func loadRoleMappings() ([]RoleMapping, error) {
+	data, err := config.Get("auth:oidc:role-mappings")
+	if err != nil {
+		return nil, nil
+	}
+	entries, ok := data.([]interface{})
+	if !ok {
+		return nil, errors.New("auth:oidc:role-mappings must be a list")
+	}
+	mappings := make([]RoleMapping, 0, len(entries))
+	for i, entry := range entries {
+		values, ok := entry.(map[interface{}]interface{})
+		if !ok {
+			return nil, errors.Errorf("invalid entry %d in auth:oidc:role-mappings", i)
+		}
+		var m RoleMapping
+		m.Group = stringValue(values["group"])
+		m.Role = stringValue(values["role"])
+		m.ContextValue = stringValue(values["context-value"])
+		m.Team = stringValue(values["team"])
+		if m.Group == "" || m.Role == "" {
+			return nil, errors.Errorf("entry %d in auth:oidc:role-mappings requires group and role", i)
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+const mappedRolesCollection = "oidc_mapped_roles"
+
+// mappedRoles records the roles granted to a user by the role mappings, so
+// only those are removed when the user leaves a group.
+type mappedRoles struct {
+	Email string `bson:"_id"`
+	Roles []auth.RoleInstance
+}
+
+// applyRoleMappings synchronizes the roles managed by the mappings with the
+// groups received in the latest ID token. Roles are added to users in a
+// matching group and, when they were granted by a mapping, removed from users
+// no longer in it. Roles the user already held when the mapping would grant
+// them are considered manually assigned and are never touched.
+func applyRoleMappings(user *auth.User, mappings []RoleMapping, groups []string) error {
+	groupSet := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		groupSet[g] = struct{}{}
+	}
+	wanted := make(map[auth.RoleInstance]bool)
+	for _, m := range mappings {
+		ri := auth.RoleInstance{Name: m.Role, ContextValue: m.contextValue()}
+		if _, ok := groupSet[m.Group]; ok {
+			if m.Team != "" {
+				if _, err := auth.GetTeam(m.Team); err != nil {
+					log.Errorf("[oidc] unable to map group %q to team %q: %s", m.Group, m.Team, err)
+					continue
+				}
+			}
+			wanted[ri] = true
+		} else if _, ok := wanted[ri]; !ok {
+			wanted[ri] = false
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Collection(mappedRolesCollection)
+	var mapped mappedRoles
+	err = coll.FindId(user.Email).One(&mapped)
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	granted := make(map[auth.RoleInstance]struct{}, len(mapped.Roles))
+	for _, r := range mapped.Roles {
+		granted[r] = struct{}{}
+	}
+	current := make(map[auth.RoleInstance]struct{}, len(user.Roles))
+	for _, r := range user.Roles {
+		current[r] = struct{}{}
+	}
+	for ri, add := range wanted {
+		_, has := current[ri]
+		_, isMapped := granted[ri]
+		if add && !has {
+			err = user.AddRole(ri.Name, ri.ContextValue)
+			granted[ri] = struct{}{}
+		} else if !add && isMapped {
+			if has {
+				err = user.RemoveRole(ri.Name, ri.ContextValue)
+			}
+			delete(granted, ri)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to sync role %q(%s) for %q", ri.Name, ri.ContextValue, user.Email)
+		}
+	}
+	mapped = mappedRoles{Email: user.Email}
+	for ri := range granted {
+		mapped.Roles = append(mapped.Roles, ri)
+	}
+	_, err = coll.UpsertId(user.Email, mapped)
+	return err
+}
+
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			result = append(result, fmt.Sprint(item))
+		}
+		return result
+	}
+	return nil
+}
+
+func stringValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
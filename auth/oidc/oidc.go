@@ -0,0 +1,249 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/native"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/validation"
+)
+
+var (
+	ErrMissingCodeError       = &tsuruErrors.ValidationError{Message: "You must provide code to login"}
+	ErrMissingCodeRedirectUrl = &tsuruErrors.ValidationError{Message: "You must provide the used redirect url to login"}
+	ErrMissingIDToken         = &tsuruErrors.NotAuthorizedError{Message: "Identity provider did not return an id token."}
+	ErrEmptyUserEmail         = &tsuruErrors.NotAuthorizedError{Message: "Couldn't find user email in id token."}
+	ErrEmailNotVerified       = &tsuruErrors.NotAuthorizedError{Message: "User email is not verified by the identity provider."}
+)
+
+const (
+	defaultEmailClaim  = "email"
+	defaultGroupsClaim = "groups"
+)
+
+type OIDCScheme struct {
+	BaseConfig BaseConfig
+	provider   *provider
+}
+
+type BaseConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	CallbackPort int
+	EmailClaim   string
+	GroupsClaim  string
+	RoleMappings []RoleMapping
+}
+
+func init() {
+	auth.RegisterScheme("oidc", &OIDCScheme{})
+}
+
+// This method loads basic config and returns a copy of the
+// config object.
+func (s *OIDCScheme) loadConfig() (BaseConfig, error) {
+	if s.BaseConfig.ClientID != "" {
+		return s.BaseConfig, nil
+	}
+	var emptyConfig BaseConfig
+	issuer, err := config.GetString("auth:oidc:issuer")
+	if err != nil {
+		return emptyConfig, err
+	}
+	clientID, err := config.GetString("auth:oidc:client-id")
+	if err != nil {
+		return emptyConfig, err
+	}
+	clientSecret, err := config.GetString("auth:oidc:client-secret")
+	if err != nil {
+		log.Debugf("auth:oidc:client-secret not found, acting as a public client: %s", err)
+	}
+	scopes, err := config.GetList("auth:oidc:scopes")
+	if err != nil || len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	callbackPort, err := config.GetInt("auth:oidc:callback-port")
+	if err != nil {
+		log.Debugf("auth:oidc:callback-port not found using random port: %s", err)
+	}
+	emailClaim, err := config.GetString("auth:oidc:email-claim")
+	if err != nil {
+		emailClaim = defaultEmailClaim
+	}
+	groupsClaim, err := config.GetString("auth:oidc:groups-claim")
+	if err != nil {
+		groupsClaim = defaultGroupsClaim
+	}
+	mappings, err := loadRoleMappings()
+	if err != nil {
+		return emptyConfig, err
+	}
+	s.BaseConfig = BaseConfig{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		CallbackPort: callbackPort,
+		EmailClaim:   emailClaim,
+		GroupsClaim:  groupsClaim,
+		RoleMappings: mappings,
+	}
+	s.provider = newProvider(issuer)
+	return s.BaseConfig, nil
+}
+
+func (s *OIDCScheme) getProvider() (*provider, error) {
+	conf, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if s.provider == nil {
+		s.provider = newProvider(conf.Issuer)
+	}
+	return s.provider, nil
+}
+
+func (s *OIDCScheme) Login(params map[string]string) (auth.Token, error) {
+	conf, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	code, ok := params["code"]
+	if !ok {
+		return nil, ErrMissingCodeError
+	}
+	redirectUrl, ok := params["redirectUrl"]
+	if !ok {
+		return nil, ErrMissingCodeRedirectUrl
+	}
+	p, err := s.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := p.exchange(&conf, code, redirectUrl, params["code_verifier"])
+	if err != nil {
+		return nil, err
+	}
+	if rsp.IDToken == "" {
+		return nil, ErrMissingIDToken
+	}
+	claims, err := p.verify(rsp.IDToken, conf.ClientID)
+	if err != nil {
+		return nil, &tsuruErrors.NotAuthorizedError{Message: err.Error()}
+	}
+	email := stringValue(claims[conf.EmailClaim])
+	if email == "" {
+		return nil, ErrEmptyUserEmail
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, ErrEmailNotVerified
+	}
+	if !validation.ValidateEmail(email) {
+		return nil, &tsuruErrors.ValidationError{Message: "invalid email in id token"}
+	}
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		if err != auth.ErrUserNotFound {
+			return nil, err
+		}
+		registrationEnabled, _ := config.GetBool("auth:user-registration")
+		if !registrationEnabled {
+			return nil, err
+		}
+		user = &auth.User{Email: email}
+		err = user.Create()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(conf.RoleMappings) > 0 {
+		err = applyRoleMappings(user, conf.RoleMappings, claimStrings(claims[conf.GroupsClaim]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return native.CreateUserToken(user)
+}
+
+func (s *OIDCScheme) AppLogin(appName string) (auth.Token, error) {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.AppLogin(appName)
+}
+
+func (s *OIDCScheme) AppLogout(token string) error {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.AppLogout(token)
+}
+
+func (s *OIDCScheme) Logout(token string) error {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.Logout(token)
+}
+
+func (s *OIDCScheme) Auth(header string) (auth.Token, error) {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.Auth(header)
+}
+
+func (s *OIDCScheme) Name() string {
+	return "oidc"
+}
+
+// Info returns the authorization URL with a placeholder for the redirect
+// URL. Clients are expected to add their own PKCE code challenge to it and
+// send the matching code_verifier on login.
+func (s *OIDCScheme) Info() (auth.SchemeInfo, error) {
+	conf, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", conf.ClientID)
+	v.Set("scope", strings.Join(conf.Scopes, " "))
+	v.Set("redirect_uri", "__redirect_url__")
+	authURL := doc.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&"
+	} else {
+		authURL += "?"
+	}
+	return auth.SchemeInfo{
+		"authorizeUrl": authURL + v.Encode(),
+		"port":         strconv.Itoa(conf.CallbackPort),
+		"pkce":         "S256",
+	}, nil
+}
+
+func (s *OIDCScheme) Create(user *auth.User) (*auth.User, error) {
+	user.Password = ""
+	err := user.Create()
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *OIDCScheme) Remove(u *auth.User) error {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.Remove(u)
+}
@@ -0,0 +1,283 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/repository/repositorytest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestOIDCLoginWithoutCode(c *check.C) {
+	scheme := OIDCScheme{}
+	params := map[string]string{"redirectUrl": "http://localhost"}
+	_, err := scheme.Login(params)
+	c.Assert(err, check.Equals, ErrMissingCodeError)
+}
+
+func (s *S) TestOIDCLoginWithoutRedirectUrl(c *check.C) {
+	scheme := OIDCScheme{}
+	params := map[string]string{"code": "abcdefg"}
+	_, err := scheme.Login(params)
+	c.Assert(err, check.Equals, ErrMissingCodeRedirectUrl)
+}
+
+func (s *S) TestOIDCLogin(c *check.C) {
+	scheme := OIDCScheme{}
+	params := map[string]string{
+		"code":          "abcdefg",
+		"redirectUrl":   "http://localhost",
+		"code_verifier": "myverifier",
+	}
+	token, err := scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetUserName(), check.Equals, "rand@althor.com")
+	c.Assert(token.IsAppToken(), check.Equals, false)
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Email, check.Equals, "rand@althor.com")
+	var tokenReq *url.Values
+	for _, r := range s.reqs {
+		if r.URL.Path == "/token" {
+			tokenReq = &r.PostForm
+		}
+	}
+	c.Assert(tokenReq, check.NotNil)
+	c.Assert(tokenReq.Get("code_verifier"), check.Equals, "myverifier")
+	c.Assert(tokenReq.Get("client_secret"), check.Equals, "clientsecret")
+	c.Assert(tokenReq.Get("redirect_uri"), check.Equals, "http://localhost")
+	dbToken, err := scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbToken.GetUserName(), check.Equals, "rand@althor.com")
+}
+
+func (s *S) TestOIDCLoginRegistrationDisabled(c *check.C) {
+	config.Set("auth:user-registration", false)
+	defer config.Set("auth:user-registration", true)
+	scheme := OIDCScheme{}
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	_, err := scheme.Login(params)
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestOIDCLoginInvalidCode(c *check.C) {
+	scheme := OIDCScheme{}
+	params := map[string]string{"code": "wrong", "redirectUrl": "http://localhost"}
+	_, err := scheme.Login(params)
+	c.Assert(err, check.ErrorMatches, `unexpected token response 400: .*invalid_grant.*`)
+}
+
+func (s *S) TestOIDCLoginMissingIDToken(c *check.C) {
+	s.noToken = true
+	scheme := OIDCScheme{}
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	_, err := scheme.Login(params)
+	c.Assert(err, check.Equals, ErrMissingIDToken)
+}
+
+func (s *S) TestOIDCLoginInvalidAudience(c *check.C) {
+	s.claims["aud"] = "otherclient"
+	scheme := OIDCScheme{}
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	_, err := scheme.Login(params)
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.NotAuthorizedError{})
+	c.Assert(err, check.ErrorMatches, `id token audience does not contain "clientid"`)
+}
+
+func (s *S) TestOIDCLoginExpiredToken(c *check.C) {
+	s.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	scheme := OIDCScheme{}
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	_, err := scheme.Login(params)
+	c.Assert(err, check.ErrorMatches, `invalid id token: .*expired.*`)
+}
+
+func (s *S) TestOIDCLoginEmptyEmail(c *check.C) {
+	delete(s.claims, "email")
+	scheme := OIDCScheme{}
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	_, err := scheme.Login(params)
+	c.Assert(err, check.Equals, ErrEmptyUserEmail)
+}
+
+func (s *S) TestOIDCLoginEmailNotVerified(c *check.C) {
+	s.claims["email_verified"] = false
+	scheme := OIDCScheme{}
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	_, err := scheme.Login(params)
+	c.Assert(err, check.Equals, ErrEmailNotVerified)
+}
+
+func (s *S) TestOIDCLoginAppliesRoleMappings(c *check.C) {
+	s.createRole(c, "team-member", "team")
+	s.createRole(c, "viewer", "global")
+	s.createRole(c, "manual", "global")
+	user := &auth.User{Email: "rand@althor.com"}
+	err := user.Create()
+	c.Assert(err, check.IsNil)
+	err = auth.CreateTeam("ops", user)
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("viewer", "")
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("manual", "")
+	c.Assert(err, check.IsNil)
+	scheme := OIDCScheme{}
+	_, err = scheme.loadConfig()
+	c.Assert(err, check.IsNil)
+	scheme.BaseConfig.RoleMappings = []RoleMapping{
+		{Group: "ops-group", Role: "team-member", Team: "ops"},
+		{Group: "viewers", Role: "viewer"},
+	}
+	s.claims["groups"] = []string{"ops-group", "other"}
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	_, err = scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	err = user.Reload()
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.DeepEquals, []auth.RoleInstance{
+		{Name: "viewer", ContextValue: ""},
+		{Name: "manual", ContextValue: ""},
+		{Name: "team-member", ContextValue: "ops"},
+	})
+	s.claims["groups"] = []string{"viewers"}
+	_, err = scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	err = user.Reload()
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.DeepEquals, []auth.RoleInstance{
+		{Name: "viewer", ContextValue: ""},
+		{Name: "manual", ContextValue: ""},
+	})
+}
+
+func (s *S) TestOIDCLoginRemovesOnlyMappedRoles(c *check.C) {
+	s.createRole(c, "viewer", "global")
+	scheme := OIDCScheme{}
+	_, err := scheme.loadConfig()
+	c.Assert(err, check.IsNil)
+	scheme.BaseConfig.RoleMappings = []RoleMapping{
+		{Group: "viewers", Role: "viewer"},
+	}
+	s.claims["groups"] = []string{"viewers"}
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	token, err := scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	user, err := token.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.DeepEquals, []auth.RoleInstance{{Name: "viewer", ContextValue: ""}})
+	s.claims["groups"] = []string{}
+	_, err = scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	err = user.Reload()
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.HasLen, 0)
+}
+
+func (s *S) TestOIDCLoginRoleMappingUnknownTeam(c *check.C) {
+	s.createRole(c, "team-member", "team")
+	scheme := OIDCScheme{}
+	_, err := scheme.loadConfig()
+	c.Assert(err, check.IsNil)
+	scheme.BaseConfig.RoleMappings = []RoleMapping{
+		{Group: "ops-group", Role: "team-member", Team: "unknown"},
+	}
+	s.claims["groups"] = "ops-group"
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	token, err := scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	user, err := token.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.HasLen, 0)
+}
+
+func (s *S) TestLoadRoleMappings(c *check.C) {
+	config.Set("auth:oidc:role-mappings", []interface{}{
+		map[interface{}]interface{}{"group": "g1", "role": "r1", "context-value": "c1"},
+		map[interface{}]interface{}{"group": "g2", "role": "r2", "team": "t2"},
+	})
+	defer config.Unset("auth:oidc:role-mappings")
+	mappings, err := loadRoleMappings()
+	c.Assert(err, check.IsNil)
+	c.Assert(mappings, check.DeepEquals, []RoleMapping{
+		{Group: "g1", Role: "r1", ContextValue: "c1"},
+		{Group: "g2", Role: "r2", Team: "t2"},
+	})
+}
+
+func (s *S) TestLoadRoleMappingsInvalid(c *check.C) {
+	config.Set("auth:oidc:role-mappings", []interface{}{
+		map[interface{}]interface{}{"group": "g1"},
+	})
+	defer config.Unset("auth:oidc:role-mappings")
+	_, err := loadRoleMappings()
+	c.Assert(err, check.ErrorMatches, `entry 0 in auth:oidc:role-mappings requires group and role`)
+}
+
+func (s *S) TestOIDCName(c *check.C) {
+	scheme := OIDCScheme{}
+	c.Assert(scheme.Name(), check.Equals, "oidc")
+}
+
+func (s *S) TestOIDCInfo(c *check.C) {
+	scheme := OIDCScheme{}
+	info, err := scheme.Info()
+	c.Assert(err, check.IsNil)
+	c.Assert(info["authorizeUrl"], check.Matches, s.server.URL+"/authorize\\?.*")
+	c.Assert(info["authorizeUrl"], check.Matches, ".*client_id=clientid.*")
+	c.Assert(info["authorizeUrl"], check.Matches, ".*redirect_uri=__redirect_url__.*")
+	c.Assert(info["authorizeUrl"], check.Matches, ".*scope=openid\\+email\\+profile.*")
+	c.Assert(info["port"], check.Equals, "0")
+	c.Assert(info["pkce"], check.Equals, "S256")
+}
+
+func (s *S) TestOIDCLogout(c *check.C) {
+	scheme := OIDCScheme{}
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	token, err := scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	err = scheme.Logout(token.GetValue())
+	c.Assert(err, check.IsNil)
+	_, err = scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+}
+
+func (s *S) TestOIDCAppLogin(c *check.C) {
+	scheme := OIDCScheme{}
+	token, err := scheme.AppLogin("myApp")
+	c.Assert(err, check.IsNil)
+	c.Assert(token.IsAppToken(), check.Equals, true)
+	c.Assert(token.GetAppName(), check.Equals, "myApp")
+}
+
+func (s *S) TestOIDCCreate(c *check.C) {
+	scheme := OIDCScheme{}
+	user := auth.User{Email: "x@x.com", Password: "something"}
+	_, err := scheme.Create(&user)
+	c.Assert(err, check.IsNil)
+	dbUser, err := auth.GetUserByEmail(user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbUser.Password, check.Equals, "")
+	c.Assert(repositorytest.Users(), check.DeepEquals, []string{user.Email})
+}
+
+func (s *S) TestOIDCRemove(c *check.C) {
+	scheme := OIDCScheme{}
+	params := map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"}
+	token, err := scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = scheme.Remove(u)
+	c.Assert(err, check.IsNil)
+	_, err = auth.GetUserByEmail("rand@althor.com")
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+	_, err = scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+}
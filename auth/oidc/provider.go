@@ -0,0 +1,255 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+// discovery is the subset of the OpenID Provider metadata document used by
+// tsuru.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// provider holds the discovered endpoints and the signing keys of an OpenID
+// Connect issuer. Keys are fetched lazily and refreshed whenever a token is
+// signed with an unknown key id.
+type provider struct {
+	sync.Mutex
+	issuer   string
+	client   *http.Client
+	doc      *discovery
+	keys     map[string]*rsa.PublicKey
+	keysTime time.Time
+}
+
+func newProvider(issuer string) *provider {
+	return &provider{
+		issuer: strings.TrimRight(issuer, "/"),
+		client: tsuruNet.Dial5Full300Client,
+	}
+}
+
+func (p *provider) getJSON(addr string, out interface{}) error {
+	rsp, err := p.client.Get(addr)
+	if err != nil {
+		return errors.Wrapf(err, "unable to request %s", addr)
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read response from %s", addr)
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected response from %s - %d: %s", addr, rsp.StatusCode, data)
+	}
+	err = json.Unmarshal(data, out)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse response from %s: %s", addr, data)
+	}
+	return nil
+}
+
+func (p *provider) discover() (*discovery, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.doc != nil {
+		return p.doc, nil
+	}
+	var doc discovery
+	err := p.getJSON(p.issuer+discoveryPath, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(doc.Issuer, "/") != p.issuer {
+		return nil, errors.Errorf("issuer mismatch in discovery document, expected %q, got %q", p.issuer, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+	p.doc = &doc
+	return p.doc, nil
+}
+
+func (p *provider) refreshKeys() error {
+	doc, err := p.discover()
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = p.getJSON(doc.JWKSURI, &set)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		pubKey, err := k.rsaKey()
+		if err != nil {
+			return err
+		}
+		keys[k.Kid] = pubKey
+	}
+	p.Lock()
+	p.keys = keys
+	p.keysTime = time.Now()
+	p.Unlock()
+	return nil
+}
+
+func (p *provider) key(kid string) (*rsa.PublicKey, error) {
+	p.Lock()
+	key, ok := p.keys[kid]
+	fresh := time.Since(p.keysTime) < time.Minute
+	p.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !fresh {
+		err := p.refreshKeys()
+		if err != nil {
+			return nil, err
+		}
+		p.Lock()
+		key, ok = p.keys[kid]
+		p.Unlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, errors.Errorf("unknown signing key %q", kid)
+}
+
+// verify checks the signature of a raw ID token against the issuer keys and
+// validates its standard claims, returning all claims on success.
+func (p *provider) verify(rawToken, clientID string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.Errorf("unexpected signing method %q", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(kid)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid id token")
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != p.issuer {
+		return nil, errors.Errorf("invalid id token issuer %q", iss)
+	}
+	if !claims.VerifyAudience(clientID, true) && !audienceContains(claims["aud"], clientID) {
+		return nil, errors.Errorf("id token audience does not contain %q", clientID)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("id token has no expiration")
+	}
+	return claims, nil
+}
+
+// exchange trades an authorization code for tokens at the token endpoint,
+// forwarding the PKCE code verifier when the client provided one.
+func (p *provider) exchange(cfg *BaseConfig, code, redirectURL, codeVerifier string) (*tokenResponse, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", redirectURL)
+	v.Set("client_id", cfg.ClientID)
+	if cfg.ClientSecret != "" {
+		v.Set("client_secret", cfg.ClientSecret)
+	}
+	if codeVerifier != "" {
+		v.Set("code_verifier", codeVerifier)
+	}
+	rsp, err := p.client.PostForm(doc.TokenEndpoint, v)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to exchange code")
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read token response")
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected token response %d: %s", rsp.StatusCode, data)
+	}
+	var result tokenResponse
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse token response: %s", data)
+	}
+	return &result, nil
+}
+
+func (k *jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.N, "="))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid modulus for key %q", k.Kid)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.E, "="))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid exponent for key %q", k.Kid)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	list, ok := aud.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, a := range list {
+		if s, _ := a.(string); s == clientID {
+			return true
+		}
+	}
+	return false
+}
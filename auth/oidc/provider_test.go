@@ -0,0 +1,83 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestProviderDiscover(c *check.C) {
+	p := newProvider(s.server.URL + "/")
+	doc, err := p.discover()
+	c.Assert(err, check.IsNil)
+	c.Assert(doc.TokenEndpoint, check.Equals, s.server.URL+"/token")
+	c.Assert(doc.JWKSURI, check.Equals, s.server.URL+"/keys")
+	_, err = p.discover()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.reqs, check.HasLen, 1)
+}
+
+func (s *S) TestProviderDiscoverIssuerMismatch(c *check.C) {
+	p := newProvider(s.server.URL + "/other")
+	_, err := p.discover()
+	c.Assert(err, check.ErrorMatches, `unexpected response from .*/other/.well-known/openid-configuration - 404: `)
+}
+
+func (s *S) TestProviderVerify(c *check.C) {
+	p := newProvider(s.server.URL)
+	claims, err := p.verify(s.signToken(s.claims, "key1"), "clientid")
+	c.Assert(err, check.IsNil)
+	c.Assert(claims["email"], check.Equals, "rand@althor.com")
+}
+
+func (s *S) TestProviderVerifyAudienceList(c *check.C) {
+	s.claims["aud"] = []string{"other", "clientid"}
+	p := newProvider(s.server.URL)
+	_, err := p.verify(s.signToken(s.claims, "key1"), "clientid")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestProviderVerifyUnknownKey(c *check.C) {
+	p := newProvider(s.server.URL)
+	_, err := p.verify(s.signToken(s.claims, "key2"), "clientid")
+	c.Assert(err, check.ErrorMatches, `invalid id token: unknown signing key "key2"`)
+}
+
+func (s *S) TestProviderVerifyInvalidIssuer(c *check.C) {
+	s.claims["iss"] = "http://evil.example.com"
+	p := newProvider(s.server.URL)
+	_, err := p.verify(s.signToken(s.claims, "key1"), "clientid")
+	c.Assert(err, check.ErrorMatches, `invalid id token issuer "http://evil.example.com"`)
+}
+
+func (s *S) TestProviderVerifyMissingExpiration(c *check.C) {
+	delete(s.claims, "exp")
+	p := newProvider(s.server.URL)
+	_, err := p.verify(s.signToken(s.claims, "key1"), "clientid")
+	c.Assert(err, check.ErrorMatches, `id token has no expiration`)
+}
+
+func (s *S) TestProviderVerifyRejectsHMAC(c *check.C) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, s.claims)
+	token.Header["kid"] = "key1"
+	raw, err := token.SignedString([]byte("secret"))
+	c.Assert(err, check.IsNil)
+	p := newProvider(s.server.URL)
+	_, err = p.verify(raw, "clientid")
+	c.Assert(err, check.ErrorMatches, `invalid id token: unexpected signing method "HS256"`)
+}
+
+func (s *S) TestProviderKeysCached(c *check.C) {
+	p := newProvider(s.server.URL)
+	_, err := p.verify(s.signToken(s.claims, "key1"), "clientid")
+	c.Assert(err, check.IsNil)
+	s.claims["exp"] = time.Now().Add(2 * time.Hour).Unix()
+	_, err = p.verify(s.signToken(s.claims, "key1"), "clientid")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.reqs, check.HasLen, 2)
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/repository/repositorytest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	conn    *db.Storage
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	reqs    []*http.Request
+	claims  jwt.MapClaims
+	noToken bool
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	var err error
+	s.key, err = rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, check.IsNil)
+	s.server = httptest.NewServer(http.HandlerFunc(s.idpHandler))
+	config.Set("auth:oidc:issuer", s.server.URL)
+	config.Set("auth:oidc:client-id", "clientid")
+	config.Set("auth:oidc:client-secret", "clientsecret")
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_auth_oidc_test")
+	config.Set("auth:user-registration", true)
+	config.Set("repo-manager", "fake")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.conn, _ = db.Conn()
+	s.reqs = nil
+	s.noToken = false
+	s.claims = jwt.MapClaims{
+		"iss":   s.server.URL,
+		"aud":   "clientid",
+		"sub":   "1234",
+		"email": "rand@althor.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	repositorytest.Reset()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	err := dbtest.ClearAllCollections(s.conn.Users().Database)
+	c.Assert(err, check.IsNil)
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	s.server.Close()
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Users().Database.DropDatabase()
+}
+
+func (s *S) idpHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	s.reqs = append(s.reqs, r)
+	switch r.URL.Path {
+	case discoveryPath:
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.server.URL,
+			"authorization_endpoint": s.server.URL + "/authorize",
+			"token_endpoint":         s.server.URL + "/token",
+			"jwks_uri":               s.server.URL + "/keys",
+		})
+	case "/keys":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			}},
+		})
+	case "/token":
+		if r.FormValue("code") != "abcdefg" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		rsp := map[string]interface{}{"access_token": "my_token", "token_type": "Bearer"}
+		if !s.noToken {
+			rsp["id_token"] = s.signToken(s.claims, "key1")
+		}
+		json.NewEncoder(w).Encode(rsp)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *S) signToken(claims jwt.MapClaims, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(s.key)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+func (s *S) createRole(c *check.C, name, ctx string) {
+	_, err := permission.NewRole(name, ctx, "")
+	c.Assert(err, check.IsNil)
+}
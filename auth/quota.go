@@ -7,6 +7,7 @@ package auth
 import (
 	"github.com/pkg/errors"
 	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/quota"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -104,3 +105,120 @@ func ChangeQuota(user *User, limit int) error {
 	user.Quota.Limit = limit
 	return user.Update()
 }
+
+// ReserveTeamApp reserves an app in the quota of the team, returning an error
+// when the team reached its limit of apps. Teams without a quota are not
+// limited.
+func ReserveTeamApp(teamName string) error {
+	return reserveTeamQuota(teamName, "apps", 1)
+}
+
+// ReleaseTeamApp releases an app from the quota of the team.
+func ReleaseTeamApp(teamName string) error {
+	return reserveTeamQuota(teamName, "apps", -1)
+}
+
+// ReserveTeamUnits reserves n units in the quota of the team, returning an
+// error when there isn't enough space available.
+func ReserveTeamUnits(teamName string, n int) error {
+	return reserveTeamQuota(teamName, "units", n)
+}
+
+// ReleaseTeamUnits releases n units from the quota of the team.
+func ReleaseTeamUnits(teamName string, n int) error {
+	return reserveTeamQuota(teamName, "units", -n)
+}
+
+func reserveTeamQuota(teamName, resource string, n int) error {
+	if n == 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	field := "quota." + resource + ".inuse"
+	for {
+		team, err := GetTeam(teamName)
+		if err == ErrTeamNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if team.Quota == nil {
+			return nil
+		}
+		q := team.Quota.Apps
+		if resource == "units" {
+			q = team.Quota.Units
+		}
+		inc := n
+		if n > 0 && !q.Unlimited() && q.InUse+n > q.Limit {
+			available := q.Limit - q.InUse
+			if available < 0 {
+				available = 0
+			}
+			return &quota.QuotaExceededError{Available: uint(available), Requested: uint(n)}
+		}
+		if q.InUse+inc < 0 {
+			inc = -q.InUse
+		}
+		if inc == 0 {
+			return nil
+		}
+		err = conn.Teams().Update(
+			bson.M{"_id": team.Name, field: q.InUse},
+			bson.M{"$inc": bson.M{field: inc}},
+		)
+		if err != mgo.ErrNotFound {
+			return err
+		}
+	}
+}
+
+// ChangeTeamQuota redefines the limits of apps and units of the team. Negative
+// limits mean unlimited. The usage is recalculated from the apps owned by the
+// team, and the new limits must not be lesser than it.
+func ChangeTeamQuota(team *Team, appsLimit, unitsLimit int) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var apps []struct {
+		Quota quota.Quota
+	}
+	err = conn.Apps().Find(bson.M{"teamowner": team.Name}).Select(bson.M{"quota": 1}).All(&apps)
+	if err != nil {
+		return err
+	}
+	var units int
+	for _, a := range apps {
+		units += a.Quota.InUse
+	}
+	if appsLimit < 0 {
+		appsLimit = -1
+	} else if appsLimit < len(apps) {
+		return &tsuruErrors.ValidationError{Message: "new apps limit is lesser than the current allocated value"}
+	}
+	if unitsLimit < 0 {
+		unitsLimit = -1
+	} else if unitsLimit < units {
+		return &tsuruErrors.ValidationError{Message: "new units limit is lesser than the current allocated value"}
+	}
+	q := TeamQuota{
+		Apps:  quota.Quota{Limit: appsLimit, InUse: len(apps)},
+		Units: quota.Quota{Limit: unitsLimit, InUse: units},
+	}
+	err = conn.Teams().UpdateId(team.Name, bson.M{"$set": bson.M{"quota": q}})
+	if err == mgo.ErrNotFound {
+		return ErrTeamNotFound
+	}
+	if err != nil {
+		return err
+	}
+	team.Quota = &q
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/tsuru/tsuru/quota"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func (s *S) TestReserveApp(c *check.C) {
@@ -265,3 +266,89 @@ func (s *S) TestChangeQuotaUserNotFound(c *check.C) {
 	c.Assert(err, check.NotNil)
 	c.Assert(err, check.Equals, mgo.ErrNotFound)
 }
+
+func (s *S) TestReserveTeamApp(c *check.C) {
+	team := Team{Name: "quotateam", Quota: &TeamQuota{Apps: quota.Quota{Limit: 1}, Units: quota.Unlimited}}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	err = ReserveTeamApp(team.Name)
+	c.Assert(err, check.IsNil)
+	err = ReserveTeamApp(team.Name)
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Available: 0, Requested: 1})
+	t, err := GetTeam(team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Quota.Apps.InUse, check.Equals, 1)
+	err = ReleaseTeamApp(team.Name)
+	c.Assert(err, check.IsNil)
+	t, err = GetTeam(team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Quota.Apps.InUse, check.Equals, 0)
+}
+
+func (s *S) TestReserveTeamAppWithoutQuota(c *check.C) {
+	err := ReserveTeamApp(s.team.Name)
+	c.Assert(err, check.IsNil)
+	err = ReserveTeamApp("unknownteam")
+	c.Assert(err, check.IsNil)
+	t, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Quota, check.IsNil)
+}
+
+func (s *S) TestReserveTeamUnits(c *check.C) {
+	team := Team{Name: "quotateam", Quota: &TeamQuota{Apps: quota.Unlimited, Units: quota.Quota{Limit: 5}}}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	err = ReserveTeamUnits(team.Name, 3)
+	c.Assert(err, check.IsNil)
+	err = ReserveTeamUnits(team.Name, 3)
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Available: 2, Requested: 3})
+	err = ReleaseTeamUnits(team.Name, 10)
+	c.Assert(err, check.IsNil)
+	t, err := GetTeam(team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Quota.Units.InUse, check.Equals, 0)
+}
+
+func (s *S) TestReserveTeamUnitsIsSafe(c *check.C) {
+	originalMaxProcs := runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(originalMaxProcs)
+	team := Team{Name: "quotateam", Quota: &TeamQuota{Apps: quota.Unlimited, Units: quota.Quota{Limit: 10}}}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	var wg sync.WaitGroup
+	for i := 0; i < 24; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ReserveTeamUnits(team.Name, 1)
+		}()
+	}
+	wg.Wait()
+	t, err := GetTeam(team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Quota.Units.InUse, check.Equals, 10)
+}
+
+func (s *S) TestChangeTeamQuota(c *check.C) {
+	err := s.conn.Apps().Insert(bson.M{"name": "app1", "teamowner": s.team.Name, "quota": quota.Quota{Limit: -1, InUse: 3}})
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Insert(bson.M{"name": "app2", "teamowner": s.team.Name, "quota": quota.Quota{Limit: -1, InUse: 2}})
+	c.Assert(err, check.IsNil)
+	err = ChangeTeamQuota(s.team, 4, 10)
+	c.Assert(err, check.IsNil)
+	t, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(*t.Quota, check.DeepEquals, TeamQuota{
+		Apps:  quota.Quota{Limit: 4, InUse: 2},
+		Units: quota.Quota{Limit: 10, InUse: 5},
+	})
+	err = ChangeTeamQuota(s.team, 1, 10)
+	c.Assert(err, check.ErrorMatches, "new apps limit is lesser than the current allocated value")
+	err = ChangeTeamQuota(s.team, -5, 4)
+	c.Assert(err, check.ErrorMatches, "new units limit is lesser than the current allocated value")
+	err = ChangeTeamQuota(s.team, -5, -2)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.team.Quota.Apps.Limit, check.Equals, -1)
+	c.Assert(s.team.Quota.Units.Limit, check.Equals, -1)
+}
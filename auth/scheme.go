@@ -27,6 +27,31 @@ type ManagedScheme interface {
 	ChangePassword(token Token, oldPassword string, newPassword string) error
 }
 
+// TwoFactorEnrollment holds the data a user needs to configure an
+// authenticator application.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TwoFactorScheme is implemented by schemes supporting TOTP based two-factor
+// authentication.
+type TwoFactorScheme interface {
+	Scheme
+	EnrollTwoFactor(user *User) (*TwoFactorEnrollment, error)
+	ConfirmTwoFactor(user *User, token Token, code string) ([]string, error)
+	DisableTwoFactor(user *User, code string) error
+	RegenerateRecoveryCodes(user *User, code string) ([]string, error)
+	TwoFactorEnabled(user *User) (bool, error)
+}
+
+// TwoFactorPendingToken is implemented by tokens which may be issued to users
+// that still have to enroll in a required two-factor authentication. Such
+// tokens must only be used for the enrollment.
+type TwoFactorPendingToken interface {
+	IsTwoFactorPending() bool
+}
+
 type AuthenticationFailure struct {
 	Message string
 }
@@ -7,20 +7,26 @@ package auth
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/validation"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 var (
-	ErrInvalidTeamName   = errors.New("invalid team name")
-	ErrTeamAlreadyExists = errors.New("team already exists")
-	ErrTeamNotFound      = errors.New("team not found")
+	ErrInvalidTeamName    = errors.New("invalid team name")
+	ErrTeamAlreadyExists  = errors.New("team already exists")
+	ErrTeamNotFound       = errors.New("team not found")
+	ErrInvalidTeamContact = &tsuruErrors.ValidationError{Message: "invalid team contact email"}
 
 	teamNameRegexp = regexp.MustCompile(`^[a-zA-Z][-@_.+\w]+$`)
 )
@@ -41,6 +47,24 @@ func (e *ErrTeamStillUsed) Error() string {
 type Team struct {
 	Name         string `bson:"_id" json:"name"`
 	CreatingUser string
+	Description  string     `json:"description,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	ContactEmail string     `json:"contact_email,omitempty"`
+	Quota        *TeamQuota `bson:",omitempty" json:"quota,omitempty"`
+}
+
+// TeamQuota holds the limits shared by all apps owned by a team. Teams
+// without a TeamQuota are not limited.
+type TeamQuota struct {
+	Apps  quota.Quota `json:"apps"`
+	Units quota.Quota `json:"units"`
+}
+
+// TeamMember represents a user holding at least one role in the context of a
+// team.
+type TeamMember struct {
+	Email string   `json:"email"`
+	Roles []string `json:"roles"`
 }
 
 // AllowedApps returns the apps that the team has access.
@@ -62,18 +86,103 @@ func (t *Team) AllowedApps() ([]string, error) {
 	return appNames, nil
 }
 
+// Members returns the users holding roles in the context of the team, along
+// with the names of these roles.
+func (t *Team) Members() ([]TeamMember, error) {
+	roles, err := permission.ListRoles()
+	if err != nil {
+		return nil, err
+	}
+	teamRoles := map[string]bool{}
+	for _, r := range roles {
+		if r.ContextType == permission.CtxTeam {
+			teamRoles[r.Name] = true
+		}
+	}
+	users, err := listUsers(bson.M{"roles.contextvalue": t.Name})
+	if err != nil {
+		return nil, err
+	}
+	members := []TeamMember{}
+	for _, u := range users {
+		var userRoles []string
+		for _, r := range u.Roles {
+			if r.ContextValue == t.Name && teamRoles[r.Name] {
+				userRoles = append(userRoles, r.Name)
+			}
+		}
+		if len(userRoles) > 0 {
+			sort.Strings(userRoles)
+			members = append(members, TeamMember{Email: u.Email, Roles: userRoles})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Email < members[j].Email })
+	return members, nil
+}
+
+// Update saves the description, tags and contact email of the team.
+func (t *Team) Update() error {
+	t.Tags = processTeamTags(t.Tags)
+	if t.ContactEmail != "" && !validation.ValidateEmail(t.ContactEmail) {
+		return ErrInvalidTeamContact
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Teams().UpdateId(t.Name, bson.M{"$set": bson.M{
+		"description":  t.Description,
+		"tags":         t.Tags,
+		"contactemail": t.ContactEmail,
+	}})
+	if err == mgo.ErrNotFound {
+		return ErrTeamNotFound
+	}
+	return err
+}
+
+func processTeamTags(tags []string) []string {
+	var result []string
+	used := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !used[tag] {
+			result = append(result, tag)
+			used[tag] = true
+		}
+	}
+	return result
+}
+
 // CreateTeam creates a team and add users to this team.
 func CreateTeam(name string, user *User) error {
+	return CreateTeamWithInfo(Team{Name: name}, user)
+}
+
+// CreateTeamWithInfo creates a team with the description, tags and contact
+// email set in the given team. The team quota is set to the values of
+// quota:apps-per-team and quota:units-per-team, which default to unlimited.
+func CreateTeamWithInfo(team Team, user *User) error {
 	if user == nil {
 		return errors.New("user cannot be null")
 	}
-	name = strings.TrimSpace(name)
+	name := strings.TrimSpace(team.Name)
 	if !isTeamNameValid(name) {
 		return ErrInvalidTeamName
 	}
-	team := Team{
-		Name:         name,
-		CreatingUser: user.Email,
+	if team.ContactEmail != "" && !validation.ValidateEmail(team.ContactEmail) {
+		return ErrInvalidTeamContact
+	}
+	team.Name = name
+	team.CreatingUser = user.Email
+	team.Tags = processTeamTags(team.Tags)
+	team.Quota = &TeamQuota{Apps: quota.Unlimited, Units: quota.Unlimited}
+	if limit, err := config.GetInt("quota:apps-per-team"); err == nil && limit > -1 {
+		team.Quota.Apps.Limit = limit
+	}
+	if limit, err := config.GetInt("quota:units-per-team"); err == nil && limit > -1 {
+		team.Quota.Units.Limit = limit
 	}
 	conn, err := db.Conn()
 	if err != nil {
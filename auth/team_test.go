@@ -7,6 +7,9 @@ package auth
 import (
 	"sort"
 
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/quota"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -48,6 +51,87 @@ func (s *S) TestCreateTeam(c *check.C) {
 	c.Assert(team.CreatingUser, check.Equals, one.Email)
 }
 
+func (s *S) TestCreateTeamWithInfo(c *check.C) {
+	config.Set("quota:units-per-team", 20)
+	defer config.Unset("quota:units-per-team")
+	one := User{Email: "king@pos.com"}
+	team := Team{
+		Name:         "pos",
+		Description:  "point of sale",
+		Tags:         []string{"billing", " sales ", "billing", ""},
+		ContactEmail: "pos@corp.globo.com",
+	}
+	err := CreateTeamWithInfo(team, &one)
+	c.Assert(err, check.IsNil)
+	t, err := GetTeam("pos")
+	c.Assert(err, check.IsNil)
+	c.Assert(t, check.DeepEquals, &Team{
+		Name:         "pos",
+		CreatingUser: one.Email,
+		Description:  "point of sale",
+		Tags:         []string{"billing", "sales"},
+		ContactEmail: "pos@corp.globo.com",
+		Quota:        &TeamQuota{Apps: quota.Unlimited, Units: quota.Quota{Limit: 20}},
+	})
+}
+
+func (s *S) TestCreateTeamWithInfoInvalidContact(c *check.C) {
+	one := User{Email: "king@pos.com"}
+	err := CreateTeamWithInfo(Team{Name: "pos", ContactEmail: "pos"}, &one)
+	c.Assert(err, check.Equals, ErrInvalidTeamContact)
+	_, err = GetTeam("pos")
+	c.Assert(err, check.Equals, ErrTeamNotFound)
+}
+
+func (s *S) TestTeamUpdate(c *check.C) {
+	s.team.Description = "the cobras"
+	s.team.Tags = []string{"snakes", "snakes"}
+	s.team.ContactEmail = "cobras@globo.com"
+	err := s.team.Update()
+	c.Assert(err, check.IsNil)
+	t, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Description, check.Equals, "the cobras")
+	c.Assert(t.Tags, check.DeepEquals, []string{"snakes"})
+	c.Assert(t.ContactEmail, check.Equals, "cobras@globo.com")
+	s.team.ContactEmail = "invalid"
+	err = s.team.Update()
+	c.Assert(err, check.Equals, ErrInvalidTeamContact)
+	err = (&Team{Name: "unknown"}).Update()
+	c.Assert(err, check.Equals, ErrTeamNotFound)
+}
+
+func (s *S) TestTeamMembers(c *check.C) {
+	_, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("team-admin", "team", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("god", "global", "")
+	c.Assert(err, check.IsNil)
+	u1 := User{Email: "zed@globo.com", Password: "123456"}
+	err = u1.Create()
+	c.Assert(err, check.IsNil)
+	u2 := User{Email: "ana@globo.com", Password: "123456"}
+	err = u2.Create()
+	c.Assert(err, check.IsNil)
+	err = u1.AddRole("team-member", s.team.Name)
+	c.Assert(err, check.IsNil)
+	err = u2.AddRole("team-member", s.team.Name)
+	c.Assert(err, check.IsNil)
+	err = u2.AddRole("team-admin", s.team.Name)
+	c.Assert(err, check.IsNil)
+	err = u2.AddRole("team-admin", "otherteam")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("god", "")
+	c.Assert(err, check.IsNil)
+	members, err := s.team.Members()
+	c.Assert(err, check.IsNil)
+	c.Assert(members, check.DeepEquals, []TeamMember{
+		{Email: "ana@globo.com", Roles: []string{"team-admin", "team-member"}},
+		{Email: "zed@globo.com", Roles: []string{"team-member"}},
+	})
+}
+
 func (s *S) TestCreateTeamDuplicate(c *check.C) {
 	u := User{Email: "king@pos.com"}
 	err := CreateTeam("pos", &u)
@@ -38,27 +38,7 @@ func ParseToken(header string) (string, error) {
 
 func BaseTokenPermission(t Token) ([]permission.Permission, error) {
 	if t.IsAppToken() {
-		// TODO(cezarsa): Improve handling of app tokens. These permissions
-		// listed here are the ones required by deploy-agent and legacy tsuru-
-		// unit-agent.
-		return []permission.Permission{
-			{
-				Scheme:  permission.PermAppUpdateUnitRegister,
-				Context: permission.Context(permission.CtxApp, t.GetAppName()),
-			},
-			{
-				Scheme:  permission.PermAppUpdateLog,
-				Context: permission.Context(permission.CtxApp, t.GetAppName()),
-			},
-			{
-				Scheme:  permission.PermAppUpdateUnitStatus,
-				Context: permission.Context(permission.CtxApp, t.GetAppName()),
-			},
-			{
-				Scheme:  permission.PermAppReadDeploy,
-				Context: permission.Context(permission.CtxApp, t.GetAppName()),
-			},
-		}, nil
+		return appTokenPermissions(t.GetAppName()), nil
 	}
 	user, err := t.User()
 	if err != nil {
@@ -66,3 +46,27 @@ func BaseTokenPermission(t Token) ([]permission.Permission, error) {
 	}
 	return user.Permissions()
 }
+
+func appTokenPermissions(appName string) []permission.Permission {
+	// TODO(cezarsa): Improve handling of app tokens. These permissions
+	// listed here are the ones required by deploy-agent and legacy tsuru-
+	// unit-agent.
+	return []permission.Permission{
+		{
+			Scheme:  permission.PermAppUpdateUnitRegister,
+			Context: permission.Context(permission.CtxApp, appName),
+		},
+		{
+			Scheme:  permission.PermAppUpdateLog,
+			Context: permission.Context(permission.CtxApp, appName),
+		},
+		{
+			Scheme:  permission.PermAppUpdateUnitStatus,
+			Context: permission.Context(permission.CtxApp, appName),
+		},
+		{
+			Scheme:  permission.PermAppReadDeploy,
+			Context: permission.Context(permission.CtxApp, appName),
+		},
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"crypto/rand"
 	_ "crypto/sha256"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -20,6 +21,7 @@ import (
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/repository"
 	"github.com/tsuru/tsuru/validation"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -27,8 +29,25 @@ var (
 	ErrUserNotFound = errors.New("user not found")
 	ErrInvalidKey   = errors.New("invalid key")
 	ErrKeyDisabled  = errors.New("key management is disabled")
+	ErrUserDisabled = AuthenticationFailure{Message: "Authentication failed, user is disabled."}
+	ErrUserLocked   = AuthenticationFailure{Message: "Authentication failed, user is locked due to too many failed login attempts."}
 )
 
+const (
+	defaultLockoutDuration = 15 * time.Minute
+	userStatusCacheTTL     = 30 * time.Second
+)
+
+type cachedUserStatus struct {
+	disabled bool
+	expires  time.Time
+}
+
+var userStatusCache = struct {
+	sync.Mutex
+	entries map[string]cachedUserStatus
+}{entries: map[string]cachedUserStatus{}}
+
 type RoleInstance struct {
 	Name         string
 	ContextValue string
@@ -36,10 +55,14 @@ type RoleInstance struct {
 
 type User struct {
 	quota.Quota
-	Email    string
-	Password string
-	APIKey   string
-	Roles    []RoleInstance `bson:",omitempty"`
+	Email        string
+	Password     string
+	APIKey       string
+	Roles        []RoleInstance `bson:",omitempty"`
+	Disabled     bool           `bson:",omitempty"`
+	FailedLogins int            `bson:",omitempty"`
+	LockedUntil  time.Time      `bson:",omitempty"`
+	LastLogin    time.Time      `bson:",omitempty"`
 }
 
 func listUsers(filter bson.M) ([]User, error) {
@@ -324,3 +347,149 @@ func (u *User) AddRolesForEvent(roleEvent *permission.RoleEvent, contextValue st
 	}
 	return nil
 }
+
+// ListInactiveUsers returns the users that didn't log in since the given
+// time, including the ones that never logged in.
+func ListInactiveUsers(since time.Time) ([]User, error) {
+	return listUsers(bson.M{"$or": []bson.M{
+		{"lastlogin": bson.M{"$lt": since}},
+		{"lastlogin": bson.M{"$exists": false}},
+	}})
+}
+
+// CheckEnabled returns an error when the user is disabled. Disabled users
+// keep their apps, teams and events but can't authenticate with any scheme.
+func (u *User) CheckEnabled() error {
+	if u.Disabled {
+		return ErrUserDisabled
+	}
+	return nil
+}
+
+// CheckUserEnabled returns ErrUserDisabled when the user with the given email
+// is disabled. The status is cached for a short time so the user isn't
+// loaded on every request, changes made by SetDisabled are seen immediately
+// by the same process.
+func CheckUserEnabled(email string) error {
+	now := time.Now()
+	userStatusCache.Lock()
+	status, ok := userStatusCache.entries[email]
+	userStatusCache.Unlock()
+	if !ok || now.After(status.expires) {
+		u, err := GetUserByEmail(email)
+		if err != nil {
+			return err
+		}
+		status = cachedUserStatus{disabled: u.Disabled, expires: now.Add(userStatusCacheTTL)}
+		userStatusCache.Lock()
+		userStatusCache.entries[email] = status
+		userStatusCache.Unlock()
+	}
+	if status.disabled {
+		return ErrUserDisabled
+	}
+	return nil
+}
+
+// IsLocked returns whether the user is temporarily locked out after reaching
+// the limit of failed logins.
+func (u *User) IsLocked() bool {
+	return u.LockedUntil.After(time.Now())
+}
+
+// SetDisabled disables or enables the user.
+func (u *User) SetDisabled(disabled bool) error {
+	err := u.setStatus(bson.M{"$set": bson.M{"disabled": disabled}})
+	if err == nil {
+		u.Disabled = disabled
+		userStatusCache.Lock()
+		delete(userStatusCache.entries, u.Email)
+		userStatusCache.Unlock()
+	}
+	return err
+}
+
+// Unlock resets the failed logins counter of the user, removing any lockout.
+func (u *User) Unlock() error {
+	err := u.setStatus(bson.M{"$unset": bson.M{"failedlogins": "", "lockeduntil": ""}})
+	if err == nil {
+		u.FailedLogins = 0
+		u.LockedUntil = time.Time{}
+	}
+	return err
+}
+
+// RecordLogin stores the time of the last successful login of the user,
+// resetting the failed logins counter.
+func (u *User) RecordLogin() error {
+	now := time.Now().UTC()
+	err := u.setStatus(bson.M{
+		"$set":   bson.M{"lastlogin": now},
+		"$unset": bson.M{"failedlogins": "", "lockeduntil": ""},
+	})
+	if err == nil {
+		u.LastLogin = now
+		u.FailedLogins = 0
+		u.LockedUntil = time.Time{}
+	}
+	return err
+}
+
+// RecordFailedLogin increments the failed logins counter of the user, locking
+// the user out for auth:lockout-duration seconds once it reaches
+// auth:max-failed-logins. Lockout is disabled unless auth:max-failed-logins
+// is set.
+func (u *User) RecordFailedLogin() error {
+	maxFailures, _ := config.GetInt("auth:max-failed-logins")
+	if maxFailures <= 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var updated User
+	_, err = conn.Users().Find(bson.M{"email": u.Email}).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"failedlogins": 1}},
+		ReturnNew: true,
+	}, &updated)
+	if err == mgo.ErrNotFound {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	u.FailedLogins = updated.FailedLogins
+	if u.FailedLogins < maxFailures {
+		return nil
+	}
+	duration := defaultLockoutDuration
+	if seconds, err := config.GetInt("auth:lockout-duration"); err == nil && seconds > 0 {
+		duration = time.Duration(seconds) * time.Second
+	}
+	lockedUntil := time.Now().UTC().Add(duration)
+	err = conn.Users().Update(bson.M{"email": u.Email}, bson.M{
+		"$set":   bson.M{"lockeduntil": lockedUntil},
+		"$unset": bson.M{"failedlogins": ""},
+	})
+	if err != nil {
+		return err
+	}
+	u.FailedLogins = 0
+	u.LockedUntil = lockedUntil
+	return nil
+}
+
+func (u *User) setStatus(update bson.M) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Users().Update(bson.M{"email": u.Email}, update)
+	if err == mgo.ErrNotFound {
+		return ErrUserNotFound
+	}
+	return err
+}
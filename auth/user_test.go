@@ -6,6 +6,7 @@ package auth
 
 import (
 	"sort"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
@@ -487,3 +488,100 @@ func (s *S) TestAddRolesForEvent(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "r1", ContextValue: "team1"}})
 }
+
+func (s *S) TestUserSetDisabled(c *check.C) {
+	err := s.user.SetDisabled(true)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.user.CheckEnabled(), check.Equals, ErrUserDisabled)
+	u, err := GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Disabled, check.Equals, true)
+	c.Assert(u.CheckEnabled(), check.Equals, ErrUserDisabled)
+	err = u.SetDisabled(false)
+	c.Assert(err, check.IsNil)
+	u, err = GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.CheckEnabled(), check.IsNil)
+}
+
+func (s *S) TestCheckUserEnabled(c *check.C) {
+	c.Assert(CheckUserEnabled(s.user.Email), check.IsNil)
+	err := s.user.SetDisabled(true)
+	c.Assert(err, check.IsNil)
+	c.Assert(CheckUserEnabled(s.user.Email), check.Equals, ErrUserDisabled)
+	err = s.user.SetDisabled(false)
+	c.Assert(err, check.IsNil)
+	c.Assert(CheckUserEnabled(s.user.Email), check.IsNil)
+	c.Assert(CheckUserEnabled("unknown@example.com"), check.Equals, ErrUserNotFound)
+}
+
+func (s *S) TestUserSetDisabledNotFound(c *check.C) {
+	u := User{Email: "unknown@globo.com"}
+	err := u.SetDisabled(true)
+	c.Assert(err, check.Equals, ErrUserNotFound)
+}
+
+func (s *S) TestUserRecordFailedLoginLockout(c *check.C) {
+	config.Set("auth:max-failed-logins", 3)
+	defer config.Unset("auth:max-failed-logins")
+	config.Set("auth:lockout-duration", 60)
+	defer config.Unset("auth:lockout-duration")
+	for i := 0; i < 2; i++ {
+		err := s.user.RecordFailedLogin()
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(s.user.FailedLogins, check.Equals, 2)
+	c.Assert(s.user.IsLocked(), check.Equals, false)
+	err := s.user.RecordFailedLogin()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.user.IsLocked(), check.Equals, true)
+	u, err := GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.IsLocked(), check.Equals, true)
+	c.Assert(u.FailedLogins, check.Equals, 0)
+	c.Assert(u.LockedUntil.Before(time.Now().Add(61*time.Second)), check.Equals, true)
+	err = u.Unlock()
+	c.Assert(err, check.IsNil)
+	u, err = GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.IsLocked(), check.Equals, false)
+}
+
+func (s *S) TestUserRecordFailedLoginWithoutLimit(c *check.C) {
+	err := s.user.RecordFailedLogin()
+	c.Assert(err, check.IsNil)
+	u, err := GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.FailedLogins, check.Equals, 0)
+}
+
+func (s *S) TestUserRecordLogin(c *check.C) {
+	config.Set("auth:max-failed-logins", 3)
+	defer config.Unset("auth:max-failed-logins")
+	err := s.user.RecordFailedLogin()
+	c.Assert(err, check.IsNil)
+	err = s.user.RecordLogin()
+	c.Assert(err, check.IsNil)
+	u, err := GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.FailedLogins, check.Equals, 0)
+	c.Assert(u.LastLogin.IsZero(), check.Equals, false)
+	c.Assert(time.Since(u.LastLogin) < time.Minute, check.Equals, true)
+}
+
+func (s *S) TestListInactiveUsers(c *check.C) {
+	u1 := User{Email: "active@globo.com", Password: "123456", LastLogin: time.Now().UTC()}
+	err := s.conn.Users().Insert(u1)
+	c.Assert(err, check.IsNil)
+	u2 := User{Email: "inactive@globo.com", Password: "123456", LastLogin: time.Now().UTC().AddDate(0, 0, -100)}
+	err = s.conn.Users().Insert(u2)
+	c.Assert(err, check.IsNil)
+	users, err := ListInactiveUsers(time.Now().AddDate(0, 0, -30))
+	c.Assert(err, check.IsNil)
+	var emails []string
+	for _, u := range users {
+		emails = append(emails, u.Email)
+	}
+	sort.Strings(emails)
+	c.Assert(emails, check.DeepEquals, []string{"inactive@globo.com", s.user.Email})
+}
@@ -38,6 +38,9 @@ type Config struct {
 	Enabled             bool
 	done                chan bool
 	writer              io.Writer
+	// dryRun makes the scalers list the units without locking the apps, it's
+	// used when simulating the auto scale.
+	dryRun bool
 }
 
 func CurrentConfig() (*Config, error) {
@@ -112,10 +115,35 @@ type autoScaler interface {
 }
 
 func (a *Config) scalerForRule(rule *Rule) (autoScaler, error) {
-	if rule.MaxContainerCount > 0 {
-		return &countScaler{Config: a, rule: rule}, nil
+	switch rule.Scaler {
+	case ScalerSchedule:
+		return &scheduleScaler{Config: a, rule: rule, base: a.reactiveScalerForRule(rule)}, nil
+	case ScalerTrend:
+		return &trendScaler{countScaler: &countScaler{Config: a, rule: rule}}, nil
+	case ScalerCPU:
+		return &cpuScaler{Config: a, rule: rule}, nil
+	case "", ScalerCount, ScalerMemory:
+		return a.reactiveScalerForRule(rule), nil
 	}
-	return &memoryScaler{Config: a, rule: rule}, nil
+	return nil, errors.Errorf("unknown scaler %q", rule.Scaler)
+}
+
+// reactiveScalerForRule returns the scaler acting on the current usage of
+// the nodes, which is also the base of the schedule scaler.
+func (a *Config) reactiveScalerForRule(rule *Rule) autoScaler {
+	if reactiveScalerName(rule) == ScalerCount {
+		return &countScaler{Config: a, rule: rule}
+	}
+	return &memoryScaler{Config: a, rule: rule}
+}
+
+// reactiveScalerName returns the name of the scaler returned by
+// reactiveScalerForRule, either ScalerCount or ScalerMemory.
+func reactiveScalerName(rule *Rule) string {
+	if rule.Scaler == ScalerCount || (rule.Scaler != ScalerMemory && rule.MaxContainerCount > 0) {
+		return ScalerCount
+	}
+	return ScalerMemory
 }
 
 func (a *Config) run() error {
@@ -172,9 +200,22 @@ func (a *Config) runScaler() (retErr error) {
 			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", r)
 		}
 	}()
+	provPoolMap, clusterMap, err := a.nodesByPool()
+	if err != nil {
+		return err
+	}
+	for pool, nodes := range clusterMap {
+		a.runScalerInNodes(provPoolMap[pool], pool, nodes)
+	}
+	return
+}
+
+// nodesByPool returns the nodes of each pool, along with the provisioner
+// managing the nodes of each pool.
+func (a *Config) nodesByPool() (map[string]provision.NodeProvisioner, map[string][]provision.Node, error) {
 	provs, err := provision.Registry()
 	if err != nil {
-		return errors.Wrap(err, "error getting provisioners")
+		return nil, nil, errors.Wrap(err, "error getting provisioners")
 	}
 	provPoolMap := map[string]provision.NodeProvisioner{}
 	var allNodes []provision.Node
@@ -186,7 +227,7 @@ func (a *Config) runScaler() (retErr error) {
 		var nodes []provision.Node
 		nodes, err = nodeProv.ListNodes(nil)
 		if err != nil {
-			return errors.Wrap(err, "error getting nodes")
+			return nil, nil, errors.Wrap(err, "error getting nodes")
 		}
 		for _, n := range nodes {
 			provPoolMap[n.Pool()] = nodeProv
@@ -202,10 +243,17 @@ func (a *Config) runScaler() (retErr error) {
 		}
 		clusterMap[pool] = append(clusterMap[pool], node)
 	}
-	for pool, nodes := range clusterMap {
-		a.runScalerInNodes(provPoolMap[pool], pool, nodes)
+	return provPoolMap, clusterMap, nil
+}
+
+// ruleForPool returns the auto scale rule for the pool, falling back to the
+// default rule.
+func ruleForPool(pool string) (*Rule, error) {
+	rule, err := AutoScaleRuleForMetadata(pool)
+	if err == mgo.ErrNotFound {
+		rule, err = AutoScaleRuleForMetadata("")
 	}
-	return
+	return rule, err
 }
 
 type EventCustomData struct {
@@ -256,10 +304,7 @@ func (a *Config) runScalerInNodes(prov provision.NodeProvisioner, pool string, n
 			})
 		}
 	}()
-	rule, err = AutoScaleRuleForMetadata(pool)
-	if err == mgo.ErrNotFound {
-		rule, err = AutoScaleRuleForMetadata("")
-	}
+	rule, err = ruleForPool(pool)
 	if err != nil {
 		if err != mgo.ErrNotFound {
 			retErr = errors.Wrapf(err, "unable to fetch auto scale rules for %s", pool)
@@ -375,7 +420,11 @@ func (a *Config) addNode(evt *event.Event, prov provision.NodeProvisioner, model
 	if !hasIaas {
 		return nil, errors.Errorf("no IaaS information in nodes metadata: %#v", metadata)
 	}
-	machine, err := iaas.CreateMachineForIaaS(metadata["iaas"], metadata)
+	machine, err := iaas.CreateMachineWithOptions(iaas.CreateMachineOptions{
+		IaaS:   metadata["iaas"],
+		Params: metadata,
+		Writer: evt,
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create machine")
 	}
@@ -519,41 +568,45 @@ func chooseMetadataFromNodes(modelNodes []provision.Node) (map[string]string, er
 	return baseMetadata, nil
 }
 
-func preciseUnitsByNode(pool string, nodes []provision.Node) (map[string][]provision.Unit, error) {
-	appsInPool, err := app.List(&app.Filter{
-		Pool: pool,
-	})
-	if err != nil {
-		return nil, err
-	}
-	for _, a := range appsInPool {
-		var locked bool
-		locked, err = app.AcquireApplicationLock(a.Name, app.InternalAppName, "node auto scale")
+// preciseUnitsByNode returns the units in each node, locking the apps in the
+// pool while listing them. In dry run mode the apps are not locked, so the
+// units listed may be changed by running operations.
+func (a *Config) preciseUnitsByNode(pool string, nodes []provision.Node) (map[string][]provision.Unit, error) {
+	if !a.dryRun {
+		appsInPool, err := app.List(&app.Filter{
+			Pool: pool,
+		})
 		if err != nil {
 			return nil, err
 		}
-		if !locked {
-			return nil, errAppNotLocked{app: a.Name}
+		for _, poolApp := range appsInPool {
+			var locked bool
+			locked, err = app.AcquireApplicationLock(poolApp.Name, app.InternalAppName, "node auto scale")
+			if err != nil {
+				return nil, err
+			}
+			if !locked {
+				return nil, errAppNotLocked{app: poolApp.Name}
+			}
+			defer app.ReleaseApplicationLock(poolApp.Name)
 		}
-		defer app.ReleaseApplicationLock(a.Name)
 	}
 	unitsByNode := map[string][]provision.Unit{}
 	for _, node := range nodes {
-		var nodeUnits []provision.Unit
-		nodeUnits, err = node.Units()
+		nodeUnits, err := node.Units()
 		if err != nil {
 			return nil, err
 		}
 		unitsByNode[node.Address()] = nodeUnits
 	}
-	return unitsByNode, err
+	return unitsByNode, nil
 }
 
-func unitsGapInNodes(pool string, nodes []provision.Node) (int, int, error) {
+func (a *Config) unitsGapInNodes(pool string, nodes []provision.Node) (int, int, error) {
 	maxCount := 0
 	minCount := -1
 	totalCount := 0
-	unitsByNode, err := preciseUnitsByNode(pool, nodes)
+	unitsByNode, err := a.preciseUnitsByNode(pool, nodes)
 	if err != nil {
 		return 0, 0, err
 	}
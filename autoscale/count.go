@@ -16,10 +16,16 @@ type countScaler struct {
 }
 
 func (a *countScaler) scale(pool string, nodes []provision.Node) (*ScalerResult, error) {
-	totalCount, _, err := unitsGapInNodes(pool, nodes)
+	totalCount, _, err := a.unitsGapInNodes(pool, nodes)
 	if err != nil {
 		return nil, err
 	}
+	return a.scaleUnits(totalCount, nodes), nil
+}
+
+// scaleUnits returns the nodes to be added or removed for totalCount units
+// to fit in the pool.
+func (a *countScaler) scaleUnits(totalCount int, nodes []provision.Node) *ScalerResult {
 	freeSlots := (len(nodes) * a.rule.MaxContainerCount) - totalCount
 	reasonMsg := fmt.Sprintf("number of free slots is %d", freeSlots)
 	scaledMaxCount := int(float32(a.rule.MaxContainerCount) * a.rule.ScaleDownRatio)
@@ -28,15 +34,15 @@ func (a *countScaler) scale(pool string, nodes []provision.Node) (*ScalerResult,
 		chosenNodes := chooseNodeForRemoval(nodes, toRemoveCount)
 		if len(chosenNodes) == 0 {
 			a.logDebug("would remove any node but can't due to metadata restrictions")
-			return &ScalerResult{}, nil
+			return &ScalerResult{}
 		}
 		return &ScalerResult{
 			ToRemove: nodesToSpec(chosenNodes),
 			Reason:   reasonMsg,
-		}, nil
+		}
 	}
 	if freeSlots >= 0 {
-		return &ScalerResult{}, nil
+		return &ScalerResult{}
 	}
 	nodesToAdd := -freeSlots / a.rule.MaxContainerCount
 	if freeSlots%a.rule.MaxContainerCount != 0 {
@@ -45,5 +51,5 @@ func (a *countScaler) scale(pool string, nodes []provision.Node) (*ScalerResult,
 	return &ScalerResult{
 		ToAdd:  nodesToAdd,
 		Reason: reasonMsg,
-	}, nil
+	}
 }
@@ -0,0 +1,101 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// cpuMetricsMaxAge is the maximum age of the CPU metrics reported by a node
+// for them to be considered by the cpu scaler.
+var cpuMetricsMaxAge = 5 * time.Minute
+
+// cpuScaler adds and removes nodes based on the CPU load of the pool. The
+// load of each node is the ratio of CPU shares reserved by the plans of its
+// units to the rule MaxCPUShare or, when UseCPUMetrics is set and the node
+// reported it recently, its CPU usage, whichever is higher.
+type cpuScaler struct {
+	*Config
+	rule *Rule
+}
+
+func (a *cpuScaler) nodesLoad(pool string, nodes []provision.Node) (float64, error) {
+	unitsMap, err := a.preciseUnitsByNode(pool, nodes)
+	if err != nil {
+		return 0, err
+	}
+	var metrics map[string]provision.NodeMetrics
+	if a.rule.UseCPUMetrics {
+		addrs := make([]string, len(nodes))
+		for i, node := range nodes {
+			addrs[i] = node.Address()
+		}
+		metrics, err = provision.NodeMetricsSince(addrs, time.Now().UTC().Add(-cpuMetricsMaxAge))
+		if err != nil {
+			return 0, errors.Wrap(err, "unable to get node metrics")
+		}
+	}
+	plans := map[string]int{}
+	var totalLoad float64
+	for _, node := range nodes {
+		var reserved int
+		for _, unit := range unitsMap[node.Address()] {
+			cpuShare, ok := plans[unit.AppName]
+			if !ok {
+				unitApp, err := app.GetByName(unit.AppName)
+				if err != nil {
+					return 0, errors.Wrapf(err, "couldn't find container app (%s)", unit.AppName)
+				}
+				cpuShare = unitApp.Plan.CpuShare
+				plans[unit.AppName] = cpuShare
+			}
+			reserved += cpuShare
+		}
+		load := float64(reserved) / float64(a.rule.MaxCPUShare)
+		if m, ok := metrics[node.Address()]; ok && m.CPU/100 > load {
+			load = m.CPU / 100
+		}
+		totalLoad += load
+	}
+	return totalLoad, nil
+}
+
+func (a *cpuScaler) scale(pool string, nodes []provision.Node) (*ScalerResult, error) {
+	totalLoad, err := a.nodesLoad(pool, nodes)
+	if err != nil {
+		return nil, err
+	}
+	load := totalLoad / float64(len(nodes))
+	reasonMsg := fmt.Sprintf("cpu load is %.2f", load)
+	upThreshold := float64(a.rule.CPUScaleUpThreshold)
+	required := int(math.Ceil(totalLoad / upThreshold))
+	if required < 1 {
+		required = 1
+	}
+	if load > upThreshold {
+		return &ScalerResult{
+			ToAdd:  required - len(nodes),
+			Reason: reasonMsg,
+		}, nil
+	}
+	if load >= float64(a.rule.CPUScaleDownThreshold) || required >= len(nodes) {
+		return &ScalerResult{}, nil
+	}
+	chosenNodes := chooseNodeForRemoval(nodes, len(nodes)-required)
+	if len(chosenNodes) == 0 {
+		a.logDebug("would remove any node but can't due to metadata restrictions")
+		return &ScalerResult{}, nil
+	}
+	return &ScalerResult{
+		ToRemove: nodesToSpec(chosenNodes),
+		Reason:   reasonMsg,
+	}, nil
+}
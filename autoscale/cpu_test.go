@@ -0,0 +1,116 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) insertCPURule(c *check.C, rule Rule) {
+	rule.MetadataFilter = "pool1"
+	rule.Enabled = true
+	rule.Scaler = ScalerCPU
+	err := rule.normalize()
+	c.Assert(err, check.IsNil)
+	coll, err := autoScaleRuleCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(rule)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestRuleNormalizeCPUScaler(c *check.C) {
+	rule := Rule{Enabled: true, Scaler: ScalerCPU}
+	c.Assert(rule.normalize(), check.ErrorMatches, "invalid rule, cpu scaler requires max cpu share to be set")
+	rule.MaxCPUShare = 100
+	c.Assert(rule.normalize(), check.IsNil)
+	c.Assert(rule.CPUScaleUpThreshold, check.Equals, float32(0.8))
+	c.Assert(rule.CPUScaleDownThreshold, check.Equals, float32(0.3))
+	rule.CPUScaleDownThreshold = 0.9
+	c.Assert(rule.normalize(), check.ErrorMatches, "invalid rule, cpu thresholds must satisfy .*")
+}
+
+func (s *S) TestAutoScaleConfigRunCPUScaler(c *check.C) {
+	s.insertCPURule(c, Rule{MaxCPUShare: 20})
+	_, err := s.p.AddUnitsToNode(s.appInstance, 4, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 3, check.Commentf("log: %s", s.logBuf.String()))
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: provision.PoolMetadataName, Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toadd":  2,
+			"result.reason": "cpu load is 2.00",
+		},
+		LogMatches: `(?s).*running scaler.*cpuScaler.*pool1.*`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAutoScaleConfigRunCPUScalerWithMetrics(c *check.C) {
+	s.insertCPURule(c, Rule{MaxCPUShare: 100, UseCPUMetrics: true})
+	_, err := s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	err = provision.UpdateNodeMetrics("http://n1:1", provision.NodeMetrics{CPU: 95})
+	c.Assert(err, check.IsNil)
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err = s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2, check.Commentf("log: %s", s.logBuf.String()))
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: provision.PoolMetadataName, Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toadd":  1,
+			"result.reason": "cpu load is 0.95",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAutoScaleConfigRunCPUScalerScaleDown(c *check.C) {
+	s.insertCPURule(c, Rule{MaxCPUShare: 100})
+	err := s.p.AddNode(provision.AddNodeOptions{
+		Address: "http://n2:2",
+		Metadata: map[string]string{
+			provision.PoolMetadataName: "pool1",
+			"iaas":                     "my-scale-iaas",
+			"totalMem":                 "25165824",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n2:2")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: provision.PoolMetadataName, Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toremove": bson.M{"$size": 1},
+			"result.reason":   "cpu load is 0.10",
+		},
+	}, eventtest.HasEvent)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+}
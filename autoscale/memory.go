@@ -28,7 +28,7 @@ type nodeMemoryData struct {
 
 func (a *memoryScaler) nodesMemoryData(pool string, nodes []provision.Node) (map[string]*nodeMemoryData, error) {
 	nodesMemoryData := make(map[string]*nodeMemoryData)
-	unitsMap, err := preciseUnitsByNode(pool, nodes)
+	unitsMap, err := a.preciseUnitsByNode(pool, nodes)
 	if err != nil {
 		return nil, err
 	}
@@ -15,6 +15,14 @@ import (
 	"gopkg.in/mgo.v2"
 )
 
+const (
+	ScalerCount    = "count"
+	ScalerMemory   = "memory"
+	ScalerSchedule = "schedule"
+	ScalerTrend    = "trend"
+	ScalerCPU      = "cpu"
+)
+
 type Rule struct {
 	MetadataFilter    string `bson:"_id"`
 	Error             string `bson:"-"`
@@ -23,6 +31,29 @@ type Rule struct {
 	MaxMemoryRatio    float32
 	Enabled           bool
 	PreventRebalance  bool
+	// Scaler is the scaler used by the rule. When empty, the count scaler
+	// is used if MaxContainerCount is set, otherwise the memory scaler is
+	// used.
+	Scaler string
+	// Schedule holds the time windows used by the schedule scaler.
+	Schedule []ScheduleWindow
+	// Timezone is the name of the location used to interpret the schedule
+	// windows, defaults to UTC.
+	Timezone string
+	// TrendWindow is the period, in seconds, considered by the trend scaler
+	// to measure the growth of units. Defaults to one hour.
+	TrendWindow int
+	// MaxCPUShare is the sum of CPU shares of the units plans each node is
+	// able to hold, used by the cpu scaler.
+	MaxCPUShare int
+	// CPUScaleUpThreshold and CPUScaleDownThreshold are the ratios of CPU
+	// usage in the pool above which nodes are added and below which nodes
+	// are removed by the cpu scaler. They default to 0.8 and 0.3.
+	CPUScaleUpThreshold   float32
+	CPUScaleDownThreshold float32
+	// UseCPUMetrics makes the cpu scaler also consider the CPU usage
+	// reported by the nodes, besides the CPU shares reserved by units.
+	UseCPUMetrics bool
 }
 
 type ruleList []Rule
@@ -44,11 +75,57 @@ func (r *Rule) normalize() error {
 		r.MaxMemoryRatio = float32(maxMemoryRatio)
 	}
 	TotalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
-	if r.Enabled && r.MaxContainerCount <= 0 && (TotalMemoryMetadata == "" || r.MaxMemoryRatio <= 0) {
+	if r.Enabled && r.Scaler != ScalerCPU && r.MaxContainerCount <= 0 && (TotalMemoryMetadata == "" || r.MaxMemoryRatio <= 0) {
 		err := errors.Errorf("invalid rule, either memory information or max container count must be set")
 		r.Error = err.Error()
 		return err
 	}
+	err := r.validateScaler()
+	if err != nil {
+		r.Error = err.Error()
+		return err
+	}
+	return nil
+}
+
+func (r *Rule) validateScaler() error {
+	switch r.Scaler {
+	case "", ScalerCount, ScalerMemory:
+	case ScalerSchedule:
+		if len(r.Schedule) == 0 {
+			return errors.New("invalid rule, schedule scaler requires at least one schedule window")
+		}
+		if _, err := r.location(); err != nil {
+			return errors.Wrapf(err, "invalid rule, unknown timezone %q", r.Timezone)
+		}
+		for _, w := range r.Schedule {
+			if err := w.validate(); err != nil {
+				return errors.Wrap(err, "invalid rule")
+			}
+		}
+	case ScalerTrend:
+		if r.MaxContainerCount <= 0 {
+			return errors.New("invalid rule, trend scaler requires max container count to be set")
+		}
+		if r.TrendWindow < 0 {
+			return errors.Errorf("invalid rule, trend window must be positive, got %d", r.TrendWindow)
+		}
+	case ScalerCPU:
+		if r.MaxCPUShare <= 0 {
+			return errors.New("invalid rule, cpu scaler requires max cpu share to be set")
+		}
+		if r.CPUScaleUpThreshold == 0 {
+			r.CPUScaleUpThreshold = 0.8
+		}
+		if r.CPUScaleDownThreshold == 0 {
+			r.CPUScaleDownThreshold = 0.3
+		}
+		if r.CPUScaleUpThreshold > 1 || r.CPUScaleDownThreshold < 0 || r.CPUScaleDownThreshold >= r.CPUScaleUpThreshold {
+			return errors.Errorf("invalid rule, cpu thresholds must satisfy 0 <= scale down < scale up <= 1, got %f and %f", r.CPUScaleDownThreshold, r.CPUScaleUpThreshold)
+		}
+	default:
+		return errors.Errorf("invalid rule, unknown scaler %q", r.Scaler)
+	}
 	return nil
 }
 
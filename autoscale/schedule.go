@@ -0,0 +1,160 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+)
+
+var now = time.Now
+
+// ScheduleWindow is a time of day window in which a pool must have at least
+// MinNodes nodes. Start and End are in the HH:MM format, windows ending
+// before they start cross midnight. When Weekdays is set, the window only
+// applies to windows starting in the given days.
+type ScheduleWindow struct {
+	Start    string
+	End      string
+	Weekdays []time.Weekday
+	MinNodes int
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, errors.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w *ScheduleWindow) validate() error {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return errors.Errorf("schedule window starting at %s must not be empty", w.Start)
+	}
+	if w.MinNodes <= 0 {
+		return errors.Errorf("schedule window starting at %s must have min nodes greater than 0", w.Start)
+	}
+	for _, d := range w.Weekdays {
+		if d < time.Sunday || d > time.Saturday {
+			return errors.Errorf("invalid weekday %d in schedule window starting at %s", d, w.Start)
+		}
+	}
+	return nil
+}
+
+func (w *ScheduleWindow) hasWeekday(d time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, wd := range w.Weekdays {
+		if wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// activeAt returns whether the window is active at t, considering it starts
+// lead earlier than configured.
+func (w *ScheduleWindow) activeAt(t time.Time, lead time.Duration) bool {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+	if end <= start {
+		end += 24 * time.Hour
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	// The window may have started in the previous day, or, because of the
+	// lead, may be about to start in the next day.
+	for _, dayStart := range []time.Time{midnight.AddDate(0, 0, -1), midnight, midnight.AddDate(0, 0, 1)} {
+		if !w.hasWeekday(dayStart.Weekday()) {
+			continue
+		}
+		windowStart := dayStart.Add(start - lead)
+		windowEnd := dayStart.Add(end)
+		if !t.Before(windowStart) && t.Before(windowEnd) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) location() (*time.Location, error) {
+	if r.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(r.Timezone)
+}
+
+// minNodesAt returns the minimum number of nodes required by the rule
+// schedule at t, the largest among the active windows.
+func (r *Rule) minNodesAt(t time.Time, lead time.Duration) (int, error) {
+	loc, err := r.location()
+	if err != nil {
+		return 0, err
+	}
+	t = t.In(loc)
+	minNodes := 0
+	for i := range r.Schedule {
+		w := &r.Schedule[i]
+		if w.MinNodes > minNodes && w.activeAt(t, lead) {
+			minNodes = w.MinNodes
+		}
+	}
+	return minNodes, nil
+}
+
+// scheduleScaler keeps a minimum number of nodes in the pool according to
+// the rule schedule, on top of a reactive scaler. Windows are considered
+// active WaitTimeNewMachine before their start, so the nodes are ready when
+// the window starts.
+type scheduleScaler struct {
+	*Config
+	rule *Rule
+	base autoScaler
+}
+
+func (a *scheduleScaler) scale(pool string, nodes []provision.Node) (*ScalerResult, error) {
+	minNodes, err := a.rule.minNodesAt(now(), a.WaitTimeNewMachine)
+	if err != nil {
+		return nil, err
+	}
+	result, err := a.base.scale(pool, nodes)
+	if err != nil {
+		return nil, err
+	}
+	missing := minNodes - len(nodes)
+	if missing > result.ToAdd {
+		return &ScalerResult{
+			ToAdd:  missing,
+			Reason: fmt.Sprintf("schedule requires at least %d nodes, got %d", minNodes, len(nodes)),
+		}, nil
+	}
+	if maxRemove := len(nodes) - minNodes; len(result.ToRemove) > maxRemove {
+		if maxRemove <= 0 {
+			return &ScalerResult{}, nil
+		}
+		result.ToRemove = result.ToRemove[:maxRemove]
+		result.Reason = fmt.Sprintf("%s, keeping %d nodes required by schedule", result.Reason, minNodes)
+	}
+	return result, nil
+}
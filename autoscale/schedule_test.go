@@ -0,0 +1,143 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestScheduleWindowActiveAt(c *check.C) {
+	w := ScheduleWindow{Start: "08:00", End: "18:00", MinNodes: 2}
+	day := time.Date(2017, 5, 3, 0, 0, 0, 0, time.UTC)
+	c.Assert(w.activeAt(day.Add(8*time.Hour), 0), check.Equals, true)
+	c.Assert(w.activeAt(day.Add(17*time.Hour+59*time.Minute), 0), check.Equals, true)
+	c.Assert(w.activeAt(day.Add(18*time.Hour), 0), check.Equals, false)
+	c.Assert(w.activeAt(day.Add(7*time.Hour+55*time.Minute), 0), check.Equals, false)
+	c.Assert(w.activeAt(day.Add(7*time.Hour+55*time.Minute), 5*time.Minute), check.Equals, true)
+	w.Weekdays = []time.Weekday{time.Monday}
+	c.Assert(w.activeAt(day.Add(9*time.Hour), 0), check.Equals, false)
+	c.Assert(w.activeAt(day.AddDate(0, 0, -2).Add(9*time.Hour), 0), check.Equals, true)
+}
+
+func (s *S) TestScheduleWindowActiveAtCrossingMidnight(c *check.C) {
+	w := ScheduleWindow{Start: "22:00", End: "02:00", Weekdays: []time.Weekday{time.Friday}, MinNodes: 2}
+	friday := time.Date(2017, 5, 5, 0, 0, 0, 0, time.UTC)
+	c.Assert(w.activeAt(friday.Add(23*time.Hour), 0), check.Equals, true)
+	c.Assert(w.activeAt(friday.Add(25*time.Hour), 0), check.Equals, true)
+	c.Assert(w.activeAt(friday.Add(26*time.Hour), 0), check.Equals, false)
+	c.Assert(w.activeAt(friday.Add(time.Hour), 0), check.Equals, false)
+	c.Assert(w.activeAt(friday.Add(-time.Minute), 0), check.Equals, false)
+	c.Assert(w.activeAt(friday.Add(21*time.Hour+50*time.Minute), 10*time.Minute), check.Equals, true)
+}
+
+func (s *S) TestRuleMinNodesAt(c *check.C) {
+	rule := Rule{
+		Timezone: "America/Sao_Paulo",
+		Schedule: []ScheduleWindow{
+			{Start: "08:00", End: "18:00", MinNodes: 2},
+			{Start: "09:00", End: "10:00", MinNodes: 5},
+		},
+	}
+	day := time.Date(2017, 5, 3, 0, 0, 0, 0, time.UTC)
+	minNodes, err := rule.minNodesAt(day.Add(12*time.Hour), 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(minNodes, check.Equals, 5)
+	minNodes, err = rule.minNodesAt(day.Add(14*time.Hour), 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(minNodes, check.Equals, 2)
+	minNodes, err = rule.minNodesAt(day.Add(22*time.Hour), 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(minNodes, check.Equals, 0)
+}
+
+func (s *S) TestRuleNormalizeScheduleScaler(c *check.C) {
+	rule := Rule{MaxContainerCount: 2, Scaler: ScalerSchedule}
+	c.Assert(rule.normalize(), check.ErrorMatches, "invalid rule, schedule scaler requires at least one schedule window")
+	rule.Schedule = []ScheduleWindow{{Start: "8h", End: "18:00", MinNodes: 1}}
+	c.Assert(rule.normalize(), check.ErrorMatches, `invalid rule: invalid time "8h", expected HH:MM`)
+	rule.Schedule = []ScheduleWindow{{Start: "08:00", End: "18:00"}}
+	c.Assert(rule.normalize(), check.ErrorMatches, "invalid rule: schedule window starting at 08:00 must have min nodes greater than 0")
+	rule.Schedule = []ScheduleWindow{{Start: "08:00", End: "18:00", MinNodes: 1}}
+	rule.Timezone = "Nowhere/Nothing"
+	c.Assert(rule.normalize(), check.ErrorMatches, `invalid rule, unknown timezone "Nowhere/Nothing".*`)
+	rule.Timezone = ""
+	c.Assert(rule.normalize(), check.IsNil)
+	rule.Scaler = "magic"
+	c.Assert(rule.normalize(), check.ErrorMatches, `invalid rule, unknown scaler "magic"`)
+	c.Assert(rule.Error, check.Equals, `invalid rule, unknown scaler "magic"`)
+}
+
+func (s *S) TestAutoScaleConfigRunScheduleScaler(c *check.C) {
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2017, 5, 3, 7, 58, 0, 0, time.UTC) }
+	coll, err := autoScaleRuleCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(Rule{
+		MetadataFilter:    "pool1",
+		Enabled:           true,
+		MaxContainerCount: 2,
+		ScaleDownRatio:    1.333,
+		Scaler:            ScalerSchedule,
+		Schedule:          []ScheduleWindow{{Start: "08:00", End: "18:00", MinNodes: 3}},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 3, check.Commentf("log: %s", s.logBuf.String()))
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: provision.PoolMetadataName, Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toadd":  2,
+			"result.reason": "schedule requires at least 3 nodes, got 1",
+		},
+		LogMatches: `(?s).*running scaler.*scheduleScaler.*pool1.*`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAutoScaleConfigRunScheduleScalerKeepsMinNodes(c *check.C) {
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2017, 5, 3, 12, 0, 0, 0, time.UTC) }
+	err := s.p.AddNode(provision.AddNodeOptions{
+		Address: "http://n2:2",
+		Metadata: map[string]string{
+			provision.PoolMetadataName: "pool1",
+			"iaas":                     "my-scale-iaas",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	coll, err := autoScaleRuleCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(Rule{
+		MetadataFilter:    "pool1",
+		Enabled:           true,
+		MaxContainerCount: 2,
+		ScaleDownRatio:    1.333,
+		Scaler:            ScalerSchedule,
+		Schedule:          []ScheduleWindow{{Start: "08:00", End: "18:00", MinNodes: 2}},
+	})
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
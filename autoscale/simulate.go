@@ -0,0 +1,130 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/safe"
+	"gopkg.in/mgo.v2"
+)
+
+var (
+	ErrNoNodesInPool = errors.New("no nodes found in pool")
+	ErrNoRuleForPool = errors.New("no auto scale rule found for pool")
+)
+
+type InvalidRuleError struct {
+	Err error
+}
+
+func (e *InvalidRuleError) Error() string {
+	return e.Err.Error()
+}
+
+// Simulation is the outcome of running the auto scale in a pool without
+// side effects. Scaler is the name of the scaler used by the rule,
+// UnitsToMove holds the units in the nodes that would be removed, and
+// RebalanceLog the output of a dry run of the rebalance in the current nodes
+// of the pool. The rebalance is not simulated when nodes would be added, as
+// the units moved depend on the new nodes.
+type Simulation struct {
+	Pool         string
+	Rule         *Rule
+	Scaler       string
+	Nodes        []provision.NodeSpec
+	Result       *ScalerResult
+	UnitsToMove  []provision.Unit
+	RebalanceLog string
+}
+
+// Simulate returns what the auto scale would do in the pool, without adding,
+// removing or rebalancing nodes and without locking the apps in the pool.
+// When rule is not nil, it's used instead of the rule stored for the pool.
+func Simulate(pool string, rule *Rule) (*Simulation, error) {
+	a := newConfig()
+	a.dryRun = true
+	provPoolMap, clusterMap, err := a.nodesByPool()
+	if err != nil {
+		return nil, err
+	}
+	nodes := clusterMap[pool]
+	if len(nodes) == 0 {
+		return nil, ErrNoNodesInPool
+	}
+	if rule == nil {
+		rule, err = ruleForPool(pool)
+		if err == mgo.ErrNotFound {
+			return nil, ErrNoRuleForPool
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to fetch auto scale rules for %s", pool)
+		}
+	} else {
+		rule.MetadataFilter = pool
+		rule.Enabled = true
+		err = rule.normalize()
+		if err != nil {
+			return nil, &InvalidRuleError{Err: err}
+		}
+	}
+	scaler, err := a.scalerForRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	sResult, err := scaler.scale(pool, nodes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error scaling group %s", pool)
+	}
+	sim := &Simulation{
+		Pool:   pool,
+		Rule:   rule,
+		Scaler: scalerName(rule),
+		Nodes:  nodesToSpec(nodes),
+		Result: sResult,
+	}
+	for _, spec := range sResult.ToRemove {
+		for _, node := range nodes {
+			if node.Address() != spec.Address {
+				continue
+			}
+			units, err := node.Units()
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to list units in node %s", spec.Address)
+			}
+			sim.UnitsToMove = append(sim.UnitsToMove, units...)
+		}
+	}
+	rebalanceProv, ok := provPoolMap[pool].(provision.NodeRebalanceProvisioner)
+	if rule.PreventRebalance || len(sResult.ToRemove) > 0 || !ok {
+		return sim, nil
+	}
+	if sResult.ToAdd > 0 {
+		sim.RebalanceLog = fmt.Sprintf("rebalance not simulated, units would be rebalanced after adding %d node(s)\n", sResult.ToAdd)
+		return sim, nil
+	}
+	buf := safe.NewBuffer(nil)
+	sResult.ToRebalance, err = rebalanceProv.RebalanceNodes(provision.RebalanceNodesOptions{
+		MetadataFilter: map[string]string{provision.PoolMetadataName: pool},
+		Writer:         buf,
+		Dry:            true,
+	})
+	sim.RebalanceLog = buf.String()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to simulate rebalance. log: %s", buf.String())
+	}
+	return sim, nil
+}
+
+// scalerName returns the name of the scaler used by the rule, resolving the
+// default scaler when the rule doesn't set one.
+func scalerName(rule *Rule) string {
+	if rule.Scaler == "" {
+		return reactiveScalerName(rule)
+	}
+	return rule.Scaler
+}
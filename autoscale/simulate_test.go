@@ -0,0 +1,108 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestSimulate(c *check.C) {
+	_, err := s.p.AddUnitsToNode(s.appInstance, 4, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	sim, err := Simulate("pool1", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sim.Pool, check.Equals, "pool1")
+	c.Assert(sim.Scaler, check.Equals, ScalerCount)
+	c.Assert(sim.Result, check.DeepEquals, &ScalerResult{
+		ToAdd:  1,
+		Reason: "number of free slots is -2",
+	})
+	c.Assert(sim.RebalanceLog, check.Equals, "rebalance not simulated, units would be rebalanced after adding 1 node(s)\n")
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) TestSimulateWithRule(c *check.C) {
+	err := s.p.AddNode(provision.AddNodeOptions{
+		Address: "http://n2:2",
+		Metadata: map[string]string{
+			provision.PoolMetadataName: "pool1",
+			"iaas":                     "my-scale-iaas",
+			"totalMem":                 "25165824",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	units, err := s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n2:2")
+	c.Assert(err, check.IsNil)
+	sim, err := Simulate("pool1", &Rule{MaxContainerCount: 4, ScaleDownRatio: 1.333})
+	c.Assert(err, check.IsNil)
+	c.Assert(sim.Rule.MetadataFilter, check.Equals, "pool1")
+	c.Assert(sim.Result.ToRemove, check.HasLen, 1)
+	c.Assert(sim.Result.ToRebalance, check.Equals, false)
+	c.Assert(sim.UnitsToMove, check.HasLen, 1)
+	if sim.Result.ToRemove[0].Address == "http://n2:2" {
+		c.Assert(sim.UnitsToMove[0].ID, check.Equals, units[0].ID)
+	}
+	c.Assert(sim.RebalanceLog, check.Equals, "")
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+}
+
+func (s *S) TestSimulateRebalance(c *check.C) {
+	_, err := s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	sim, err := Simulate("pool1", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sim.Result, check.DeepEquals, &ScalerResult{ToRebalance: true})
+	c.Assert(sim.RebalanceLog, check.Equals, "rebalancing - dry: true, force: false\nfiltering metadata: map[pool:pool1]\n")
+}
+
+func (s *S) TestSimulateLockedApp(c *check.C) {
+	_, err := s.p.AddUnitsToNode(s.appInstance, 4, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	locked, err := app.AcquireApplicationLock(s.appInstance.GetName(), "tsurud", "something")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	sim, err := Simulate("pool1", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sim.Result.ToAdd, check.Equals, 1)
+	var dbApp app.App
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Find(bson.M{"name": s.appInstance.GetName()}).One(&dbApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Locked, check.Equals, true)
+	c.Assert(dbApp.Lock.Owner, check.Equals, "tsurud")
+}
+
+func (s *S) TestSimulateScalerName(c *check.C) {
+	c.Assert(scalerName(&Rule{MaxContainerCount: 2}), check.Equals, ScalerCount)
+	c.Assert(scalerName(&Rule{}), check.Equals, ScalerMemory)
+	c.Assert(scalerName(&Rule{Scaler: ScalerCPU}), check.Equals, ScalerCPU)
+}
+
+func (s *S) TestSimulateInvalidRule(c *check.C) {
+	_, err := Simulate("pool1", &Rule{Scaler: "magic", MaxContainerCount: 2})
+	c.Assert(err, check.FitsTypeOf, &InvalidRuleError{})
+	c.Assert(err, check.ErrorMatches, `invalid rule, unknown scaler "magic"`)
+}
+
+func (s *S) TestSimulateNoNodes(c *check.C) {
+	_, err := Simulate("pool2", nil)
+	c.Assert(err, check.Equals, ErrNoNodesInPool)
+}
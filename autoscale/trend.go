@@ -0,0 +1,131 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const defaultTrendWindow = time.Hour
+
+// unitsGrowthBatchSize is the number of unit events loaded at a time when
+// calculating the units growth.
+var unitsGrowthBatchSize = 500
+
+// trendScaler adds nodes ahead of demand, based on the growth of units in
+// the pool apps over the rule trend window. The growth is extrapolated to
+// the time a new node takes to be ready, plus the time until the next run.
+// Nodes are only removed according to the current number of units, as done
+// by the count scaler. Only units explicitly added or removed, by users or
+// by the units auto scaler, count towards the growth, units created by
+// deploys and rollbacks, e.g. the first unit of an app, are not considered.
+type trendScaler struct {
+	*countScaler
+}
+
+func (a *trendScaler) window() time.Duration {
+	if a.rule.TrendWindow > 0 {
+		return time.Duration(a.rule.TrendWindow) * time.Second
+	}
+	return defaultTrendWindow
+}
+
+func (a *trendScaler) scale(pool string, nodes []provision.Node) (*ScalerResult, error) {
+	totalCount, _, err := a.unitsGapInNodes(pool, nodes)
+	if err != nil {
+		return nil, err
+	}
+	window := a.window()
+	growth, err := unitsGrowth(pool, now().Add(-window))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to calculate units growth")
+	}
+	if growth > 0 {
+		lookahead := a.WaitTimeNewMachine + a.RunInterval
+		expected := int(math.Ceil(float64(growth) * float64(lookahead) / float64(window)))
+		result := a.scaleUnits(totalCount+expected, nodes)
+		if result.ToAdd > 0 {
+			result.Reason = fmt.Sprintf("%s, expecting %d new units from growth of %d units in %s", result.Reason, expected, growth, window)
+			return result, nil
+		}
+	}
+	return a.scaleUnits(totalCount, nodes), nil
+}
+
+// unitsGrowth returns the number of units added minus the number of units
+// removed, since the given time, in the apps of the pool, according to the
+// unit add and remove events and the units auto scale events. Units changed
+// by other operations, such as deploys and rollbacks, are not accounted.
+func unitsGrowth(pool string, since time.Time) (int, error) {
+	apps, err := app.List(&app.Filter{Pool: pool})
+	if err != nil {
+		return 0, err
+	}
+	if len(apps) == 0 {
+		return 0, nil
+	}
+	appNames := make([]string, len(apps))
+	for i := range apps {
+		appNames[i] = apps[i].Name
+	}
+	addKind := permission.PermAppUpdateUnitAdd.FullName()
+	removeKind := permission.PermAppUpdateUnitRemove.FullName()
+	growth := 0
+	for skip := 0; ; skip += unitsGrowthBatchSize {
+		evts, err := event.List(&event.Filter{
+			Target: event.Target{Type: event.TargetTypeApp},
+			Since:  since,
+			Raw: bson.M{
+				"target.value": bson.M{"$in": appNames},
+				"kind.name":    bson.M{"$in": []string{addKind, removeKind, app.UnitsAutoScaleEventKind}},
+				"running":      false,
+				"error":        "",
+			},
+			Sort:  "starttime",
+			Limit: unitsGrowthBatchSize,
+			Skip:  skip,
+		})
+		if err != nil {
+			return 0, err
+		}
+		for i := range evts {
+			if evts[i].Kind.Name == app.UnitsAutoScaleEventKind {
+				var result app.UnitsAutoScaleResult
+				if err = evts[i].EndData(&result); err != nil {
+					return 0, err
+				}
+				growth += result.ToUnits - result.FromUnits
+				continue
+			}
+			var data []map[string]interface{}
+			if err = evts[i].StartData(&data); err != nil {
+				return 0, err
+			}
+			units := 0
+			for _, item := range data {
+				if item["name"] == "units" {
+					units, _ = strconv.Atoi(fmt.Sprint(item["value"]))
+				}
+			}
+			if evts[i].Kind.Name == removeKind {
+				units = -units
+			}
+			growth += units
+		}
+		if len(evts) < unitsGrowthBatchSize {
+			return growth, nil
+		}
+	}
+}
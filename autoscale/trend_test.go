@@ -0,0 +1,117 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) addUnitsEvent(c *check.C, appName string, kind *permission.PermissionScheme, units string) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: appName},
+		InternalKind: kind.FullName(),
+		CustomData:   event.FormToCustomData(url.Values{"units": []string{units}}),
+		Allowed:      event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestUnitsGrowth(c *check.C) {
+	s.addUnitsEvent(c, "myapp", permission.PermAppUpdateUnitAdd, "4")
+	s.addUnitsEvent(c, "myapp", permission.PermAppUpdateUnitRemove, "1")
+	s.addUnitsEvent(c, "otherapp", permission.PermAppUpdateUnitAdd, "10")
+	growth, err := unitsGrowth("pool1", time.Now().Add(-time.Hour))
+	c.Assert(err, check.IsNil)
+	c.Assert(growth, check.Equals, 3)
+	growth, err = unitsGrowth("pool1", time.Now().Add(time.Hour))
+	c.Assert(err, check.IsNil)
+	c.Assert(growth, check.Equals, 0)
+}
+
+func (s *S) TestUnitsGrowthWithUnitsAutoScaleEvents(c *check.C) {
+	s.addUnitsEvent(c, "myapp", permission.PermAppUpdateUnitAdd, "1")
+	for _, result := range []app.UnitsAutoScaleResult{
+		{Process: "web", FromUnits: 1, ToUnits: 4},
+		{Process: "web", FromUnits: 4, ToUnits: 3},
+	} {
+		evt, err := event.NewInternal(&event.Opts{
+			Target:       event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+			InternalKind: app.UnitsAutoScaleEventKind,
+			Allowed:      event.Allowed(permission.PermAppReadEvents),
+		})
+		c.Assert(err, check.IsNil)
+		err = evt.DoneCustomData(nil, result)
+		c.Assert(err, check.IsNil)
+	}
+	growth, err := unitsGrowth("pool1", time.Now().Add(-time.Hour))
+	c.Assert(err, check.IsNil)
+	c.Assert(growth, check.Equals, 3)
+}
+
+func (s *S) TestUnitsGrowthMultipleBatches(c *check.C) {
+	oldBatchSize := unitsGrowthBatchSize
+	unitsGrowthBatchSize = 2
+	defer func() { unitsGrowthBatchSize = oldBatchSize }()
+	for i := 0; i < 5; i++ {
+		s.addUnitsEvent(c, "myapp", permission.PermAppUpdateUnitAdd, "1")
+	}
+	growth, err := unitsGrowth("pool1", time.Now().Add(-time.Hour))
+	c.Assert(err, check.IsNil)
+	c.Assert(growth, check.Equals, 5)
+}
+
+func (s *S) TestRuleNormalizeTrendScaler(c *check.C) {
+	rule := Rule{MaxMemoryRatio: 0.8, Scaler: ScalerTrend}
+	c.Assert(rule.normalize(), check.ErrorMatches, "invalid rule, trend scaler requires max container count to be set")
+	rule.MaxContainerCount = 2
+	c.Assert(rule.normalize(), check.IsNil)
+}
+
+func (s *S) TestAutoScaleConfigRunTrendScaler(c *check.C) {
+	coll, err := autoScaleRuleCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(Rule{
+		MetadataFilter:    "pool1",
+		Enabled:           true,
+		MaxContainerCount: 4,
+		ScaleDownRatio:    1.333,
+		Scaler:            ScalerTrend,
+	})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	s.addUnitsEvent(c, "myapp", permission.PermAppUpdateUnitAdd, "4")
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err = s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2, check.Commentf("log: %s", s.logBuf.String()))
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: provision.PoolMetadataName, Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toadd":  1,
+			"result.reason": "number of free slots is -3, expecting 5 new units from growth of 4 units in 1h0m0s",
+		},
+		LogMatches: `(?s).*running scaler.*trendScaler.*pool1.*`,
+	}, eventtest.HasEvent)
+}
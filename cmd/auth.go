@@ -16,6 +16,7 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+	tsuruerr "github.com/tsuru/tsuru/errors"
 	tsuruNet "github.com/tsuru/tsuru/net"
 	"golang.org/x/crypto/ssh/terminal"
 )
@@ -29,6 +30,10 @@ type login struct {
 	scheme *loginScheme
 }
 
+// twoFactorCodeRequiredMsg is the message returned by the API when the user
+// has two-factor authentication enabled and no code was sent.
+const twoFactorCodeRequiredMsg = "two-factor authentication code required"
+
 func nativeLogin(context *Context, client *Client) error {
 	var email string
 	if len(context.Args) > 0 {
@@ -43,34 +48,50 @@ func nativeLogin(context *Context, client *Client) error {
 		return err
 	}
 	fmt.Fprintln(context.Stdout)
-	u, err := GetURL("/users/" + email + "/tokens")
+	v := url.Values{}
+	v.Set("password", password)
+	token, err := requestNativeToken(client, email, v)
+	if httpErr, ok := err.(*tsuruerr.HTTP); ok && strings.TrimSpace(httpErr.Message) == twoFactorCodeRequiredMsg {
+		var code string
+		fmt.Fprint(context.Stdout, "Two-factor authentication code: ")
+		fmt.Fscanf(context.Stdin, "%s\n", &code)
+		v.Set("otp", code)
+		token, err = requestNativeToken(client, email, v)
+	}
 	if err != nil {
 		return err
 	}
-	v := url.Values{}
-	v.Set("password", password)
+	fmt.Fprintln(context.Stdout, "Successfully logged in!")
+	return writeToken(token)
+}
+
+func requestNativeToken(client *Client, email string, v url.Values) (string, error) {
+	u, err := GetURL("/users/" + email + "/tokens")
+	if err != nil {
+		return "", err
+	}
 	b := strings.NewReader(v.Encode())
 	request, err := http.NewRequest("POST", u, b)
 	if err != nil {
-		return err
+		return "", err
 	}
 	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	response, err := client.Do(request)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer response.Body.Close()
 	result, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return err
+		return "", err
 	}
 	out := make(map[string]interface{})
 	err = json.Unmarshal(result, &out)
 	if err != nil {
-		return err
+		return "", err
 	}
-	fmt.Fprintln(context.Stdout, "Successfully logged in!")
-	return writeToken(out["token"].(string))
+	token, _ := out["token"].(string)
+	return token, nil
 }
 
 func (c *login) getScheme() *loginScheme {
@@ -86,7 +107,7 @@ func (c *login) getScheme() *loginScheme {
 }
 
 func (c *login) Run(context *Context, client *Client) error {
-	if c.getScheme().Name == "oauth" {
+	if name := c.getScheme().Name; name == "oauth" || name == "oidc" {
 		return c.oauthLogin(context, client)
 	}
 	if c.getScheme().Name == "saml" {
@@ -102,8 +123,8 @@ func (c *login) Info() *Info {
 		Usage: usage,
 		Desc: `Initiates a new tsuru session for a user. If using tsuru native authentication
 scheme, it will ask for the email and the password and check if the user is
-successfully authenticated. If using OAuth, it will open a web browser for the
-user to complete the login.
+successfully authenticated. If using OAuth or OpenID Connect, it will open a web
+browser for the user to complete the login.
 
 After that, the token generated by the tsuru server will be stored in
 [[${HOME}/.tsuru/token]].
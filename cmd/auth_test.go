@@ -345,3 +345,45 @@ func (s *S) TestPasswordFromReaderUsingStringsReader(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(password, check.Equals, "abcd")
 }
+
+func (s *S) TestNativeLoginWithTwoFactor(c *check.C) {
+	os.Unsetenv("TSURU_TOKEN")
+	nativeScheme()
+	fsystem = &fstest.RecordingFs{FileContent: "old-token"}
+	defer func() {
+		fsystem = nil
+	}()
+	expected := "Password: \nTwo-factor authentication code: Successfully logged in!\n"
+	reader := strings.NewReader("chico\n123456\n")
+	context := Context{[]string{"foo@foo.com"}, globalManager.stdout, globalManager.stderr, reader}
+	transport := cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{
+					Message: "two-factor authentication code required\n",
+					Status:  http.StatusBadRequest,
+				},
+				CondFunc: func(r *http.Request) bool {
+					return r.FormValue("password") == "chico" && r.FormValue("otp") == ""
+				},
+			},
+			{
+				Transport: cmdtest.Transport{
+					Message: `{"token": "sometoken"}`,
+					Status:  http.StatusOK,
+				},
+				CondFunc: func(r *http.Request) bool {
+					return r.FormValue("password") == "chico" && r.FormValue("otp") == "123456"
+				},
+			},
+		},
+	}
+	client := NewClient(&http.Client{Transport: &transport}, nil, globalManager)
+	command := login{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(globalManager.stdout.(*bytes.Buffer).String(), check.Equals, expected)
+	token, err := ReadToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token, check.Equals, "sometoken")
+}
@@ -5,6 +5,9 @@
 package cmd
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -61,11 +64,14 @@ func port(schemeData map[string]string) string {
 	return ":0"
 }
 
-func convertToken(code, redirectUrl string) (string, error) {
+func convertToken(code, redirectUrl, codeVerifier string) (string, error) {
 	var token string
 	v := url.Values{}
 	v.Set("code", code)
 	v.Set("redirectUrl", redirectUrl)
+	if codeVerifier != "" {
+		v.Set("code_verifier", codeVerifier)
+	}
 	u, err := GetURL("/auth/login")
 	if err != nil {
 		return token, errors.Wrap(err, "Error in GetURL")
@@ -87,13 +93,23 @@ func convertToken(code, redirectUrl string) (string, error) {
 	return data["token"].(string), nil
 }
 
-func callback(redirectUrl string, finish chan bool) http.HandlerFunc {
+// callback returns the handler of the redirect from the authorization
+// server. The code is only exchanged when the state sent in the
+// authorization request is returned, protecting the login against forged
+// redirects.
+func callback(redirectUrl, codeVerifier, state string, finish chan bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			finish <- true
 		}()
 		var page string
-		token, err := convertToken(r.URL.Query().Get("code"), redirectUrl)
+		var token string
+		var err error
+		if r.URL.Query().Get("state") != state {
+			err = errors.New("invalid state in authorization response")
+		} else {
+			token, err = convertToken(r.URL.Query().Get("code"), redirectUrl, codeVerifier)
+		}
 		if err == nil {
 			writeToken(token)
 			page = fmt.Sprintf(callbackPage, successMarkup)
@@ -106,6 +122,31 @@ func callback(redirectUrl string, finish chan bool) http.HandlerFunc {
 	}
 }
 
+// randomState generates a random value for the state parameter of the
+// authorization request.
+func randomState() (string, error) {
+	var buf [16]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
+
+// pkcePair generates a random PKCE code verifier and its S256 challenge, as
+// described in RFC 7636.
+func pkcePair() (verifier string, challenge string, err error) {
+	var buf [32]byte
+	_, err = rand.Read(buf[:])
+	if err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(buf[:])
+	sum := sha256.Sum256([]byte(verifier))
+	challenge = base64.RawURLEncoding.EncodeToString(sum[:])
+	return verifier, challenge, nil
+}
+
 func (c *login) oauthLogin(context *Context, client *Client) error {
 	schemeData := c.getScheme().Data
 	finish := make(chan bool)
@@ -119,7 +160,24 @@ func (c *login) oauthLogin(context *Context, client *Client) error {
 	}
 	redirectUrl := fmt.Sprintf("http://localhost:%s", port)
 	authUrl := strings.Replace(schemeData["authorizeUrl"], "__redirect_url__", redirectUrl, 1)
-	http.HandleFunc("/", callback(redirectUrl, finish))
+	var codeVerifier string
+	if schemeData["pkce"] == "S256" {
+		var challenge string
+		codeVerifier, challenge, err = pkcePair()
+		if err != nil {
+			return err
+		}
+		authUrl += "&code_challenge=" + challenge + "&code_challenge_method=S256"
+	}
+	state, err := randomState()
+	if err != nil {
+		return err
+	}
+	authUrl, err = setQueryParam(authUrl, "state", state)
+	if err != nil {
+		return err
+	}
+	http.HandleFunc("/", callback(redirectUrl, codeVerifier, state, finish))
 	server := &http.Server{}
 	go server.Serve(l)
 	err = open(authUrl)
@@ -131,3 +189,14 @@ func (c *login) oauthLogin(context *Context, client *Client) error {
 	fmt.Fprintln(context.Stdout, "Successfully logged in!")
 	return nil
 }
+
+func setQueryParam(rawURL, key, value string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -5,10 +5,13 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"runtime"
 	"strings"
@@ -52,9 +55,9 @@ func (s *S) TestCallbackHandler(c *check.C) {
 	os.Setenv("TSURU_TARGET", ts.URL)
 	redirectUrl := "someurl"
 	finish := make(chan bool, 1)
-	handler := callback(redirectUrl, finish)
+	handler := callback(redirectUrl, "", "mystate", finish)
 	body := `{"code":"xpto"}`
-	request, err := http.NewRequest("GET", "/", strings.NewReader(body))
+	request, err := http.NewRequest("GET", "/?state=mystate", strings.NewReader(body))
 	c.Assert(err, check.IsNil)
 	recorder := httptest.NewRecorder()
 	handler(recorder, request)
@@ -67,3 +70,72 @@ func (s *S) TestCallbackHandler(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(string(data), check.Equals, "xpto")
 }
+
+func (s *S) TestCallbackHandlerWithCodeVerifier(c *check.C) {
+	var form url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"token": "xpto"}`))
+	}))
+	defer ts.Close()
+	rfs := &fstest.RecordingFs{}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	os.Setenv("TSURU_TARGET", ts.URL)
+	finish := make(chan bool, 1)
+	handler := callback("someurl", "myverifier", "mystate", finish)
+	request, err := http.NewRequest("GET", "/?code=mycode&state=mystate", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	c.Assert(<-finish, check.Equals, true)
+	c.Assert(form.Get("code"), check.Equals, "mycode")
+	c.Assert(form.Get("redirectUrl"), check.Equals, "someurl")
+	c.Assert(form.Get("code_verifier"), check.Equals, "myverifier")
+}
+
+func (s *S) TestCallbackHandlerInvalidState(c *check.C) {
+	var called bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Write([]byte(`{"token": "xpto"}`))
+	}))
+	defer ts.Close()
+	rfs := &fstest.RecordingFs{}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	os.Setenv("TSURU_TARGET", ts.URL)
+	finish := make(chan bool, 1)
+	handler := callback("someurl", "", "mystate", finish)
+	request, err := http.NewRequest("GET", "/?code=mycode&state=otherstate", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	c.Assert(<-finish, check.Equals, true)
+	c.Assert(recorder.Body.String(), check.Equals, fmt.Sprintf(callbackPage, fmt.Sprintf(errorMarkup, "invalid state in authorization response")))
+	c.Assert(called, check.Equals, false)
+	_, err = rfs.Open(JoinWithUserDir(".tsuru", "token"))
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestSetQueryParam(c *check.C) {
+	u, err := setQueryParam("http://idp/authorize?client_id=x&state=", "state", "abc")
+	c.Assert(err, check.IsNil)
+	c.Assert(u, check.Equals, "http://idp/authorize?client_id=x&state=abc")
+}
+
+func (s *S) TestPkcePair(c *check.C) {
+	verifier, challenge, err := pkcePair()
+	c.Assert(err, check.IsNil)
+	c.Assert(verifier, check.HasLen, 43)
+	sum := sha256.Sum256([]byte(verifier))
+	c.Assert(challenge, check.Equals, base64.RawURLEncoding.EncodeToString(sum[:]))
+	other, _, err := pkcePair()
+	c.Assert(err, check.IsNil)
+	c.Assert(other, check.Not(check.Equals), verifier)
+}
@@ -96,6 +96,24 @@ func (s *Storage) Apps() *storage.Collection {
 	return c
 }
 
+// AppEnvVersions returns the collection holding the history of environment
+// variables of apps.
+func (s *Storage) AppEnvVersions() *storage.Collection {
+	versionIndex := mgo.Index{Key: []string{"app", "version"}, Unique: true}
+	c := s.Collection("app_env_versions")
+	c.EnsureIndex(versionIndex)
+	return c
+}
+
+// AppAutoScalePolicies returns the collection holding the units auto scale
+// policies of apps.
+func (s *Storage) AppAutoScalePolicies() *storage.Collection {
+	policyIndex := mgo.Index{Key: []string{"app", "process"}, Unique: true}
+	c := s.Collection("app_autoscale_policies")
+	c.EnsureIndex(policyIndex)
+	return c
+}
+
 // Platforms returns the platforms collection from MongoDB.
 func (s *Storage) Platforms() *storage.Collection {
 	return s.Collection("platforms")
@@ -116,6 +134,11 @@ func (s *Storage) Plans() *storage.Collection {
 	return s.Collection("plans")
 }
 
+// NodeMetrics returns the node metrics collection.
+func (s *Storage) NodeMetrics() *storage.Collection {
+	return s.Collection("node_metrics")
+}
+
 // Pools returns the pool collection.
 func (s *Storage) Pools() *storage.Collection {
 	return s.Collection("pool")
@@ -147,6 +170,12 @@ func (s *Storage) PasswordTokens() *storage.Collection {
 	return s.Collection("password_tokens")
 }
 
+// TwoFactorSecrets returns the collection holding two-factor authentication
+// secrets and recovery codes from MongoDB.
+func (s *Storage) TwoFactorSecrets() *storage.Collection {
+	return s.Collection("two_factor_secrets")
+}
+
 func (s *Storage) UserActions() *storage.Collection {
 	return s.Collection("user_actions")
 }
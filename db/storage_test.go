@@ -95,6 +95,15 @@ func (s *S) TestPasswordTokens(c *check.C) {
 	c.Assert(tokens, check.DeepEquals, tokensc)
 }
 
+func (s *S) TestTwoFactorSecrets(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	secrets := strg.TwoFactorSecrets()
+	secretsc := strg.Collection("two_factor_secrets")
+	c.Assert(secrets, check.DeepEquals, secretsc)
+}
+
 func (s *S) TestUserActions(c *check.C) {
 	strg, err := Conn()
 	c.Assert(err, check.IsNil)
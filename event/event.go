@@ -147,6 +147,7 @@ type eventData struct {
 	StartTime       time.Time
 	EndTime         time.Time `bson:",omitempty"`
 	Target          Target    `bson:",omitempty"`
+	ExtraTargets    []Target  `bson:",omitempty"`
 	StartCustomData bson.Raw  `bson:",omitempty"`
 	EndCustomData   bson.Raw  `bson:",omitempty"`
 	OtherCustomData bson.Raw  `bson:",omitempty"`
@@ -251,7 +252,10 @@ type Event struct {
 }
 
 type Opts struct {
-	Target        Target
+	Target Target
+	// ExtraTargets are other targets affected by the event. They're not
+	// locked, but the event is listed when filtering by any of them.
+	ExtraTargets  []Target
 	Kind          *permission.PermissionScheme
 	InternalKind  string
 	Owner         auth.Token
@@ -377,11 +381,21 @@ func (f *Filter) toQuery() (bson.M, error) {
 		}
 		query["$or"] = orBlock
 	}
-	if f.Target.Type != "" {
-		query["target.type"] = f.Target.Type
-	}
-	if f.Target.Value != "" {
-		query["target.value"] = f.Target.Value
+	var andBlock []bson.M
+	if f.Target.Type != "" || f.Target.Value != "" {
+		target, extraTarget := bson.M{}, bson.M{}
+		if f.Target.Type != "" {
+			target["target.type"] = f.Target.Type
+			extraTarget["type"] = f.Target.Type
+		}
+		if f.Target.Value != "" {
+			target["target.value"] = f.Target.Value
+			extraTarget["value"] = f.Target.Value
+		}
+		andBlock = append(andBlock, bson.M{"$or": []bson.M{
+			target,
+			{"extratargets": bson.M{"$elemMatch": extraTarget}},
+		}})
 	}
 	if f.KindType != "" {
 		query["kind.type"] = f.KindType
@@ -395,15 +409,14 @@ func (f *Filter) toQuery() (bson.M, error) {
 	if f.OwnerName != "" {
 		query["owner.name"] = f.OwnerName
 	}
-	var timeParts []bson.M
 	if !f.Since.IsZero() {
-		timeParts = append(timeParts, bson.M{"starttime": bson.M{"$gte": f.Since}})
+		andBlock = append(andBlock, bson.M{"starttime": bson.M{"$gte": f.Since}})
 	}
 	if !f.Until.IsZero() {
-		timeParts = append(timeParts, bson.M{"starttime": bson.M{"$lte": f.Until}})
+		andBlock = append(andBlock, bson.M{"starttime": bson.M{"$lte": f.Until}})
 	}
-	if len(timeParts) != 0 {
-		query["$and"] = timeParts
+	if len(andBlock) != 0 {
+		query["$and"] = andBlock
 	}
 	if f.Running != nil {
 		query["running"] = *f.Running
@@ -618,6 +631,11 @@ func newEvt(opts *Opts) (*Event, error) {
 	if !opts.Target.IsValid() {
 		return nil, ErrNoTarget
 	}
+	for _, t := range opts.ExtraTargets {
+		if !t.IsValid() {
+			return nil, ErrNoTarget
+		}
+	}
 	if opts.Allowed.Scheme == "" && len(opts.Allowed.Contexts) == 0 {
 		return nil, ErrNoAllowed
 	}
@@ -690,6 +708,7 @@ func newEvt(opts *Opts) (*Event, error) {
 		ID:              id,
 		UniqueID:        uniqID,
 		Target:          opts.Target,
+		ExtraTargets:    opts.ExtraTargets,
 		StartTime:       now,
 		Kind:            k,
 		Owner:           o,
@@ -756,6 +775,14 @@ func (e *Event) RawInsert(start, other, end interface{}) error {
 	return coll.Insert(e.eventData)
 }
 
+// ResumeLock keeps the lock of a running event loaded from the database
+// updated, so that a process can finish an event started by another process
+// that stopped before finishing it.
+func (e *Event) ResumeLock() {
+	updater.start()
+	updater.addCh <- &e.Target
+}
+
 func (e *Event) Abort() error {
 	return e.done(nil, nil, true)
 }
@@ -881,6 +908,7 @@ func (e *Event) done(evtErr error, customData interface{}, abort bool) (err erro
 			log.Errorf("[events] error marking event as done - %#v: %s", e, err)
 		}
 	}()
+	updater.start()
 	updater.removeCh <- &e.Target
 	conn, err := db.Conn()
 	if err != nil {
@@ -153,6 +153,26 @@ func (s *S) TestListFilterMany(c *check.C) {
 	}, Sort: "_id"}, allEvts[:0])
 }
 
+func (s *S) TestListFilterExtraTargets(c *check.C) {
+	evt, err := event.New(&event.Opts{
+		Target:       event.Target{Type: "app", Value: "myapp"},
+		ExtraTargets: []event.Target{{Type: "service-instance", Value: "mysql/db"}},
+		Kind:         permission.PermAppUpdateBind,
+		Owner:        s.token,
+		Allowed:      event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: "service-instance", Value: "mysql/db"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, eventtest.EvtEquals, evt)
+	evts, err = event.List(&event.Filter{Target: event.Target{Type: "app", Value: "myapp"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, eventtest.EvtEquals, evt)
+	evts, err = event.List(&event.Filter{Target: event.Target{Type: "service-instance", Value: "mysql/other"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
 func (s *S) TestGetByID(c *check.C) {
 	evt, err := event.New(&event.Opts{
 		Target:  event.Target{Type: "app", Value: "myapp"},
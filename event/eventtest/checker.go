@@ -17,6 +17,7 @@ import (
 
 type EventDesc struct {
 	Target          event.Target
+	ExtraTargets    []event.Target
 	Kind            string
 	Owner           string
 	StartCustomData interface{}
@@ -85,6 +86,9 @@ func (hasEventChecker) Check(params []interface{}, names []string) (bool, string
 		"owner.name": evt.Owner,
 		"running":    false,
 	}
+	if len(evt.ExtraTargets) > 0 {
+		query["extratargets"] = evt.ExtraTargets
+	}
 	queryPartCustom(query, "startcustomdata", evt.StartCustomData)
 	queryPartCustom(query, "endcustomdata", evt.EndCustomData)
 	queryPartCustom(query, "othercustomdata", evt.OtherCustomData)
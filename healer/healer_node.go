@@ -7,6 +7,7 @@ package healer
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -27,8 +28,38 @@ import (
 const (
 	nodeHealerConfigCollection = "node-healer"
 	poolMetadataName           = "pool"
+
+	// RemediationRestartNodeContainers restarts the agents running on the
+	// node, like the node containers, keeping the node in place. It doesn't
+	// restart the node daemons, a hung daemon requires a reboot.
+	RemediationRestartNodeContainers = "restart-node-containers"
+	// RemediationReboot reboots the node machine through its IaaS, which
+	// must implement iaas.Rebooter, and then restarts its node containers.
+	RemediationReboot = "reboot"
+	// RemediationReplace destroys the node machine and creates a new one.
+	RemediationReplace = "replace"
 )
 
+var defaultRemediationActions = []string{RemediationReplace}
+
+var (
+	// nodeHealthCheckInterval is the interval between the checks of the
+	// node status after a remediation action that keeps the node in place.
+	nodeHealthCheckInterval = 5 * time.Second
+	// remediationEscalationWindow is the time, after a remediation action,
+	// in which another healing of the node starts from the next action, as
+	// the previous one didn't keep the node healthy.
+	remediationEscalationWindow = time.Hour
+)
+
+type InvalidRemediationActionError struct {
+	Action string
+}
+
+func (e *InvalidRemediationActionError) Error() string {
+	return fmt.Sprintf("invalid remediation action %q, valid actions are %q, %q and %q", e.Action, RemediationRestartNodeContainers, RemediationReboot, RemediationReplace)
+}
+
 type NodeHealer struct {
 	wg                    sync.WaitGroup
 	disabledTime          time.Duration
@@ -48,9 +79,11 @@ type NodeHealerConfig struct {
 	Enabled                      *bool
 	MaxTimeSinceSuccess          *int
 	MaxUnresponsiveTime          *int
+	RemediationActions           []string
 	EnabledInherited             bool
 	MaxTimeSinceSuccessInherited bool
 	MaxUnresponsiveTimeInherited bool
+	RemediationActionsInherited  bool
 }
 
 type NodeStatusData struct {
@@ -58,6 +91,10 @@ type NodeStatusData struct {
 	Checks      []NodeChecks `bson:",omitempty"`
 	LastSuccess time.Time    `bson:",omitempty"`
 	LastUpdate  time.Time
+	// LastRemediation is the last remediation action, other than replace,
+	// run on the node, at LastRemediationTime.
+	LastRemediation     string    `bson:",omitempty"`
+	LastRemediationTime time.Time `bson:",omitempty"`
 }
 
 type NodeChecks struct {
@@ -71,6 +108,14 @@ type NodeHealerCustomData struct {
 	LastCheck *NodeChecks
 }
 
+// NodeHealingResult is stored as the end custom data of healing events. The
+// node created in place of the failing one is only set when it was replaced,
+// and is inlined for compatibility with events storing only the new node.
+type NodeHealingResult struct {
+	Action             string
+	provision.NodeSpec `bson:",inline"`
+}
+
 func newNodeHealer(args nodeHealerArgs) *NodeHealer {
 	healer := &NodeHealer{
 		quit:                  make(chan bool),
@@ -94,7 +139,167 @@ func newNodeHealer(args nodeHealerArgs) *NodeHealer {
 	return healer
 }
 
-func (h *NodeHealer) healNode(node provision.Node) (*provision.NodeSpec, error) {
+// healNode runs the remediation actions configured for the pool of the node,
+// in order, until one of them succeeds. Actions other than replace keep the
+// node in place and only succeed when the node reports being healthy again.
+// When the node is healed again shortly after one of these actions, the
+// healing starts from the next action. The last action run is returned,
+// along with the spec of the new node when the node was replaced.
+func (h *NodeHealer) healNode(node provision.Node) (string, *provision.NodeSpec, error) {
+	actions, err := remediationActions(node.Metadata()[poolMetadataName])
+	if err != nil {
+		return "", nil, errors.Wrap(err, "unable to load remediation actions")
+	}
+	failingHost := net.URLToHost(node.Address())
+	last, err := lastRemediation(node.Address())
+	if err != nil {
+		return "", nil, errors.Wrap(err, "unable to load last remediation action")
+	}
+	actions = escalateRemediationActions(actions, last)
+	var actionErrs []string
+	var action string
+	for _, action = range actions {
+		start := time.Now().UTC()
+		switch action {
+		case RemediationRestartNodeContainers:
+			err = h.restartNodeContainers(node, false)
+		case RemediationReboot:
+			err = h.rebootNode(node)
+		case RemediationReplace:
+			createdNode, err := h.replaceNode(node)
+			return action, createdNode, err
+		default:
+			err = &InvalidRemediationActionError{Action: action}
+		}
+		if err == nil {
+			err = h.waitNodeHealthy(node, start)
+		}
+		if recordErr := setLastRemediation(node.Address(), action); recordErr != nil {
+			log.Errorf("Unable to record remediation action %q for node %q: %s", action, failingHost, recordErr)
+		}
+		if err == nil {
+			if healthNode, ok := node.(provision.NodeHealthChecker); ok {
+				healthNode.ResetFailures()
+			}
+			log.Debugf("Done auto-healing node %q with remediation action %q.", failingHost, action)
+			return action, nil, nil
+		}
+		log.Errorf("Remediation action %q failed for node %q: %s", action, failingHost, err)
+		actionErrs = append(actionErrs, fmt.Sprintf("%s: %s", action, err))
+	}
+	return action, nil, errors.Errorf("Can't auto-heal node %s: all remediation actions failed: %s", failingHost, strings.Join(actionErrs, "; "))
+}
+
+// escalateRemediationActions returns the actions after the last one run on
+// the node. The last configured action is always kept, so there's always an
+// action to run.
+func escalateRemediationActions(actions []string, last string) []string {
+	if last == "" {
+		return actions
+	}
+	for i, action := range actions {
+		if action != last {
+			continue
+		}
+		if i == len(actions)-1 {
+			return actions[i:]
+		}
+		return actions[i+1:]
+	}
+	return actions
+}
+
+// waitNodeHealthy waits for the node to report a successful check after the
+// given time. Nodes that never reported their status can't be checked and
+// are considered healthy.
+func (h *NodeHealer) waitNodeHealthy(node provision.Node, since time.Time) error {
+	coll, err := nodeDataCollection()
+	if err != nil {
+		return errors.Wrap(err, "unable to get node data collection")
+	}
+	defer coll.Close()
+	since = since.Truncate(time.Millisecond)
+	timeout := time.After(h.waitTimeNewMachine)
+	for {
+		var data NodeStatusData
+		err = coll.FindId(node.Address()).One(&data)
+		if err != nil && err != mgo.ErrNotFound {
+			return errors.Wrap(err, "unable to get node status")
+		}
+		if data.LastUpdate.IsZero() || !data.LastSuccess.Before(since) {
+			return nil
+		}
+		select {
+		case <-timeout:
+			return errors.Errorf("node didn't report a successful check in %v", h.waitTimeNewMachine)
+		case <-time.After(nodeHealthCheckInterval):
+		}
+	}
+}
+
+// lastRemediation returns the last remediation action run on the node, if it
+// was run within the escalation window.
+func lastRemediation(address string) (string, error) {
+	coll, err := nodeDataCollection()
+	if err != nil {
+		return "", err
+	}
+	defer coll.Close()
+	var data NodeStatusData
+	err = coll.FindId(address).One(&data)
+	if err == mgo.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if time.Since(data.LastRemediationTime) > remediationEscalationWindow {
+		return "", nil
+	}
+	return data.LastRemediation, nil
+}
+
+func setLastRemediation(address, action string) error {
+	coll, err := nodeDataCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.UpsertId(address, bson.M{"$set": bson.M{
+		"lastremediation":     action,
+		"lastremediationtime": time.Now().UTC(),
+	}})
+	return err
+}
+
+func (h *NodeHealer) restartNodeContainers(node provision.Node, waitNodeDown bool) error {
+	restarter, ok := node.Provisioner().(provision.NodeRestarter)
+	if !ok {
+		return errors.New("provisioner doesn't support restarting nodes")
+	}
+	return restarter.RestartNode(provision.RestartNodeOptions{
+		Address:      node.Address(),
+		WaitTO:       h.waitTimeNewMachine,
+		WaitNodeDown: waitNodeDown,
+	})
+}
+
+// rebootNode reboots the machine of the node and then restarts its node
+// containers. As the IaaS may return before the machine goes down, the node
+// must stop responding before it's waited to respond again.
+func (h *NodeHealer) rebootNode(node provision.Node) error {
+	machine, err := iaas.FindMachineByIdOrAddress(node.Metadata()["iaas-id"], net.URLToHost(node.Address()))
+	if err != nil {
+		return errors.Wrap(err, "unable to find machine in IaaS")
+	}
+	err = machine.Reboot()
+	if err != nil {
+		return errors.Wrap(err, "unable to reboot machine")
+	}
+	return h.restartNodeContainers(node, true)
+}
+
+func (h *NodeHealer) replaceNode(node provision.Node) (*provision.NodeSpec, error) {
 	failingAddr := node.Address()
 	// Copy metadata to ensure underlying data structure is not modified.
 	newNodeMetadata := map[string]string{}
@@ -189,14 +394,22 @@ func (h *NodeHealer) tryHealingNode(node provision.Node, reason string, lastChec
 		}
 		return errors.Wrap(err, "Error trying to insert node healing event, healing aborted")
 	}
+	var action string
 	var createdNode *provision.NodeSpec
 	var evtErr error
 	defer func() {
 		var updateErr error
-		if evtErr == nil && createdNode == nil {
+		if evtErr == nil && action == "" {
 			updateErr = evt.Abort()
 		} else {
-			updateErr = evt.DoneCustomData(evtErr, createdNode)
+			var result *NodeHealingResult
+			if action != "" {
+				result = &NodeHealingResult{Action: action}
+				if createdNode != nil {
+					result.NodeSpec = *createdNode
+				}
+			}
+			updateErr = evt.DoneCustomData(evtErr, result)
 		}
 		if updateErr != nil {
 			log.Errorf("error trying to update healing event: %s", updateErr)
@@ -219,7 +432,7 @@ func (h *NodeHealer) tryHealingNode(node provision.Node, reason string, lastChec
 		return nil
 	}
 	log.Errorf("initiating healing process for node %q due to: %s", node.Address(), reason)
-	createdNode, evtErr = h.healNode(node)
+	action, createdNode, evtErr = h.healNode(node)
 	return evtErr
 }
 
@@ -469,6 +682,11 @@ func (h *NodeHealer) runActiveHealing() {
 }
 
 func UpdateConfig(pool string, config NodeHealerConfig) error {
+	for _, action := range config.RemediationActions {
+		if !isValidRemediationAction(action) {
+			return &InvalidRemediationActionError{Action: action}
+		}
+	}
 	conf := healerConfig()
 	err := conf.SaveMerge(pool, config)
 	if err != nil {
@@ -498,6 +716,26 @@ func GetConfig() (map[string]NodeHealerConfig, error) {
 	return ret, nil
 }
 
+func isValidRemediationAction(action string) bool {
+	switch action {
+	case RemediationRestartNodeContainers, RemediationReboot, RemediationReplace:
+		return true
+	}
+	return false
+}
+
+func remediationActions(pool string) ([]string, error) {
+	var configEntry NodeHealerConfig
+	err := healerConfig().Load(pool, &configEntry)
+	if err != nil {
+		return nil, err
+	}
+	if len(configEntry.RemediationActions) == 0 {
+		return defaultRemediationActions, nil
+	}
+	return configEntry.RemediationActions, nil
+}
+
 func nodeDataCollection() (*storage.Collection, error) {
 	conn, err := db.Conn()
 	if err != nil {
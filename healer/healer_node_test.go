@@ -56,8 +56,9 @@ func (s *S) TestHealerHealNode(c *check.C) {
 	c.Assert(machines, check.HasLen, 1)
 	c.Assert(machines[0].Address, check.Equals, "addr1")
 
-	created, err := healer.healNode(nodes[0])
+	action, created, err := healer.healNode(nodes[0])
 	c.Assert(err, check.IsNil)
+	c.Assert(action, check.Equals, RemediationReplace)
 	c.Assert(created.Address, check.Equals, "http://addr2:2")
 	nodes, err = p.ListNodes(nil)
 	c.Assert(err, check.IsNil)
@@ -70,6 +71,252 @@ func (s *S) TestHealerHealNode(c *check.C) {
 	c.Assert(machines[0].Address, check.Equals, "addr2")
 }
 
+func (s *S) TestHealerHealNodeRestart(c *check.C) {
+	factory, iaasInst := iaasTesting.NewHealerIaaSConstructorWithInst("addr1")
+	iaas.RegisterIaasProvider("my-healer-iaas", factory)
+	_, err := iaas.CreateMachineForIaaS("my-healer-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	iaasInst.Addr = "addr2"
+	err = UpdateConfig("p1", NodeHealerConfig{RemediationActions: []string{RemediationRestartNodeContainers, RemediationReplace}})
+	c.Assert(err, check.IsNil)
+	p := provisiontest.ProvisionerInstance
+	err = p.AddNode(provision.AddNodeOptions{
+		Address:  "http://addr1:1",
+		Metadata: map[string]string{"iaas": "my-healer-iaas", "pool": "p1"},
+	})
+	c.Assert(err, check.IsNil)
+	healer := newNodeHealer(nodeHealerArgs{WaitTimeNewMachine: time.Minute})
+	healer.Shutdown()
+	nodes, err := p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	action, created, err := healer.healNode(nodes[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(action, check.Equals, RemediationRestartNodeContainers)
+	c.Assert(created, check.IsNil)
+	node, err := p.GetNode("http://addr1:1")
+	c.Assert(err, check.IsNil)
+	c.Assert(node.(*provisiontest.FakeNode).Restarts(), check.Equals, 1)
+	c.Assert(node.(*provisiontest.FakeNode).LastRestartOptions().WaitNodeDown, check.Equals, false)
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+	c.Assert(machines[0].Address, check.Equals, "addr1")
+	c.Assert(iaasInst.Rebooted, check.HasLen, 0)
+}
+
+func (s *S) TestHealerHealNodeRebootAfterRestartFailure(c *check.C) {
+	factory, iaasInst := iaasTesting.NewHealerIaaSConstructorWithInst("addr1")
+	iaas.RegisterIaasProvider("my-healer-iaas", factory)
+	_, err := iaas.CreateMachineForIaaS("my-healer-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	iaasInst.Addr = "addr2"
+	err = UpdateConfig("p1", NodeHealerConfig{RemediationActions: []string{RemediationRestartNodeContainers, RemediationReboot, RemediationReplace}})
+	c.Assert(err, check.IsNil)
+	p := provisiontest.ProvisionerInstance
+	err = p.AddNode(provision.AddNodeOptions{
+		Address:  "http://addr1:1",
+		Metadata: map[string]string{"iaas": "my-healer-iaas", "pool": "p1"},
+	})
+	c.Assert(err, check.IsNil)
+	p.PrepareFailure("RestartNode", fmt.Errorf("docker hung"))
+	healer := newNodeHealer(nodeHealerArgs{WaitTimeNewMachine: time.Minute})
+	healer.Shutdown()
+	nodes, err := p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	action, created, err := healer.healNode(nodes[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(action, check.Equals, RemediationReboot)
+	c.Assert(created, check.IsNil)
+	c.Assert(iaasInst.Rebooted, check.DeepEquals, []string{"m-addr1"})
+	node, err := p.GetNode("http://addr1:1")
+	c.Assert(err, check.IsNil)
+	c.Assert(node.(*provisiontest.FakeNode).Restarts(), check.Equals, 1)
+	c.Assert(node.(*provisiontest.FakeNode).LastRestartOptions().WaitNodeDown, check.Equals, true)
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+	c.Assert(machines[0].Address, check.Equals, "addr1")
+}
+
+func (s *S) TestHealerHealNodeReplaceAfterRemediationFailures(c *check.C) {
+	factory, iaasInst := iaasTesting.NewHealerIaaSConstructorWithInst("addr1")
+	iaas.RegisterIaasProvider("my-healer-iaas", factory)
+	_, err := iaas.CreateMachineForIaaS("my-healer-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	iaasInst.Addr = "addr2"
+	iaasInst.RebootErr = fmt.Errorf("reboot failed")
+	config.Set("iaas:node-protocol", "http")
+	config.Set("iaas:node-port", 2)
+	defer config.Unset("iaas:node-protocol")
+	defer config.Unset("iaas:node-port")
+	err = UpdateConfig("p1", NodeHealerConfig{RemediationActions: []string{RemediationRestartNodeContainers, RemediationReboot, RemediationReplace}})
+	c.Assert(err, check.IsNil)
+	p := provisiontest.ProvisionerInstance
+	err = p.AddNode(provision.AddNodeOptions{
+		Address:  "http://addr1:1",
+		Metadata: map[string]string{"iaas": "my-healer-iaas", "pool": "p1"},
+	})
+	c.Assert(err, check.IsNil)
+	p.PrepareFailure("RestartNode", fmt.Errorf("docker hung"))
+	healer := newNodeHealer(nodeHealerArgs{WaitTimeNewMachine: time.Minute})
+	healer.Shutdown()
+	nodes, err := p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	_, created, err := healer.healNode(nodes[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(created.Address, check.Equals, "http://addr2:2")
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+	c.Assert(machines[0].Address, check.Equals, "addr2")
+}
+
+func (s *S) TestHealerHealNodeAllRemediationActionsFail(c *check.C) {
+	factory, iaasInst := iaasTesting.NewHealerIaaSConstructorWithInst("addr1")
+	iaas.RegisterIaasProvider("my-healer-iaas", factory)
+	_, err := iaas.CreateMachineForIaaS("my-healer-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	iaasInst.RebootErr = fmt.Errorf("reboot failed")
+	err = UpdateConfig("p1", NodeHealerConfig{RemediationActions: []string{RemediationRestartNodeContainers, RemediationReboot}})
+	c.Assert(err, check.IsNil)
+	p := provisiontest.ProvisionerInstance
+	err = p.AddNode(provision.AddNodeOptions{
+		Address:  "http://addr1:1",
+		Metadata: map[string]string{"iaas": "my-healer-iaas", "pool": "p1"},
+	})
+	c.Assert(err, check.IsNil)
+	p.PrepareFailure("RestartNode", fmt.Errorf("docker hung"))
+	healer := newNodeHealer(nodeHealerArgs{WaitTimeNewMachine: time.Minute})
+	healer.Shutdown()
+	nodes, err := p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	_, created, err := healer.healNode(nodes[0])
+	c.Assert(err, check.ErrorMatches, `Can't auto-heal node addr1: all remediation actions failed: restart-node-containers: docker hung; reboot: unable to reboot machine: reboot failed`)
+	c.Assert(created, check.IsNil)
+	nodes, err = p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	c.Assert(nodes[0].Address(), check.Equals, "http://addr1:1")
+}
+
+func (s *S) TestHealerHealNodeWaitsNodeHealthy(c *check.C) {
+	oldInterval := nodeHealthCheckInterval
+	nodeHealthCheckInterval = 10 * time.Millisecond
+	defer func() { nodeHealthCheckInterval = oldInterval }()
+	factory, iaasInst := iaasTesting.NewHealerIaaSConstructorWithInst("addr1")
+	iaas.RegisterIaasProvider("my-healer-iaas", factory)
+	_, err := iaas.CreateMachineForIaaS("my-healer-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	err = UpdateConfig("p1", NodeHealerConfig{RemediationActions: []string{RemediationRestartNodeContainers, RemediationReboot}})
+	c.Assert(err, check.IsNil)
+	p := provisiontest.ProvisionerInstance
+	err = p.AddNode(provision.AddNodeOptions{
+		Address:  "http://addr1:1",
+		Metadata: map[string]string{"iaas": "my-healer-iaas", "pool": "p1"},
+	})
+	c.Assert(err, check.IsNil)
+	healer := newNodeHealer(nodeHealerArgs{WaitTimeNewMachine: 5 * time.Second})
+	healer.Shutdown()
+	nodes, err := p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	failed := []provision.NodeCheckResult{{Name: "ok1", Successful: false}}
+	err = healer.UpdateNodeData(nodes[0], failed)
+	c.Assert(err, check.IsNil)
+	type healResult struct {
+		action string
+		err    error
+	}
+	done := make(chan healResult)
+	go func() {
+		action, _, err := healer.healNode(nodes[0])
+		done <- healResult{action: action, err: err}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	err = healer.UpdateNodeData(nodes[0], []provision.NodeCheckResult{{Name: "ok1", Successful: true}})
+	c.Assert(err, check.IsNil)
+	select {
+	case result := <-done:
+		c.Assert(result.err, check.IsNil)
+		c.Assert(result.action, check.Equals, RemediationRestartNodeContainers)
+	case <-time.After(10 * time.Second):
+		c.Fatal("timeout waiting for node healing")
+	}
+	c.Assert(iaasInst.Rebooted, check.HasLen, 0)
+}
+
+func (s *S) TestHealerHealNodeEscalatesWhenNodeStaysUnhealthy(c *check.C) {
+	oldInterval := nodeHealthCheckInterval
+	nodeHealthCheckInterval = 10 * time.Millisecond
+	defer func() { nodeHealthCheckInterval = oldInterval }()
+	factory, iaasInst := iaasTesting.NewHealerIaaSConstructorWithInst("addr1")
+	iaas.RegisterIaasProvider("my-healer-iaas", factory)
+	_, err := iaas.CreateMachineForIaaS("my-healer-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	iaasInst.Addr = "addr2"
+	config.Set("iaas:node-protocol", "http")
+	config.Set("iaas:node-port", 2)
+	defer config.Unset("iaas:node-protocol")
+	defer config.Unset("iaas:node-port")
+	err = UpdateConfig("p1", NodeHealerConfig{RemediationActions: []string{RemediationRestartNodeContainers, RemediationReboot, RemediationReplace}})
+	c.Assert(err, check.IsNil)
+	p := provisiontest.ProvisionerInstance
+	err = p.AddNode(provision.AddNodeOptions{
+		Address:  "http://addr1:1",
+		Metadata: map[string]string{"iaas": "my-healer-iaas", "pool": "p1"},
+	})
+	c.Assert(err, check.IsNil)
+	healer := newNodeHealer(nodeHealerArgs{WaitTimeNewMachine: 100 * time.Millisecond})
+	healer.Shutdown()
+	nodes, err := p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	err = healer.UpdateNodeData(nodes[0], []provision.NodeCheckResult{{Name: "ok1", Successful: false}})
+	c.Assert(err, check.IsNil)
+	action, created, err := healer.healNode(nodes[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(action, check.Equals, RemediationReplace)
+	c.Assert(created.Address, check.Equals, "http://addr2:2")
+	c.Assert(iaasInst.Rebooted, check.DeepEquals, []string{"m-addr1"})
+}
+
+func (s *S) TestHealerHealNodeEscalatesFromLastRemediation(c *check.C) {
+	factory, iaasInst := iaasTesting.NewHealerIaaSConstructorWithInst("addr1")
+	iaas.RegisterIaasProvider("my-healer-iaas", factory)
+	_, err := iaas.CreateMachineForIaaS("my-healer-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	err = UpdateConfig("p1", NodeHealerConfig{RemediationActions: []string{RemediationRestartNodeContainers, RemediationReboot, RemediationReplace}})
+	c.Assert(err, check.IsNil)
+	p := provisiontest.ProvisionerInstance
+	err = p.AddNode(provision.AddNodeOptions{
+		Address:  "http://addr1:1",
+		Metadata: map[string]string{"iaas": "my-healer-iaas", "pool": "p1"},
+	})
+	c.Assert(err, check.IsNil)
+	err = setLastRemediation("http://addr1:1", RemediationRestartNodeContainers)
+	c.Assert(err, check.IsNil)
+	healer := newNodeHealer(nodeHealerArgs{WaitTimeNewMachine: time.Minute})
+	healer.Shutdown()
+	nodes, err := p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	action, created, err := healer.healNode(nodes[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(action, check.Equals, RemediationReboot)
+	c.Assert(created, check.IsNil)
+	c.Assert(iaasInst.Rebooted, check.DeepEquals, []string{"m-addr1"})
+	last, err := lastRemediation("http://addr1:1")
+	c.Assert(err, check.IsNil)
+	c.Assert(last, check.Equals, RemediationReboot)
+}
+
+func (s *S) TestEscalateRemediationActions(c *check.C) {
+	actions := []string{RemediationRestartNodeContainers, RemediationReboot, RemediationReplace}
+	c.Assert(escalateRemediationActions(actions, ""), check.DeepEquals, actions)
+	c.Assert(escalateRemediationActions(actions, RemediationRestartNodeContainers), check.DeepEquals, []string{RemediationReboot, RemediationReplace})
+	c.Assert(escalateRemediationActions(actions, RemediationReboot), check.DeepEquals, []string{RemediationReplace})
+	c.Assert(escalateRemediationActions(actions[:2], RemediationReboot), check.DeepEquals, []string{RemediationReboot})
+	c.Assert(escalateRemediationActions([]string{RemediationReplace}, RemediationReboot), check.DeepEquals, []string{RemediationReplace})
+}
+
 func (s *S) TestHealerHealNodeWithoutIaaS(c *check.C) {
 	p := provisiontest.ProvisionerInstance
 	err := p.AddNode(provision.AddNodeOptions{
@@ -85,7 +332,7 @@ func (s *S) TestHealerHealNodeWithoutIaaS(c *check.C) {
 	nodes, err := p.ListNodes(nil)
 	c.Assert(err, check.IsNil)
 	c.Assert(nodes, check.HasLen, 1)
-	created, err := healer.healNode(nodes[0])
+	_, created, err := healer.healNode(nodes[0])
 	c.Assert(err, check.ErrorMatches, ".*error creating new machine.*")
 	c.Assert(created, check.IsNil)
 	nodes, err = p.ListNodes(nil)
@@ -122,7 +369,7 @@ func (s *S) TestHealerHealNodeCreateMachineError(c *check.C) {
 	fakeNode := nodes[0].(*provisiontest.FakeNode)
 	fakeNode.SetHealth(1, false)
 	c.Assert(fakeNode.FailureCount() > 0, check.Equals, true)
-	created, err := healer.healNode(nodes[0])
+	_, created, err := healer.healNode(nodes[0])
 	c.Assert(err, check.ErrorMatches, ".*my create machine error.*")
 	c.Assert(created, check.IsNil)
 	c.Assert(fakeNode.FailureCount(), check.Equals, 0)
@@ -157,7 +404,7 @@ func (s *S) TestHealerHealNodeWaitAndRegisterError(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(nodes, check.HasLen, 1)
 	c.Assert(nodes[0].Address(), check.Equals, "http://addr1:1")
-	created, err := healer.healNode(nodes[0])
+	_, created, err := healer.healNode(nodes[0])
 	c.Assert(err, check.ErrorMatches, ".*error registering new node: add node error.*")
 	c.Assert(created, check.IsNil)
 	nodes, err = p.ListNodes(nil)
@@ -202,7 +449,7 @@ func (s *S) TestHealerHealNodeDestroyError(c *check.C) {
 	buf := bytes.Buffer{}
 	log.SetLogger(log.NewWriterLogger(&buf, false))
 	defer log.SetLogger(nil)
-	created, err := healer.healNode(nodes[0])
+	_, created, err := healer.healNode(nodes[0])
 	c.Assert(err, check.IsNil)
 	c.Assert(created.Address, check.Equals, "http://addr2:2")
 	c.Assert(buf.String(), check.Matches, "(?s).*my destroy error.*")
@@ -281,7 +528,8 @@ func (s *S) TestHealerHandleError(c *check.C) {
 			"node._id": "http://addr1:1",
 		},
 		EndCustomData: map[string]interface{}{
-			"_id": "http://addr2:2",
+			"action": RemediationReplace,
+			"_id":    "http://addr2:2",
 		},
 	}, eventtest.HasEvent)
 }
@@ -823,6 +1071,7 @@ func (s *S) TestUpdateConfigIgnoresEmpty(c *check.C) {
 		EnabledInherited:             true,
 		MaxUnresponsiveTimeInherited: true,
 		MaxTimeSinceSuccessInherited: true,
+		RemediationActionsInherited:  true,
 	})
 	err = UpdateConfig("p1", NodeHealerConfig{
 		MaxTimeSinceSuccess: intPtr(2),
@@ -838,6 +1087,7 @@ func (s *S) TestUpdateConfigIgnoresEmpty(c *check.C) {
 		EnabledInherited:             true,
 		MaxUnresponsiveTimeInherited: true,
 		MaxTimeSinceSuccessInherited: false,
+		RemediationActionsInherited:  true,
 	})
 	err = UpdateConfig("p1", NodeHealerConfig{
 		MaxTimeSinceSuccess: intPtr(2),
@@ -854,9 +1104,18 @@ func (s *S) TestUpdateConfigIgnoresEmpty(c *check.C) {
 		EnabledInherited:             true,
 		MaxUnresponsiveTimeInherited: false,
 		MaxTimeSinceSuccessInherited: false,
+		RemediationActionsInherited:  true,
 	})
 }
 
+func (s *S) TestUpdateConfigInvalidRemediationAction(c *check.C) {
+	err := UpdateConfig("p1", NodeHealerConfig{RemediationActions: []string{RemediationRestartNodeContainers, "pray"}})
+	c.Assert(err, check.DeepEquals, &InvalidRemediationActionError{Action: "pray"})
+	conf, err := GetConfig()
+	c.Assert(err, check.IsNil)
+	c.Assert(conf["p1"].RemediationActions, check.IsNil)
+}
+
 func boolPtr(b bool) *bool {
 	return &b
 }
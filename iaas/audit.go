@@ -0,0 +1,156 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tsuru/config"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+// Lister is implemented by IaaSs able to list the machines currently
+// existing in the provider, allowing tsuru to reconcile them with the
+// machines it knows about.
+type Lister interface {
+	ListMachines() ([]Machine, error)
+}
+
+// NodeRef identifies a node registered in a provisioner. It's used to find
+// machines that were never registered as nodes.
+type NodeRef struct {
+	Address string
+	IaaSID  string
+}
+
+// MachineAudit is the result of reconciling the machines of an IaaS stored
+// in tsuru with the ones existing in the provider and the registered nodes.
+//
+// Orphaned machines exist in the provider but are unknown to tsuru, Missing
+// machines are known to tsuru but don't exist in the provider anymore and
+// Unregistered machines are known to tsuru but aren't registered as nodes.
+// Orphaned and Missing are only filled for IaaSs implementing Lister.
+type MachineAudit struct {
+	IaaS         string
+	Listable     bool
+	Error        string `json:",omitempty"`
+	Orphaned     []Machine
+	Missing      []Machine
+	Unregistered []Machine
+}
+
+// AuditMachines reconciles the machines of every configured IaaS, and of
+// every IaaS with machines stored in tsuru, with the machines existing in
+// the providers and with the given nodes. When iaasNames is not nil, only
+// the named IaaSes are audited and the others are never listed.
+func AuditMachines(nodes []NodeRef, iaasNames []string) ([]MachineAudit, error) {
+	machines, err := ListMachines()
+	if err != nil {
+		return nil, err
+	}
+	nodeAddrs := map[string]bool{}
+	nodeIDs := map[string]bool{}
+	for _, n := range nodes {
+		nodeAddrs[tsuruNet.URLToHost(n.Address)] = true
+		if n.IaaSID != "" {
+			nodeIDs[n.IaaSID] = true
+		}
+	}
+	byIaaS := map[string][]Machine{}
+	for _, name := range configuredIaaSNames() {
+		byIaaS[name] = nil
+	}
+	for _, m := range machines {
+		if m.Pending() {
+			continue
+		}
+		byIaaS[m.Iaas] = append(byIaaS[m.Iaas], m)
+	}
+	var allowed map[string]bool
+	if iaasNames != nil {
+		allowed = make(map[string]bool, len(iaasNames))
+		for _, name := range iaasNames {
+			allowed[name] = true
+		}
+	}
+	names := make([]string, 0, len(byIaaS))
+	for name := range byIaaS {
+		if allowed == nil || allowed[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	result := make([]MachineAudit, 0, len(names))
+	for _, name := range names {
+		audit := MachineAudit{IaaS: name}
+		known := byIaaS[name]
+		for _, m := range known {
+			if !nodeIDs[m.Id] && !nodeAddrs[m.Address] {
+				audit.Unregistered = append(audit.Unregistered, m)
+			}
+		}
+		err = audit.reconcile(known)
+		if err != nil {
+			audit.Error = err.Error()
+		}
+		result = append(result, audit)
+	}
+	return result, nil
+}
+
+func (a *MachineAudit) reconcile(known []Machine) error {
+	provider, err := getIaasProvider(a.IaaS)
+	if err != nil {
+		return err
+	}
+	lister, ok := provider.(Lister)
+	if !ok {
+		return nil
+	}
+	a.Listable = true
+	existing, err := lister.ListMachines()
+	if err != nil {
+		return err
+	}
+	existingIDs := map[string]bool{}
+	for _, m := range existing {
+		existingIDs[m.Id] = true
+	}
+	knownIDs := map[string]bool{}
+	for _, m := range known {
+		knownIDs[m.Id] = true
+		if !existingIDs[m.Id] {
+			a.Missing = append(a.Missing, m)
+		}
+	}
+	for _, m := range existing {
+		if !knownIDs[m.Id] {
+			m.Iaas = a.IaaS
+			a.Orphaned = append(a.Orphaned, m)
+		}
+	}
+	return nil
+}
+
+// configuredIaaSNames returns the names of the registered IaaS providers
+// with configuration entries along with the custom IaaSs.
+func configuredIaaSNames() []string {
+	var names []string
+	for provider := range iaasProviders {
+		if _, err := config.Get(fmt.Sprintf("iaas:%s", provider)); err == nil {
+			names = append(names, provider)
+		}
+	}
+	c, err := config.Get("iaas:custom")
+	if err == nil {
+		if v, ok := c.(map[interface{}]interface{}); ok {
+			for provider := range v {
+				names = append(names, provider.(string))
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"errors"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAuditMachines(c *check.C) {
+	lister := &TestListerIaaS{machines: []Machine{
+		{Id: "m1", Address: "m1.somewhere.com", Status: "running"},
+		{Id: "m3", Address: "m3.somewhere.com", Status: "running"},
+	}}
+	RegisterIaasProvider("lister-iaas", func(string) IaaS { return lister })
+	for _, m := range []Machine{
+		{Id: "m1", Iaas: "lister-iaas", Address: "m1.somewhere.com"},
+		{Id: "m2", Iaas: "lister-iaas", Address: "m2.somewhere.com"},
+	} {
+		err := m.saveToDB()
+		c.Assert(err, check.IsNil)
+	}
+	audits, err := AuditMachines([]NodeRef{{Address: "http://m1.somewhere.com:2375"}}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(audits, check.HasLen, 1)
+	c.Assert(audits[0].IaaS, check.Equals, "lister-iaas")
+	c.Assert(audits[0].Listable, check.Equals, true)
+	c.Assert(audits[0].Error, check.Equals, "")
+	c.Assert(audits[0].Orphaned, check.DeepEquals, []Machine{
+		{Id: "m3", Iaas: "lister-iaas", Address: "m3.somewhere.com", Status: "running"},
+	})
+	c.Assert(audits[0].Missing, check.HasLen, 1)
+	c.Assert(audits[0].Missing[0].Id, check.Equals, "m2")
+	c.Assert(audits[0].Unregistered, check.HasLen, 1)
+	c.Assert(audits[0].Unregistered[0].Id, check.Equals, "m2")
+}
+
+func (s *S) TestAuditMachinesMatchesNodesByIaaSID(c *check.C) {
+	m := Machine{Id: "m1", Iaas: "test-iaas", Address: "10.0.0.1"}
+	err := m.saveToDB()
+	c.Assert(err, check.IsNil)
+	audits, err := AuditMachines([]NodeRef{{Address: "http://other.address:2375", IaaSID: "m1"}}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(audits, check.HasLen, 1)
+	c.Assert(audits[0].Listable, check.Equals, false)
+	c.Assert(audits[0].Unregistered, check.IsNil)
+	c.Assert(audits[0].Orphaned, check.IsNil)
+	c.Assert(audits[0].Missing, check.IsNil)
+}
+
+func (s *S) TestAuditMachinesIncludesConfiguredIaaSWithoutMachines(c *check.C) {
+	lister := &TestListerIaaS{machines: []Machine{{Id: "lost", Address: "lost.somewhere.com"}}}
+	RegisterIaasProvider("lister-iaas", func(string) IaaS { return lister })
+	config.Set("iaas:custom:my-lister:provider", "lister-iaas")
+	defer config.Unset("iaas:custom")
+	audits, err := AuditMachines(nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(audits, check.HasLen, 1)
+	c.Assert(audits[0].IaaS, check.Equals, "my-lister")
+	c.Assert(audits[0].Orphaned, check.DeepEquals, []Machine{
+		{Id: "lost", Iaas: "my-lister", Address: "lost.somewhere.com"},
+	})
+}
+
+func (s *S) TestAuditMachinesListError(c *check.C) {
+	lister := &TestListerIaaS{err: errors.New("provider is down")}
+	RegisterIaasProvider("lister-iaas", func(string) IaaS { return lister })
+	m := Machine{Id: "m1", Iaas: "lister-iaas", Address: "m1.somewhere.com"}
+	err := m.saveToDB()
+	c.Assert(err, check.IsNil)
+	audits, err := AuditMachines(nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(audits, check.HasLen, 1)
+	c.Assert(audits[0].Listable, check.Equals, true)
+	c.Assert(audits[0].Error, check.Equals, "provider is down")
+	c.Assert(audits[0].Missing, check.IsNil)
+	c.Assert(audits[0].Unregistered, check.HasLen, 1)
+}
+
+func (s *S) TestAuditMachinesOnlyListsAllowedIaaS(c *check.C) {
+	lister := &TestListerIaaS{err: errors.New("should not be listed")}
+	RegisterIaasProvider("lister-iaas", func(string) IaaS { return lister })
+	for _, m := range []Machine{
+		{Id: "m1", Iaas: "lister-iaas", Address: "m1.somewhere.com"},
+		{Id: "m2", Iaas: "test-iaas", Address: "m2.somewhere.com"},
+	} {
+		err := m.saveToDB()
+		c.Assert(err, check.IsNil)
+	}
+	audits, err := AuditMachines(nil, []string{"test-iaas"})
+	c.Assert(err, check.IsNil)
+	c.Assert(audits, check.HasLen, 1)
+	c.Assert(audits[0].IaaS, check.Equals, "test-iaas")
+	c.Assert(audits[0].Error, check.Equals, "")
+	audits, err = AuditMachines(nil, []string{})
+	c.Assert(err, check.IsNil)
+	c.Assert(audits, check.HasLen, 0)
+}
@@ -26,6 +26,10 @@ import (
 	"github.com/tsuru/tsuru/queue"
 )
 
+// iaasTagKey is the tag set on every virtual machine created by tsuru,
+// holding the name of the IaaS that created it.
+const iaasTagKey = "tsuru-iaas"
+
 func init() {
 	iaas.RegisterIaasProvider("cloudstack", newCloudstackIaaS)
 	hc.AddChecker("CloudStack", iaas.BuildHealthCheck("cloudstack"))
@@ -39,6 +43,10 @@ func newCloudstackIaaS(name string) iaas.IaaS {
 	return &CloudstackIaaS{base: iaas.UserDataIaaS{NamedIaaS: iaas.NamedIaaS{BaseIaaSName: "cloudstack", IaaSName: name}}}
 }
 
+func (i *CloudstackIaaS) InstanceType(params map[string]string) string {
+	return params["serviceofferingid"]
+}
+
 func (i *CloudstackIaaS) Describe() string {
 	return `Cloudstack IaaS required params:
   networkids=<networkids>                   Your network uuid
@@ -181,9 +189,11 @@ func (i *CloudstackIaaS) CreateMachine(params map[string]string) (*iaas.Machine,
 		"jobId": vmStatus.DeployVirtualMachineResponse.JobID,
 		"vmId":  vmStatus.DeployVirtualMachineResponse.ID,
 	}
-	if tags, ok := params["tags"]; ok {
-		jobParams["tags"] = tags
+	tags := iaasTagKey + ":" + i.base.IaaSName
+	if extraTags := params["tags"]; extraTags != "" {
+		tags = extraTags + "," + tags
 	}
+	jobParams["tags"] = tags
 	if projectId, ok := params["projectid"]; ok {
 		jobParams["projectId"] = projectId
 	}
@@ -207,6 +217,37 @@ func (i *CloudstackIaaS) CreateMachine(params map[string]string) (*iaas.Machine,
 	return m, nil
 }
 
+// ListMachines returns the virtual machines created by this IaaS, identified
+// by the tsuru-iaas tag and restricted to the project set in the "projectid"
+// config, if any. Destroyed and expunging machines are ignored.
+func (i *CloudstackIaaS) ListMachines() ([]iaas.Machine, error) {
+	params := map[string]string{
+		"listall":       "true",
+		"tags[0].key":   iaasTagKey,
+		"tags[0].value": i.base.IaaSName,
+	}
+	if projectId, _ := i.base.GetConfigString("projectid"); projectId != "" {
+		params["projectid"] = projectId
+	}
+	var resp ListVirtualMachinesResponse
+	err := i.do("listVirtualMachines", params, &resp)
+	if err != nil {
+		return nil, err
+	}
+	var machines []iaas.Machine
+	for _, vm := range resp.ListVirtualMachinesResponse.VirtualMachine {
+		if vm.State == "Destroyed" || vm.State == "Expunging" {
+			continue
+		}
+		m := iaas.Machine{Id: vm.ID, Status: vm.State}
+		if len(vm.Nic) > 0 {
+			m.Address = vm.Nic[0].IpAddress
+		}
+		machines = append(machines, m)
+	}
+	return machines, nil
+}
+
 func (i *CloudstackIaaS) buildUrl(command string, params map[string]string) (string, error) {
 	apiKey, err := i.base.GetConfigString("api-key")
 	if err != nil {
@@ -52,6 +52,10 @@ func (s *cloudstackSuite) TestCreateMachineWithoutProjectID(c *check.C) {
 			json := `{ "listvirtualmachinesresponse" : { "count":1 ,"virtualmachine" : [  {"id":"0366ae09-0a77-4e2b-8595-3b749764a107","name":"vm-0366ae09-0a77-4e2b-8595-3b749764a107","domainid":"eec2dacf-9982-11e3-a2b8-eee0bc1594e0","domain":"ROOT","created":"2014-07-18T18:29:30-0300","state":"Stopped","haenable":false,"zoneid":"95046c6c-65b8-415f-99cb-0cff40dc5f9c","zonename":"RJOEBT0200BE","templateid":"99f66d4c-f923-46e5-aa7b-09a0b22ee747","templatename":"ubuntu-14.04-server-amd64","templatedisplaytext":"ubuntu 14.04 ( 3.13.0-24-generic )","passwordenabled":false,"serviceofferingid":"3ff651c8-a27f-4008-87d5-71636aaabbc6","serviceofferingname":"Medium","cpunumber":2,"cpuspeed":1800,"memory":8192,"guestosid":"eede1fdf-9982-11e3-a2b8-eee0bc1594e0","rootdeviceid":0,"rootdevicetype":"ROOT","securitygroup":[],"nic":[{"id":"40cd6225-9475-44a3-8288-d7a9a485d8ac","networkid":"18c20437-df18-4757-8435-1230248f955b","networkname":"PLAYGROUND_200BE","netmask":"255.255.255.0","gateway":"10.24.16.1","ipaddress":"10.24.16.241","isolationuri":"vlan://19","broadcasturi":"vlan://19","traffictype":"Guest","type":"Shared","isdefault":true,"macaddress":"06:54:7e:00:46:c6"}],"hypervisor":"XenServer","tags":[],"affinitygroup":[],"displayvm":true,"isdynamicallyscalable":true,"jobid":"82a574cc-43f2-440d-8774-e638065c37af","jobstatus":0} ] } }`
 			fmt.Fprintln(w, json)
 		}
+		if cmd == "createTags" {
+			json := `{"createtagsresponse": {"Displaytext": "display", "Success": "success"}}`
+			fmt.Fprintln(w, json)
+		}
 	}))
 	defer fakeServer.Close()
 	config.Set("iaas:cloudstack:url", fakeServer.URL)
@@ -69,7 +73,7 @@ func (s *cloudstackSuite) TestCreateMachineWithoutProjectID(c *check.C) {
 	c.Assert(vm, check.NotNil)
 	c.Assert(vm.Address, check.Equals, "10.24.16.241")
 	c.Assert(vm.Id, check.Equals, "0366ae09-0a77-4e2b-8595-3b749764a107")
-	c.Assert(calls, check.DeepEquals, []string{"deployVirtualMachine", "queryAsyncJobResult", "listVirtualMachines"})
+	c.Assert(calls, check.DeepEquals, []string{"deployVirtualMachine", "queryAsyncJobResult", "listVirtualMachines", "createTags"})
 }
 
 func (s *cloudstackSuite) TestCreateMachine(c *check.C) {
@@ -88,6 +92,10 @@ func (s *cloudstackSuite) TestCreateMachine(c *check.C) {
 			json := `{ "listvirtualmachinesresponse" : { "count":1 ,"virtualmachine" : [  {"id":"0366ae09-0a77-4e2b-8595-3b749764a107","name":"vm-0366ae09-0a77-4e2b-8595-3b749764a107","projectid":"a98738c9-5acd-43e3-b1a1-972a3db5b196","project":"tsuru playground","domainid":"eec2dacf-9982-11e3-a2b8-eee0bc1594e0","domain":"ROOT","created":"2014-07-18T18:29:30-0300","state":"Stopped","haenable":false,"zoneid":"95046c6c-65b8-415f-99cb-0cff40dc5f9c","zonename":"RJOEBT0200BE","templateid":"99f66d4c-f923-46e5-aa7b-09a0b22ee747","templatename":"ubuntu-14.04-server-amd64","templatedisplaytext":"ubuntu 14.04 ( 3.13.0-24-generic )","passwordenabled":false,"serviceofferingid":"3ff651c8-a27f-4008-87d5-71636aaabbc6","serviceofferingname":"Medium","cpunumber":2,"cpuspeed":1800,"memory":8192,"guestosid":"eede1fdf-9982-11e3-a2b8-eee0bc1594e0","rootdeviceid":0,"rootdevicetype":"ROOT","securitygroup":[],"nic":[{"id":"40cd6225-9475-44a3-8288-d7a9a485d8ac","networkid":"18c20437-df18-4757-8435-1230248f955b","networkname":"PLAYGROUND_200BE","netmask":"255.255.255.0","gateway":"10.24.16.1","ipaddress":"10.24.16.241","isolationuri":"vlan://19","broadcasturi":"vlan://19","traffictype":"Guest","type":"Shared","isdefault":true,"macaddress":"06:54:7e:00:46:c6"}],"hypervisor":"XenServer","tags":[],"affinitygroup":[],"displayvm":true,"isdynamicallyscalable":true,"jobid":"82a574cc-43f2-440d-8774-e638065c37af","jobstatus":0} ] } }`
 			fmt.Fprintln(w, json)
 		}
+		if cmd == "createTags" {
+			json := `{"createtagsresponse": {"Displaytext": "display", "Success": "success"}}`
+			fmt.Fprintln(w, json)
+		}
 	}))
 	defer fakeServer.Close()
 	config.Set("iaas:cloudstack:url", fakeServer.URL)
@@ -106,7 +114,7 @@ func (s *cloudstackSuite) TestCreateMachine(c *check.C) {
 	c.Assert(vm, check.NotNil)
 	c.Assert(vm.Address, check.Equals, "10.24.16.241")
 	c.Assert(vm.Id, check.Equals, "0366ae09-0a77-4e2b-8595-3b749764a107")
-	c.Assert(calls, check.DeepEquals, []string{"deployVirtualMachine", "queryAsyncJobResult", "listVirtualMachines"})
+	c.Assert(calls, check.DeepEquals, []string{"deployVirtualMachine", "queryAsyncJobResult", "listVirtualMachines", "createTags"})
 }
 
 func (s *cloudstackSuite) TestCreateMachineAsyncFailure(c *check.C) {
@@ -172,6 +180,7 @@ func (s *cloudstackSuite) TestBuildUrlToCloudstack(c *check.C) {
 
 func (s *cloudstackSuite) TestCreateMachineWithTags(c *check.C) {
 	var calls []string
+	var tagParams url.Values
 	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cmd := r.URL.Query().Get("command")
 		calls = append(calls, cmd)
@@ -187,6 +196,7 @@ func (s *cloudstackSuite) TestCreateMachineWithTags(c *check.C) {
 			fmt.Fprintln(w, json)
 		}
 		if cmd == "createTags" {
+			tagParams = r.URL.Query()
 			json := `{"createtagsresponse": {"Displaytext": "display", "Success": "success"}}`
 			fmt.Fprintln(w, json)
 		}
@@ -210,6 +220,12 @@ func (s *cloudstackSuite) TestCreateMachineWithTags(c *check.C) {
 	c.Assert(vm.Address, check.Equals, "10.24.16.241")
 	c.Assert(vm.Id, check.Equals, "0366ae09-0a77-4e2b-8595-3b749764a107")
 	c.Assert(calls, check.DeepEquals, []string{"deployVirtualMachine", "queryAsyncJobResult", "listVirtualMachines", "createTags"})
+	c.Assert(tagParams.Get("tags[1].key"), check.Equals, "name1")
+	c.Assert(tagParams.Get("tags[1].value"), check.Equals, "value1")
+	c.Assert(tagParams.Get("tags[2].key"), check.Equals, "name2")
+	c.Assert(tagParams.Get("tags[2].value"), check.Equals, "value2")
+	c.Assert(tagParams.Get("tags[3].key"), check.Equals, "tsuru-iaas")
+	c.Assert(tagParams.Get("tags[3].value"), check.Equals, "cloudstack")
 }
 
 func (s *cloudstackSuite) TestDeleteMachineWithoutProjectID(c *check.C) {
@@ -426,6 +442,10 @@ func (s *cloudstackSuite) TestCreateMachineTimeout(c *check.C) {
 		if cmd == "deleteVolume" {
 			done <- true
 		}
+		if cmd == "createTags" {
+			json := `{"createtagsresponse": {"Displaytext": "display", "Success": "success"}}`
+			fmt.Fprintln(w, json)
+		}
 	}))
 	defer fakeServer.Close()
 	config.Set("iaas:cloudstack:url", fakeServer.URL)
@@ -456,6 +476,7 @@ func (s *cloudstackSuite) TestCreateMachineTimeout(c *check.C) {
 		"queryAsyncJobResult",
 		"queryAsyncJobResult",
 		"listVirtualMachines",
+		"createTags",
 		"listVolumes",
 		"destroyVirtualMachine",
 		"queryAsyncJobResult",
@@ -464,3 +485,30 @@ func (s *cloudstackSuite) TestCreateMachineTimeout(c *check.C) {
 		"deleteVolume",
 	})
 }
+
+func (s *cloudstackSuite) TestListMachines(c *check.C) {
+	var params url.Values
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = r.URL.Query()
+		w.Header().Set("Content-type", "application/json")
+		fmt.Fprintln(w, `{"listvirtualmachinesresponse": {"count": 2, "virtualmachine": [
+			{"id": "vm-1", "state": "Running", "nic": [{"ipaddress": "10.24.16.241"}]},
+			{"id": "vm-2", "state": "Expunging", "nic": [{"ipaddress": "10.24.16.242"}]}
+		]}}`)
+	}))
+	defer fakeServer.Close()
+	config.Set("iaas:cloudstack:url", fakeServer.URL)
+	config.Set("iaas:cloudstack:projectid", "project-x")
+	defer config.Unset("iaas:cloudstack:projectid")
+	cs := newCloudstackIaaS("cloudstack").(*CloudstackIaaS)
+	machines, err := cs.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.DeepEquals, []iaas.Machine{
+		{Id: "vm-1", Status: "Running", Address: "10.24.16.241"},
+	})
+	c.Assert(params.Get("command"), check.Equals, "listVirtualMachines")
+	c.Assert(params.Get("listall"), check.Equals, "true")
+	c.Assert(params.Get("projectid"), check.Equals, "project-x")
+	c.Assert(params.Get("tags[0].key"), check.Equals, "tsuru-iaas")
+	c.Assert(params.Get("tags[0].value"), check.Equals, "cloudstack")
+}
@@ -20,7 +20,9 @@ type ListVirtualMachinesResponse struct {
 }
 
 type VirtualMachine struct {
-	Nic []NicStruct `json:"nic"`
+	ID    string      `json:"id"`
+	State string      `json:"state"`
+	Nic   []NicStruct `json:"nic"`
 }
 
 type NicStruct struct {
@@ -5,6 +5,7 @@
 package digitalocean
 
 import (
+	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
@@ -21,6 +22,22 @@ func init() {
 	iaas.RegisterIaasProvider("digitalocean", newDigitalOceanIaas)
 }
 
+// dropletCreateRequest adds tags to the droplet creation request, as they're
+// not supported by the godo client in use.
+type dropletCreateRequest struct {
+	*godo.DropletCreateRequest
+	Tags []string `json:"tags,omitempty"`
+}
+
+type dropletRoot struct {
+	Droplet *godo.Droplet `json:"droplet"`
+}
+
+type dropletsRoot struct {
+	Droplets []godo.Droplet `json:"droplets"`
+	Links    *godo.Links    `json:"links"`
+}
+
 type digitalOceanIaas struct {
 	base   iaas.UserDataIaaS
 	client *godo.Client
@@ -52,6 +69,11 @@ func (i *digitalOceanIaas) Auth() error {
 	return nil
 }
 
+// iaasTag returns the tag set on every droplet created by this IaaS.
+func (i *digitalOceanIaas) iaasTag() string {
+	return "tsuru-iaas:" + i.base.IaaSName
+}
+
 func (i *digitalOceanIaas) CreateMachine(params map[string]string) (*iaas.Machine, error) {
 	i.Auth()
 	image := godo.DropletCreateImage{Slug: params["image"]}
@@ -79,11 +101,19 @@ func (i *digitalOceanIaas) CreateMachine(params map[string]string) (*iaas.Machin
 		SSHKeys:           sshKeys,
 		UserData:          userData,
 	}
-	droplet, _, err := i.client.Droplets.Create(createRequest)
+	req, err := i.client.NewRequest("POST", "v2/droplets", dropletCreateRequest{
+		DropletCreateRequest: createRequest,
+		Tags:                 []string{i.iaasTag()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	root := new(dropletRoot)
+	_, err = i.client.Do(req, root)
 	if err != nil {
 		return nil, err
 	}
-	droplet, err = i.waitNetworkCreated(droplet)
+	droplet, err := i.waitNetworkCreated(root.Droplet)
 	if err != nil {
 		return nil, err
 	}
@@ -162,6 +192,46 @@ func (i *digitalOceanIaas) DeleteMachine(m *iaas.Machine) error {
 	return nil
 }
 
+// ListMachines returns the droplets created by this IaaS, identified by the
+// tsuru-iaas tag.
+func (i *digitalOceanIaas) ListMachines() ([]iaas.Machine, error) {
+	err := i.Auth()
+	if err != nil {
+		return nil, err
+	}
+	var machines []iaas.Machine
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("v2/droplets?tag_name=%s&page=%d", url.QueryEscape(i.iaasTag()), page)
+		req, err := i.client.NewRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+		root := new(dropletsRoot)
+		_, err = i.client.Do(req, root)
+		if err != nil {
+			return nil, err
+		}
+		for _, droplet := range root.Droplets {
+			m := iaas.Machine{
+				Id:     strconv.Itoa(droplet.ID),
+				Status: droplet.Status,
+			}
+			if droplet.Networks != nil && len(droplet.Networks.V4) > 0 {
+				m.Address = droplet.Networks.V4[0].IPAddress
+			}
+			machines = append(machines, m)
+		}
+		if root.Links == nil || root.Links.IsLastPage() {
+			break
+		}
+	}
+	return machines, nil
+}
+
+func (i *digitalOceanIaas) InstanceType(params map[string]string) string {
+	return params["size"]
+}
+
 func (i *digitalOceanIaas) Describe() string {
 	return `DigitalOcean IaaS required params:
   name=<name>                Name of the droplet
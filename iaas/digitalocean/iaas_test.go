@@ -57,6 +57,7 @@ func (s *digitaloceanSuite) TestCreateMachine(c *check.C) {
 	expectedKeys := []interface{}{float64(5050), float64(2032), "07:b9:a1:65:1b", float64(13)}
 	c.Assert(createRequest["ssh_keys"], check.DeepEquals, expectedKeys)
 	c.Assert(createRequest["private_networking"], check.Equals, false)
+	c.Assert(createRequest["tags"], check.DeepEquals, []interface{}{"tsuru-iaas:digitalocean"})
 }
 
 func (s *digitaloceanSuite) TestCreateMachinePrivateNetworking(c *check.C) {
@@ -149,3 +150,30 @@ func (s *digitaloceanSuite) TestDeleteMachineFailure(c *check.C) {
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "failed to delete machine")
 }
+
+func (s *digitaloceanSuite) TestListMachines(c *check.C) {
+	var fakeURL string
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/droplets" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		c.Check(r.URL.Query().Get("tag_name"), check.Equals, "tsuru-iaas:digitalocean")
+		w.Header().Set("Content-type", "application/json")
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprintf(w, `{"droplets": [{"id": 2, "status": "off", "networks": {"v4": []}}], "links": {"pages": {"prev": "%[1]s/v2/droplets?page=1", "first": "%[1]s/v2/droplets?page=1"}}}`, fakeURL)
+			return
+		}
+		fmt.Fprintf(w, `{"droplets": [{"id": 1, "status": "active", "networks": {"v4": [{"ip_address": "104.131.186.241", "type": "public"}]}}], "links": {"pages": {"next": "%[1]s/v2/droplets?page=2", "last": "%[1]s/v2/droplets?page=2"}}}`, fakeURL)
+	}))
+	defer fakeServer.Close()
+	fakeURL = fakeServer.URL
+	config.Set("iaas:digitalocean:url", fakeServer.URL)
+	do := newDigitalOceanIaas("digitalocean").(*digitalOceanIaas)
+	machines, err := do.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.DeepEquals, []iaas.Machine{
+		{Id: "1", Status: "active", Address: "104.131.186.241"},
+		{Id: "2", Status: "off"},
+	})
+}
@@ -15,6 +15,7 @@ type FakeDockerMachine struct {
 	createdMachine *Machine
 	config         *DockerMachineConfig
 	hostOpts       *CreateMachineOpts
+	machines       []*Machine
 	closed         bool
 }
 
@@ -61,5 +62,5 @@ func (f *FakeDockerMachine) RegisterMachine(opts RegisterMachineOpts) (*Machine,
 }
 
 func (f *FakeDockerMachine) List() ([]*Machine, error) {
-	return nil, nil
+	return f.machines, nil
 }
@@ -21,7 +21,10 @@ import (
 	"github.com/tsuru/tsuru/log"
 )
 
-var errDriverNotSet = errors.Errorf("driver is mandatory")
+var (
+	errDriverNotSet    = errors.Errorf("driver is mandatory")
+	errStorePathNotSet = errors.Errorf("store-path must be configured to list machines")
+)
 
 func init() {
 	iaas.RegisterIaasProvider("dockermachine", newDockerMachineIaaS)
@@ -106,8 +109,10 @@ func (i *dockerMachineIaaS) CreateMachine(params map[string]string) (*iaas.Machi
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to parse debug config")
 	}
+	storePath, _ := i.base.GetConfigString("store-path")
 	dockerMachine, err := i.apiFactory(DockerMachineConfig{
 		CaPath:    caPath,
+		StorePath: storePath,
 		OutWriter: buf,
 		ErrWriter: buf,
 		IsDebug:   isDebug,
@@ -167,7 +172,9 @@ func (i *dockerMachineIaaS) DeleteMachine(m *iaas.Machine) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to parse debug config")
 	}
+	storePath, _ := i.base.GetConfigString("store-path")
 	dockerMachine, err := i.apiFactory(DockerMachineConfig{
+		StorePath: storePath,
 		OutWriter: buf,
 		ErrWriter: buf,
 		IsDebug:   isDebug,
@@ -182,6 +189,38 @@ func (i *dockerMachineIaaS) DeleteMachine(m *iaas.Machine) error {
 	return dockerMachine.DeleteMachine(m)
 }
 
+// ListMachines returns the machines saved in the docker machine store. It
+// requires the "store-path" config, otherwise machines are created in
+// temporary stores and can't be listed afterwards.
+func (i *dockerMachineIaaS) ListMachines() ([]iaas.Machine, error) {
+	storePath, _ := i.base.GetConfigString("store-path")
+	if storePath == "" {
+		return nil, errStorePathNotSet
+	}
+	buf := &bytes.Buffer{}
+	dockerMachine, err := i.apiFactory(DockerMachineConfig{
+		StorePath: storePath,
+		OutWriter: buf,
+		ErrWriter: buf,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		dockerMachine.Close()
+		log.Debug(buf.String())
+	}()
+	dmMachines, err := dockerMachine.List()
+	if err != nil {
+		return nil, err
+	}
+	machines := make([]iaas.Machine, 0, len(dmMachines))
+	for _, m := range dmMachines {
+		machines = append(machines, *m.Base)
+	}
+	return machines, nil
+}
+
 func generateMachineName(prefix string) (string, error) {
 	r := strings.NewReplacer("_", "-", " ", "-")
 	prefix = r.Replace(prefix)
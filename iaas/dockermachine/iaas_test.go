@@ -187,3 +187,26 @@ func (s *S) TestGenerateMachineName(c *check.C) {
 		c.Assert(len(name), check.Equals, t.expectedLength)
 	}
 }
+
+func (s *S) TestListMachinesIaaS(c *check.C) {
+	config.Set("iaas:dockermachine:store-path", "/var/lib/tsuru/machines")
+	defer config.Unset("iaas:dockermachine:store-path")
+	i := newDockerMachineIaaS("dockermachine")
+	dmIaas := i.(*dockerMachineIaaS)
+	dmIaas.apiFactory = NewFakeDockerMachine
+	FakeDM.machines = []*Machine{{Base: &iaas.Machine{Id: "m1", Address: "10.0.0.1"}}}
+	defer func() { FakeDM.machines = nil }()
+	machines, err := dmIaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.DeepEquals, []iaas.Machine{{Id: "m1", Address: "10.0.0.1"}})
+	c.Assert(FakeDM.config.StorePath, check.Equals, "/var/lib/tsuru/machines")
+	c.Assert(FakeDM.closed, check.Equals, true)
+}
+
+func (s *S) TestListMachinesIaaSWithoutStorePath(c *check.C) {
+	i := newDockerMachineIaaS("dockermachine")
+	dmIaas := i.(*dockerMachineIaaS)
+	dmIaas.apiFactory = NewFakeDockerMachine
+	_, err := dmIaas.ListMachines()
+	c.Assert(err, check.Equals, errStorePathNotSet)
+}
@@ -25,7 +25,13 @@ import (
 	"github.com/tsuru/tsuru/queue"
 )
 
-const defaultRegion = "us-east-1"
+const (
+	defaultRegion = "us-east-1"
+
+	// iaasTagKey is the tag set on every instance created by tsuru, holding
+	// the name of the IaaS that created it.
+	iaasTagKey = "tsuru-iaas"
+)
 
 func init() {
 	iaas.RegisterIaasProvider("ec2", newEC2IaaS)
@@ -109,6 +115,18 @@ func (i *EC2IaaS) Initialize() error {
 	return q.RegisterTask(&ec2WaitTask{iaas: i})
 }
 
+// InstanceType returns the instance type informed in params, which, like
+// other ec2 params, may be informed in any case or by its alias.
+func (i *EC2IaaS) InstanceType(params map[string]string) string {
+	for key, value := range params {
+		lowerKey := strings.ToLower(key)
+		if lowerKey == "type" || lowerKey == "instancetype" {
+			return value
+		}
+	}
+	return ""
+}
+
 func (i *EC2IaaS) Describe() string {
 	return `EC2 IaaS required params:
   image=<image id>         Image AMI ID
@@ -135,6 +153,20 @@ func (i *EC2IaaS) DeleteMachine(m *iaas.Machine) error {
 	return err
 }
 
+func (i *EC2IaaS) RebootMachine(m *iaas.Machine) error {
+	regionOrEndpoint := getRegionOrEndpoint(m.CreationParams, false)
+	if regionOrEndpoint == "" {
+		return errors.Errorf("region or endpoint creation param required")
+	}
+	ec2Inst, err := i.createEC2Handler(regionOrEndpoint)
+	if err != nil {
+		return err
+	}
+	input := ec2.RebootInstancesInput{InstanceIds: []*string{&m.Id}}
+	_, err = ec2Inst.RebootInstances(&input)
+	return err
+}
+
 type invalidFieldError struct {
 	fieldName    string
 	convertError error
@@ -310,11 +342,12 @@ func (i *EC2IaaS) CreateMachine(params map[string]string) (*iaas.Machine, error)
 		return nil, errors.Errorf("no instance created")
 	}
 	runInst := resp.Instances[0]
+	ec2Tags := []*ec2.Tag{{
+		Key:   aws.String(iaasTagKey),
+		Value: aws.String(i.base.IaaSName),
+	}}
 	if tags, ok := params["tags"]; ok {
-		var ec2Tags []*ec2.Tag
-		tagList := strings.Split(tags, ",")
-		ec2Tags = make([]*ec2.Tag, 0, len(tagList))
-		for _, tag := range tagList {
+		for _, tag := range strings.Split(tags, ",") {
 			if strings.Contains(tag, ":") {
 				parts := strings.SplitN(tag, ":", 2)
 				ec2Tags = append(ec2Tags, &ec2.Tag{
@@ -323,16 +356,14 @@ func (i *EC2IaaS) CreateMachine(params map[string]string) (*iaas.Machine, error)
 				})
 			}
 		}
-		if len(ec2Tags) > 0 {
-			input := ec2.CreateTagsInput{
-				Resources: []*string{runInst.InstanceId},
-				Tags:      ec2Tags,
-			}
-			_, err = ec2Inst.CreateTags(&input)
-			if err != nil {
-				log.Errorf("failed to tag EC2 instance: %s", err)
-			}
-		}
+	}
+	input := ec2.CreateTagsInput{
+		Resources: []*string{runInst.InstanceId},
+		Tags:      ec2Tags,
+	}
+	_, err = ec2Inst.CreateTags(&input)
+	if err != nil {
+		log.Errorf("failed to tag EC2 instance: %s", err)
 	}
 	dnsName, err := i.waitForDnsName(ec2Inst, aws.StringValue(runInst.InstanceId), params)
 	if err != nil {
@@ -346,6 +377,69 @@ func (i *EC2IaaS) CreateMachine(params map[string]string) (*iaas.Machine, error)
 	return &machine, nil
 }
 
+// ListMachines returns the instances not yet terminated created by this IaaS,
+// identified by the tsuru-iaas tag, in the regions (or endpoints) set in the
+// "regions" config, defaulting to us-east-1. When "audit-tag" is set as
+// key:value, instances with that tag are listed as well.
+func (i *EC2IaaS) ListMachines() ([]iaas.Machine, error) {
+	regions := []string{defaultRegion}
+	if rawRegions, _ := i.base.GetConfigString("regions"); rawRegions != "" {
+		regions = strings.Split(rawRegions, ",")
+	}
+	var tagKey, tagValue string
+	if auditTag, _ := i.base.GetConfigString("audit-tag"); auditTag != "" {
+		parts := strings.SplitN(auditTag, ":", 2)
+		tagKey = parts[0]
+		if len(parts) > 1 {
+			tagValue = parts[1]
+		}
+	}
+	var machines []iaas.Machine
+	for _, region := range regions {
+		ec2Inst, err := i.createEC2Handler(strings.TrimSpace(region))
+		if err != nil {
+			return nil, err
+		}
+		err = ec2Inst.DescribeInstancesPages(&ec2.DescribeInstancesInput{}, func(resp *ec2.DescribeInstancesOutput, lastPage bool) bool {
+			for _, reservation := range resp.Reservations {
+				for _, instance := range reservation.Instances {
+					state := aws.StringValue(instance.State.Name)
+					if state == ec2.InstanceStateNameTerminated || state == ec2.InstanceStateNameShuttingDown {
+						continue
+					}
+					if !hasTag(instance.Tags, iaasTagKey, i.base.IaaSName) &&
+						(tagKey == "" || !hasTag(instance.Tags, tagKey, tagValue)) {
+						continue
+					}
+					address := aws.StringValue(instance.PublicDnsName)
+					if address == "" {
+						address = aws.StringValue(instance.PrivateDnsName)
+					}
+					machines = append(machines, iaas.Machine{
+						Id:      aws.StringValue(instance.InstanceId),
+						Status:  state,
+						Address: address,
+					})
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list instances in %s", region)
+		}
+	}
+	return machines, nil
+}
+
+func hasTag(tags []*ec2.Tag, key, value string) bool {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key && aws.StringValue(tag.Value) == value {
+			return true
+		}
+	}
+	return false
+}
+
 func getRegionOrEndpoint(params map[string]string, useDefault bool) string {
 	regionOrEndpoint := params["endpoint"]
 	if regionOrEndpoint == "" {
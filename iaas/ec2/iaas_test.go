@@ -329,3 +329,72 @@ func (s *S) TestDeleteMachineValidations(c *check.C) {
 	err = ec2iaas.DeleteMachine(m)
 	c.Assert(err, check.ErrorMatches, `region or endpoint creation param required`)
 }
+
+func (s *S) TestRebootMachineValidations(c *check.C) {
+	ec2iaas := newEC2IaaS("ec2")
+	err := (ec2iaas.(*EC2IaaS)).Initialize()
+	c.Assert(err, check.IsNil)
+	m := &iaas.Machine{Id: "i-0", CreationParams: map[string]string{}}
+	err = ec2iaas.(iaas.Rebooter).RebootMachine(m)
+	c.Assert(err, check.ErrorMatches, `region or endpoint creation param required`)
+}
+
+func (s *S) describeInstancesServer(c *check.C) *httptest.Server {
+	instance := func(id, state, tagKey, tagValue string) string {
+		return `<item>
+  <instanceId>` + id + `</instanceId>
+  <instanceState><code>16</code><name>` + state + `</name></instanceState>
+  <privateDnsName>` + id + `.internal</privateDnsName>
+  <tagSet><item><key>` + tagKey + `</key><value>` + tagValue + `</value></item></tagSet>
+</item>`
+	}
+	pages := map[string]string{
+		"": `<nextToken>page2</nextToken>` +
+			`<reservationSet><item><reservationId>r-1</reservationId><instancesSet>` +
+			instance("i-1", "running", "tsuru-iaas", "ec2") +
+			instance("i-2", "running", "Name", "other") +
+			instance("i-3", "shutting-down", "tsuru-iaas", "ec2") +
+			`</instancesSet></item></reservationSet>`,
+		"page2": `<reservationSet><item><reservationId>r-2</reservationId><instancesSet>` +
+			instance("i-4", "stopped", "tsuru-iaas", "ec2") +
+			instance("i-5", "running", "tsuru-iaas", "other-ec2") +
+			instance("i-6", "running", "managed-by", "tsuru") +
+			`</instancesSet></item></reservationSet>`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.FormValue("Action"), check.Equals, "DescribeInstances")
+		w.Write([]byte(`<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2015-10-01/">
+<requestId>xxx</requestId>` + pages[r.FormValue("NextToken")] + `</DescribeInstancesResponse>`))
+	}))
+}
+
+func (s *S) TestListMachines(c *check.C) {
+	server := s.describeInstancesServer(c)
+	defer server.Close()
+	config.Set("iaas:ec2:regions", server.URL)
+	defer config.Unset("iaas:ec2:regions")
+	ec2iaas := newEC2IaaS("ec2").(*EC2IaaS)
+	machines, err := ec2iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.DeepEquals, []iaas.Machine{
+		{Id: "i-1", Status: "running", Address: "i-1.internal"},
+		{Id: "i-4", Status: "stopped", Address: "i-4.internal"},
+	})
+}
+
+func (s *S) TestListMachinesWithAuditTag(c *check.C) {
+	server := s.describeInstancesServer(c)
+	defer server.Close()
+	config.Set("iaas:ec2:regions", server.URL)
+	config.Set("iaas:ec2:audit-tag", "managed-by:tsuru")
+	defer config.Unset("iaas:ec2:regions")
+	defer config.Unset("iaas:ec2:audit-tag")
+	ec2iaas := newEC2IaaS("ec2").(*EC2IaaS)
+	machines, err := ec2iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.DeepEquals, []iaas.Machine{
+		{Id: "i-1", Status: "running", Address: "i-1.internal"},
+		{Id: "i-4", Status: "stopped", Address: "i-4.internal"},
+		{Id: "i-6", Status: "running", Address: "i-6.internal"},
+	})
+}
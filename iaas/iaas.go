@@ -21,7 +21,10 @@ const defaultUserData = `#!/bin/bash
 curl -sL https://raw.github.com/tsuru/now/master/run.bash | bash -s -- --docker-only
 `
 
-var ErrNoDefaultIaaS = errors.New("no default iaas configured")
+var (
+	ErrNoDefaultIaaS      = errors.New("no default iaas configured")
+	ErrRebootNotSupported = errors.New("iaas doesn't support rebooting machines")
+)
 
 // Every Tsuru IaaS must implement this interface.
 type IaaS interface {
@@ -36,6 +39,25 @@ type Describer interface {
 	Describe() string
 }
 
+// InstanceTyper is implemented by IaaSs able to tell the instance type
+// (size, flavor, offering, etc.) of a machine from its creation params, used
+// to account the cost of machines.
+type InstanceTyper interface {
+	InstanceType(params map[string]string) string
+}
+
+// ParamsValidator is implemented by IaaSs able to tell whether a set of
+// params is acceptable before any machine is created with them.
+type ParamsValidator interface {
+	ValidateParams(params map[string]string) error
+}
+
+// Rebooter is implemented by IaaSs able to reboot a machine in place,
+// keeping its address.
+type Rebooter interface {
+	RebootMachine(m *Machine) error
+}
+
 type HealthChecker interface {
 	HealthCheck() error
 }
@@ -117,10 +139,7 @@ func getIaasProvider(name string) (IaaS, error) {
 	defer iaasLock.Unlock()
 	instance, ok := iaasInstances[name]
 	if !ok {
-		providerName, err := config.GetString(fmt.Sprintf("iaas:custom:%s:provider", name))
-		if err != nil {
-			providerName = name
-		}
+		providerName := providerName(name)
 		providerFactory, ok := iaasProviders[providerName]
 		if !ok {
 			return nil, errors.Errorf("IaaS provider %q based on %q not registered", name, providerName)
@@ -161,30 +180,15 @@ func getDefaultIaasName() (string, error) {
 	if err == nil {
 		return defaultIaaS, nil
 	}
-	ec2ProviderName := "ec2"
-	ec2Configured := false
-	var configuredIaases []string
-	for provider := range iaasProviders {
-		if _, err = config.Get(fmt.Sprintf("iaas:%s", provider)); err == nil {
-			configuredIaases = append(configuredIaases, provider)
-			if provider == ec2ProviderName {
-				ec2Configured = true
-			}
-		}
-	}
-	c, err := config.Get("iaas:custom")
-	if err == nil {
-		if v, ok := c.(map[interface{}]interface{}); ok {
-			for provider := range v {
-				configuredIaases = append(configuredIaases, provider.(string))
-			}
-		}
-	}
+	configuredIaases := configuredIaaSNames()
 	if len(configuredIaases) == 1 {
 		return configuredIaases[0], nil
 	}
-	if ec2Configured {
-		return ec2ProviderName, nil
+	ec2ProviderName := "ec2"
+	if _, ok := iaasProviders[ec2ProviderName]; ok {
+		if _, err = config.Get(fmt.Sprintf("iaas:%s", ec2ProviderName)); err == nil {
+			return ec2ProviderName, nil
+		}
 	}
 	return "", ErrNoDefaultIaaS
 }
@@ -8,6 +8,8 @@ package iaas
 
 import (
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -53,10 +55,22 @@ func init() {
 	prometheus.MustRegister(machineDestroyErrors)
 }
 
+const (
+	// pendingMachinePrefix prefixes the id of the records stored before the
+	// machine is created in the IaaS, as the IaaS id is only known
+	// afterwards.
+	pendingMachinePrefix = "pending-"
+
+	machineLockUpdateInterval = 30 * time.Second
+	machineLockExpireTimeout  = 5 * time.Minute
+)
+
 type Machine struct {
 	Id             string `bson:"_id"`
 	Iaas           string
 	Status         string
+	State          MachineState `bson:",omitempty"`
+	Error          string       `bson:",omitempty" json:",omitempty"`
 	Address        string
 	Port           int
 	Protocol       string
@@ -65,6 +79,32 @@ type Machine struct {
 	CaCert         []byte                 `json:"-"`
 	ClientCert     []byte                 `json:"-"`
 	ClientKey      []byte                 `json:"-"`
+	// RequestID identifies the operation that requested the machine, e.g.
+	// an event, so it can be finished when the creation is interrupted.
+	RequestID string `bson:",omitempty" json:",omitempty"`
+	// LockUpdateTime is periodically updated by the process creating a
+	// pending machine, and by the process still using a machine created
+	// with CreateMachineOptions.KeepLocked.
+	LockUpdateTime time.Time `bson:",omitempty" json:"-"`
+
+	stopLock func()
+}
+
+// CreateMachineOptions holds the options used to create a machine.
+type CreateMachineOptions struct {
+	// IaaS is the name of the IaaS where the machine is created. When empty,
+	// the "iaas" param is used, falling back to the default IaaS.
+	IaaS   string
+	Params map[string]string
+	// Writer, when set, receives the state transitions of the machine.
+	Writer io.Writer
+	// RequestID, when set, is stored in the machine record.
+	RequestID string
+	// KeepLocked keeps the lock of the created machine updated until Unlock
+	// is called, so FailInterruptedCreations also reports machines whose
+	// caller was interrupted after the creation, e.g. while registering
+	// them as nodes.
+	KeepLocked bool
 }
 
 func CreateMachine(params map[string]string) (*Machine, error) {
@@ -72,6 +112,22 @@ func CreateMachine(params map[string]string) (*Machine, error) {
 }
 
 func CreateMachineForIaaS(iaasName string, params map[string]string) (*Machine, error) {
+	return CreateMachineWithOptions(CreateMachineOptions{IaaS: iaasName, Params: params})
+}
+
+// CreateMachineWithOptions creates a machine in the IaaS and stores it. Each
+// creation attempt may be limited by the "iaas:create-timeout" setting and
+// failed attempts are retried up to "iaas:create-retries" times. Machines
+// created by attempts that already timed out are removed from the IaaS as
+// soon as the provider returns them.
+//
+// A pending record, holding the state of the creation, is stored before
+// calling the IaaS. It's replaced by the machine once it's running and kept
+// in the failed state when every attempt fails, so it can be listed and
+// destroyed.
+func CreateMachineWithOptions(opts CreateMachineOptions) (*Machine, error) {
+	iaasName := opts.IaaS
+	params := opts.Params
 	if iaasName == "" {
 		iaasName = params["iaas"]
 	}
@@ -87,24 +143,224 @@ func CreateMachineForIaaS(iaasName string, params map[string]string) (*Machine,
 	if err != nil {
 		return nil, err
 	}
-	t0 := time.Now()
-	m, err := iaas.CreateMachine(params)
-	machineCreateDuration.WithLabelValues(iaasName).Observe(time.Since(t0).Seconds())
+	retries, _ := config.GetInt("iaas:create-retries")
+	timeout, _ := config.GetInt("iaas:create-timeout")
+	originalParams := copyParams(params)
+	pendingID := pendingMachinePrefix + bson.NewObjectId().Hex()
+	requested := &Machine{
+		Id:    pendingID,
+		Iaas:  iaasName,
+		State: MachineStateRequested,
+		// addresses are unique, pending records use their id until the
+		// IaaS returns the actual address.
+		Address:        pendingID,
+		CreationParams: originalParams,
+		RequestID:      opts.RequestID,
+	}
+	err = requested.saveToDB()
 	if err != nil {
-		machineCreateErrors.WithLabelValues(iaasName).Inc()
 		return nil, err
 	}
+	stopLock := requested.keepLocked()
+	defer stopLock()
+	var m *Machine
+	for attempt := 0; ; attempt++ {
+		err = requested.transition(MachineStateCreating, opts.Writer)
+		if err != nil {
+			return nil, err
+		}
+		attemptParams := copyParams(originalParams)
+		m, err = createMachineWithTimeout(iaas, iaasName, attemptParams, time.Duration(timeout)*time.Second)
+		if err == nil {
+			for k := range params {
+				delete(params, k)
+			}
+			for k, v := range attemptParams {
+				params[k] = v
+			}
+			break
+		}
+		requested.Error = err.Error()
+		requested.transition(MachineStateFailed, opts.Writer)
+		if attempt >= retries {
+			return nil, err
+		}
+	}
 	params["iaas-id"] = m.Id
 	m.Iaas = iaasName
 	m.CreationParams = params
-	err = m.saveToDB()
+	m.RequestID = opts.RequestID
+	m.State = MachineStateCreating
+	if opts.KeepLocked {
+		m.LockUpdateTime = time.Now().UTC()
+	}
+	err = m.transition(MachineStateRunning, opts.Writer)
+	if err == nil {
+		err = m.saveToDB()
+	}
 	if err != nil {
 		m.Destroy()
+		requested.Error = err.Error()
+		requested.transition(MachineStateFailed, opts.Writer)
 		return nil, err
 	}
+	if opts.KeepLocked {
+		m.stopLock = m.keepLocked()
+	}
+	m.recordCreation(iaas)
+	err = requested.removeFromDB()
+	if err != nil {
+		log.Errorf("unable to remove pending machine %s: %s", requested.Id, err)
+	}
 	return m, nil
 }
 
+// Pending returns whether the machine is a record stored before the machine
+// was created in the IaaS.
+func (m *Machine) Pending() bool {
+	return strings.HasPrefix(m.Id, pendingMachinePrefix)
+}
+
+// keepLocked periodically updates the lock of the machine, until the
+// returned function is called, so other processes can tell whether its
+// creation was interrupted.
+func (m *Machine) keepLocked() func() {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(machineLockUpdateInterval):
+			}
+			coll, err := collection()
+			if err != nil {
+				continue
+			}
+			err = coll.UpdateId(m.Id, bson.M{"$set": bson.M{"lockupdatetime": time.Now().UTC()}})
+			coll.Close()
+			if err != nil && err != mgo.ErrNotFound {
+				log.Errorf("unable to update lock of machine %s: %s", m.Id, err)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// Unlock stops updating the lock of a machine created with
+// CreateMachineOptions.KeepLocked and removes it.
+func (m *Machine) Unlock() error {
+	if m.stopLock != nil {
+		m.stopLock()
+		m.stopLock = nil
+	}
+	m.LockUpdateTime = time.Time{}
+	coll, err := collection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.UpdateId(m.Id, bson.M{"$unset": bson.M{"lockupdatetime": ""}})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// FailInterruptedCreations handles the machines whose lock wasn't updated
+// for a while, i.e. the process creating them, or still using them after
+// the creation, stopped. Pending machines are marked as failed, while
+// running ones only have their lock removed. Each machine is claimed
+// atomically, so it's returned by a single call, even across processes.
+// The returned machines hold the reason of the interruption in their Error.
+func FailInterruptedCreations() ([]Machine, error) {
+	coll, err := collection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var candidates []Machine
+	err = coll.Find(bson.M{
+		"state":          bson.M{"$in": []MachineState{MachineStateRequested, MachineStateCreating, MachineStateRunning}},
+		"lockupdatetime": bson.M{"$lt": time.Now().UTC().Add(-machineLockExpireTimeout)},
+	}).All(&candidates)
+	if err != nil {
+		return nil, err
+	}
+	var machines []Machine
+	for _, m := range candidates {
+		since := m.LockUpdateTime.Format(time.RFC3339)
+		update := bson.M{"$unset": bson.M{"lockupdatetime": ""}}
+		if m.Pending() {
+			m.State = MachineStateFailed
+			m.Error = fmt.Sprintf("creation interrupted, no update since %s", since)
+			update["$set"] = bson.M{"state": m.State, "error": m.Error}
+		} else {
+			m.Error = fmt.Sprintf("interrupted after creation, no update since %s", since)
+		}
+		err = coll.Update(bson.M{"_id": m.Id, "lockupdatetime": m.LockUpdateTime}, update)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.LockUpdateTime = time.Time{}
+		machines = append(machines, m)
+	}
+	return machines, nil
+}
+
+// createMachineWithTimeout calls the IaaS to create a machine, giving up
+// after the timeout, if greater than zero. The machine is deleted if the
+// IaaS returns it after the timeout.
+func createMachineWithTimeout(iaas IaaS, iaasName string, params map[string]string, timeout time.Duration) (*Machine, error) {
+	type result struct {
+		m   *Machine
+		err error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		t0 := time.Now()
+		m, err := iaas.CreateMachine(params)
+		machineCreateDuration.WithLabelValues(iaasName).Observe(time.Since(t0).Seconds())
+		if err != nil {
+			machineCreateErrors.WithLabelValues(iaasName).Inc()
+		}
+		resultCh <- result{m: m, err: err}
+	}()
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timeoutCh = time.After(timeout)
+	}
+	select {
+	case r := <-resultCh:
+		return r.m, r.err
+	case <-timeoutCh:
+		go func() {
+			r := <-resultCh
+			if r.err != nil || r.m == nil {
+				return
+			}
+			log.Errorf("machine %s created in iaas %s after timeout, removing it", r.m.Id, iaasName)
+			r.m.Iaas = iaasName
+			err := iaas.DeleteMachine(r.m)
+			if err != nil {
+				log.Errorf("failed to remove machine %s created after timeout: %s", r.m.Id, err)
+			}
+		}()
+		return nil, errors.Errorf("timeout after %v waiting for machine creation in iaas %s", timeout, iaasName)
+	}
+}
+
+func copyParams(params map[string]string) map[string]string {
+	result := make(map[string]string, len(params))
+	for k, v := range params {
+		result[k] = v
+	}
+	return result
+}
+
 func ListMachines() ([]Machine, error) {
 	coll, err := collection()
 	if err != nil {
@@ -157,11 +413,28 @@ func FindMachineById(id string) (Machine, error) {
 	return result, err
 }
 
+// Destroy removes the machine from the IaaS and from the database. Pending
+// machines only exist in the database and may only be destroyed after their
+// creation failed.
 func (m *Machine) Destroy() error {
 	iaas, err := getIaasProvider(m.Iaas)
 	if err != nil {
 		return err
 	}
+	if m.CurrentState() != MachineStateDeleting {
+		err = m.transition(MachineStateDeleting, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if m.Pending() {
+		err = m.removeFromDB()
+		if err != nil {
+			return err
+		}
+		m.State = MachineStateDeleted
+		return nil
+	}
 	t0 := time.Now()
 	err = iaas.DeleteMachine(m)
 	machineDestroyDuration.WithLabelValues(m.Iaas).Observe(time.Since(t0).Seconds())
@@ -169,7 +442,27 @@ func (m *Machine) Destroy() error {
 		machineDestroyErrors.WithLabelValues(m.Iaas).Inc()
 		log.Errorf("failed to destroy machine in the IaaS: %s", err)
 	}
-	return m.removeFromDB()
+	err = m.removeFromDB()
+	if err != nil {
+		return err
+	}
+	m.recordDestruction()
+	m.State = MachineStateDeleted
+	return nil
+}
+
+// Reboot reboots the machine through its IaaS, returning
+// ErrRebootNotSupported if the IaaS is not a Rebooter.
+func (m *Machine) Reboot() error {
+	iaas, err := getIaasProvider(m.Iaas)
+	if err != nil {
+		return err
+	}
+	rebooter, ok := iaas.(Rebooter)
+	if !ok {
+		return ErrRebootNotSupported
+	}
+	return rebooter.RebootMachine(m)
 }
 
 func (m *Machine) FormatNodeAddress() string {
@@ -191,6 +484,9 @@ func (m *Machine) FormatNodeAddress() string {
 }
 
 func (m *Machine) saveToDB() error {
+	if m.Pending() {
+		m.LockUpdateTime = time.Now().UTC()
+	}
 	coll, err := collectionEnsureIdx()
 	if err != nil {
 		return err
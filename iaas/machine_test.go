@@ -5,6 +5,9 @@
 package iaas
 
 import (
+	"bytes"
+	"time"
+
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
 	"gopkg.in/check.v1"
@@ -25,6 +28,7 @@ func (s *S) TestCreateMachineForIaaS(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(dbMachine.Id, check.Equals, "myid")
 	c.Assert(dbMachine.Iaas, check.Equals, "test-iaas")
+	c.Assert(dbMachine.State, check.Equals, MachineStateRunning)
 	c.Assert(dbMachine.CreationParams, check.DeepEquals, map[string]string{
 		"id":        "myid",
 		"something": "x",
@@ -154,11 +158,27 @@ func (s *S) TestDestroy(c *check.C) {
 	err = m.Destroy()
 	c.Assert(err, check.IsNil)
 	c.Assert(m.Status, check.Equals, "destroyed")
+	c.Assert(m.State, check.Equals, MachineStateDeleted)
 	machines, err := ListMachines()
 	c.Assert(err, check.IsNil)
 	c.Assert(machines, check.HasLen, 0)
 }
 
+func (s *S) TestReboot(c *check.C) {
+	rebooter := &TestRebooterIaaS{}
+	RegisterIaasProvider("rebooter-iaas", func(string) IaaS { return rebooter })
+	m := Machine{Id: "myid", Iaas: "rebooter-iaas"}
+	err := m.Reboot()
+	c.Assert(err, check.IsNil)
+	c.Assert(rebooter.rebooted, check.DeepEquals, []string{"myid"})
+}
+
+func (s *S) TestRebootNotSupported(c *check.C) {
+	m := Machine{Id: "myid", Iaas: "test-iaas"}
+	err := m.Reboot()
+	c.Assert(err, check.Equals, ErrRebootNotSupported)
+}
+
 func (s *S) TestFindById(c *check.C) {
 	_, err := CreateMachineForIaaS("test-iaas", map[string]string{"id": "myid1"})
 	c.Assert(err, check.IsNil)
@@ -194,3 +214,182 @@ func (s *S) TestFormatNodeAddress(c *check.C) {
 	addr = m.FormatNodeAddress()
 	c.Assert(addr, check.Equals, "http://myid.somewhere.com:9123")
 }
+
+func (s *S) TestCreateMachineWithOptionsRetries(c *check.C) {
+	flaky := &TestFlakyIaaS{failures: 1}
+	RegisterIaasProvider("flaky-iaas", func(string) IaaS { return flaky })
+	config.Set("iaas:create-retries", 1)
+	defer config.Unset("iaas:create-retries")
+	var buf bytes.Buffer
+	params := map[string]string{"id": "myid"}
+	m, err := CreateMachineWithOptions(CreateMachineOptions{IaaS: "flaky-iaas", Params: params, Writer: &buf})
+	c.Assert(err, check.IsNil)
+	c.Assert(m.State, check.Equals, MachineStateRunning)
+	c.Assert(flaky.cmds, check.DeepEquals, []string{"create-error", "create"})
+	c.Assert(params, check.DeepEquals, map[string]string{
+		"id":      "myid",
+		"iaas":    "flaky-iaas",
+		"should":  "be in",
+		"iaas-id": "myid",
+	})
+	c.Assert(buf.String(), check.Equals, `machine (pending) in iaas flaky-iaas: requested -> creating
+machine (pending) in iaas flaky-iaas: creating -> failed: create failed
+machine (pending) in iaas flaky-iaas: failed -> creating
+machine myid in iaas flaky-iaas: creating -> running
+`)
+	dbMachine, err := FindMachineById("myid")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbMachine.State, check.Equals, MachineStateRunning)
+}
+
+func (s *S) TestCreateMachineWithOptionsFailure(c *check.C) {
+	flaky := &TestFlakyIaaS{failures: 2}
+	RegisterIaasProvider("flaky-iaas", func(string) IaaS { return flaky })
+	config.Set("iaas:create-retries", 1)
+	defer config.Unset("iaas:create-retries")
+	var buf bytes.Buffer
+	_, err := CreateMachineWithOptions(CreateMachineOptions{IaaS: "flaky-iaas", Params: map[string]string{"id": "myid"}, Writer: &buf})
+	c.Assert(err, check.ErrorMatches, "create failed")
+	c.Assert(flaky.cmds, check.DeepEquals, []string{"create-error", "create-error"})
+	c.Assert(buf.String(), check.Matches, `(?s).*creating -> failed: create failed\n$`)
+	machines, err := ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+	c.Assert(machines[0].Pending(), check.Equals, true)
+	c.Assert(machines[0].Iaas, check.Equals, "flaky-iaas")
+	c.Assert(machines[0].State, check.Equals, MachineStateFailed)
+	c.Assert(machines[0].Error, check.Equals, "create failed")
+	c.Assert(machines[0].CreationParams, check.DeepEquals, map[string]string{"id": "myid", "iaas": "flaky-iaas"})
+	err = machines[0].Destroy()
+	c.Assert(err, check.IsNil)
+	c.Assert(flaky.cmds, check.DeepEquals, []string{"create-error", "create-error"})
+	machines, err = ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 0)
+}
+
+func (s *S) TestCreateMachineWithOptionsStoresPendingMachine(c *check.C) {
+	var states []MachineState
+	RegisterIaasProvider("checker-iaas", func(string) IaaS {
+		return &TestCheckerIaaS{check: func() {
+			machines, err := ListMachines()
+			c.Assert(err, check.IsNil)
+			c.Assert(machines, check.HasLen, 1)
+			c.Assert(machines[0].Pending(), check.Equals, true)
+			c.Assert(machines[0].RequestID, check.Equals, "req1")
+			states = append(states, machines[0].State)
+		}}
+	})
+	m, err := CreateMachineWithOptions(CreateMachineOptions{IaaS: "checker-iaas", Params: map[string]string{"id": "myid"}, RequestID: "req1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(states, check.DeepEquals, []MachineState{MachineStateCreating})
+	machines, err := ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+	c.Assert(machines[0].Id, check.Equals, m.Id)
+	c.Assert(machines[0].RequestID, check.Equals, "req1")
+}
+
+func (s *S) TestFailInterruptedCreations(c *check.C) {
+	coll, err := collection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	stale := time.Now().UTC().Add(-time.Hour)
+	for _, m := range []Machine{
+		{Id: "pending-1", Address: "pending-1", Iaas: "test-iaas", State: MachineStateCreating, LockUpdateTime: stale},
+		{Id: "pending-2", Address: "pending-2", Iaas: "test-iaas", State: MachineStateCreating, LockUpdateTime: time.Now().UTC()},
+		{Id: "pending-3", Address: "pending-3", Iaas: "test-iaas", State: MachineStateFailed, LockUpdateTime: stale},
+	} {
+		err = coll.Insert(m)
+		c.Assert(err, check.IsNil)
+	}
+	failed, err := FailInterruptedCreations()
+	c.Assert(err, check.IsNil)
+	c.Assert(failed, check.HasLen, 1)
+	c.Assert(failed[0].Id, check.Equals, "pending-1")
+	dbMachine, err := FindMachineById("pending-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbMachine.State, check.Equals, MachineStateFailed)
+	c.Assert(dbMachine.Error, check.Matches, "creation interrupted, no update since .*")
+	dbMachine, err = FindMachineById("pending-2")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbMachine.State, check.Equals, MachineStateCreating)
+	err = dbMachine.Destroy()
+	c.Assert(err, check.DeepEquals, &ErrInvalidStateTransition{From: MachineStateCreating, To: MachineStateDeleting})
+}
+
+func (s *S) TestFailInterruptedCreationsClaimsOnce(c *check.C) {
+	coll, err := collection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(Machine{Id: "pending-1", Address: "pending-1", Iaas: "test-iaas", State: MachineStateCreating, LockUpdateTime: time.Now().UTC().Add(-time.Hour)})
+	c.Assert(err, check.IsNil)
+	failed, err := FailInterruptedCreations()
+	c.Assert(err, check.IsNil)
+	c.Assert(failed, check.HasLen, 1)
+	failed, err = FailInterruptedCreations()
+	c.Assert(err, check.IsNil)
+	c.Assert(failed, check.HasLen, 0)
+}
+
+func (s *S) TestFailInterruptedCreationsRunningMachine(c *check.C) {
+	coll, err := collection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	stale := time.Now().UTC().Add(-time.Hour)
+	for _, m := range []Machine{
+		{Id: "m1", Address: "m1", Iaas: "test-iaas", State: MachineStateRunning, LockUpdateTime: stale},
+		{Id: "m2", Address: "m2", Iaas: "test-iaas", State: MachineStateRunning},
+	} {
+		err = coll.Insert(m)
+		c.Assert(err, check.IsNil)
+	}
+	interrupted, err := FailInterruptedCreations()
+	c.Assert(err, check.IsNil)
+	c.Assert(interrupted, check.HasLen, 1)
+	c.Assert(interrupted[0].Id, check.Equals, "m1")
+	c.Assert(interrupted[0].Error, check.Matches, "interrupted after creation, no update since .*")
+	dbMachine, err := FindMachineById("m1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbMachine.State, check.Equals, MachineStateRunning)
+	c.Assert(dbMachine.Error, check.Equals, "")
+	c.Assert(dbMachine.LockUpdateTime.IsZero(), check.Equals, true)
+}
+
+func (s *S) TestCreateMachineWithOptionsKeepLocked(c *check.C) {
+	m, err := CreateMachineWithOptions(CreateMachineOptions{IaaS: "test-iaas", Params: map[string]string{"id": "myid"}, KeepLocked: true})
+	c.Assert(err, check.IsNil)
+	dbMachine, err := FindMachineById(m.Id)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbMachine.State, check.Equals, MachineStateRunning)
+	c.Assert(dbMachine.LockUpdateTime.IsZero(), check.Equals, false)
+	err = m.Unlock()
+	c.Assert(err, check.IsNil)
+	dbMachine, err = FindMachineById(m.Id)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbMachine.LockUpdateTime.IsZero(), check.Equals, true)
+}
+
+func (s *S) TestCreateMachineWithTimeout(c *check.C) {
+	flaky := &TestFlakyIaaS{delay: 50 * time.Millisecond, deleteCh: make(chan string, 1)}
+	_, err := createMachineWithTimeout(flaky, "flaky-iaas", map[string]string{"id": "late"}, 10*time.Millisecond)
+	c.Assert(err, check.ErrorMatches, "timeout after 10ms waiting for machine creation in iaas flaky-iaas")
+	select {
+	case id := <-flaky.deleteCh:
+		c.Assert(id, check.Equals, "late")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for machine created after timeout to be removed")
+	}
+	m, err := createMachineWithTimeout(flaky, "flaky-iaas", map[string]string{"id": "fast"}, time.Second)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Id, check.Equals, "fast")
+}
+
+func (s *S) TestDestroyInvalidState(c *check.C) {
+	m := Machine{Id: "myid", Iaas: "test-iaas", State: MachineStateDeleted}
+	err := m.Destroy()
+	c.Assert(err, check.DeepEquals, &ErrInvalidStateTransition{From: MachineStateDeleted, To: MachineStateDeleting})
+	iaas, err := getIaasProvider("test-iaas")
+	c.Assert(err, check.IsNil)
+	c.Assert(iaas.(*TestIaaS).cmds, check.HasLen, 0)
+}
@@ -0,0 +1,416 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rackspace/gophercloud"
+	"github.com/rackspace/gophercloud/openstack"
+	"github.com/rackspace/gophercloud/openstack/compute/v2/extensions/keypairs"
+	"github.com/rackspace/gophercloud/openstack/compute/v2/flavors"
+	"github.com/rackspace/gophercloud/openstack/compute/v2/images"
+	"github.com/rackspace/gophercloud/openstack/compute/v2/servers"
+	"github.com/rackspace/gophercloud/openstack/networking/v2/networks"
+	"github.com/rackspace/gophercloud/pagination"
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+)
+
+const (
+	statusActive  = "ACTIVE"
+	statusError   = "ERROR"
+	statusDeleted = "DELETED"
+)
+
+var statusPollInterval = 2 * time.Second
+
+func init() {
+	iaas.RegisterIaasProvider("openstack", newOpenStackIaaS)
+	hc.AddChecker("OpenStack", iaas.BuildHealthCheck("openstack"))
+}
+
+type openStackIaaS struct {
+	base iaas.UserDataIaaS
+}
+
+func newOpenStackIaaS(name string) iaas.IaaS {
+	return &openStackIaaS{base: iaas.UserDataIaaS{NamedIaaS: iaas.NamedIaaS{BaseIaaSName: "openstack", IaaSName: name}}}
+}
+
+func (i *openStackIaaS) InstanceType(params map[string]string) string {
+	if flavor := params["flavor"]; flavor != "" {
+		return flavor
+	}
+	return params["flavor-id"]
+}
+
+func (i *openStackIaaS) Describe() string {
+	return `OpenStack IaaS required params:
+  flavor=<flavor>                       Name of the flavor (or flavor-id=<id>)
+  image=<image>                         Name of the image (or image-id=<id>)
+
+Optional params:
+  name=<name>                           Name of the server, defaults to a random name
+  networks=<net1,net2>                  Comma separated list of network names, resolved with Neutron
+  network-ids=<id1,id2>                 Comma separated list of network ids
+  address-network=<name>                Network whose address is used by tsuru, defaults to the
+                                        first network with an IPv4 address
+  security-groups=<group1,group2>       Comma separated list of security group names
+  keypair=<name>                        Name of the key pair injected in the server
+  availability-zone=<zone>              Availability zone where the server is created
+`
+}
+
+func (i *openStackIaaS) providerClient() (*gophercloud.ProviderClient, error) {
+	authURL, err := i.base.GetConfigString("auth-url")
+	if err != nil {
+		return nil, err
+	}
+	username, err := i.base.GetConfigString("username")
+	if err != nil {
+		return nil, err
+	}
+	password, err := i.base.GetConfigString("password")
+	if err != nil {
+		return nil, err
+	}
+	tenantName, _ := i.base.GetConfigString("tenant-name")
+	tenantID, _ := i.base.GetConfigString("tenant-id")
+	domainName, _ := i.base.GetConfigString("domain-name")
+	client, err := openstack.NewClient(authURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "openstack: invalid auth-url")
+	}
+	client.HTTPClient = *net.Dial5Full300ClientNoKeepAlive
+	err = openstack.Authenticate(client, gophercloud.AuthOptions{
+		IdentityEndpoint: authURL,
+		Username:         username,
+		Password:         password,
+		TenantName:       tenantName,
+		TenantID:         tenantID,
+		DomainName:       domainName,
+		AllowReauth:      true,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "openstack: unable to authenticate")
+	}
+	return client, nil
+}
+
+func (i *openStackIaaS) endpointOpts() gophercloud.EndpointOpts {
+	region, _ := i.base.GetConfigString("region")
+	availability := gophercloud.AvailabilityPublic
+	if endpointType, _ := i.base.GetConfigString("endpoint-type"); endpointType != "" {
+		availability = gophercloud.Availability(endpointType)
+	}
+	return gophercloud.EndpointOpts{Region: region, Availability: availability}
+}
+
+func (i *openStackIaaS) computeClient() (*gophercloud.ServiceClient, error) {
+	provider, err := i.providerClient()
+	if err != nil {
+		return nil, err
+	}
+	client, err := openstack.NewComputeV2(provider, i.endpointOpts())
+	if err != nil {
+		return nil, errors.Wrap(err, "openstack: unable to find compute endpoint")
+	}
+	return client, nil
+}
+
+func (i *openStackIaaS) HealthCheck() error {
+	client, err := i.computeClient()
+	if err != nil {
+		return err
+	}
+	err = flavors.ListDetail(client, nil).EachPage(func(page pagination.Page) (bool, error) {
+		return false, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "openstack: unable to list flavors")
+	}
+	return nil
+}
+
+// ValidateParams checks that the flavor, image and networks informed by name
+// exist in OpenStack.
+func (i *openStackIaaS) ValidateParams(params map[string]string) error {
+	provider, err := i.providerClient()
+	if err != nil {
+		return err
+	}
+	client, err := openstack.NewComputeV2(provider, i.endpointOpts())
+	if err != nil {
+		return errors.Wrap(err, "openstack: unable to find compute endpoint")
+	}
+	if name := params["flavor"]; name != "" && params["flavor-id"] == "" {
+		if _, err = flavors.IDFromName(client, name); err != nil {
+			return errors.Wrapf(err, "openstack: invalid flavor %q", name)
+		}
+	}
+	if name := params["image"]; name != "" && params["image-id"] == "" {
+		if _, err = images.IDFromName(client, name); err != nil {
+			return errors.Wrapf(err, "openstack: invalid image %q", name)
+		}
+	}
+	_, err = i.resolveNetworks(provider, params)
+	return err
+}
+
+func (i *openStackIaaS) CreateMachine(params map[string]string) (*iaas.Machine, error) {
+	if params["flavor"] == "" && params["flavor-id"] == "" {
+		return nil, errors.Errorf("the parameter %q is required", "flavor")
+	}
+	if params["image"] == "" && params["image-id"] == "" {
+		return nil, errors.Errorf("the parameter %q is required", "image")
+	}
+	userData, err := i.base.ReadUserData(params)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := i.providerClient()
+	if err != nil {
+		return nil, err
+	}
+	client, err := openstack.NewComputeV2(provider, i.endpointOpts())
+	if err != nil {
+		return nil, errors.Wrap(err, "openstack: unable to find compute endpoint")
+	}
+	name := params["name"]
+	if name == "" {
+		name, err = generateServerName(params["pool"])
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts := servers.CreateOpts{
+		Name:             name,
+		ImageRef:         params["image-id"],
+		ImageName:        params["image"],
+		FlavorRef:        params["flavor-id"],
+		FlavorName:       params["flavor"],
+		AvailabilityZone: params["availability-zone"],
+		Metadata:         map[string]string{"tsuru-iaas": i.base.IaaSName},
+	}
+	if opts.ImageRef != "" {
+		opts.ImageName = ""
+	}
+	if opts.FlavorRef != "" {
+		opts.FlavorName = ""
+	}
+	if userData != "" {
+		opts.UserData = []byte(userData)
+	}
+	if groups := splitParam(params["security-groups"]); len(groups) > 0 {
+		opts.SecurityGroups = groups
+	}
+	opts.Networks, err = i.resolveNetworks(provider, params)
+	if err != nil {
+		return nil, err
+	}
+	createOpts := keypairs.CreateOptsExt{CreateOptsBuilder: opts, KeyName: params["keypair"]}
+	server, err := servers.Create(client, createOpts).Extract()
+	if err != nil {
+		return nil, errors.Wrap(err, "openstack: unable to create server")
+	}
+	server, err = i.waitServerActive(client, server.ID)
+	if err == nil && serverAddress(server, params["address-network"]) == "" {
+		err = errors.Errorf("openstack: no IPv4 address found for server %s", server.ID)
+	}
+	if err != nil {
+		if delErr := servers.Delete(client, server.ID).ExtractErr(); delErr != nil {
+			log.Errorf("openstack: unable to remove server %s after error: %s", server.ID, delErr)
+		}
+		return nil, err
+	}
+	return &iaas.Machine{
+		Id:      server.ID,
+		Status:  server.Status,
+		Address: serverAddress(server, params["address-network"]),
+	}, nil
+}
+
+func (i *openStackIaaS) resolveNetworks(provider *gophercloud.ProviderClient, params map[string]string) ([]servers.Network, error) {
+	var result []servers.Network
+	for _, id := range splitParam(params["network-ids"]) {
+		result = append(result, servers.Network{UUID: id})
+	}
+	names := splitParam(params["networks"])
+	if len(names) == 0 {
+		return result, nil
+	}
+	client, err := openstack.NewNetworkV2(provider, i.endpointOpts())
+	if err != nil {
+		return nil, errors.Wrap(err, "openstack: unable to find network endpoint")
+	}
+	for _, name := range names {
+		id, err := networks.IDFromName(client, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "openstack: unable to find network %q", name)
+		}
+		result = append(result, servers.Network{UUID: id})
+	}
+	return result, nil
+}
+
+// waitServerActive polls the server until it becomes active, failing with
+// the fault reported by Nova when the server ends up in error state.
+func (i *openStackIaaS) waitServerActive(client *gophercloud.ServiceClient, id string) (*servers.Server, error) {
+	rawTimeout, _ := i.base.GetConfigString("wait-timeout")
+	timeout, _ := strconv.Atoi(rawTimeout)
+	if timeout == 0 {
+		timeout = 300
+	}
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		result := servers.Get(client, id)
+		server, err := result.Extract()
+		if err != nil {
+			return &servers.Server{ID: id}, errors.Wrapf(err, "openstack: unable to get server %s", id)
+		}
+		switch server.Status {
+		case statusActive:
+			return server, nil
+		case statusError, statusDeleted:
+			return server, errors.Errorf("openstack: server %s is in %s state: %s", id, server.Status, serverFault(result))
+		}
+		if time.Now().After(deadline) {
+			return server, errors.Errorf("openstack: time out after %d seconds waiting for server %s to become active, last status: %s", timeout, id, server.Status)
+		}
+		time.Sleep(statusPollInterval)
+	}
+}
+
+func (i *openStackIaaS) DeleteMachine(m *iaas.Machine) error {
+	client, err := i.computeClient()
+	if err != nil {
+		return err
+	}
+	err = servers.Delete(client, m.Id).ExtractErr()
+	if respErr, ok := err.(*gophercloud.UnexpectedResponseCodeError); ok && respErr.Actual == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "openstack: unable to delete server %s", m.Id)
+	}
+	return nil
+}
+
+// RebootMachine hard reboots the server, as a soft reboot depends on the
+// cooperation of an operating system that may be hung.
+func (i *openStackIaaS) RebootMachine(m *iaas.Machine) error {
+	client, err := i.computeClient()
+	if err != nil {
+		return err
+	}
+	err = servers.Reboot(client, m.Id, servers.HardReboot).ExtractErr()
+	if err != nil {
+		return errors.Wrapf(err, "openstack: unable to reboot server %s", m.Id)
+	}
+	return nil
+}
+
+// ListMachines returns the servers created by this IaaS, identified by the
+// metadata set on creation.
+func (i *openStackIaaS) ListMachines() ([]iaas.Machine, error) {
+	client, err := i.computeClient()
+	if err != nil {
+		return nil, err
+	}
+	var machines []iaas.Machine
+	err = servers.List(client, nil).EachPage(func(page pagination.Page) (bool, error) {
+		serverList, err := servers.ExtractServers(page)
+		if err != nil {
+			return false, err
+		}
+		for _, server := range serverList {
+			if server.Metadata["tsuru-iaas"] != i.base.IaaSName {
+				continue
+			}
+			machines = append(machines, iaas.Machine{
+				Id:      server.ID,
+				Status:  server.Status,
+				Address: serverAddress(&server, ""),
+			})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "openstack: unable to list servers")
+	}
+	return machines, nil
+}
+
+// serverAddress returns the IPv4 address of the server in the given network,
+// or in the first network (in alphabetical order) with an IPv4 address when
+// network is empty.
+func serverAddress(server *servers.Server, network string) string {
+	names := make([]string, 0, len(server.Addresses))
+	for name := range server.Addresses {
+		if network == "" || name == network {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		addrs, _ := server.Addresses[name].([]interface{})
+		for _, rawAddr := range addrs {
+			addr, _ := rawAddr.(map[string]interface{})
+			if version, _ := addr["version"].(float64); version != 4 {
+				continue
+			}
+			if ip, _ := addr["addr"].(string); ip != "" {
+				return ip
+			}
+		}
+	}
+	if network == "" {
+		return server.AccessIPv4
+	}
+	return ""
+}
+
+func serverFault(result servers.GetResult) string {
+	body, _ := result.Body.(map[string]interface{})
+	server, _ := body["server"].(map[string]interface{})
+	fault, _ := server["fault"].(map[string]interface{})
+	if message, _ := fault["message"].(string); message != "" {
+		return message
+	}
+	return "no fault reported"
+}
+
+func splitParam(value string) []string {
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+func generateServerName(prefix string) (string, error) {
+	id := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return "", errors.Wrap(err, "failed to generate random id")
+	}
+	if prefix == "" {
+		prefix = "tsuru"
+	}
+	return fmt.Sprintf("%s-%s", prefix, hex.EncodeToString(id)), nil
+}
@@ -0,0 +1,270 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/iaas"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type openstackSuite struct {
+	server *fakeOpenStack
+}
+
+var _ = check.Suite(&openstackSuite{})
+
+func (s *openstackSuite) SetUpSuite(c *check.C) {
+	statusPollInterval = time.Millisecond
+}
+
+func (s *openstackSuite) SetUpTest(c *check.C) {
+	s.server = newFakeOpenStack()
+	config.Set("iaas:openstack:auth-url", s.server.URL+"/v2.0")
+	config.Set("iaas:openstack:username", "admin")
+	config.Set("iaas:openstack:password", "secret")
+	config.Set("iaas:openstack:tenant-name", "tsuru")
+	config.Set("iaas:openstack:region", "RegionOne")
+}
+
+func (s *openstackSuite) TearDownTest(c *check.C) {
+	s.server.Close()
+	config.Unset("iaas:openstack")
+}
+
+type fakeOpenStack struct {
+	*httptest.Server
+	mu            sync.Mutex
+	createRequest map[string]interface{}
+	statuses      []string
+	deleted       []string
+	actions       []map[string]interface{}
+	servers       string
+}
+
+func newFakeOpenStack() *fakeOpenStack {
+	f := &fakeOpenStack{statuses: []string{"BUILD", "ACTIVE"}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeOpenStack) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/v2.0/tokens":
+		fmt.Fprintf(w, `{"access": {"token": {"id": "tok", "expires": "2030-01-01T00:00:00Z"},
+"serviceCatalog": [
+  {"type": "compute", "endpoints": [{"region": "RegionOne", "publicURL": "%[1]s/compute/"}]},
+  {"type": "network", "endpoints": [{"region": "RegionOne", "publicURL": "%[1]s/network/"}]}
+]}}`, f.URL)
+	case r.URL.Path == "/compute/flavors/detail":
+		fmt.Fprint(w, `{"flavors": [{"id": "f1", "name": "m1.small"}, {"id": "f2", "name": "m1.large"}]}`)
+	case r.URL.Path == "/compute/images/detail":
+		fmt.Fprint(w, `{"images": [{"id": "img1", "name": "ubuntu-16.04"}]}`)
+	case r.URL.Path == "/network/v2.0/networks":
+		fmt.Fprint(w, `{"networks": [{"id": "net1", "name": "private"}]}`)
+	case r.URL.Path == "/compute/servers" && r.Method == http.MethodPost:
+		json.NewDecoder(r.Body).Decode(&f.createRequest)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"server": {"id": "srv1"}}`)
+	case r.URL.Path == "/compute/servers/detail":
+		fmt.Fprint(w, f.servers)
+	case r.URL.Path == "/compute/servers/srv1" && r.Method == http.MethodGet:
+		status := f.statuses[0]
+		if len(f.statuses) > 1 {
+			f.statuses = f.statuses[1:]
+		}
+		fault := ""
+		if status == "ERROR" {
+			fault = `, "fault": {"code": 500, "message": "No valid host was found."}`
+		}
+		fmt.Fprintf(w, `{"server": {"id": "srv1", "status": %q%s, "addresses": {
+  "private": [{"version": 6, "addr": "fe80::1"}, {"version": 4, "addr": "10.0.0.5"}]
+}}}`, status, fault)
+	case r.URL.Path == "/compute/servers/srv1/action" && r.Method == http.MethodPost:
+		var action map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&action)
+		f.actions = append(f.actions, action)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodDelete:
+		f.deleted = append(f.deleted, r.URL.Path)
+		if r.URL.Path != "/compute/servers/srv1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *openstackSuite) TestCreateMachine(c *check.C) {
+	provider := newOpenStackIaaS("openstack")
+	m, err := provider.CreateMachine(map[string]string{
+		"name":            "node1",
+		"flavor":          "m1.small",
+		"image":           "ubuntu-16.04",
+		"networks":        "private",
+		"network-ids":     "net2",
+		"security-groups": "default, docker",
+		"keypair":         "tsuru",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(m, check.DeepEquals, &iaas.Machine{Id: "srv1", Status: "ACTIVE", Address: "10.0.0.5"})
+	server := s.server.createRequest["server"].(map[string]interface{})
+	c.Assert(server["name"], check.Equals, "node1")
+	c.Assert(server["flavorRef"], check.Equals, "f1")
+	c.Assert(server["imageRef"], check.Equals, "img1")
+	c.Assert(server["key_name"], check.Equals, "tsuru")
+	c.Assert(server["metadata"], check.DeepEquals, map[string]interface{}{"tsuru-iaas": "openstack"})
+	c.Assert(server["networks"], check.DeepEquals, []interface{}{
+		map[string]interface{}{"uuid": "net2"},
+		map[string]interface{}{"uuid": "net1"},
+	})
+	c.Assert(server["security_groups"], check.DeepEquals, []interface{}{
+		map[string]interface{}{"name": "default"},
+		map[string]interface{}{"name": "docker"},
+	})
+	c.Assert(s.server.deleted, check.HasLen, 0)
+}
+
+func (s *openstackSuite) TestCreateMachineUserData(c *check.C) {
+	provider := newOpenStackIaaS("openstack")
+	_, err := provider.CreateMachine(map[string]string{
+		"flavor":    "m1.small",
+		"image":     "ubuntu-16.04",
+		"user-data": "#!/bin/bash\necho hi",
+	})
+	c.Assert(err, check.IsNil)
+	server := s.server.createRequest["server"].(map[string]interface{})
+	c.Assert(server["user_data"], check.Equals, base64.StdEncoding.EncodeToString([]byte("#!/bin/bash\necho hi")))
+}
+
+func (s *openstackSuite) TestCreateMachineByIDWithoutUserData(c *check.C) {
+	config.Set("iaas:openstack:user-data", "")
+	provider := newOpenStackIaaS("openstack")
+	_, err := provider.CreateMachine(map[string]string{"flavor-id": "f2", "image-id": "img9"})
+	c.Assert(err, check.IsNil)
+	server := s.server.createRequest["server"].(map[string]interface{})
+	c.Assert(server["flavorRef"], check.Equals, "f2")
+	c.Assert(server["imageRef"], check.Equals, "img9")
+	c.Assert(server["name"], check.Matches, "tsuru-[0-9a-f]{16}")
+	_, ok := server["user_data"]
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *openstackSuite) TestCreateMachineRequiredParams(c *check.C) {
+	provider := newOpenStackIaaS("openstack")
+	_, err := provider.CreateMachine(map[string]string{"image": "ubuntu-16.04"})
+	c.Assert(err, check.ErrorMatches, `the parameter "flavor" is required`)
+	_, err = provider.CreateMachine(map[string]string{"flavor": "m1.small"})
+	c.Assert(err, check.ErrorMatches, `the parameter "image" is required`)
+}
+
+func (s *openstackSuite) TestCreateMachineUnknownFlavor(c *check.C) {
+	provider := newOpenStackIaaS("openstack")
+	_, err := provider.CreateMachine(map[string]string{"flavor": "m1.huge", "image": "ubuntu-16.04"})
+	c.Assert(err, check.ErrorMatches, "openstack: unable to create server: Unable to find flavor: m1.huge")
+}
+
+func (s *openstackSuite) TestCreateMachineErrorState(c *check.C) {
+	s.server.statuses = []string{"BUILD", "ERROR"}
+	provider := newOpenStackIaaS("openstack")
+	_, err := provider.CreateMachine(map[string]string{"flavor": "m1.small", "image": "ubuntu-16.04"})
+	c.Assert(err, check.ErrorMatches, "openstack: server srv1 is in ERROR state: No valid host was found.")
+	c.Assert(s.server.deleted, check.DeepEquals, []string{"/compute/servers/srv1"})
+}
+
+func (s *openstackSuite) TestCreateMachineTimeout(c *check.C) {
+	config.Set("iaas:openstack:wait-timeout", -1)
+	s.server.statuses = []string{"BUILD"}
+	provider := newOpenStackIaaS("openstack")
+	_, err := provider.CreateMachine(map[string]string{"flavor": "m1.small", "image": "ubuntu-16.04"})
+	c.Assert(err, check.ErrorMatches, "openstack: time out after -1 seconds waiting for server srv1 to become active, last status: BUILD")
+	c.Assert(s.server.deleted, check.DeepEquals, []string{"/compute/servers/srv1"})
+}
+
+func (s *openstackSuite) TestCreateMachineAddressNetworkNotFound(c *check.C) {
+	provider := newOpenStackIaaS("openstack")
+	_, err := provider.CreateMachine(map[string]string{"flavor": "m1.small", "image": "ubuntu-16.04", "address-network": "public"})
+	c.Assert(err, check.ErrorMatches, "openstack: no IPv4 address found for server srv1")
+	c.Assert(s.server.deleted, check.DeepEquals, []string{"/compute/servers/srv1"})
+}
+
+func (s *openstackSuite) TestDeleteMachine(c *check.C) {
+	provider := newOpenStackIaaS("openstack")
+	err := provider.DeleteMachine(&iaas.Machine{Id: "srv1"})
+	c.Assert(err, check.IsNil)
+	err = provider.DeleteMachine(&iaas.Machine{Id: "gone"})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.server.deleted, check.DeepEquals, []string{"/compute/servers/srv1", "/compute/servers/gone"})
+}
+
+func (s *openstackSuite) TestRebootMachine(c *check.C) {
+	provider := newOpenStackIaaS("openstack").(iaas.Rebooter)
+	err := provider.RebootMachine(&iaas.Machine{Id: "srv1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.server.actions, check.DeepEquals, []map[string]interface{}{
+		{"reboot": map[string]interface{}{"type": "HARD"}},
+	})
+	err = provider.RebootMachine(&iaas.Machine{Id: "gone"})
+	c.Assert(err, check.ErrorMatches, `(?s)openstack: unable to reboot server gone: .*`)
+}
+
+func (s *openstackSuite) TestListMachines(c *check.C) {
+	s.server.servers = `{"servers": [
+  {"id": "srv1", "status": "ACTIVE", "metadata": {"tsuru-iaas": "openstack"},
+   "addresses": {"private": [{"version": 4, "addr": "10.0.0.5"}]}},
+  {"id": "srv2", "status": "ACTIVE", "metadata": {"tsuru-iaas": "other"}},
+  {"id": "srv3", "status": "SHUTOFF", "metadata": {}}
+]}`
+	provider := newOpenStackIaaS("openstack")
+	machines, err := provider.(iaas.Lister).ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.DeepEquals, []iaas.Machine{
+		{Id: "srv1", Status: "ACTIVE", Address: "10.0.0.5"},
+	})
+}
+
+func (s *openstackSuite) TestHealthCheck(c *check.C) {
+	provider := newOpenStackIaaS("openstack")
+	err := provider.(iaas.HealthChecker).HealthCheck()
+	c.Assert(err, check.IsNil)
+	config.Set("iaas:openstack:region", "RegionTwo")
+	err = provider.(iaas.HealthChecker).HealthCheck()
+	c.Assert(err, check.ErrorMatches, "openstack: unable to find compute endpoint: .*")
+}
+
+func (s *openstackSuite) TestHealthCheckMissingConfig(c *check.C) {
+	config.Unset("iaas:openstack:auth-url")
+	provider := newOpenStackIaaS("openstack")
+	err := provider.(iaas.HealthChecker).HealthCheck()
+	c.Assert(err, check.NotNil)
+}
+
+func (s *openstackSuite) TestValidateParams(c *check.C) {
+	validator := newOpenStackIaaS("openstack").(iaas.ParamsValidator)
+	err := validator.ValidateParams(map[string]string{"flavor": "m1.small", "image": "ubuntu-16.04", "networks": "private"})
+	c.Assert(err, check.IsNil)
+	err = validator.ValidateParams(map[string]string{"flavor": "m1.huge"})
+	c.Assert(err, check.ErrorMatches, `openstack: invalid flavor "m1.huge": Unable to find flavor: m1.huge`)
+	err = validator.ValidateParams(map[string]string{"image": "centos"})
+	c.Assert(err, check.ErrorMatches, `openstack: invalid image "centos": .*`)
+	err = validator.ValidateParams(map[string]string{"networks": "public"})
+	c.Assert(err, check.ErrorMatches, `openstack: unable to find network "public": .*`)
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MachineState is the state of a machine in its lifecycle, as seen by tsuru.
+// It's independent from Machine.Status, which holds the raw status reported
+// by the IaaS provider.
+type MachineState string
+
+const (
+	MachineStateRequested = MachineState("requested")
+	MachineStateCreating  = MachineState("creating")
+	MachineStateRunning   = MachineState("running")
+	MachineStateFailed    = MachineState("failed")
+	MachineStateDeleting  = MachineState("deleting")
+	MachineStateDeleted   = MachineState("deleted")
+)
+
+var machineStateTransitions = map[MachineState][]MachineState{
+	MachineStateRequested: {MachineStateCreating, MachineStateFailed},
+	MachineStateCreating:  {MachineStateRunning, MachineStateFailed},
+	MachineStateRunning:   {MachineStateDeleting},
+	MachineStateFailed:    {MachineStateCreating, MachineStateDeleting},
+	MachineStateDeleting:  {MachineStateDeleted, MachineStateFailed},
+}
+
+type ErrInvalidStateTransition struct {
+	From MachineState
+	To   MachineState
+}
+
+func (e *ErrInvalidStateTransition) Error() string {
+	return fmt.Sprintf("invalid machine state transition from %q to %q", e.From, e.To)
+}
+
+// CanTransitionTo returns whether a machine in state s may move to state
+// next.
+func (s MachineState) CanTransitionTo(next MachineState) bool {
+	for _, allowed := range machineStateTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentState returns the state of the machine. Machines stored before
+// states were introduced have no state and are considered running.
+func (m *Machine) CurrentState() MachineState {
+	if m.State == "" {
+		return MachineStateRunning
+	}
+	return m.State
+}
+
+// transition moves the machine to the next state, logging the change to w
+// when it's not nil. Machines already stored in the database, including
+// pending ones, have their state updated there too.
+func (m *Machine) transition(next MachineState, w io.Writer) error {
+	current := m.CurrentState()
+	if !current.CanTransitionTo(next) {
+		return &ErrInvalidStateTransition{From: current, To: next}
+	}
+	m.State = next
+	if next != MachineStateFailed {
+		m.Error = ""
+	}
+	if w != nil {
+		id := m.Id
+		if id == "" || m.Pending() {
+			id = "(pending)"
+		}
+		if m.Error != "" {
+			fmt.Fprintf(w, "machine %s in iaas %s: %s -> %s: %s\n", id, m.Iaas, current, next, m.Error)
+		} else {
+			fmt.Fprintf(w, "machine %s in iaas %s: %s -> %s\n", id, m.Iaas, current, next)
+		}
+	}
+	if m.Id == "" {
+		return nil
+	}
+	return m.updateState()
+}
+
+func (m *Machine) updateState() error {
+	coll, err := collection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.UpdateId(m.Id, bson.M{"$set": bson.M{"state": m.State, "error": m.Error}})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return errors.Wrapf(err, "unable to update state of machine %s", m.Id)
+}
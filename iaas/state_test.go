@@ -0,0 +1,56 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"bytes"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestMachineStateCanTransitionTo(c *check.C) {
+	tests := []struct {
+		from, to MachineState
+		expected bool
+	}{
+		{MachineStateRequested, MachineStateCreating, true},
+		{MachineStateRequested, MachineStateRunning, false},
+		{MachineStateCreating, MachineStateRunning, true},
+		{MachineStateCreating, MachineStateFailed, true},
+		{MachineStateFailed, MachineStateCreating, true},
+		{MachineStateFailed, MachineStateRunning, false},
+		{MachineStateRunning, MachineStateDeleting, true},
+		{MachineStateRunning, MachineStateCreating, false},
+		{MachineStateDeleting, MachineStateDeleted, true},
+		{MachineStateDeleted, MachineStateDeleting, false},
+	}
+	for _, tt := range tests {
+		c.Check(tt.from.CanTransitionTo(tt.to), check.Equals, tt.expected, check.Commentf("%s -> %s", tt.from, tt.to))
+	}
+}
+
+func (s *S) TestMachineCurrentState(c *check.C) {
+	m := Machine{}
+	c.Assert(m.CurrentState(), check.Equals, MachineStateRunning)
+	m.State = MachineStateFailed
+	c.Assert(m.CurrentState(), check.Equals, MachineStateFailed)
+}
+
+func (s *S) TestMachineTransition(c *check.C) {
+	var buf bytes.Buffer
+	m := Machine{Iaas: "test-iaas", State: MachineStateRequested}
+	err := m.transition(MachineStateCreating, &buf)
+	c.Assert(err, check.IsNil)
+	m.Error = "boom"
+	err = m.transition(MachineStateFailed, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Error, check.Equals, "boom")
+	err = m.transition(MachineStateRunning, &buf)
+	c.Assert(err, check.DeepEquals, &ErrInvalidStateTransition{From: MachineStateFailed, To: MachineStateRunning})
+	c.Assert(err, check.ErrorMatches, `invalid machine state transition from "failed" to "running"`)
+	c.Assert(buf.String(), check.Equals, `machine (pending) in iaas test-iaas: requested -> creating
+machine (pending) in iaas test-iaas: creating -> failed: boom
+`)
+}
@@ -5,7 +5,9 @@
 package iaas
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/tsuru/config"
 	"gopkg.in/check.v1"
@@ -30,6 +32,10 @@ func (s *S) SetUpTest(c *check.C) {
 	tplColl := template_collection()
 	defer tplColl.Close()
 	tplColl.RemoveAll(nil)
+	usageColl, err := usageCollection()
+	c.Assert(err, check.IsNil)
+	defer usageColl.Close()
+	usageColl.RemoveAll(nil)
 }
 
 func (s *S) TearDownSuite(c *check.C) {
@@ -117,3 +123,69 @@ func newTestDescriberIaaS(name string) IaaS {
 func newTestIaaS(name string) IaaS {
 	return &TestIaaS{}
 }
+
+type TestListerIaaS struct {
+	TestIaaS
+	machines []Machine
+	err      error
+}
+
+func (i *TestListerIaaS) ListMachines() ([]Machine, error) {
+	return i.machines, i.err
+}
+
+type TestFlakyIaaS struct {
+	TestIaaS
+	failures int
+	delay    time.Duration
+	deleteCh chan string
+}
+
+func (i *TestFlakyIaaS) CreateMachine(params map[string]string) (*Machine, error) {
+	time.Sleep(i.delay)
+	if i.failures > 0 {
+		i.failures--
+		i.cmds = append(i.cmds, "create-error")
+		params["should"] = "not be in"
+		return nil, errors.New("create failed")
+	}
+	return i.TestIaaS.CreateMachine(params)
+}
+
+func (i *TestFlakyIaaS) DeleteMachine(m *Machine) error {
+	if i.deleteCh != nil {
+		i.deleteCh <- m.Id
+	}
+	return nil
+}
+
+type TestCheckerIaaS struct {
+	TestIaaS
+	check func()
+}
+
+func (i *TestCheckerIaaS) CreateMachine(params map[string]string) (*Machine, error) {
+	i.check()
+	return i.TestIaaS.CreateMachine(params)
+}
+
+type TestValidatorIaaS struct {
+	TestIaaS
+	params map[string]string
+	err    error
+}
+
+func (i *TestValidatorIaaS) ValidateParams(params map[string]string) error {
+	i.params = params
+	return i.err
+}
+
+type TestRebooterIaaS struct {
+	TestIaaS
+	rebooted []string
+}
+
+func (i *TestRebooterIaaS) RebootMachine(m *Machine) error {
+	i.rebooted = append(i.rebooted, m.Id)
+	return nil
+}
@@ -5,11 +5,23 @@
 package iaas
 
 import (
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/pkg/errors"
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/storage"
 	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	TemplateParamString = "string"
+	TemplateParamInt    = "int"
+	TemplateParamBool   = "bool"
 )
 
 type TemplateData struct {
@@ -23,10 +35,33 @@ func (l TemplateDataList) Len() int           { return len(l) }
 func (l TemplateDataList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 func (l TemplateDataList) Less(i, j int) bool { return l[i].Name < l[j].Name }
 
+// TemplateParam declares a param accepted by a template, which is checked
+// whenever the template is expanded to create a machine. An empty Type is
+// the same as TemplateParamString.
+type TemplateParam struct {
+	Name        string
+	Type        string `json:",omitempty"`
+	Required    bool
+	Default     string `json:",omitempty"`
+	Description string `json:",omitempty"`
+}
+
+type TemplateParamList []TemplateParam
+
+func (l TemplateParamList) Len() int           { return len(l) }
+func (l TemplateParamList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l TemplateParamList) Less(i, j int) bool { return l[i].Name < l[j].Name }
+
+// Template is a named set of params used to create machines. A template may
+// extend a parent template, inheriting its IaaS, data and param declarations,
+// and overriding only what differs. The inherited IaaS is not stored in the
+// template, use ResolveIaaSName to get it.
 type Template struct {
 	Name     string `bson:"_id"`
 	IaaSName string
+	Parent   string `bson:",omitempty" json:",omitempty"`
 	Data     TemplateDataList
+	Params   TemplateParamList `bson:",omitempty" json:",omitempty"`
 }
 
 func FindTemplate(name string) (*Template, error) {
@@ -42,7 +77,11 @@ func ExpandTemplate(name string, params map[string]string) (map[string]string, e
 	if err != nil {
 		return nil, err
 	}
-	templateParams := template.paramsMap()
+	resolved, err := template.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	templateParams := resolved.paramsMap()
 	delete(params, "template")
 	// User params will override template params
 	for k, v := range templateParams {
@@ -51,6 +90,10 @@ func ExpandTemplate(name string, params map[string]string) (map[string]string, e
 			params[k] = v
 		}
 	}
+	err = resolved.Params.apply(params, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid params for template %q", name)
+	}
 	return params, nil
 }
 
@@ -65,10 +108,39 @@ func ListTemplates() ([]Template, error) {
 func DestroyTemplate(name string) error {
 	coll := template_collection()
 	defer coll.Close()
+	var children []string
+	err := coll.Find(bson.M{"parent": name}).Distinct("_id", &children)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		sort.Strings(children)
+		return errors.Errorf("template %q is extended by: %s", name, strings.Join(children, ", "))
+	}
 	return coll.RemoveId(name)
 }
 
+// TemplateUpdateOptions holds the changes to a template that can't be
+// expressed by the partial template merged into it.
+type TemplateUpdateOptions struct {
+	// ClearParent removes the parent of the template, which stops inheriting
+	// from it.
+	ClearParent bool
+	// RemoveParams holds the names of the param declarations removed from
+	// the template. Declarations inherited from a parent are kept.
+	RemoveParams []string
+}
+
 func (t *Template) Update(toMerge *Template) error {
+	return t.UpdateWithOptions(toMerge, TemplateUpdateOptions{})
+}
+
+// UpdateWithOptions merges toMerge into the template, data with empty values
+// are removed, and applies the changes in opts before saving it.
+func (t *Template) UpdateWithOptions(toMerge *Template, opts TemplateUpdateOptions) error {
+	if opts.ClearParent && toMerge.Parent != "" {
+		return errors.New("cannot set and clear the template parent at the same time")
+	}
 	currentMap := t.paramsMap()
 	toMergeMap := toMerge.paramsMap()
 	delete(toMergeMap, "iaas")
@@ -84,6 +156,19 @@ func (t *Template) Update(toMerge *Template) error {
 	for k, v := range currentMap {
 		t.Data = append(t.Data, TemplateData{Name: k, Value: v})
 	}
+	if toMerge.Parent != "" {
+		t.Parent = toMerge.Parent
+	}
+	if opts.ClearParent && t.Parent != "" {
+		iaasName, err := t.ResolveIaaSName()
+		if err != nil {
+			return err
+		}
+		t.IaaSName = iaasName
+		t.Parent = ""
+	}
+	t.Params = mergeTemplateParams(t.Params, toMerge.Params)
+	t.Params = removeTemplateParams(t.Params, opts.RemoveParams)
 	return t.Save()
 }
 
@@ -91,13 +176,216 @@ func (t *Template) Save() error {
 	if t.Name == "" {
 		return errors.New("template name cannot be empty")
 	}
-	_, err := getIaasProvider(t.IaaSName)
+	resolved, err := t.Resolve()
+	if err != nil {
+		return err
+	}
+	_, err = getIaasProvider(resolved.IaaSName)
+	if err != nil {
+		return err
+	}
+	err = resolved.Params.validate()
 	if err != nil {
 		return err
 	}
 	return t.saveToDB()
 }
 
+// Validate checks the template, along with its ancestors, without saving it.
+// The resulting params, with defaults applied, are also sent to the IaaS when
+// it implements ParamsValidator. Required params are not enforced, as they
+// may be informed only when the template is used.
+func (t *Template) Validate() error {
+	if t.Name == "" {
+		return errors.New("template name cannot be empty")
+	}
+	resolved, err := t.Resolve()
+	if err != nil {
+		return err
+	}
+	iaas, err := getIaasProvider(resolved.IaaSName)
+	if err != nil {
+		return err
+	}
+	err = resolved.Params.validate()
+	if err != nil {
+		return err
+	}
+	params := resolved.paramsMap()
+	err = resolved.Params.apply(params, false)
+	if err != nil {
+		return err
+	}
+	if validator, ok := iaas.(ParamsValidator); ok {
+		return validator.ValidateParams(params)
+	}
+	return nil
+}
+
+// Resolve returns a copy of the template with the IaaS, data and param
+// declarations inherited from its ancestors merged into it. The template
+// itself doesn't need to be saved.
+func (t *Template) Resolve() (*Template, error) {
+	chain := []*Template{t}
+	visited := map[string]bool{t.Name: true}
+	for current := t; current.Parent != ""; {
+		if visited[current.Parent] {
+			names := make([]string, 0, len(chain)+1)
+			for _, tpl := range chain {
+				names = append(names, tpl.Name)
+			}
+			names = append(names, current.Parent)
+			return nil, errors.Errorf("template inheritance cycle: %s", strings.Join(names, " -> "))
+		}
+		parent, err := FindTemplate(current.Parent)
+		if err == mgo.ErrNotFound {
+			return nil, errors.Errorf("parent template %q of %q not found", current.Parent, current.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		visited[parent.Name] = true
+		chain = append(chain, parent)
+		current = parent
+	}
+	resolved := &Template{Name: t.Name, Parent: t.Parent}
+	data := map[string]string{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		tpl := chain[i]
+		if tpl.IaaSName != "" {
+			if resolved.IaaSName != "" && resolved.IaaSName != tpl.IaaSName {
+				return nil, errors.Errorf("template %q uses iaas %q, but its parent uses %q", tpl.Name, tpl.IaaSName, resolved.IaaSName)
+			}
+			resolved.IaaSName = tpl.IaaSName
+		}
+		for _, item := range tpl.Data {
+			data[item.Name] = item.Value
+		}
+		resolved.Params = mergeTemplateParams(resolved.Params, tpl.Params)
+	}
+	for k, v := range data {
+		resolved.Data = append(resolved.Data, TemplateData{Name: k, Value: v})
+	}
+	sort.Sort(resolved.Data)
+	return resolved, nil
+}
+
+// ResolveIaaSName returns the IaaS of the template, inherited from its
+// ancestors when the template doesn't set one.
+func (t *Template) ResolveIaaSName() (string, error) {
+	if t.IaaSName != "" || t.Parent == "" {
+		return t.IaaSName, nil
+	}
+	resolved, err := t.Resolve()
+	if err != nil {
+		return "", err
+	}
+	return resolved.IaaSName, nil
+}
+
+// mergeTemplateParams returns base with the declarations in overrides
+// replacing the ones with the same name, sorted by name.
+func mergeTemplateParams(base, overrides TemplateParamList) TemplateParamList {
+	if len(overrides) == 0 {
+		return base
+	}
+	byName := map[string]TemplateParam{}
+	for _, p := range base {
+		byName[p.Name] = p
+	}
+	for _, p := range overrides {
+		byName[p.Name] = p
+	}
+	result := make(TemplateParamList, 0, len(byName))
+	for _, p := range byName {
+		result = append(result, p)
+	}
+	sort.Sort(result)
+	return result
+}
+
+// removeTemplateParams returns params without the declarations with the
+// given names.
+func removeTemplateParams(params TemplateParamList, names []string) TemplateParamList {
+	if len(names) == 0 {
+		return params
+	}
+	toRemove := map[string]bool{}
+	for _, name := range names {
+		toRemove[name] = true
+	}
+	result := make(TemplateParamList, 0, len(params))
+	for _, p := range params {
+		if !toRemove[p.Name] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// validate checks the declarations themselves: names must be set, types must
+// be known and defaults must match their types.
+func (l TemplateParamList) validate() error {
+	for _, p := range l {
+		if p.Name == "" {
+			return errors.New("template param name cannot be empty")
+		}
+		switch p.Type {
+		case "", TemplateParamString, TemplateParamInt, TemplateParamBool:
+		default:
+			return errors.Errorf("invalid type %q for template param %q, must be one of: %s, %s, %s",
+				p.Type, p.Name, TemplateParamString, TemplateParamInt, TemplateParamBool)
+		}
+		if p.Default != "" {
+			if err := p.check(p.Default); err != nil {
+				return errors.Wrap(err, "invalid default")
+			}
+		}
+	}
+	return nil
+}
+
+// apply sets the defaults of declared params missing in params and checks
+// the types of the declared ones, failing when a required param is missing
+// if enforceRequired is true.
+func (l TemplateParamList) apply(params map[string]string, enforceRequired bool) error {
+	var missing []string
+	for _, p := range l {
+		value, isSet := params[p.Name]
+		if !isSet && p.Default != "" {
+			value, isSet = p.Default, true
+			params[p.Name] = value
+		}
+		if !isSet {
+			if p.Required && enforceRequired {
+				missing = append(missing, p.Name)
+			}
+			continue
+		}
+		if err := p.check(value); err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("missing required params: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (p *TemplateParam) check(value string) error {
+	var err error
+	switch p.Type {
+	case TemplateParamInt:
+		_, err = strconv.Atoi(value)
+	case TemplateParamBool:
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return errors.Errorf("param %q must be of type %s, got %q", p.Name, p.Type, value)
+	}
+	return nil
+}
+
 func (t *Template) saveToDB() error {
 	coll := template_collection()
 	defer coll.Close()
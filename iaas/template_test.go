@@ -5,9 +5,11 @@
 package iaas
 
 import (
+	"errors"
 	"sort"
 
 	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2"
 )
 
 func (s *S) TestTemplateSave(c *check.C) {
@@ -196,3 +198,275 @@ func (s *S) TestExpandTemplate(c *check.C) {
 		"iaas": "test-iaas",
 	})
 }
+
+func (s *S) TestTemplateSaveWithParent(c *check.C) {
+	base := Template{
+		Name:     "base",
+		IaaSName: "test-iaas",
+		Data: TemplateDataList{
+			{Name: "region", Value: "us-east-1"},
+			{Name: "type", Value: "m1.small"},
+		},
+		Params: TemplateParamList{{Name: "pool", Required: true}},
+	}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	large := Template{
+		Name:   "large",
+		Parent: "base",
+		Data:   TemplateDataList{{Name: "type", Value: "m1.large"}},
+	}
+	err = large.Save()
+	c.Assert(err, check.IsNil)
+	dbTpl, err := FindTemplate("large")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbTpl.IaaSName, check.Equals, "")
+	iaasName, err := dbTpl.ResolveIaaSName()
+	c.Assert(err, check.IsNil)
+	c.Assert(iaasName, check.Equals, "test-iaas")
+	resolved, err := large.Resolve()
+	c.Assert(err, check.IsNil)
+	c.Assert(resolved, check.DeepEquals, &Template{
+		Name:     "large",
+		IaaSName: "test-iaas",
+		Parent:   "base",
+		Data: TemplateDataList{
+			{Name: "region", Value: "us-east-1"},
+			{Name: "type", Value: "m1.large"},
+		},
+		Params: TemplateParamList{{Name: "pool", Required: true}},
+	})
+}
+
+func (s *S) TestTemplateResolveIaaSNameFollowsParent(c *check.C) {
+	RegisterIaasProvider("other-iaas", newTestIaaS)
+	base := Template{Name: "base", IaaSName: "test-iaas"}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{Name: "child", Parent: "base"}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	base.IaaSName = "other-iaas"
+	err = base.Save()
+	c.Assert(err, check.IsNil)
+	dbTpl, err := FindTemplate("child")
+	c.Assert(err, check.IsNil)
+	iaasName, err := dbTpl.ResolveIaaSName()
+	c.Assert(err, check.IsNil)
+	c.Assert(iaasName, check.Equals, "other-iaas")
+}
+
+func (s *S) TestTemplateSaveParentNotFound(c *check.C) {
+	t := Template{Name: "tpl1", IaaSName: "test-iaas", Parent: "unknown"}
+	err := t.Save()
+	c.Assert(err, check.ErrorMatches, `parent template "unknown" of "tpl1" not found`)
+}
+
+func (s *S) TestTemplateSaveParentDifferentIaaS(c *check.C) {
+	RegisterIaasProvider("other-iaas", newTestIaaS)
+	base := Template{Name: "base", IaaSName: "test-iaas"}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	t := Template{Name: "tpl1", IaaSName: "other-iaas", Parent: "base"}
+	err = t.Save()
+	c.Assert(err, check.ErrorMatches, `template "tpl1" uses iaas "other-iaas", but its parent uses "test-iaas"`)
+}
+
+func (s *S) TestTemplateSaveInheritanceCycle(c *check.C) {
+	a := Template{Name: "a", IaaSName: "test-iaas"}
+	err := a.Save()
+	c.Assert(err, check.IsNil)
+	b := Template{Name: "b", Parent: "a"}
+	err = b.Save()
+	c.Assert(err, check.IsNil)
+	a.Parent = "b"
+	err = a.Save()
+	c.Assert(err, check.ErrorMatches, "template inheritance cycle: a -> b -> a")
+}
+
+func (s *S) TestTemplateSaveInvalidParams(c *check.C) {
+	t := Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Params:   TemplateParamList{{Name: "count", Type: "number"}},
+	}
+	err := t.Save()
+	c.Assert(err, check.ErrorMatches, `invalid type "number" for template param "count", must be one of: string, int, bool`)
+	t.Params = TemplateParamList{{Name: "count", Type: TemplateParamInt, Default: "many"}}
+	err = t.Save()
+	c.Assert(err, check.ErrorMatches, `invalid default: param "count" must be of type int, got "many"`)
+}
+
+func (s *S) TestUpdateTemplateParentAndParams(c *check.C) {
+	base := Template{Name: "base", IaaSName: "test-iaas"}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	tpl1 := Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Params: TemplateParamList{
+			{Name: "count", Type: TemplateParamInt},
+			{Name: "zone", Default: "a"},
+		},
+	}
+	err = tpl1.Save()
+	c.Assert(err, check.IsNil)
+	err = tpl1.Update(&Template{
+		Parent: "base",
+		Params: TemplateParamList{{Name: "zone", Default: "b"}},
+	})
+	c.Assert(err, check.IsNil)
+	dbTpl, err := FindTemplate("tpl1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbTpl.Parent, check.Equals, "base")
+	c.Assert(dbTpl.Params, check.DeepEquals, TemplateParamList{
+		{Name: "count", Type: TemplateParamInt},
+		{Name: "zone", Default: "b"},
+	})
+}
+
+func (s *S) TestUpdateTemplateClearParentAndRemoveParams(c *check.C) {
+	base := Template{
+		Name:     "base",
+		IaaSName: "test-iaas",
+		Params:   TemplateParamList{{Name: "pool", Required: true}},
+	}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	tpl1 := Template{
+		Name:   "tpl1",
+		Parent: "base",
+		Params: TemplateParamList{
+			{Name: "count", Type: TemplateParamInt},
+			{Name: "zone", Default: "a"},
+		},
+	}
+	err = tpl1.Save()
+	c.Assert(err, check.IsNil)
+	err = tpl1.UpdateWithOptions(&Template{}, TemplateUpdateOptions{
+		ClearParent:  true,
+		RemoveParams: []string{"zone", "pool"},
+	})
+	c.Assert(err, check.IsNil)
+	dbTpl, err := FindTemplate("tpl1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbTpl.Parent, check.Equals, "")
+	c.Assert(dbTpl.IaaSName, check.Equals, "test-iaas")
+	c.Assert(dbTpl.Params, check.DeepEquals, TemplateParamList{
+		{Name: "count", Type: TemplateParamInt},
+	})
+	err = DestroyTemplate("base")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestUpdateTemplateSetAndClearParent(c *check.C) {
+	tpl1 := Template{Name: "tpl1", IaaSName: "test-iaas"}
+	err := tpl1.Save()
+	c.Assert(err, check.IsNil)
+	err = tpl1.UpdateWithOptions(&Template{Parent: "base"}, TemplateUpdateOptions{ClearParent: true})
+	c.Assert(err, check.ErrorMatches, "cannot set and clear the template parent at the same time")
+}
+
+func (s *S) TestDestroyTemplateWithChildren(c *check.C) {
+	base := Template{Name: "base", IaaSName: "test-iaas"}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{Name: "child", Parent: "base"}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	err = DestroyTemplate("base")
+	c.Assert(err, check.ErrorMatches, `template "base" is extended by: child`)
+	err = DestroyTemplate("child")
+	c.Assert(err, check.IsNil)
+	err = DestroyTemplate("base")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestExpandTemplateWithParentAndParams(c *check.C) {
+	base := Template{
+		Name:     "base",
+		IaaSName: "test-iaas",
+		Data:     TemplateDataList{{Name: "key1", Value: "val1"}},
+		Params: TemplateParamList{
+			{Name: "pool", Required: true},
+			{Name: "count", Type: TemplateParamInt, Default: "1"},
+		},
+	}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{
+		Name:   "child",
+		Parent: "base",
+		Data:   TemplateDataList{{Name: "key2", Value: "val2"}},
+	}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	data, err := ExpandTemplate("child", map[string]string{"template": "child", "pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.DeepEquals, map[string]string{
+		"key1":  "val1",
+		"key2":  "val2",
+		"pool":  "pool1",
+		"count": "1",
+		"iaas":  "test-iaas",
+	})
+	_, err = ExpandTemplate("child", map[string]string{})
+	c.Assert(err, check.ErrorMatches, `invalid params for template "child": missing required params: pool`)
+	_, err = ExpandTemplate("child", map[string]string{"pool": "pool1", "count": "two"})
+	c.Assert(err, check.ErrorMatches, `invalid params for template "child": param "count" must be of type int, got "two"`)
+}
+
+func (s *S) TestTemplateValidate(c *check.C) {
+	validator := &TestValidatorIaaS{}
+	RegisterIaasProvider("validator-iaas", func(string) IaaS { return validator })
+	t := Template{
+		Name:     "tpl1",
+		IaaSName: "validator-iaas",
+		Data:     TemplateDataList{{Name: "type", Value: "m1.small"}},
+		Params: TemplateParamList{
+			{Name: "pool", Required: true},
+			{Name: "zone", Default: "a"},
+		},
+	}
+	err := t.Validate()
+	c.Assert(err, check.IsNil)
+	c.Assert(validator.params, check.DeepEquals, map[string]string{
+		"type": "m1.small",
+		"zone": "a",
+		"iaas": "validator-iaas",
+	})
+	validator.err = errors.New("invalid type")
+	err = t.Validate()
+	c.Assert(err, check.ErrorMatches, "invalid type")
+	_, err = FindTemplate("tpl1")
+	c.Assert(err, check.Equals, mgo.ErrNotFound)
+}
+
+func (s *S) TestTemplateParamListApply(c *check.C) {
+	params := TemplateParamList{
+		{Name: "count", Type: TemplateParamInt, Default: "2"},
+		{Name: "debug", Type: TemplateParamBool},
+		{Name: "pool", Required: true},
+	}
+	values := map[string]string{"debug": "true", "pool": "p1"}
+	err := params.apply(values, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(values, check.DeepEquals, map[string]string{"count": "2", "debug": "true", "pool": "p1"})
+	err = params.apply(map[string]string{"debug": "yes", "pool": "p1"}, true)
+	c.Assert(err, check.ErrorMatches, `param "debug" must be of type bool, got "yes"`)
+	err = params.apply(map[string]string{}, true)
+	c.Assert(err, check.ErrorMatches, "missing required params: pool")
+	err = params.apply(map[string]string{}, false)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestMergeTemplateParams(c *check.C) {
+	base := TemplateParamList{{Name: "b", Default: "1"}, {Name: "a"}}
+	c.Assert(mergeTemplateParams(base, nil), check.DeepEquals, base)
+	merged := mergeTemplateParams(base, TemplateParamList{{Name: "b", Default: "2"}, {Name: "c", Required: true}})
+	c.Assert(merged, check.DeepEquals, TemplateParamList{
+		{Name: "a"},
+		{Name: "b", Default: "2"},
+		{Name: "c", Required: true},
+	})
+}
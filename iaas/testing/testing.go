@@ -12,12 +12,14 @@ import (
 
 type TestHealerIaaS struct {
 	sync.Mutex
-	Addr   string
-	Err    error
-	DelErr error
-	Addrs  []string
-	Ports  []int
-	AddrId int
+	Addr      string
+	Err       error
+	DelErr    error
+	RebootErr error
+	Rebooted  []string
+	Addrs     []string
+	Ports     []int
+	AddrId    int
 }
 
 func NewHealerIaaSConstructor(addr string, err error) func(string) iaas.IaaS {
@@ -73,3 +75,13 @@ func (t *TestHealerIaaS) CreateMachine(params map[string]string) (*iaas.Machine,
 func (t *TestHealerIaaS) Describe() string {
 	return "iaas describe"
 }
+
+func (t *TestHealerIaaS) RebootMachine(m *iaas.Machine) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.RebootErr != nil {
+		return t.RebootErr
+	}
+	t.Rebooted = append(t.Rebooted, m.Id)
+	return nil
+}
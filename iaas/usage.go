@@ -0,0 +1,349 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TemplateMetadataName is the param holding the name of the template used to
+// create a machine, kept so machine usage can be accounted per template.
+const TemplateMetadataName = "iaas-template"
+
+var (
+	usageLabels = []string{"iaas", "pool", "template", "instance_type"}
+
+	machinesRunningDesc = prometheus.NewDesc("tsuru_iaas_machines_running", "The number of machines currently running.", usageLabels, nil)
+	hourlyCostDesc      = prometheus.NewDesc("tsuru_iaas_machines_hourly_cost", "The hourly cost of the machines currently running.", usageLabels, nil)
+	machineHoursDesc    = prometheus.NewDesc("tsuru_iaas_machine_hours_total", "The total number of machine-hours used.", usageLabels, nil)
+	costDesc            = prometheus.NewDesc("tsuru_iaas_machines_cost", "The cost of the machines used, according to the current hourly costs.", usageLabels, nil)
+
+	usageMetricsCacheTTL = time.Minute
+)
+
+func init() {
+	prometheus.MustRegister(&usageCollector{})
+}
+
+// MachineUsage records the lifetime of a machine, used to account the
+// machine-hours and cost of each pool and template. Records are kept after
+// the machine is destroyed.
+type MachineUsage struct {
+	ID           bson.ObjectId `bson:"_id"`
+	MachineID    string
+	IaaS         string
+	Pool         string
+	Template     string
+	InstanceType string
+	CreatedAt    time.Time
+	DestroyedAt  time.Time `bson:",omitempty"`
+}
+
+// UsageSummary aggregates the usage of machines in a period. Hours of
+// machines whose instance type has no cost configured are accounted in
+// UnpricedHours, besides Hours.
+type UsageSummary struct {
+	Name          string
+	Machines      int
+	Hours         float64
+	Cost          float64
+	UnpricedHours float64
+}
+
+// UsageReport holds the usage of machines between Since and Until.
+type UsageReport struct {
+	Since     time.Time
+	Until     time.Time
+	Pools     []UsageSummary
+	Templates []UsageSummary
+}
+
+// hours returns the number of hours the machine was alive between since
+// and until.
+func (u *MachineUsage) hours(since, until time.Time) float64 {
+	start, end := u.CreatedAt, until
+	if !u.DestroyedAt.IsZero() && u.DestroyedAt.Before(end) {
+		end = u.DestroyedAt
+	}
+	if start.Before(since) {
+		start = since
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start).Hours()
+}
+
+// Usage returns the machine-hours and cost of the machines alive between
+// since and until, aggregated by pool and by template. When iaasNames is not
+// empty, only machines in the given IaaSs are considered.
+func Usage(since, until time.Time, iaasNames []string) (*UsageReport, error) {
+	coll, err := usageCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	query := bson.M{
+		"createdat": bson.M{"$lt": until},
+		"$or": []bson.M{
+			{"destroyedat": bson.M{"$exists": false}},
+			{"destroyedat": bson.M{"$gt": since}},
+		},
+	}
+	if iaasNames != nil {
+		query["iaas"] = bson.M{"$in": iaasNames}
+	}
+	var usages []MachineUsage
+	err = coll.Find(query).All(&usages)
+	if err != nil {
+		return nil, err
+	}
+	pools := map[string]*UsageSummary{}
+	templates := map[string]*UsageSummary{}
+	for _, u := range usages {
+		hours := u.hours(since, until)
+		cost, priced := hourlyCost(u.IaaS, u.InstanceType)
+		for _, summary := range []*UsageSummary{getSummary(pools, u.Pool), getSummary(templates, u.Template)} {
+			summary.Machines++
+			summary.Hours += hours
+			if priced {
+				summary.Cost += hours * cost
+			} else {
+				summary.UnpricedHours += hours
+			}
+		}
+	}
+	return &UsageReport{
+		Since:     since,
+		Until:     until,
+		Pools:     sortedSummaries(pools),
+		Templates: sortedSummaries(templates),
+	}, nil
+}
+
+func getSummary(summaries map[string]*UsageSummary, name string) *UsageSummary {
+	summary, ok := summaries[name]
+	if !ok {
+		summary = &UsageSummary{Name: name}
+		summaries[name] = summary
+	}
+	return summary
+}
+
+func sortedSummaries(summaries map[string]*UsageSummary) []UsageSummary {
+	result := make([]UsageSummary, 0, len(summaries))
+	for _, s := range summaries {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// hourlyCost returns the cost per hour of the instance type in the IaaS,
+// according to its "hourly-cost" table. The "default" entry in the table is
+// used for instance types not listed.
+func hourlyCost(iaasName, instanceType string) (float64, bool) {
+	named := NamedIaaS{BaseIaaSName: providerName(iaasName), IaaSName: iaasName}
+	rawTable, err := named.GetConfig("hourly-cost")
+	if err != nil {
+		return 0, false
+	}
+	table, ok := rawTable.(map[interface{}]interface{})
+	if !ok {
+		return 0, false
+	}
+	value, ok := table[instanceType]
+	if !ok || instanceType == "" {
+		if value, ok = table["default"]; !ok {
+			return 0, false
+		}
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case string:
+		cost, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Errorf("invalid hourly cost %q for %q in iaas %s: %s", v, instanceType, iaasName, err)
+			return 0, false
+		}
+		return cost, true
+	}
+	return 0, false
+}
+
+func (m *Machine) recordCreation(iaas IaaS) {
+	var instanceType string
+	if typer, ok := iaas.(InstanceTyper); ok {
+		instanceType = typer.InstanceType(m.CreationParams)
+	}
+	coll, err := usageCollection()
+	if err != nil {
+		log.Errorf("unable to record usage of machine %s: %s", m.Id, err)
+		return
+	}
+	defer coll.Close()
+	err = coll.Insert(MachineUsage{
+		ID:           bson.NewObjectId(),
+		MachineID:    m.Id,
+		IaaS:         m.Iaas,
+		Pool:         m.CreationParams["pool"],
+		Template:     m.CreationParams[TemplateMetadataName],
+		InstanceType: instanceType,
+		CreatedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		log.Errorf("unable to record usage of machine %s: %s", m.Id, err)
+	}
+}
+
+func (m *Machine) recordDestruction() {
+	coll, err := usageCollection()
+	if err != nil {
+		log.Errorf("unable to record destruction of machine %s: %s", m.Id, err)
+		return
+	}
+	defer coll.Close()
+	_, err = coll.UpdateAll(bson.M{
+		"machineid":   m.Id,
+		"iaas":        m.Iaas,
+		"destroyedat": bson.M{"$exists": false},
+	}, bson.M{"$set": bson.M{"destroyedat": time.Now().UTC()}})
+	if err != nil {
+		log.Errorf("unable to record destruction of machine %s: %s", m.Id, err)
+	}
+}
+
+// usageCollector exposes the usage of machines. Metrics are aggregated by
+// the database and cached for usageMetricsCacheTTL, as scrapes would
+// otherwise go through every usage record.
+type usageCollector struct {
+	mu        sync.Mutex
+	metrics   []prometheus.Metric
+	updatedAt time.Time
+}
+
+func (c *usageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- machinesRunningDesc
+	ch <- hourlyCostDesc
+	ch <- machineHoursDesc
+	ch <- costDesc
+}
+
+func (c *usageCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.updatedAt) >= usageMetricsCacheTTL {
+		metrics, err := usageMetrics()
+		if err != nil {
+			log.Errorf("unable to collect iaas usage metrics: %s", err)
+		} else {
+			c.metrics = metrics
+			c.updatedAt = time.Now()
+		}
+	}
+	for _, m := range c.metrics {
+		ch <- m
+	}
+}
+
+type usageGroup struct {
+	ID struct {
+		IaaS         string `bson:"iaas"`
+		Pool         string `bson:"pool"`
+		Template     string `bson:"template"`
+		InstanceType string `bson:"instancetype"`
+	} `bson:"_id"`
+	Running      float64 `bson:"running"`
+	Milliseconds float64 `bson:"milliseconds"`
+}
+
+// usageMetrics aggregates the usage records by their labels. The cost is
+// computed with the current hourly-cost tables, which may change, so it's
+// exposed as a gauge.
+func usageMetrics() ([]prometheus.Metric, error) {
+	coll, err := usageCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	now := time.Now().UTC()
+	var groups []usageGroup
+	err = coll.Pipe([]bson.M{
+		{"$group": bson.M{
+			"_id": bson.M{
+				"iaas":         "$iaas",
+				"pool":         "$pool",
+				"template":     "$template",
+				"instancetype": "$instancetype",
+			},
+			"running": bson.M{"$sum": bson.M{
+				"$cond": []interface{}{bson.M{"$ifNull": []interface{}{"$destroyedat", false}}, 0, 1},
+			}},
+			"milliseconds": bson.M{"$sum": bson.M{
+				"$subtract": []interface{}{bson.M{"$ifNull": []interface{}{"$destroyedat", now}}, "$createdat"},
+			}},
+		}},
+	}).All(&groups)
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]prometheus.Metric, 0, len(groups)*4)
+	for _, g := range groups {
+		labels := []string{g.ID.IaaS, g.ID.Pool, g.ID.Template, g.ID.InstanceType}
+		hours := g.Milliseconds / float64(time.Hour/time.Millisecond)
+		cost, _ := hourlyCost(g.ID.IaaS, g.ID.InstanceType)
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(machinesRunningDesc, prometheus.GaugeValue, g.Running, labels...),
+			prometheus.MustNewConstMetric(hourlyCostDesc, prometheus.GaugeValue, g.Running*cost, labels...),
+			prometheus.MustNewConstMetric(machineHoursDesc, prometheus.CounterValue, hours, labels...),
+			prometheus.MustNewConstMetric(costDesc, prometheus.GaugeValue, hours*cost, labels...),
+		)
+	}
+	return metrics, nil
+}
+
+func usageCollection() (*storage.Collection, error) {
+	name, err := config.GetString("iaas:collection")
+	if err != nil {
+		name = "iaas_machines"
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection(name + "_usage")
+	for _, key := range []string{"machineid", "createdat", "destroyedat"} {
+		err = coll.EnsureIndexKey(key)
+		if err != nil {
+			coll.Close()
+			return nil, err
+		}
+	}
+	return coll, nil
+}
+
+func providerName(iaasName string) string {
+	name, err := config.GetString(fmt.Sprintf("iaas:custom:%s:provider", iaasName))
+	if err != nil {
+		return iaasName
+	}
+	return name
+}
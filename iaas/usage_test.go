@@ -0,0 +1,150 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestMachineUsageHours(c *check.C) {
+	base := time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC)
+	u := MachineUsage{CreatedAt: base.Add(2 * time.Hour)}
+	c.Assert(u.hours(base, base.Add(10*time.Hour)), check.Equals, 8.0)
+	c.Assert(u.hours(base.Add(4*time.Hour), base.Add(10*time.Hour)), check.Equals, 6.0)
+	c.Assert(u.hours(base, base.Add(time.Hour)), check.Equals, 0.0)
+	u.DestroyedAt = base.Add(5 * time.Hour)
+	c.Assert(u.hours(base, base.Add(10*time.Hour)), check.Equals, 3.0)
+	c.Assert(u.hours(base.Add(6*time.Hour), base.Add(10*time.Hour)), check.Equals, 0.0)
+}
+
+func (s *S) TestHourlyCost(c *check.C) {
+	config.Set("iaas:test-iaas:hourly-cost", map[interface{}]interface{}{
+		"small":   0.5,
+		"medium":  1,
+		"large":   "2.5",
+		"default": 0.25,
+	})
+	config.Set("iaas:custom:other-iaas:provider", "test-iaas")
+	config.Set("iaas:custom:other-iaas:hourly-cost", map[interface{}]interface{}{
+		"small": 0.75,
+	})
+	cost, ok := hourlyCost("test-iaas", "small")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(cost, check.Equals, 0.5)
+	cost, ok = hourlyCost("test-iaas", "medium")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(cost, check.Equals, 1.0)
+	cost, ok = hourlyCost("test-iaas", "large")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(cost, check.Equals, 2.5)
+	cost, ok = hourlyCost("test-iaas", "unknown")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(cost, check.Equals, 0.25)
+	cost, ok = hourlyCost("other-iaas", "small")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(cost, check.Equals, 0.75)
+	_, ok = hourlyCost("other-iaas", "medium")
+	c.Assert(ok, check.Equals, false)
+	_, ok = hourlyCost("unconfigured-iaas", "small")
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestCreateAndDestroyMachineRecordsUsage(c *check.C) {
+	m, err := CreateMachineForIaaS("test-iaas", map[string]string{
+		"id":                 "myid",
+		"pool":               "pool1",
+		TemplateMetadataName: "tpl1",
+	})
+	c.Assert(err, check.IsNil)
+	coll, err := usageCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	var usage MachineUsage
+	err = coll.Find(bson.M{"machineid": "myid"}).One(&usage)
+	c.Assert(err, check.IsNil)
+	c.Assert(usage.IaaS, check.Equals, "test-iaas")
+	c.Assert(usage.Pool, check.Equals, "pool1")
+	c.Assert(usage.Template, check.Equals, "tpl1")
+	c.Assert(usage.CreatedAt.IsZero(), check.Equals, false)
+	c.Assert(usage.DestroyedAt.IsZero(), check.Equals, true)
+	err = m.Destroy()
+	c.Assert(err, check.IsNil)
+	err = coll.Find(bson.M{"machineid": "myid"}).One(&usage)
+	c.Assert(err, check.IsNil)
+	c.Assert(usage.DestroyedAt.IsZero(), check.Equals, false)
+}
+
+func (s *S) TestUsage(c *check.C) {
+	config.Set("iaas:test-iaas:hourly-cost", map[interface{}]interface{}{"small": 2})
+	base := time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC)
+	coll, err := usageCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(
+		MachineUsage{ID: bson.NewObjectId(), MachineID: "m1", IaaS: "test-iaas", Pool: "p1", Template: "t1", InstanceType: "small", CreatedAt: base},
+		MachineUsage{ID: bson.NewObjectId(), MachineID: "m2", IaaS: "test-iaas", Pool: "p1", Template: "t2", InstanceType: "big", CreatedAt: base, DestroyedAt: base.Add(2 * time.Hour)},
+		MachineUsage{ID: bson.NewObjectId(), MachineID: "m3", IaaS: "test-iaas", Pool: "p2", Template: "t1", InstanceType: "small", CreatedAt: base.Add(-10 * time.Hour), DestroyedAt: base.Add(-time.Hour)},
+		MachineUsage{ID: bson.NewObjectId(), MachineID: "m4", IaaS: "other-iaas", Pool: "p2", Template: "t1", InstanceType: "small", CreatedAt: base},
+	)
+	c.Assert(err, check.IsNil)
+	report, err := Usage(base, base.Add(4*time.Hour), []string{"test-iaas"})
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Since.Equal(base), check.Equals, true)
+	c.Assert(report.Pools, check.DeepEquals, []UsageSummary{
+		{Name: "p1", Machines: 2, Hours: 6, Cost: 8, UnpricedHours: 2},
+	})
+	c.Assert(report.Templates, check.DeepEquals, []UsageSummary{
+		{Name: "t1", Machines: 1, Hours: 4, Cost: 8},
+		{Name: "t2", Machines: 1, Hours: 2, UnpricedHours: 2},
+	})
+	report, err = Usage(base, base.Add(4*time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Pools, check.HasLen, 2)
+	c.Assert(report.Pools[1], check.DeepEquals, UsageSummary{Name: "p2", Machines: 1, Hours: 4, UnpricedHours: 4})
+}
+
+func (s *S) TestUsageMetrics(c *check.C) {
+	config.Set("iaas:test-iaas:hourly-cost", map[interface{}]interface{}{"small": 0.5})
+	defer config.Unset("iaas:test-iaas:hourly-cost")
+	coll, err := usageCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	now := time.Now().UTC()
+	for _, u := range []MachineUsage{
+		{MachineID: "m1", CreatedAt: now.Add(-2 * time.Hour), DestroyedAt: now.Add(-time.Hour)},
+		{MachineID: "m2", CreatedAt: now.Add(-4 * time.Hour), DestroyedAt: now.Add(-2 * time.Hour)},
+		{MachineID: "m3", CreatedAt: now.Add(-time.Hour)},
+	} {
+		u.ID = bson.NewObjectId()
+		u.IaaS = "test-iaas"
+		u.Pool = "pool1"
+		u.InstanceType = "small"
+		err = coll.Insert(u)
+		c.Assert(err, check.IsNil)
+	}
+	metrics, err := usageMetrics()
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 4)
+	var values []float64
+	for _, m := range metrics {
+		var metric dto.Metric
+		err = m.Write(&metric)
+		c.Assert(err, check.IsNil)
+		if metric.Gauge != nil {
+			values = append(values, metric.Gauge.GetValue())
+		} else {
+			values = append(values, metric.Counter.GetValue())
+		}
+	}
+	c.Assert(values[0], check.Equals, 1.0)
+	c.Assert(values[1], check.Equals, 0.5)
+	c.Assert(values[2] >= 4.0 && values[2] < 4.1, check.Equals, true)
+	c.Assert(values[3] >= 2.0 && values[3] < 2.1, check.Equals, true)
+}
@@ -59,6 +59,16 @@ var (
 	}
 )
 
+// ParseContext builds a permission context from the name of its type and its
+// value.
+func ParseContext(ctxType, value string) (PermissionContext, error) {
+	t, err := parseContext(ctxType)
+	if err != nil {
+		return PermissionContext{}, err
+	}
+	return Context(t, value), nil
+}
+
 func parseContext(ctx string) (contextType, error) {
 	for _, t := range ContextTypes {
 		if string(t) == ctx {
@@ -125,3 +125,11 @@ func (s *S) TestGetTeamForPermissionGlobalMustSpecifyTeam(c *check.C) {
 	c.Assert(err, check.NotNil)
 	c.Assert(err, check.Equals, ErrTooManyTeams)
 }
+
+func (s *S) TestParseContext(c *check.C) {
+	ctx, err := ParseContext("team", "myteam")
+	c.Assert(err, check.IsNil)
+	c.Assert(ctx, check.Equals, Context(CtxTeam, "myteam"))
+	_, err = ParseContext("galaxy", "myteam")
+	c.Assert(err, check.ErrorMatches, `invalid context type "galaxy"`)
+}
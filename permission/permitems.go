@@ -33,6 +33,7 @@ var (
 	PermAppRun                           = PermissionRegistry.get("app.run")                             // [global app team pool]
 	PermAppRunShell                      = PermissionRegistry.get("app.run.shell")                       // [global app team pool]
 	PermAppUpdate                        = PermissionRegistry.get("app.update")                          // [global app team pool]
+	PermAppUpdateAutoscale               = PermissionRegistry.get("app.update.autoscale")                // [global app team pool]
 	PermAppUpdateBind                    = PermissionRegistry.get("app.update.bind")                     // [global app team pool]
 	PermAppUpdateCertificate             = PermissionRegistry.get("app.update.certificate")              // [global app team pool]
 	PermAppUpdateCertificateSet          = PermissionRegistry.get("app.update.certificate.set")          // [global app team pool]
@@ -41,8 +42,8 @@ var (
 	PermAppUpdateCnameAdd                = PermissionRegistry.get("app.update.cname.add")                // [global app team pool]
 	PermAppUpdateCnameRemove             = PermissionRegistry.get("app.update.cname.remove")             // [global app team pool]
 	PermAppUpdateDescription             = PermissionRegistry.get("app.update.description")              // [global app team pool]
-	PermAppUpdateTags                    = PermissionRegistry.get("app.update.tags")                     // [global app team pool]
 	PermAppUpdateEnv                     = PermissionRegistry.get("app.update.env")                      // [global app team pool]
+	PermAppUpdateEnvRestore              = PermissionRegistry.get("app.update.env.restore")              // [global app team pool]
 	PermAppUpdateEnvSet                  = PermissionRegistry.get("app.update.env.set")                  // [global app team pool]
 	PermAppUpdateEnvUnset                = PermissionRegistry.get("app.update.env.unset")                // [global app team pool]
 	PermAppUpdateEvents                  = PermissionRegistry.get("app.update.events")                   // [global app team pool]
@@ -57,6 +58,7 @@ var (
 	PermAppUpdateStart                   = PermissionRegistry.get("app.update.start")                    // [global app team pool]
 	PermAppUpdateStop                    = PermissionRegistry.get("app.update.stop")                     // [global app team pool]
 	PermAppUpdateSwap                    = PermissionRegistry.get("app.update.swap")                     // [global app team pool]
+	PermAppUpdateTags                    = PermissionRegistry.get("app.update.tags")                     // [global app team pool]
 	PermAppUpdateTeamowner               = PermissionRegistry.get("app.update.teamowner")                // [global app team pool]
 	PermAppUpdateUnbind                  = PermissionRegistry.get("app.update.unbind")                   // [global app team pool]
 	PermAppUpdateUnit                    = PermissionRegistry.get("app.update.unit")                     // [global app team pool]
@@ -137,6 +139,7 @@ var (
 	PermRoleDefaultDelete                = PermissionRegistry.get("role.default.delete")                 // [global]
 	PermRoleDelete                       = PermissionRegistry.get("role.delete")                         // [global]
 	PermRoleRead                         = PermissionRegistry.get("role.read")                           // [global]
+	PermRoleReadAudit                    = PermissionRegistry.get("role.read.audit")                     // [global]
 	PermRoleReadEvents                   = PermissionRegistry.get("role.read.events")                    // [global]
 	PermRoleUpdate                       = PermissionRegistry.get("role.update")                         // [global]
 	PermRoleUpdateAssign                 = PermissionRegistry.get("role.update.assign")                  // [global]
@@ -149,15 +152,21 @@ var (
 	PermServiceInstanceCreate            = PermissionRegistry.get("service-instance.create")             // [global team]
 	PermServiceInstanceDelete            = PermissionRegistry.get("service-instance.delete")             // [global service-instance team]
 	PermServiceInstanceRead              = PermissionRegistry.get("service-instance.read")               // [global service-instance team]
+	PermServiceInstanceReadBackups       = PermissionRegistry.get("service-instance.read.backups")       // [global service-instance team]
+	PermServiceInstanceReadBindings      = PermissionRegistry.get("service-instance.read.bindings")      // [global service-instance team]
 	PermServiceInstanceReadEvents        = PermissionRegistry.get("service-instance.read.events")        // [global service-instance team]
 	PermServiceInstanceReadStatus        = PermissionRegistry.get("service-instance.read.status")        // [global service-instance team]
 	PermServiceInstanceUpdate            = PermissionRegistry.get("service-instance.update")             // [global service-instance team]
+	PermServiceInstanceUpdateBackup      = PermissionRegistry.get("service-instance.update.backup")      // [global service-instance team]
 	PermServiceInstanceUpdateBind        = PermissionRegistry.get("service-instance.update.bind")        // [global service-instance team]
 	PermServiceInstanceUpdateDescription = PermissionRegistry.get("service-instance.update.description") // [global service-instance team]
-	PermServiceInstanceUpdateTags        = PermissionRegistry.get("service-instance.update.tags")        // [global service-instance team]
 	PermServiceInstanceUpdateGrant       = PermissionRegistry.get("service-instance.update.grant")       // [global service-instance team]
+	PermServiceInstanceUpdatePlan        = PermissionRegistry.get("service-instance.update.plan")        // [global service-instance team]
 	PermServiceInstanceUpdateProxy       = PermissionRegistry.get("service-instance.update.proxy")       // [global service-instance team]
+	PermServiceInstanceUpdateRestore     = PermissionRegistry.get("service-instance.update.restore")     // [global service-instance team]
 	PermServiceInstanceUpdateRevoke      = PermissionRegistry.get("service-instance.update.revoke")      // [global service-instance team]
+	PermServiceInstanceUpdateRotate      = PermissionRegistry.get("service-instance.update.rotate")      // [global service-instance team]
+	PermServiceInstanceUpdateTags        = PermissionRegistry.get("service-instance.update.tags")        // [global service-instance team]
 	PermServiceInstanceUpdateUnbind      = PermissionRegistry.get("service-instance.update.unbind")      // [global service-instance team]
 	PermServiceCreate                    = PermissionRegistry.get("service.create")                      // [global team]
 	PermServiceDelete                    = PermissionRegistry.get("service.delete")                      // [global service team]
@@ -166,6 +175,7 @@ var (
 	PermServiceReadEvents                = PermissionRegistry.get("service.read.events")                 // [global service team]
 	PermServiceReadPlans                 = PermissionRegistry.get("service.read.plans")                  // [global service team]
 	PermServiceUpdate                    = PermissionRegistry.get("service.update")                      // [global service team]
+	PermServiceUpdateCatalog             = PermissionRegistry.get("service.update.catalog")              // [global service team]
 	PermServiceUpdateDoc                 = PermissionRegistry.get("service.update.doc")                  // [global service team]
 	PermServiceUpdateGrantAccess         = PermissionRegistry.get("service.update.grant-access")         // [global service team]
 	PermServiceUpdateProxy               = PermissionRegistry.get("service.update.proxy")                // [global service team]
@@ -175,12 +185,17 @@ var (
 	PermTeamDelete                       = PermissionRegistry.get("team.delete")                         // [global team]
 	PermTeamRead                         = PermissionRegistry.get("team.read")                           // [global team]
 	PermTeamReadEvents                   = PermissionRegistry.get("team.read.events")                    // [global team]
+	PermTeamUpdate                       = PermissionRegistry.get("team.update")                         // [global team]
+	PermTeamUpdateQuota                  = PermissionRegistry.get("team.update.quota")                   // [global team]
 	PermUser                             = PermissionRegistry.get("user")                                // [global user]
 	PermUserCreate                       = PermissionRegistry.get("user.create")                         // [global]
 	PermUserDelete                       = PermissionRegistry.get("user.delete")                         // [global user]
 	PermUserRead                         = PermissionRegistry.get("user.read")                           // [global user]
 	PermUserReadEvents                   = PermissionRegistry.get("user.read.events")                    // [global user]
+	PermUserReadInactive                 = PermissionRegistry.get("user.read.inactive")                  // [global user]
 	PermUserUpdate                       = PermissionRegistry.get("user.update")                         // [global user]
+	PermUserUpdateDisable                = PermissionRegistry.get("user.update.disable")                 // [global user]
+	PermUserUpdateEnable                 = PermissionRegistry.get("user.update.enable")                  // [global user]
 	PermUserUpdateKey                    = PermissionRegistry.get("user.update.key")                     // [global user]
 	PermUserUpdateKeyAdd                 = PermissionRegistry.get("user.update.key.add")                 // [global user]
 	PermUserUpdateKeyRemove              = PermissionRegistry.get("user.update.key.remove")              // [global user]
@@ -188,4 +203,6 @@ var (
 	PermUserUpdateQuota                  = PermissionRegistry.get("user.update.quota")                   // [global user]
 	PermUserUpdateReset                  = PermissionRegistry.get("user.update.reset")                   // [global user]
 	PermUserUpdateToken                  = PermissionRegistry.get("user.update.token")                   // [global user]
+	PermUserUpdateTwoFactor              = PermissionRegistry.get("user.update.two-factor")              // [global user]
+	PermUserUpdateUnlock                 = PermissionRegistry.get("user.update.unlock")                  // [global user]
 )
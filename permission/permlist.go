@@ -19,8 +19,10 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.unit.remove",
 	"app.update.unit.register",
 	"app.update.unit.status",
+	"app.update.autoscale",
 	"app.update.env.set",
 	"app.update.env.unset",
+	"app.update.env.restore",
 	"app.update.restart",
 	"app.update.sleep",
 	"app.update.start",
@@ -92,6 +94,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 ).add(
 	"team.read.events",
 	"team.delete",
+	"team.update",
+	"team.update.quota",
 ).addWithCtx(
 	"user", []contextType{CtxUser},
 ).addWithCtx(
@@ -99,10 +103,15 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 ).add(
 	"user.delete",
 	"user.read.events",
+	"user.read.inactive",
 	"user.update.token",
 	"user.update.quota",
 	"user.update.password",
 	"user.update.reset",
+	"user.update.two-factor",
+	"user.update.disable",
+	"user.update.enable",
+	"user.update.unlock",
 	"user.update.key.add",
 	"user.update.key.remove",
 ).addWithCtx(
@@ -117,6 +126,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"service.update.revoke-access",
 	"service.update.grant-access",
 	"service.update.doc",
+	"service.update.catalog",
 	"service.delete",
 ).addWithCtx(
 	"service-instance", []contextType{CtxServiceInstance, CtxTeam},
@@ -125,6 +135,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 ).add(
 	"service-instance.read.events",
 	"service-instance.read.status",
+	"service-instance.read.bindings",
+	"service-instance.read.backups",
 	"service-instance.delete",
 	"service-instance.update.proxy",
 	"service-instance.update.bind",
@@ -133,10 +145,15 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"service-instance.update.revoke",
 	"service-instance.update.description",
 	"service-instance.update.tags",
+	"service-instance.update.plan",
+	"service-instance.update.rotate",
+	"service-instance.update.backup",
+	"service-instance.update.restore",
 ).add(
 	"role.create",
 	"role.delete",
 	"role.read.events",
+	"role.read.audit",
 	"role.update.assign",
 	"role.update.dissociate",
 	"role.update.permission.add",
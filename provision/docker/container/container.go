@@ -147,7 +147,10 @@ func (c *Container) Create(args *CreateArgs) error {
 		User:         user,
 		Labels:       labelSet.ToLabels(),
 	}
-	c.addEnvsToConfig(args, strings.TrimSuffix(c.ExposedPort, "/tcp"), &conf)
+	err = c.addEnvsToConfig(args, strings.TrimSuffix(c.ExposedPort, "/tcp"), &conf)
+	if err != nil {
+		return err
+	}
 	opts := docker.CreateContainerOptions{Name: c.Name, Config: &conf, HostConfig: hostConf}
 	var nodeList []string
 	if len(args.DestinationHosts) > 0 {
@@ -177,8 +180,11 @@ func (c *Container) Create(args *CreateArgs) error {
 	return nil
 }
 
-func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.Config) {
-	envs := provision.EnvsForApp(args.App, c.ProcessName, args.Deploy)
+func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.Config) error {
+	envs, err := provision.EnvsForApp(args.App, c.ProcessName, args.Deploy)
+	if err != nil {
+		return err
+	}
 	for _, envData := range envs {
 		cfg.Env = append(cfg.Env, fmt.Sprintf("%s=%s", envData.Name, envData.Value))
 	}
@@ -190,6 +196,7 @@ func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.C
 		}
 		cfg.Env = append(cfg.Env, fmt.Sprintf("TSURU_SHAREDFS_MOUNTPOINT=%s", sharedMount))
 	}
+	return nil
 }
 
 func (c *Container) user() string {
@@ -63,7 +63,10 @@ func randomString() string {
 }
 
 func (p *dockerProvisioner) archiveDeploy(app provision.App, image, archiveURL string, evt *event.Event) (string, error) {
-	commands := dockercommon.ArchiveDeployCmds(app, archiveURL)
+	commands, err := dockercommon.ArchiveDeployCmds(app, archiveURL)
+	if err != nil {
+		return "", err
+	}
 	return p.deployPipeline(app, image, commands, evt)
 }
 
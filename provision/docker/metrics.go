@@ -0,0 +1,70 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"sync"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"github.com/tsuru/tsuru/provision/dockercommon"
+)
+
+// UnitsMetrics returns the resource usage of the running containers of the
+// app. Containers in any other status are skipped.
+func (p *dockerProvisioner) UnitsMetrics(a provision.App) ([]provision.UnitMetrics, error) {
+	containers, err := p.listContainersByApp(a.GetName())
+	if err != nil {
+		return nil, err
+	}
+	var running []container.Container
+	for _, c := range containers {
+		if c.Status == provision.StatusStarted.String() {
+			running = append(running, c)
+		}
+	}
+	metrics := make([]provision.UnitMetrics, len(running))
+	errs := tsuruErrors.NewMultiError()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := range running {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m, err := p.containerMetrics(&running[i])
+			if err != nil {
+				mu.Lock()
+				errs.Add(err)
+				mu.Unlock()
+				return
+			}
+			metrics[i] = *m
+		}(i)
+	}
+	wg.Wait()
+	if errs.Len() > 0 {
+		return nil, errs
+	}
+	return metrics, nil
+}
+
+func (p *dockerProvisioner) containerMetrics(c *container.Container) (*provision.UnitMetrics, error) {
+	node, err := p.GetNodeByHost(c.HostAddr)
+	if err != nil {
+		return nil, err
+	}
+	client, err := node.Client()
+	if err != nil {
+		return nil, err
+	}
+	m, err := dockercommon.ContainerMetrics(client, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	m.ID = c.ID
+	m.Process = c.ProcessName
+	return m, nil
+}
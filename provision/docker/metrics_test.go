@@ -0,0 +1,37 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestProvisionerUnitsMetrics(c *check.C) {
+	cont, err := s.newContainer(&newContainerOpts{AppName: "myapp", ProcessName: "web", Status: provision.StatusStarted.String()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	stopped, err := s.newContainer(&newContainerOpts{AppName: "myapp", ProcessName: "web", Status: provision.StatusStopped.String()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(stopped)
+	s.server.PrepareStats(cont.ID, func(string) docker.Stats {
+		var stats docker.Stats
+		stats.MemoryStats.Usage = 1024
+		stats.PreCPUStats.CPUUsage.TotalUsage = 100
+		stats.PreCPUStats.SystemCPUUsage = 1000
+		stats.CPUStats.CPUUsage.TotalUsage = 300
+		stats.CPUStats.SystemCPUUsage = 2000
+		stats.CPUStats.CPUUsage.PercpuUsage = []uint64{150, 150}
+		return stats
+	})
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetrics{
+		{ID: cont.ID, Process: "web", CPU: 40, Memory: 1024},
+	})
+}
@@ -7,6 +7,7 @@ package docker
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -58,7 +59,19 @@ var (
 	ErrDeployCanceled = errors.New("deploy canceled by user action")
 )
 
-const provisionerName = "docker"
+const (
+	provisionerName        = "docker"
+	defaultRestartNodeWait = 5 * time.Minute
+)
+
+var (
+	// restartNodePingTimeout is how long RestartNode waits for the docker
+	// daemon to answer a ping before giving up on the node.
+	restartNodePingTimeout = 10 * time.Second
+	// nodeDownPollInterval is the interval between pings while waiting for
+	// a rebooted node to go down.
+	nodeDownPollInterval = 5 * time.Second
+)
 
 func init() {
 	mainDockerProvisioner = &dockerProvisioner{}
@@ -101,9 +114,11 @@ var (
 	_ provision.InitializableProvisioner = &dockerProvisioner{}
 	_ provision.OptionalLogsProvisioner  = &dockerProvisioner{}
 	_ provision.UnitStatusProvisioner    = &dockerProvisioner{}
+	_ provision.MetricsProvisioner       = &dockerProvisioner{}
 	_ provision.NodeProvisioner          = &dockerProvisioner{}
 	_ provision.NodeRebalanceProvisioner = &dockerProvisioner{}
 	_ provision.NodeContainerProvisioner = &dockerProvisioner{}
+	_ provision.NodeRestarter            = &dockerProvisioner{}
 	_ provision.UnitFinderProvisioner    = &dockerProvisioner{}
 	_ provision.AppFilterProvisioner     = &dockerProvisioner{}
 	_ provision.ExtensibleProvisioner    = &dockerProvisioner{}
@@ -1271,14 +1286,74 @@ func (p *dockerProvisioner) AddNode(opts provision.AddNodeOptions) error {
 	if err != nil {
 		return err
 	}
+	return p.enqueueNodeContainers(opts.Address, opts.Metadata, opts.WaitTO)
+}
+
+// RestartNode relaunches the node containers of the node, as done when the
+// node is added. The docker daemon itself is not restarted, so RestartNode
+// fails right away when the daemon doesn't respond, unless WaitNodeDown is
+// set, in which case it waits for the daemon to stop responding and then to
+// come back.
+func (p *dockerProvisioner) RestartNode(opts provision.RestartNodeOptions) error {
+	node, err := p.Cluster().GetNode(opts.Address)
+	if err != nil {
+		if err == clusterStorage.ErrNoSuchNode {
+			return provision.ErrNodeNotFound
+		}
+		return err
+	}
+	waitTO := opts.WaitTO
+	if waitTO == 0 {
+		waitTO = defaultRestartNodeWait
+	}
+	client, err := node.Client()
+	if err != nil {
+		return err
+	}
+	if opts.WaitNodeDown {
+		err = waitNodeDown(client, waitTO)
+		if err != nil {
+			return errors.Wrapf(err, "node %s", opts.Address)
+		}
+	} else {
+		err = pingNode(client)
+		if err != nil {
+			return errors.Wrapf(err, "docker daemon in node %s is not responding, unable to restart node containers", opts.Address)
+		}
+	}
+	if opts.Writer != nil {
+		fmt.Fprintf(opts.Writer, "restarting node containers in node %s\n", opts.Address)
+	}
+	return p.enqueueNodeContainers(node.Address, node.Metadata, waitTO)
+}
+
+func pingNode(client *docker.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), restartNodePingTimeout)
+	defer cancel()
+	return client.PingWithContext(ctx)
+}
+
+// waitNodeDown pings the node until it stops responding or timeout expires.
+func waitNodeDown(client *docker.Client, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for pingNode(client) == nil {
+		if time.Now().After(deadline) {
+			return errors.Errorf("still responding %s after reboot", timeout)
+		}
+		time.Sleep(nodeDownPollInterval)
+	}
+	return nil
+}
+
+func (p *dockerProvisioner) enqueueNodeContainers(address string, metadata map[string]string, waitTO time.Duration) error {
 	q, err := queue.Queue()
 	if err != nil {
 		return err
 	}
-	jobParams := monsterqueue.JobParams{"endpoint": opts.Address, "metadata": opts.Metadata}
+	jobParams := monsterqueue.JobParams{"endpoint": address, "metadata": metadata}
 	var job monsterqueue.Job
-	if opts.WaitTO != 0 {
-		job, err = q.EnqueueWait(internalNodeContainer.QueueTaskName, jobParams, opts.WaitTO)
+	if waitTO != 0 {
+		job, err = q.EnqueueWait(internalNodeContainer.QueueTaskName, jobParams, waitTO)
 	} else {
 		_, err = q.Enqueue(internalNodeContainer.QueueTaskName, jobParams)
 	}
@@ -3269,6 +3269,92 @@ func (s *S) TestAddNodeWithWait(c *check.C) {
 	c.Assert(nodes[0].CreationStatus, check.Equals, cluster.NodeCreationStatusCreated)
 }
 
+func (s *S) TestRestartNode(c *check.C) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer server.Stop()
+	var p dockerProvisioner
+	err = p.Initialize()
+	c.Assert(err, check.IsNil)
+	p.cluster, _ = cluster.New(nil, &cluster.MapStorage{})
+	mainDockerProvisioner = &p
+	err = p.Cluster().Register(cluster.Node{
+		Address:        server.URL(),
+		Metadata:       map[string]string{"pool": "pool1"},
+		CreationStatus: cluster.NodeCreationStatusCreated,
+	})
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = p.RestartNode(provision.RestartNodeOptions{
+		Address: server.URL(),
+		WaitTO:  time.Second,
+		Writer:  &buf,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "restarting node containers in node "+server.URL()+"\n")
+	nodes, err := p.Cluster().Nodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	c.Assert(nodes[0].Metadata["LastSuccess"], check.Not(check.Equals), "")
+	c.Assert(nodes[0].CreationStatus, check.Equals, cluster.NodeCreationStatusCreated)
+}
+
+func (s *S) TestRestartNodeNotResponding(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	var p dockerProvisioner
+	err := p.Initialize()
+	c.Assert(err, check.IsNil)
+	p.cluster, _ = cluster.New(nil, &cluster.MapStorage{})
+	err = p.Cluster().Register(cluster.Node{Address: server.URL, Metadata: map[string]string{"pool": "pool1"}})
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = p.RestartNode(provision.RestartNodeOptions{
+		Address: server.URL,
+		WaitTO:  time.Second,
+		Writer:  &buf,
+	})
+	c.Assert(err, check.ErrorMatches, `docker daemon in node .* is not responding, unable to restart node containers: .*`)
+	c.Assert(buf.String(), check.Equals, "")
+}
+
+func (s *S) TestWaitNodeDown(c *check.C) {
+	oldInterval := nodeDownPollInterval
+	nodeDownPollInterval = 10 * time.Millisecond
+	defer func() { nodeDownPollInterval = oldInterval }()
+	var pings int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&pings, 1) > 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	c.Assert(err, check.IsNil)
+	err = waitNodeDown(client, time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&pings), check.Equals, int32(4))
+}
+
+func (s *S) TestWaitNodeDownTimeout(c *check.C) {
+	oldInterval := nodeDownPollInterval
+	nodeDownPollInterval = 10 * time.Millisecond
+	defer func() { nodeDownPollInterval = oldInterval }()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	c.Assert(err, check.IsNil)
+	err = waitNodeDown(client, 50*time.Millisecond)
+	c.Assert(err, check.ErrorMatches, "still responding 50ms after reboot")
+}
+
+func (s *S) TestRestartNodeNotFound(c *check.C) {
+	err := s.p.RestartNode(provision.RestartNodeOptions{Address: "http://notfound:2375"})
+	c.Assert(err, check.Equals, provision.ErrNodeNotFound)
+}
+
 func (s *S) TestRemoveNode(c *check.C) {
 	var buf bytes.Buffer
 	nodes, err := s.p.Cluster().Nodes()
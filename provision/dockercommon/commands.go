@@ -14,21 +14,24 @@ import (
 )
 
 // provisioner deploys a unit using the archive method.
-func ArchiveDeployCmds(app provision.App, archiveURL string) []string {
+func ArchiveDeployCmds(app provision.App, archiveURL string) ([]string, error) {
 	return DeployCmds(app, "archive", archiveURL)
 }
 
-func DeployCmds(app provision.App, params ...string) []string {
+func DeployCmds(app provision.App, params ...string) ([]string, error) {
 	deployCmd, err := config.GetString("docker:deploy-cmd")
 	if err != nil {
 		deployCmd = "/var/lib/tsuru/deploy"
 	}
 	cmds := append([]string{deployCmd}, params...)
 	host, _ := config.GetString("host")
-	token := app.Envs()["TSURU_APP_TOKEN"].Value
+	token, err := provision.EnvValue(app, "TSURU_APP_TOKEN")
+	if err != nil {
+		return nil, err
+	}
 	unitAgentCmds := []string{"tsuru_unit_agent", host, token, app.GetName(), `"` + strings.Join(cmds, " ") + `"`, "deploy"}
 	finalCmd := strings.Join(unitAgentCmds, " ")
-	return []string{"/bin/sh", "-lc", finalCmd}
+	return []string{"/bin/sh", "-lc", finalCmd}, nil
 }
 
 // runWithAgentCmds returns the list of commands that should be passed when the
@@ -43,7 +46,10 @@ func runWithAgentCmds(app provision.App) ([]string, error) {
 		runCmd = "/var/lib/tsuru/start"
 	}
 	host, _ := config.GetString("host")
-	token := app.Envs()["TSURU_APP_TOKEN"].Value
+	token, err := provision.EnvValue(app, "TSURU_APP_TOKEN")
+	if err != nil {
+		return nil, err
+	}
 	return []string{"tsuru_unit_agent", host, token, app.GetName(), runCmd}, nil
 }
 
@@ -0,0 +1,47 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dockercommon
+
+import (
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+)
+
+var statsTimeout = 30 * time.Second
+
+// ContainerMetrics returns the resource usage of the container, according to
+// a single stats sample. Only CPU and Memory are set in the returned metrics.
+func ContainerMetrics(client *docker.Client, containerID string) (*provision.UnitMetrics, error) {
+	statsCh := make(chan *docker.Stats, 1)
+	err := client.Stats(docker.StatsOptions{
+		ID:      containerID,
+		Stats:   statsCh,
+		Stream:  false,
+		Timeout: statsTimeout,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get stats of container %s", containerID)
+	}
+	stats, ok := <-statsCh
+	if !ok || stats == nil {
+		return nil, errors.Errorf("no stats received for container %s", containerID)
+	}
+	m := &provision.UnitMetrics{
+		Memory: int64(stats.MemoryStats.Usage),
+	}
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpus := len(stats.CPUStats.CPUUsage.PercpuUsage)
+		if cpus == 0 {
+			cpus = 1
+		}
+		m.CPU = cpuDelta / systemDelta * float64(cpus) * 100
+	}
+	return m, nil
+}
@@ -7,8 +7,10 @@ package provision
 import (
 	"fmt"
 
+	"github.com/pkg/errors"
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
 )
 
 func WebProcessDefaultPort() string {
@@ -19,10 +21,18 @@ func WebProcessDefaultPort() string {
 	return fmt.Sprint(port)
 }
 
-func EnvsForApp(a App, process string, isDeploy bool) []bind.EnvVar {
+// EnvsForApp returns the environment variables of the units of the app,
+// decrypting the ones stored as secrets. Units must not be started without
+// their secrets, so an error is returned when any of them can't be decrypted.
+func EnvsForApp(a App, process string, isDeploy bool) ([]bind.EnvVar, error) {
 	var envs []bind.EnvVar
 	if !isDeploy {
 		for _, envData := range a.Envs() {
+			value, err := secret.Open(envData.Value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to decrypt env %s of app %s", envData.Name, a.GetName())
+			}
+			envData.Value = value
 			envs = append(envs, envData)
 		}
 		envs = append(envs, bind.EnvVar{Name: "TSURU_PROCESSNAME", Value: process})
@@ -36,5 +46,15 @@ func EnvsForApp(a App, process string, isDeploy bool) []bind.EnvVar {
 			{Name: "PORT", Value: port},
 		}...)
 	}
-	return envs
+	return envs, nil
+}
+
+// EnvValue returns the value of an environment variable of the app,
+// decrypting it when stored as a secret.
+func EnvValue(a App, name string) (string, error) {
+	value, err := secret.Open(a.Envs()[name].Value)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to decrypt env %s of app %s", name, a.GetName())
+	}
+	return value, nil
 }
@@ -7,6 +7,8 @@ package provision_test
 import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/app/secret/secrettest"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	"gopkg.in/check.v1"
@@ -27,7 +29,8 @@ func (s *S) TestWebProcessDefaultPortWithConfig(c *check.C) {
 func (s *S) TestEnvsForApp(c *check.C) {
 	a := provisiontest.NewFakeApp("myapp", "crystal", 1)
 	a.SetEnv(bind.EnvVar{Name: "e1", Value: "v1"})
-	envs := provision.EnvsForApp(a, "p1", false)
+	envs, err := provision.EnvsForApp(a, "p1", false)
+	c.Assert(err, check.IsNil)
 	c.Assert(envs, check.DeepEquals, []bind.EnvVar{
 		{Name: "e1", Value: "v1"},
 		{Name: "TSURU_PROCESSNAME", Value: "p1"},
@@ -35,7 +38,8 @@ func (s *S) TestEnvsForApp(c *check.C) {
 		{Name: "port", Value: "8888"},
 		{Name: "PORT", Value: "8888"},
 	})
-	envs = provision.EnvsForApp(a, "p1", true)
+	envs, err = provision.EnvsForApp(a, "p1", true)
+	c.Assert(err, check.IsNil)
 	c.Assert(envs, check.DeepEquals, []bind.EnvVar{
 		{Name: "TSURU_HOST", Value: ""},
 	})
@@ -48,7 +52,8 @@ func (s *S) TestEnvsForAppCustomConfig(c *check.C) {
 	defer config.Unset("docker:run-cmd:port")
 	a := provisiontest.NewFakeApp("myapp", "crystal", 1)
 	a.SetEnv(bind.EnvVar{Name: "e1", Value: "v1"})
-	envs := provision.EnvsForApp(a, "p1", false)
+	envs, err := provision.EnvsForApp(a, "p1", false)
+	c.Assert(err, check.IsNil)
 	c.Assert(envs, check.DeepEquals, []bind.EnvVar{
 		{Name: "e1", Value: "v1"},
 		{Name: "TSURU_PROCESSNAME", Value: "p1"},
@@ -56,8 +61,40 @@ func (s *S) TestEnvsForAppCustomConfig(c *check.C) {
 		{Name: "port", Value: "8989"},
 		{Name: "PORT", Value: "8989"},
 	})
-	envs = provision.EnvsForApp(a, "p1", true)
+	envs, err = provision.EnvsForApp(a, "p1", true)
+	c.Assert(err, check.IsNil)
 	c.Assert(envs, check.DeepEquals, []bind.EnvVar{
 		{Name: "TSURU_HOST", Value: "cloud.tsuru.io"},
 	})
 }
+
+func (s *S) TestEnvsForAppDecryptsSecrets(c *check.C) {
+	cleanup, err := secrettest.EnableLocalKey()
+	c.Assert(err, check.IsNil)
+	defer cleanup()
+	sealed, err := secret.Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "crystal", 1)
+	a.SetEnv(bind.EnvVar{Name: "e1", Value: sealed})
+	envs, err := provision.EnvsForApp(a, "p1", false)
+	c.Assert(err, check.IsNil)
+	c.Assert(envs[0], check.DeepEquals, bind.EnvVar{Name: "e1", Value: "s3cr3t"})
+	value, err := provision.EnvValue(a, "e1")
+	c.Assert(err, check.IsNil)
+	c.Assert(value, check.Equals, "s3cr3t")
+	c.Assert(a.Envs()["e1"].Value, check.Equals, sealed)
+}
+
+func (s *S) TestEnvsForAppUndecryptableSecret(c *check.C) {
+	cleanup, err := secrettest.EnableLocalKey()
+	c.Assert(err, check.IsNil)
+	sealed, err := secret.Seal("s3cr3t")
+	c.Assert(err, check.IsNil)
+	cleanup()
+	a := provisiontest.NewFakeApp("myapp", "crystal", 1)
+	a.SetEnv(bind.EnvVar{Name: "e1", Value: sealed})
+	_, err = provision.EnvsForApp(a, "p1", false)
+	c.Assert(err, check.ErrorMatches, "unable to decrypt env e1 of app myapp: .*")
+	_, err = provision.EnvValue(a, "e1")
+	c.Assert(err, check.ErrorMatches, "unable to decrypt env e1 of app myapp: .*")
+}
@@ -92,7 +92,10 @@ func createBuildPod(params buildPodParams) error {
 	}
 	buildImageLabel := &provision.LabelSet{}
 	buildImageLabel.SetBuildImage(params.destinationImage)
-	appEnvs := provision.EnvsForApp(params.app, "", true)
+	appEnvs, err := provision.EnvsForApp(params.app, "", true)
+	if err != nil {
+		return err
+	}
 	var envs []v1.EnvVar
 	for _, envData := range appEnvs {
 		envs = append(envs, v1.EnvVar{Name: envData.Name, Value: envData.Value})
@@ -161,7 +164,7 @@ func createBuildPod(params buildPodParams) error {
 	return nil
 }
 
-func extraRegisterCmds(a provision.App) string {
+func extraRegisterCmds(a provision.App) (string, error) {
 	host, _ := config.GetString("host")
 	if !strings.HasPrefix(host, "http") {
 		host = "http://" + host
@@ -169,8 +172,11 @@ func extraRegisterCmds(a provision.App) string {
 	if !strings.HasSuffix(host, "/") {
 		host += "/"
 	}
-	token := a.Envs()["TSURU_APP_TOKEN"].Value
-	return fmt.Sprintf(`curl -fsSL -m15 -XPOST -d"hostname=$(hostname)" -o/dev/null -H"Content-Type:application/x-www-form-urlencoded" -H"Authorization:bearer %s" %sapps/%s/units/register`, token, host, a.GetName())
+	token, err := provision.EnvValue(a, "TSURU_APP_TOKEN")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`curl -fsSL -m15 -XPOST -d"hostname=$(hostname)" -o/dev/null -H"Content-Type:application/x-www-form-urlencoded" -H"Authorization:bearer %s" %sapps/%s/units/register`, token, host, a.GetName()), nil
 }
 
 func probeFromHC(hc provision.TsuruYamlHealthcheck, port int) (*v1.Probe, error) {
@@ -240,12 +246,18 @@ func createAppDeployment(client kubernetes.Interface, oldDeployment *extensions.
 		restartCount++
 		labels.SetRestarts(restartCount)
 	}
-	extra := []string{extraRegisterCmds(a)}
-	cmds, _, err := dockercommon.LeanContainerCmdsWithExtra(process, imageName, a, extra)
+	registerCmds, err := extraRegisterCmds(a)
+	if err != nil {
+		return nil, err
+	}
+	cmds, _, err := dockercommon.LeanContainerCmdsWithExtra(process, imageName, a, []string{registerCmds})
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	appEnvs := provision.EnvsForApp(a, process, false)
+	appEnvs, err := provision.EnvsForApp(a, process, false)
+	if err != nil {
+		return nil, err
+	}
 	var envs []v1.EnvVar
 	for _, envData := range appEnvs {
 		envs = append(envs, v1.EnvVar{Name: envData.Name, Value: envData.Value})
@@ -0,0 +1,112 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+)
+
+// statsSummary holds the parts of the stats summary reported by kubelets
+// used as units metrics.
+type statsSummary struct {
+	Pods []podStats `json:"pods"`
+}
+
+type podStats struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"podRef"`
+	Containers []containerStats `json:"containers"`
+}
+
+type containerStats struct {
+	CPU struct {
+		UsageNanoCores uint64 `json:"usageNanoCores"`
+	} `json:"cpu"`
+	Memory struct {
+		WorkingSetBytes uint64 `json:"workingSetBytes"`
+	} `json:"memory"`
+}
+
+// nodeStatsSummary returns the stats summary of the kubelet running in the
+// node, through the API server proxy.
+var nodeStatsSummary = func(client kubernetes.Interface, nodeName string) (*statsSummary, error) {
+	data, err := client.Core().RESTClient().Get().
+		Resource("nodes").
+		Name(nodeName).
+		SubResource("proxy").
+		Suffix("stats/summary").
+		DoRaw()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get stats summary of node %s", nodeName)
+	}
+	var summary statsSummary
+	err = json.Unmarshal(data, &summary)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse stats summary of node %s", nodeName)
+	}
+	return &summary, nil
+}
+
+// UnitsMetrics returns the resource usage of the running pods of the app,
+// according to the stats summary of the nodes running them. Pods not yet
+// reported by their kubelet are skipped.
+func (p *kubernetesProvisioner) UnitsMetrics(a provision.App) ([]provision.UnitMetrics, error) {
+	client, err := getClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	l, err := provision.ServiceLabels(provision.ServiceLabelsOpts{App: a, Provisioner: provisionerName, Prefix: tsuruLabelPrefix})
+	if err != nil {
+		return nil, err
+	}
+	pods, err := client.Core().Pods(tsuruNamespace).List(v1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set(l.ToAppSelector())).String(),
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	podsStats := map[string]*podStats{}
+	summaries := map[string]bool{}
+	var metrics []provision.UnitMetrics
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodRunning || pod.Spec.NodeName == "" {
+			continue
+		}
+		if !summaries[pod.Spec.NodeName] {
+			summary, err := nodeStatsSummary(client, pod.Spec.NodeName)
+			if err != nil {
+				return nil, err
+			}
+			for i := range summary.Pods {
+				if summary.Pods[i].PodRef.Namespace == tsuruNamespace {
+					podsStats[summary.Pods[i].PodRef.Name] = &summary.Pods[i]
+				}
+			}
+			summaries[pod.Spec.NodeName] = true
+		}
+		stats, ok := podsStats[pod.Name]
+		if !ok {
+			continue
+		}
+		m := provision.UnitMetrics{
+			ID:      pod.Name,
+			Process: labelSetFromMeta(&pod.ObjectMeta).AppProcess(),
+		}
+		for _, cont := range stats.Containers {
+			m.CPU += float64(cont.CPU.UsageNanoCores) / 1e7
+			m.Memory += int64(cont.Memory.WorkingSetBytes)
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
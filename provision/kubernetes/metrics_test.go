@@ -0,0 +1,57 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func (s *S) TestUnitsMetrics(c *check.C) {
+	a, wait, rollback := s.defaultReactions(c)
+	defer rollback()
+	imgName := "myapp:v1"
+	err := image.SaveImageCustomData(imgName, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web":    "python myapp.py",
+			"worker": "myworker",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), imgName)
+	c.Assert(err, check.IsNil)
+	err = s.p.Start(a, "")
+	c.Assert(err, check.IsNil)
+	wait()
+	pod, err := s.client.Core().Pods(tsuruNamespace).Get("myapp-worker-pod-2-1")
+	c.Assert(err, check.IsNil)
+	pod.Status.Phase = v1.PodPending
+	_, err = s.client.Core().Pods(tsuruNamespace).Update(pod)
+	c.Assert(err, check.IsNil)
+	var nodes []string
+	oldNodeStatsSummary := nodeStatsSummary
+	defer func() { nodeStatsSummary = oldNodeStatsSummary }()
+	nodeStatsSummary = func(client kubernetes.Interface, nodeName string) (*statsSummary, error) {
+		nodes = append(nodes, nodeName)
+		summary := &statsSummary{Pods: make([]podStats, 2)}
+		for i, name := range []string{"myapp-web-pod-1-1", "myapp-worker-pod-2-1"} {
+			summary.Pods[i].PodRef.Name = name
+			summary.Pods[i].PodRef.Namespace = tsuruNamespace
+			summary.Pods[i].Containers = make([]containerStats, 1)
+			summary.Pods[i].Containers[0].CPU.UsageNanoCores = 250000000
+			summary.Pods[i].Containers[0].Memory.WorkingSetBytes = 1024
+		}
+		return summary, nil
+	}
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.DeepEquals, []string{"n1"})
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetrics{
+		{ID: "myapp-web-pod-1-1", Process: "web", CPU: 25, Memory: 1024},
+	})
+}
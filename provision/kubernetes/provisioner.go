@@ -48,6 +48,7 @@ var (
 	_ provision.ExecutableProvisioner    = &kubernetesProvisioner{}
 	_ provision.MessageProvisioner       = &kubernetesProvisioner{}
 	_ provision.SleepableProvisioner     = &kubernetesProvisioner{}
+	_ provision.MetricsProvisioner       = &kubernetesProvisioner{}
 	// _ provision.ArchiveDeployer          = &kubernetesProvisioner{}
 	// _ provision.ImageDeployer            = &kubernetesProvisioner{}
 	// _ provision.InitializableProvisioner = &kubernetesProvisioner{}
@@ -495,7 +496,10 @@ func (p *kubernetesProvisioner) UploadDeploy(a provision.App, archiveFile io.Rea
 		return "", err
 	}
 	defer cleanupPod(client, deployPodName)
-	cmds := dockercommon.ArchiveDeployCmds(a, "file:///home/application/archive.tar.gz")
+	cmds, err := dockercommon.ArchiveDeployCmds(a, "file:///home/application/archive.tar.gz")
+	if err != nil {
+		return "", err
+	}
 	if len(cmds) != 3 {
 		return "", errors.Errorf("unexpected cmds list: %#v", cmds)
 	}
@@ -627,7 +631,10 @@ func runPod(client kubernetes.Interface, a provision.App, out io.Writer, cmds []
 	if err != nil {
 		return err
 	}
-	appEnvs := provision.EnvsForApp(a, "", false)
+	appEnvs, err := provision.EnvsForApp(a, "", false)
+	if err != nil {
+		return err
+	}
 	var envs []v1.EnvVar
 	for _, envData := range appEnvs {
 		envs = append(envs, v1.EnvVar{Name: envData.Name, Value: envData.Value})
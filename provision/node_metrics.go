@@ -0,0 +1,59 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// NodeMetrics holds resource usage metrics reported by a node. CPU is the
+// percentage, from 0 to 100, of the node CPU in use.
+type NodeMetrics struct {
+	Address string `bson:"_id,omitempty"`
+	CPU     float64
+	Time    time.Time
+}
+
+// UpdateNodeMetrics stores the latest metrics reported by the node with the
+// given address. The time reported by the node is ignored, metrics are always
+// stored with the current server time, so that a node with a skewed clock
+// can't keep stale metrics looking fresh.
+func UpdateNodeMetrics(address string, metrics NodeMetrics) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	metrics.Address = ""
+	metrics.Time = time.Now().UTC()
+	_, err = conn.NodeMetrics().UpsertId(address, metrics)
+	return err
+}
+
+// NodeMetricsSince returns the metrics of the nodes with the given addresses
+// reported after since, indexed by node address.
+func NodeMetricsSince(addresses []string, since time.Time) (map[string]NodeMetrics, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var metrics []NodeMetrics
+	err = conn.NodeMetrics().Find(bson.M{
+		"_id":  bson.M{"$in": addresses},
+		"time": bson.M{"$gt": since},
+	}).All(&metrics)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]NodeMetrics, len(metrics))
+	for _, m := range metrics {
+		result[m.Address] = m
+	}
+	return result, nil
+}
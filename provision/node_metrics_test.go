@@ -0,0 +1,41 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestUpdateNodeMetrics(c *check.C) {
+	err := UpdateNodeMetrics("http://n1:2375", NodeMetrics{CPU: 42.5})
+	c.Assert(err, check.IsNil)
+	err = UpdateNodeMetrics("http://n1:2375", NodeMetrics{CPU: 50})
+	c.Assert(err, check.IsNil)
+	metrics, err := NodeMetricsSince([]string{"http://n1:2375", "http://n2:2375"}, time.Now().Add(-time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 1)
+	c.Assert(metrics["http://n1:2375"].CPU, check.Equals, 50.0)
+	metrics, err = NodeMetricsSince([]string{"http://n1:2375"}, time.Now())
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 0)
+}
+
+func (s *S) TestUpdateNodeMetricsIgnoresReportedTime(c *check.C) {
+	reported := time.Now().Add(time.Hour)
+	err := UpdateNodeMetrics("http://n1:2375", NodeMetrics{CPU: 10, Time: reported})
+	c.Assert(err, check.IsNil)
+	metrics, err := NodeMetricsSince([]string{"http://n1:2375"}, time.Now().Add(-time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 1)
+	c.Assert(metrics["http://n1:2375"].Time.Before(reported), check.Equals, true)
+	err = UpdateNodeMetrics("http://n2:2375", NodeMetrics{CPU: 10, Time: time.Now().Add(-time.Hour)})
+	c.Assert(err, check.IsNil)
+	metrics, err = NodeMetricsSince([]string{"http://n2:2375"}, time.Now().Add(-time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 1)
+	c.Assert(metrics["http://n2:2375"].CPU, check.Equals, 10.0)
+}
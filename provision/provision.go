@@ -380,6 +380,21 @@ type UnitStatusProvisioner interface {
 	SetUnitStatus(Unit, Status) error
 }
 
+// UnitMetrics holds the resource usage of a unit. CPU is the percentage of a
+// single CPU core in use and Memory the memory in use, in bytes.
+type UnitMetrics struct {
+	ID      string
+	Process string
+	CPU     float64
+	Memory  int64
+}
+
+// MetricsProvisioner is a provisioner able to report the resource usage of
+// the units of an app.
+type MetricsProvisioner interface {
+	UnitsMetrics(App) ([]UnitMetrics, error)
+}
+
 type AddNodeOptions struct {
 	Address    string
 	Metadata   map[string]string
@@ -435,6 +450,24 @@ type NodeRebalanceProvisioner interface {
 	RebalanceNodes(RebalanceNodesOptions) (bool, error)
 }
 
+type RestartNodeOptions struct {
+	Address string
+	WaitTO  time.Duration
+	Writer  io.Writer
+	// WaitNodeDown makes RestartNode wait for the node to stop responding
+	// before restarting its agents, used after the node machine is rebooted.
+	WaitNodeDown bool
+}
+
+// NodeRestarter is a provisioner able to restart the agents running on a
+// node, like the node containers, without replacing the node. It doesn't
+// restart the node daemons, so a node with a hung daemon can't be fixed by
+// it. RestartNode must only return after the node is responsive again or
+// WaitTO expires.
+type NodeRestarter interface {
+	RestartNode(RestartNodeOptions) error
+}
+
 type NodeContainerProvisioner interface {
 	UpgradeNodeContainer(name string, pool string, writer io.Writer) error
 	RemoveNodeContainer(name string, pool string, writer io.Writer) error
@@ -506,9 +539,10 @@ func NodeToJSON(n Node) ([]byte, error) {
 }
 
 type NodeStatusData struct {
-	Addrs  []string
-	Units  []UnitStatusData
-	Checks []NodeCheckResult
+	Addrs   []string
+	Units   []UnitStatusData
+	Checks  []NodeCheckResult
+	Metrics *NodeMetrics
 }
 
 type UnitStatusData struct {
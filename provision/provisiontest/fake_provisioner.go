@@ -30,7 +30,9 @@ var (
 	errNotProvisioned         = &provision.Error{Reason: "App is not provisioned."}
 	uniqueIpCounter     int32 = 0
 
-	_ provision.NodeProvisioner = &FakeProvisioner{}
+	_ provision.NodeProvisioner    = &FakeProvisioner{}
+	_ provision.MetricsProvisioner = &FakeProvisioner{}
+	_ provision.NodeRestarter      = &FakeProvisioner{}
 )
 
 const fakeAppImage = "app-image"
@@ -309,8 +311,14 @@ func (a *FakeApp) GetUnits() ([]bind.Unit, error) {
 	return units, nil
 }
 
-func (a *FakeApp) InstanceEnv(env string) map[string]bind.EnvVar {
-	return nil
+func (a *FakeApp) InstanceEnv(name string) map[string]bind.EnvVar {
+	envs := make(map[string]bind.EnvVar)
+	for k, env := range a.env {
+		if env.InstanceName == name {
+			envs[k] = env
+		}
+	}
+	return envs
 }
 
 // Env returns app.Env
@@ -396,13 +404,15 @@ func (p *FakeProvisioner) getError(method string) error {
 }
 
 type FakeNode struct {
-	Addr       string
-	PoolName   string
-	Meta       map[string]string
-	status     string
-	p          *FakeProvisioner
-	failures   int
-	hasSuccess bool
+	Addr        string
+	PoolName    string
+	Meta        map[string]string
+	status      string
+	p           *FakeProvisioner
+	failures    int
+	hasSuccess  bool
+	restarts    int
+	lastRestart provision.RestartNodeOptions
 }
 
 func (n *FakeNode) Pool() string {
@@ -451,6 +461,16 @@ func (n *FakeNode) Provisioner() provision.NodeProvisioner {
 	return n.p
 }
 
+// Restarts returns the number of times the node was restarted.
+func (n *FakeNode) Restarts() int {
+	return n.restarts
+}
+
+// LastRestartOptions returns the options of the last node restart.
+func (n *FakeNode) LastRestartOptions() provision.RestartNodeOptions {
+	return n.lastRestart
+}
+
 func (n *FakeNode) SetHealth(failures int, hasSuccess bool) {
 	n.failures = failures
 	n.hasSuccess = hasSuccess
@@ -516,6 +536,22 @@ func (p *FakeProvisioner) RemoveNode(opts provision.RemoveNodeOptions) error {
 	return nil
 }
 
+func (p *FakeProvisioner) RestartNode(opts provision.RestartNodeOptions) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if err := p.getError("RestartNode"); err != nil {
+		return err
+	}
+	n, ok := p.nodes[opts.Address]
+	if !ok {
+		return provision.ErrNodeNotFound
+	}
+	n.restarts++
+	n.lastRestart = opts
+	p.nodes[opts.Address] = n
+	return nil
+}
+
 func (p *FakeProvisioner) UpdateNode(opts provision.UpdateNodeOptions) error {
 	p.mut.Lock()
 	defer p.mut.Unlock()
@@ -1172,6 +1208,25 @@ func (p *FakeProvisioner) RoutableAddresses(app provision.App) ([]url.URL, error
 	return addrs, nil
 }
 
+// PrepareUnitsMetrics sets the metrics returned by UnitsMetrics for the
+// given app.
+func (p *FakeProvisioner) PrepareUnitsMetrics(app provision.App, metrics []provision.UnitMetrics) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	a := p.apps[app.GetName()]
+	a.metrics = metrics
+	p.apps[app.GetName()] = a
+}
+
+func (p *FakeProvisioner) UnitsMetrics(app provision.App) ([]provision.UnitMetrics, error) {
+	if err := p.getError("UnitsMetrics"); err != nil {
+		return nil, err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.apps[app.GetName()].metrics, nil
+}
+
 func (p *FakeProvisioner) SetUnitStatus(unit provision.Unit, status provision.Status) error {
 	p.mut.Lock()
 	defer p.mut.Unlock()
@@ -1489,6 +1544,7 @@ type provisionedApp struct {
 	unitLen     int
 	lastData    map[string]interface{}
 	image       string
+	metrics     []provision.UnitMetrics
 }
 
 type provisionedPlatform struct {
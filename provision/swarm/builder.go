@@ -68,7 +68,10 @@ func (p *swarmProvisioner) buildImage(app provision.App, archiveFile io.ReadClos
 			fmt.Sprintf("node.id == %s", tasks[0].NodeID),
 		},
 	}
-	cmds := dockercommon.ArchiveDeployCmds(app, fileURI)
+	cmds, err := dockercommon.ArchiveDeployCmds(app, fileURI)
+	if err != nil {
+		return "", err
+	}
 	srvID, task, err := runOnceCmds(client, opts, cmds, evt, evt)
 	if srvID != "" {
 		defer removeServiceAndLog(client, srvID)
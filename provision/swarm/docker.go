@@ -296,7 +296,7 @@ type tsuruServiceOpts struct {
 	constraints   []string
 }
 
-func extraRegisterCmds(app provision.App) string {
+func extraRegisterCmds(app provision.App) (string, error) {
 	host, _ := config.GetString("host")
 	if !strings.HasPrefix(host, "http") {
 		host = "http://" + host
@@ -304,18 +304,23 @@ func extraRegisterCmds(app provision.App) string {
 	if !strings.HasSuffix(host, "/") {
 		host += "/"
 	}
-	token := app.Envs()["TSURU_APP_TOKEN"].Value
-	return fmt.Sprintf(`curl -fsSL -m15 -XPOST -d"hostname=$(hostname)" -o/dev/null -H"Content-Type:application/x-www-form-urlencoded" -H"Authorization:bearer %s" %sapps/%s/units/register`, token, host, app.GetName())
+	token, err := provision.EnvValue(app, "TSURU_APP_TOKEN")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`curl -fsSL -m15 -XPOST -d"hostname=$(hostname)" -o/dev/null -H"Content-Type:application/x-www-form-urlencoded" -H"Authorization:bearer %s" %sapps/%s/units/register`, token, host, app.GetName()), nil
 }
 
 func serviceSpecForApp(opts tsuruServiceOpts) (*swarm.ServiceSpec, error) {
 	var envs []string
-	appEnvs := provision.EnvsForApp(opts.app, opts.process, opts.isDeploy)
+	appEnvs, err := provision.EnvsForApp(opts.app, opts.process, opts.isDeploy)
+	if err != nil {
+		return nil, err
+	}
 	for _, envData := range appEnvs {
 		envs = append(envs, fmt.Sprintf("%s=%s", envData.Name, envData.Value))
 	}
 	var cmds []string
-	var err error
 	var endpointSpec *swarm.EndpointSpec
 	var networks []swarm.NetworkAttachmentConfig
 	var healthConfig *container.HealthConfig
@@ -331,8 +336,12 @@ func serviceSpecForApp(opts tsuruServiceOpts) (*swarm.ServiceSpec, error) {
 		networks = []swarm.NetworkAttachmentConfig{
 			{Target: networkNameForApp(opts.app)},
 		}
-		extra := []string{extraRegisterCmds(opts.app)}
-		cmds, _, err = dockercommon.LeanContainerCmdsWithExtra(opts.process, opts.image, opts.app, extra)
+		var registerCmds string
+		registerCmds, err = extraRegisterCmds(opts.app)
+		if err != nil {
+			return nil, err
+		}
+		cmds, _, err = dockercommon.LeanContainerCmdsWithExtra(opts.process, opts.image, opts.app, []string{registerCmds})
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -0,0 +1,54 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swarm
+
+import (
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/dockercommon"
+)
+
+// UnitsMetrics returns the resource usage of the running tasks of the app,
+// read from the stats of their containers in the nodes running them.
+func (p *swarmProvisioner) UnitsMetrics(a provision.App) ([]provision.UnitMetrics, error) {
+	client, err := chooseDBSwarmNode()
+	if err != nil {
+		if errors.Cause(err) == errNoSwarmNode {
+			return nil, nil
+		}
+		return nil, err
+	}
+	tasks, err := runningTasksForApp(client, a, "")
+	if err != nil {
+		return nil, err
+	}
+	nodeClients := map[string]*docker.Client{}
+	var metrics []provision.UnitMetrics
+	for _, t := range tasks {
+		containerID := t.Status.ContainerStatus.ContainerID
+		if t.Status.State != swarm.TaskStateRunning || containerID == "" {
+			continue
+		}
+		nodeClient, ok := nodeClients[t.NodeID]
+		if !ok {
+			nodeClient, err = clientForNode(client, t.NodeID)
+			if err != nil {
+				return nil, err
+			}
+			nodeClients[t.NodeID] = nodeClient
+		}
+		m, err := dockercommon.ContainerMetrics(nodeClient, containerID)
+		if err != nil {
+			return nil, err
+		}
+		labels := provision.LabelSet{Labels: t.Spec.ContainerSpec.Labels, Prefix: tsuruLabelPrefix}
+		m.ID = t.ID
+		m.Process = labels.AppProcess()
+		metrics = append(metrics, *m)
+	}
+	return metrics, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swarm
+
+import (
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestUnitsMetrics(c *check.C) {
+	srv, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer srv.Stop()
+	err = s.p.AddNode(provision.AddNodeOptions{Address: srv.URL()})
+	c.Assert(err, check.IsNil)
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name, Deploys: 1}
+	err = app.CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	imgName := "myapp:v1"
+	err = image.SaveImageCustomData(imgName, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), imgName)
+	c.Assert(err, check.IsNil)
+	err = s.p.AddUnits(a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	client, err := docker.NewClient(srv.URL())
+	c.Assert(err, check.IsNil)
+	for i, u := range units {
+		task, err := client.InspectTask(u.ID)
+		c.Assert(err, check.IsNil)
+		task.DesiredState = swarm.TaskStateRunning
+		if i == 0 {
+			task.Status.State = swarm.TaskStateRunning
+		}
+		err = srv.MutateTask(task.ID, *task)
+		c.Assert(err, check.IsNil)
+		srv.PrepareStats(task.Status.ContainerStatus.ContainerID, func(string) docker.Stats {
+			var stats docker.Stats
+			stats.MemoryStats.Usage = 2048
+			stats.PreCPUStats.CPUUsage.TotalUsage = 100
+			stats.PreCPUStats.SystemCPUUsage = 1000
+			stats.CPUStats.CPUUsage.TotalUsage = 200
+			stats.CPUStats.SystemCPUUsage = 2000
+			return stats
+		})
+	}
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetrics{
+		{ID: units[0].ID, Process: "web", CPU: 10, Memory: 2048},
+	})
+}
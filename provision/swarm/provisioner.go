@@ -47,6 +47,7 @@ var (
 	_ provision.NodeProvisioner          = &swarmProvisioner{}
 	_ provision.NodeContainerProvisioner = &swarmProvisioner{}
 	_ provision.SleepableProvisioner     = &swarmProvisioner{}
+	_ provision.MetricsProvisioner       = &swarmProvisioner{}
 	// _ provision.RollbackableDeployer     = &swarmProvisioner{}
 	// _ provision.RebuildableDeployer      = &swarmProvisioner{}
 	// _ provision.OptionalLogsProvisioner  = &swarmProvisioner{}
@@ -610,7 +611,10 @@ func (p *swarmProvisioner) ArchiveDeploy(a provision.App, archiveURL string, evt
 	if err != nil {
 		return "", err
 	}
-	cmds := dockercommon.ArchiveDeployCmds(a, archiveURL)
+	cmds, err := dockercommon.ArchiveDeployCmds(a, archiveURL)
+	if err != nil {
+		return "", err
+	}
 	srvID, task, err := runOnceBuildCmds(client, a, cmds, baseImage, buildingImage, evt)
 	if srvID != "" {
 		defer removeServiceAndLog(client, srvID)
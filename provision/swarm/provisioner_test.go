@@ -1275,12 +1275,14 @@ func (s *S) TestUploadDeploy(c *check.C) {
 	c.Assert(err, check.IsNil)
 	cont, err := cli.InspectContainer(task.Status.ContainerStatus.ContainerID)
 	c.Assert(err, check.IsNil)
+	registerCmds, err := extraRegisterCmds(a)
+	c.Assert(err, check.IsNil)
 	c.Assert(cont.Config.Entrypoint, check.DeepEquals, []string{
 		"/bin/sh",
 		"-lc",
 		fmt.Sprintf(
 			"[ -d /home/application/current ] && cd /home/application/current; %s && exec python myapp.py",
-			extraRegisterCmds(a),
+			registerCmds,
 		),
 	})
 }
@@ -1322,12 +1324,14 @@ func (s *S) TestArchiveDeploy(c *check.C) {
 	c.Assert(err, check.IsNil)
 	cont, err := cli.InspectContainer(task.Status.ContainerStatus.ContainerID)
 	c.Assert(err, check.IsNil)
+	registerCmds, err := extraRegisterCmds(a)
+	c.Assert(err, check.IsNil)
 	c.Assert(cont.Config.Entrypoint, check.DeepEquals, []string{
 		"/bin/sh",
 		"-lc",
 		fmt.Sprintf(
 			"[ -d /home/application/current ] && cd /home/application/current; %s && exec python myapp.py",
-			extraRegisterCmds(a),
+			registerCmds,
 		),
 	})
 }
@@ -1374,12 +1378,14 @@ func (s *S) TestDeployServiceBind(c *check.C) {
 	c.Assert(err, check.IsNil)
 	task, err := cli.InspectTask(units[0].ID)
 	c.Assert(err, check.IsNil)
+	registerCmds, err := extraRegisterCmds(a)
+	c.Assert(err, check.IsNil)
 	c.Assert(task.Spec.ContainerSpec.Command, check.DeepEquals, []string{
 		"/bin/sh",
 		"-lc",
 		fmt.Sprintf(
 			"[ -d /home/application/current ] && cd /home/application/current; %s && exec python myapp.py",
-			extraRegisterCmds(a),
+			registerCmds,
 		),
 	})
 	c.Assert(serviceBodies, check.HasLen, 1)
@@ -1439,12 +1445,14 @@ func (s *S) TestImageDeploy(c *check.C) {
 	c.Assert(err, check.IsNil)
 	cont, err := cli.InspectContainer(task.Status.ContainerStatus.ContainerID)
 	c.Assert(err, check.IsNil)
+	registerCmds, err := extraRegisterCmds(a)
+	c.Assert(err, check.IsNil)
 	c.Assert(cont.Config.Entrypoint, check.DeepEquals, []string{
 		"/bin/sh",
 		"-lc",
 		fmt.Sprintf(
 			"[ -d /home/application/current ] && cd /home/application/current; %s && exec $0 \"$@\"",
-			extraRegisterCmds(a),
+			registerCmds,
 		),
 		"/bin/sh", "-c", "python test.py",
 	})
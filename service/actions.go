@@ -7,6 +7,7 @@ package service
 import (
 	"io"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/tsuru/tsuru/action"
@@ -75,11 +76,16 @@ var createServiceInstance = action.Action{
 
 // insertServiceInstance is an action that inserts an instance in the database.
 //
-// The first argument in the context must be a Service Instance.
+// The instance returned by the previous action is preferred, as it carries
+// the provisioning state reported by the service API, otherwise the second
+// argument in the context must be a ServiceInstance.
 var insertServiceInstance = action.Action{
 	Name: "insert-service-instance",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
-		instance, ok := ctx.Params[1].(ServiceInstance)
+		instance, ok := ctx.Previous.(ServiceInstance)
+		if !ok {
+			instance, ok = ctx.Params[1].(ServiceInstance)
+		}
 		if !ok {
 			return nil, errors.New("Second parameter must be a ServiceInstance.")
 		}
@@ -88,6 +94,9 @@ var insertServiceInstance = action.Action{
 			return nil, err
 		}
 		defer conn.Close()
+		if instance.State == InstanceStatePending {
+			instance.ProvisionLockUpdateTime = time.Now().UTC()
+		}
 		return nil, conn.ServiceInstances().Insert(&instance)
 	},
 	Backward: func(ctx action.BWContext) {
@@ -133,6 +142,10 @@ var bindAppDBAction = &action.Action{
 			}
 			return nil, err
 		}
+		_, err = si.addBinding(args.app.GetName())
+		if err != nil {
+			return nil, err
+		}
 		return nil, nil
 	},
 	Backward: func(ctx action.BWContext) {
@@ -140,6 +153,9 @@ var bindAppDBAction = &action.Action{
 		if err := args.serviceInstance.updateData(bson.M{"$pull": bson.M{"apps": args.app.GetName()}}); err != nil {
 			log.Errorf("[bind-app-db backward] could not remove app from service instance: %s", err)
 		}
+		if err := args.serviceInstance.removeBinding(args.app.GetName()); err != nil {
+			log.Errorf("[bind-app-db backward] could not remove binding from service instance: %s", err)
+		}
 	},
 	MinParams: 1,
 }
@@ -155,7 +171,15 @@ var bindAppEndpointAction = &action.Action{
 		if err != nil {
 			return nil, err
 		}
-		return endpoint.BindApp(args.serviceInstance, args.app)
+		envs, err := endpoint.BindApp(args.serviceInstance, args.app)
+		if err != nil {
+			return nil, err
+		}
+		err = args.serviceInstance.setBindingCredentials(args.app.GetName(), envs)
+		if err != nil {
+			log.Errorf("[bind-app-endpoint] could not record binding credentials: %s", err)
+		}
+		return envs, nil
 	},
 	Backward: func(ctx action.BWContext) {
 		args, _ := ctx.Params[0].(*bindPipelineArgs)
@@ -316,11 +340,16 @@ var unbindAppDB = action.Action{
 		if args == nil {
 			return nil, errors.New("invalid arguments for pipeline, expected *bindPipelineArgs")
 		}
-		return nil, args.serviceInstance.updateData(bson.M{"$pull": bson.M{"apps": args.app.GetName()}})
+		update := bson.M{"$pull": bson.M{"apps": args.app.GetName(), "bindings": bson.M{"app": args.app.GetName()}}}
+		return nil, args.serviceInstance.updateData(update)
 	},
 	Backward: func(ctx action.BWContext) {
 		args, _ := ctx.Params[0].(*bindPipelineArgs)
-		err := args.serviceInstance.updateData(bson.M{"$addToSet": bson.M{"apps": args.app.GetName()}})
+		update := bson.M{"$addToSet": bson.M{"apps": args.app.GetName()}}
+		if b := args.serviceInstance.BindingFor(args.app.GetName()); b != nil {
+			update["$push"] = bson.M{"bindings": *b}
+		}
+		err := args.serviceInstance.updateData(update)
 		if err != nil {
 			log.Errorf("[unbind-app-db backward] failed to rebind app in db: %s", err)
 		}
@@ -0,0 +1,50 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "time"
+
+// Backup represents a snapshot of a service instance kept by the service
+// API. Services are not required to support backups.
+type Backup struct {
+	ID          string
+	Description string
+	Status      string
+	Size        int64
+	CreatedAt   time.Time
+}
+
+// ListBackups returns the backups of the instance.
+func (si *ServiceInstance) ListBackups(requestID string) ([]Backup, error) {
+	endpoint, err := si.Service().getClient("production")
+	if err != nil {
+		return nil, err
+	}
+	return endpoint.ListBackups(si, requestID)
+}
+
+// CreateBackup asks the service API for a new backup of the instance.
+func (si *ServiceInstance) CreateBackup(description, requestID string) (*Backup, error) {
+	if err := si.CheckReady(); err != nil {
+		return nil, err
+	}
+	endpoint, err := si.Service().getClient("production")
+	if err != nil {
+		return nil, err
+	}
+	return endpoint.CreateBackup(si, description, requestID)
+}
+
+// RestoreBackup restores the instance from one of its backups.
+func (si *ServiceInstance) RestoreBackup(backupID, requestID string) error {
+	if err := si.CheckReady(); err != nil {
+		return err
+	}
+	endpoint, err := si.Service().getClient("production")
+	if err != nil {
+		return err
+	}
+	return endpoint.RestoreBackup(si, backupID, requestID)
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestListBackups(c *check.C) {
+	var path, method string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, method = r.URL.Path, r.Method
+		w.Write([]byte(`[{"id": "b1", "description": "before deploy", "status": "done", "size": 1024, "createdat": "2017-05-01T10:00:00Z"}]`))
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	backups, err := client.ListBackups(&instance, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(path, check.Equals, "/resources/my-redis/backups")
+	c.Assert(method, check.Equals, "GET")
+	c.Assert(backups, check.DeepEquals, []Backup{
+		{ID: "b1", Description: "before deploy", Status: "done", Size: 1024, CreatedAt: time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)},
+	})
+}
+
+func (s *S) TestListBackupsNotSupported(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(notFoundHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	_, err := client.ListBackups(&instance, "")
+	c.Assert(err, check.Equals, ErrBackupNotSupported)
+}
+
+func (s *S) TestCreateBackup(c *check.C) {
+	var path, method string
+	var form url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		path, method, form = r.URL.Path, r.Method, r.PostForm
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "b2", "status": "running"}`))
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	backup, err := client.CreateBackup(&instance, "before deploy", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(backup, check.DeepEquals, &Backup{ID: "b2", Status: "running"})
+	c.Assert(path, check.Equals, "/resources/my-redis/backups")
+	c.Assert(method, check.Equals, "POST")
+	c.Assert(map[string][]string(form), check.DeepEquals, map[string][]string{"description": {"before deploy"}})
+}
+
+func (s *S) TestRestoreBackup(c *check.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.RestoreBackup(&instance, "b1", "")
+	c.Assert(err, check.IsNil)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(h.url, check.Equals, "/resources/my-redis/backups/b1/restore")
+	c.Assert(h.method, check.Equals, "POST")
+}
+
+func (s *S) TestRestoreBackupNotFound(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(notFoundHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.RestoreBackup(&instance, "b1", "")
+	c.Assert(err, check.Equals, ErrBackupNotFound)
+}
+
+func (s *S) TestBrokerClientBackupsNotSupported(c *check.C) {
+	client := &brokerClient{serviceName: "mysql", endpoint: "http://localhost:1"}
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql"}
+	_, err := client.ListBackups(&instance, "")
+	c.Assert(err, check.Equals, ErrBackupNotSupported)
+	_, err = client.CreateBackup(&instance, "", "")
+	c.Assert(err, check.Equals, ErrBackupNotSupported)
+	err = client.RestoreBackup(&instance, "b1", "")
+	c.Assert(err, check.Equals, ErrBackupNotSupported)
+}
+
+func (s *InstanceSuite) TestCreateBackupInstanceNotReady(c *check.C) {
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": "http://localhost:1"}}
+	err := s.conn.Services().Insert(&srvc)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().RemoveId(srvc.Name)
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", State: InstanceStatePending}
+	err = s.conn.ServiceInstances().Insert(&instance)
+	c.Assert(err, check.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": instance.Name})
+	_, err = instance.CreateBackup("", "")
+	c.Assert(err, check.Equals, ErrInstanceNotReady)
+	err = instance.RestoreBackup("b1", "")
+	c.Assert(err, check.Equals, ErrInstanceNotReady)
+}
@@ -5,11 +5,14 @@
 package service
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app/bind"
@@ -342,3 +345,302 @@ func (s *BindSuite) TestUnbindReturnsPreconditionFailedIfTheAppIsNotBoundToTheIn
 	err = instance.UnbindApp(app, true, nil)
 	c.Assert(err, check.Equals, ErrAppNotBound)
 }
+
+func (s *BindSuite) TestBindAppCreatesBindingWithOwnCredentials(c *check.C) {
+	var bindingIDs []string
+	var counter int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/my-mysql/bind-app" {
+			r.ParseForm()
+			bindingIDs = append(bindingIDs, r.Form.Get("binding-id"))
+			n := atomic.AddInt32(&counter, 1)
+			w.Write([]byte(fmt.Sprintf(`{"DATABASE_USER":"user%d","DATABASE_PASSWORD":"s3cr3t%d"}`, n, n)))
+		}
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	app1 := provisiontest.NewFakeApp("painkiller", "python", 0)
+	app2 := provisiontest.NewFakeApp("nightcrawler", "python", 0)
+	err = instance.BindApp(app1, false, nil)
+	c.Assert(err, check.IsNil)
+	err = instance.BindApp(app2, false, nil)
+	c.Assert(err, check.IsNil)
+	var dbInstance ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&dbInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.Bindings, check.HasLen, 2)
+	b1 := dbInstance.BindingFor("painkiller")
+	b2 := dbInstance.BindingFor("nightcrawler")
+	c.Assert(b1, check.NotNil)
+	c.Assert(b2, check.NotNil)
+	c.Assert(bindingIDs, check.DeepEquals, []string{b1.ID, b2.ID})
+	c.Assert(b1.ID, check.Not(check.Equals), b2.ID)
+	c.Assert(b1.Credentials, check.DeepEquals, []string{"DATABASE_PASSWORD", "DATABASE_USER"})
+	c.Assert(b1.Fingerprint, check.Not(check.Equals), "")
+	c.Assert(b1.Fingerprint, check.Not(check.Equals), b2.Fingerprint)
+}
+
+func (s *BindSuite) TestUnbindAppRemovesOnlyItsBinding(c *check.C) {
+	var unboundID string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			r.ParseForm()
+			unboundID = r.Form.Get("binding-id")
+			return
+		}
+		w.Write([]byte(`{"DATABASE_USER":"root"}`))
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	app1 := provisiontest.NewFakeApp("painkiller", "python", 0)
+	app2 := provisiontest.NewFakeApp("nightcrawler", "python", 0)
+	err = instance.BindApp(app1, false, nil)
+	c.Assert(err, check.IsNil)
+	err = instance.BindApp(app2, false, nil)
+	c.Assert(err, check.IsNil)
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, check.IsNil)
+	bindingID := instance.BindingFor("painkiller").ID
+	err = instance.UnbindApp(app1, false, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(unboundID, check.Equals, bindingID)
+	var dbInstance ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&dbInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.Apps, check.DeepEquals, []string{"nightcrawler"})
+	c.Assert(dbInstance.Bindings, check.HasLen, 1)
+	c.Assert(dbInstance.Bindings[0].App, check.Equals, "nightcrawler")
+}
+
+func (s *BindSuite) TestRotateCredentials(c *check.C) {
+	var rotateForm, revokeForm url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case r.URL.Path == "/resources/my-mysql/bind-app/credentials" && r.Method == "POST":
+			rotateForm = r.Form
+			w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"n3w"}`))
+		case r.URL.Path == "/resources/my-mysql/bind-app/credentials" && r.Method == "DELETE":
+			revokeForm = r.Form
+		default:
+			w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"old"}`))
+		}
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	app := provisiontest.NewFakeApp("painkiller", "python", 0)
+	err = instance.BindApp(app, false, nil)
+	c.Assert(err, check.IsNil)
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, check.IsNil)
+	old := *instance.BindingFor("painkiller")
+	err = instance.RotateCredentials(app, false, 0, nil)
+	c.Assert(err, check.IsNil)
+	envs := app.GetInstances("mysql")
+	c.Assert(envs, check.HasLen, 1)
+	c.Assert(envs[0].Envs, check.DeepEquals, map[string]string{"DATABASE_USER": "root", "DATABASE_PASSWORD": "n3w"})
+	var dbInstance ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&dbInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.Apps, check.DeepEquals, []string{"painkiller"})
+	b := dbInstance.BindingFor("painkiller")
+	c.Assert(b, check.NotNil)
+	c.Assert(b.ID, check.Not(check.Equals), old.ID)
+	c.Assert(b.Fingerprint, check.Not(check.Equals), old.Fingerprint)
+	c.Assert(rotateForm.Get("binding-id"), check.Equals, b.ID)
+	c.Assert(rotateForm.Get("previous-binding-id"), check.Equals, old.ID)
+	c.Assert(revokeForm.Get("binding-id"), check.Equals, old.ID)
+	c.Assert(b.Rotated, check.HasLen, 1)
+	c.Assert(b.Rotated[0].ID, check.Equals, old.ID)
+	c.Assert(b.Rotated[0].Fingerprint, check.Equals, old.Fingerprint)
+	c.Assert(b.Rotated[0].RevokedAt.IsZero(), check.Equals, false)
+}
+
+func (s *BindSuite) TestRotateCredentialsRemovesStaleEnvs(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/my-mysql/bind-app/credentials" && r.Method == "POST" {
+			w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"n3w"}`))
+			return
+		}
+		w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"old","DATABASE_TOKEN":"t0k3n"}`))
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	app := provisiontest.NewFakeApp("painkiller", "python", 0)
+	err = instance.BindApp(app, false, nil)
+	c.Assert(err, check.IsNil)
+	app.SetEnv(bind.EnvVar{Name: "DATABASE_PASSWORD", Value: "old", InstanceName: "my-mysql"})
+	app.SetEnv(bind.EnvVar{Name: "DATABASE_TOKEN", Value: "t0k3n", InstanceName: "my-mysql"})
+	app.SetEnv(bind.EnvVar{Name: "OTHER_TOKEN", Value: "other", InstanceName: "other-instance"})
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, check.IsNil)
+	err = instance.RotateCredentials(app, false, time.Hour, nil)
+	c.Assert(err, check.IsNil)
+	envs := app.Envs()
+	_, ok := envs["DATABASE_TOKEN"]
+	c.Assert(ok, check.Equals, false)
+	_, ok = envs["DATABASE_PASSWORD"]
+	c.Assert(ok, check.Equals, true)
+	_, ok = envs["OTHER_TOKEN"]
+	c.Assert(ok, check.Equals, true)
+}
+
+func (s *BindSuite) TestRotateCredentialsGracePeriod(c *check.C) {
+	var revoked []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Method == "DELETE" {
+			revoked = append(revoked, r.Form.Get("binding-id"))
+			return
+		}
+		w.Write([]byte(`{"DATABASE_USER":"root"}`))
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	app := provisiontest.NewFakeApp("painkiller", "python", 0)
+	err = instance.BindApp(app, false, nil)
+	c.Assert(err, check.IsNil)
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, check.IsNil)
+	oldID := instance.BindingFor("painkiller").ID
+	err = instance.RotateCredentials(app, false, time.Hour, nil)
+	c.Assert(err, check.IsNil)
+	getApp := func(appName string) (bind.App, error) {
+		c.Assert(appName, check.Equals, "painkiller")
+		return app, nil
+	}
+	err = RevokeExpiredCredentials(getApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(revoked, check.HasLen, 0)
+	var dbInstance ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&dbInstance)
+	c.Assert(err, check.IsNil)
+	rotated := dbInstance.BindingFor("painkiller").Rotated
+	c.Assert(rotated, check.HasLen, 1)
+	c.Assert(rotated[0].ID, check.Equals, oldID)
+	c.Assert(rotated[0].RevokedAt.IsZero(), check.Equals, true)
+	c.Assert(rotated[0].RevokeAfter.Sub(rotated[0].RotatedAt), check.Equals, time.Hour)
+}
+
+func (s *BindSuite) TestRevokeExpiredCredentialsAfterRestart(c *check.C) {
+	var revoked []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Method == "DELETE" {
+			revoked = append(revoked, r.Form.Get("binding-id"))
+			return
+		}
+		w.Write([]byte(`{"DATABASE_USER":"root"}`))
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	app := provisiontest.NewFakeApp("painkiller", "python", 0)
+	err = instance.BindApp(app, false, nil)
+	c.Assert(err, check.IsNil)
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, check.IsNil)
+	oldID := instance.BindingFor("painkiller").ID
+	err = instance.RotateCredentials(app, false, time.Hour, nil)
+	c.Assert(err, check.IsNil)
+	// Only the database is kept across restarts, simulate the grace period
+	// expiring while the API was down.
+	err = s.conn.ServiceInstances().Update(
+		bson.M{"name": instance.Name, "bindings.app": "painkiller"},
+		bson.M{"$set": bson.M{"bindings.$.rotated.0.revokeafter": time.Now().UTC().Add(-time.Minute)}},
+	)
+	c.Assert(err, check.IsNil)
+	err = RevokeExpiredCredentials(func(appName string) (bind.App, error) {
+		return app, nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(revoked, check.DeepEquals, []string{oldID})
+	var dbInstance ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&dbInstance)
+	c.Assert(err, check.IsNil)
+	rotated := dbInstance.BindingFor("painkiller").Rotated
+	c.Assert(rotated, check.HasLen, 1)
+	c.Assert(rotated[0].RevokedAt.IsZero(), check.Equals, false)
+	c.Assert(rotated[0].RevokeAfter.IsZero(), check.Equals, true)
+	err = RevokeExpiredCredentials(func(appName string) (bind.App, error) {
+		return app, nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(revoked, check.HasLen, 1)
+}
+
+func (s *BindSuite) TestRotateCredentialsNotBound(c *check.C) {
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": "http://localhost:1"}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	app := provisiontest.NewFakeApp("painkiller", "python", 0)
+	err = instance.RotateCredentials(app, false, 0, nil)
+	c.Assert(err, check.Equals, ErrAppNotBound)
+}
+
+func (s *BindSuite) TestRotateCredentialsNotSupported(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/my-mysql/bind-app/credentials" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"DATABASE_USER":"root"}`))
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	app := provisiontest.NewFakeApp("painkiller", "python", 0)
+	err = instance.BindApp(app, false, nil)
+	c.Assert(err, check.IsNil)
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, check.IsNil)
+	err = instance.RotateCredentials(app, false, 0, nil)
+	c.Assert(err, check.Equals, ErrRotationNotSupported)
+	envs := app.GetInstances("mysql")
+	c.Assert(envs, check.HasLen, 1)
+	c.Assert(envs[0].Envs, check.DeepEquals, map[string]string{"DATABASE_USER": "root"})
+}
@@ -0,0 +1,351 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultRotationGracePeriod is the time the credentials replaced by a
+// rotation remain valid before being revoked, giving the app units time to
+// pick up the new ones.
+var DefaultRotationGracePeriod = 5 * time.Minute
+
+// credentialsRevokeInterval is how often rotated credentials are checked for
+// an expired grace period.
+var credentialsRevokeInterval = time.Minute
+
+// Binding represents the bind between a service instance and an app. Each
+// binding gets its own set of credentials from the service API. Only the
+// names of the credentials and a fingerprint of their values are kept here,
+// the values themselves live in the app environment.
+type Binding struct {
+	ID          string
+	App         string
+	Credentials []string
+	Fingerprint string
+	CreatedAt   time.Time
+	// Rotated keeps the history of the credentials replaced by rotations.
+	Rotated []RotatedCredentials `bson:",omitempty"`
+}
+
+// RotatedCredentials represents credentials of a binding that were replaced
+// by a rotation. RevokedAt is zero while the credentials are still valid in
+// the service API, RevokeAfter holds when they must be revoked until then.
+type RotatedCredentials struct {
+	ID          string
+	Fingerprint string
+	CreatedAt   time.Time
+	RotatedAt   time.Time
+	RevokedAt   time.Time
+	RevokeAfter time.Time `bson:",omitempty"`
+}
+
+// BindingFor returns the binding between the instance and the given app, or
+// nil for apps bound before bindings were tracked.
+func (si *ServiceInstance) BindingFor(appName string) *Binding {
+	for i := range si.Bindings {
+		if si.Bindings[i].App == appName {
+			return &si.Bindings[i]
+		}
+	}
+	return nil
+}
+
+func (si *ServiceInstance) addBinding(appName string) (*Binding, error) {
+	b := Binding{
+		ID:        bson.NewObjectId().Hex(),
+		App:       appName,
+		CreatedAt: time.Now().UTC(),
+	}
+	err := si.updateData(bson.M{"$push": bson.M{"bindings": b}})
+	if err != nil {
+		return nil, err
+	}
+	si.Bindings = append(si.Bindings, b)
+	return &si.Bindings[len(si.Bindings)-1], nil
+}
+
+func (si *ServiceInstance) removeBinding(appName string) error {
+	err := si.updateData(bson.M{"$pull": bson.M{"bindings": bson.M{"app": appName}}})
+	if err != nil {
+		return err
+	}
+	for i := range si.Bindings {
+		if si.Bindings[i].App == appName {
+			si.Bindings = append(si.Bindings[:i], si.Bindings[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (si *ServiceInstance) setBindingCredentials(appName string, envs map[string]string) error {
+	b := si.BindingFor(appName)
+	if b == nil {
+		return nil
+	}
+	b.Credentials, b.Fingerprint = credentialsFingerprint(envs)
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.ServiceInstances().Update(
+		bson.M{"name": si.Name, "service_name": si.ServiceName, "bindings.id": b.ID},
+		bson.M{"$set": bson.M{"bindings.$.credentials": b.Credentials, "bindings.$.fingerprint": b.Fingerprint}},
+	)
+}
+
+func credentialsFingerprint(envs map[string]string) ([]string, string) {
+	names := make([]string, 0, len(envs))
+	for k := range envs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, k := range names {
+		h.Write([]byte(k + "=" + envs[k] + "\n"))
+	}
+	return names, hex.EncodeToString(h.Sum(nil))
+}
+
+// RotateCredentials asks the service API for a new set of credentials for
+// the binding between the instance and the app, replacing the ones in the
+// app environment. The previous credentials are revoked by the credentials
+// revoker once the grace period expires, a non-positive grace revokes them
+// right away.
+func (si *ServiceInstance) RotateCredentials(app bind.App, shouldRestart bool, grace time.Duration, writer io.Writer) error {
+	if writer == nil {
+		writer = ioutil.Discard
+	}
+	if err := si.CheckReady(); err != nil {
+		return err
+	}
+	if si.FindApp(app.GetName()) == -1 {
+		return ErrAppNotBound
+	}
+	endpoint, err := si.Service().getClient("production")
+	if err != nil {
+		return err
+	}
+	var old *Binding
+	if b := si.BindingFor(app.GetName()); b != nil {
+		current := *b
+		old = &current
+	}
+	newID := bson.NewObjectId().Hex()
+	envs, err := endpoint.RotateCredentials(si, app, newID)
+	if err != nil {
+		return err
+	}
+	// AddInstance merges the new variables into the app environment, so the
+	// ones left out of the new credentials must be removed first.
+	var stale []string
+	for name := range app.InstanceEnv(si.Name) {
+		if _, ok := envs[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		err = app.UnsetEnvs(bind.UnsetEnvApp{VariableNames: stale}, writer)
+	}
+	if err == nil {
+		err = app.AddInstance(bind.InstanceApp{
+			ServiceName:   si.ServiceName,
+			Instance:      bind.ServiceInstance{Name: si.Name, Envs: envs},
+			ShouldRestart: shouldRestart,
+		}, writer)
+	}
+	if err != nil {
+		if revokeErr := endpoint.RevokeCredentials(si, app, newID); revokeErr != nil {
+			log.Errorf("[rotate credentials] could not revoke unused credentials %s of %s/%s: %s", newID, si.ServiceName, si.Name, revokeErr)
+		}
+		return err
+	}
+	err = si.replaceBinding(app.GetName(), newID, envs, old, grace)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		fmt.Fprintf(writer, "Previous credentials of app %q were not tracked by tsuru and must be revoked in the service.\n", app.GetName())
+		return nil
+	}
+	if grace <= 0 {
+		fmt.Fprintf(writer, "Revoking previous credentials of app %q.\n", app.GetName())
+		return si.revokeCredentials(endpoint, app, old.ID)
+	}
+	fmt.Fprintf(writer, "Previous credentials of app %q will be revoked in %v.\n", app.GetName(), grace)
+	return nil
+}
+
+func (si *ServiceInstance) replaceBinding(appName, newID string, envs map[string]string, old *Binding, grace time.Duration) error {
+	b := Binding{
+		ID:        newID,
+		App:       appName,
+		CreatedAt: time.Now().UTC(),
+	}
+	b.Credentials, b.Fingerprint = credentialsFingerprint(envs)
+	if old == nil {
+		err := si.updateData(bson.M{"$push": bson.M{"bindings": b}})
+		if err != nil {
+			return err
+		}
+		si.Bindings = append(si.Bindings, b)
+		return nil
+	}
+	b.Rotated = append(old.Rotated, RotatedCredentials{
+		ID:          old.ID,
+		Fingerprint: old.Fingerprint,
+		CreatedAt:   old.CreatedAt,
+		RotatedAt:   b.CreatedAt,
+	})
+	if grace > 0 {
+		b.Rotated[len(b.Rotated)-1].RevokeAfter = b.CreatedAt.Add(grace)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.ServiceInstances().Update(
+		bson.M{"name": si.Name, "service_name": si.ServiceName, "bindings.id": old.ID},
+		bson.M{"$set": bson.M{"bindings.$": b}},
+	)
+	if err != nil {
+		return err
+	}
+	if current := si.BindingFor(appName); current != nil {
+		*current = b
+	}
+	return nil
+}
+
+func (si *ServiceInstance) revokeCredentials(endpoint ServiceClient, app bind.App, bindingID string) error {
+	err := endpoint.RevokeCredentials(si, app, bindingID)
+	if err != nil && err != ErrInstanceNotFoundInAPI {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var instance ServiceInstance
+	err = conn.ServiceInstances().Find(bson.M{"name": si.Name, "service_name": si.ServiceName}).One(&instance)
+	if err != nil {
+		return err
+	}
+	b := instance.BindingFor(app.GetName())
+	if b == nil {
+		return nil
+	}
+	for i := range b.Rotated {
+		if b.Rotated[i].ID == bindingID {
+			b.Rotated[i].RevokedAt = time.Now().UTC()
+			b.Rotated[i].RevokeAfter = time.Time{}
+		}
+	}
+	return conn.ServiceInstances().Update(
+		bson.M{"name": si.Name, "service_name": si.ServiceName, "bindings.id": b.ID},
+		bson.M{"$set": bson.M{"bindings.$.rotated": b.Rotated}},
+	)
+}
+
+// RevokeExpiredCredentials revokes the rotated credentials whose grace period
+// expired. getApp is used to find the apps bound to the instances. Failures
+// are logged and the credentials are retried in the next call.
+func RevokeExpiredCredentials(getApp func(appName string) (bind.App, error)) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	var instances []ServiceInstance
+	err = conn.ServiceInstances().Find(bson.M{"bindings.rotated.revokeafter": bson.M{"$lte": now}}).All(&instances)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	for i := range instances {
+		si := &instances[i]
+		endpoint, err := si.Service().getClient("production")
+		if err != nil {
+			log.Errorf("[revoke credentials] could not get the client of %s/%s: %s", si.ServiceName, si.Name, err)
+			continue
+		}
+		for _, b := range si.Bindings {
+			for _, rotated := range b.Rotated {
+				if !rotated.RevokedAt.IsZero() || rotated.RevokeAfter.IsZero() || rotated.RevokeAfter.After(now) {
+					continue
+				}
+				app, err := getApp(b.App)
+				if err == nil {
+					err = si.revokeCredentials(endpoint, app, rotated.ID)
+				}
+				if err != nil {
+					log.Errorf("[revoke credentials] could not revoke credentials %s of %s/%s: %s", rotated.ID, si.ServiceName, si.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// credentialsRevoker periodically revokes the rotated credentials whose
+// grace period expired. Deadlines are kept in the database, so credentials
+// pending revocation when the API restarts are revoked by the next run.
+type credentialsRevoker struct {
+	getApp      func(appName string) (bind.App, error)
+	runInterval time.Duration
+	done        chan bool
+}
+
+// InitializeCredentialsRevoker starts the credentials revoker, getApp is
+// used to find the apps bound to the instances.
+func InitializeCredentialsRevoker(getApp func(appName string) (bind.App, error)) {
+	revoker := &credentialsRevoker{
+		getApp:      getApp,
+		runInterval: credentialsRevokeInterval,
+		done:        make(chan bool),
+	}
+	shutdown.Register(revoker)
+	go revoker.run()
+}
+
+func (r *credentialsRevoker) run() {
+	for {
+		err := RevokeExpiredCredentials(r.getApp)
+		if err != nil {
+			log.Errorf("[revoke credentials] %s", err)
+		}
+		select {
+		case <-r.done:
+			return
+		case <-time.After(r.runInterval):
+		}
+	}
+}
+
+func (r *credentialsRevoker) Shutdown() {
+	r.done <- true
+}
+
+func (r *credentialsRevoker) String() string {
+	return "service credentials revoker"
+}
@@ -0,0 +1,488 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+)
+
+const brokerAPIVersion = "2.12"
+
+var errBrokerProxyNotSupported = errors.New("proxy is not supported by service brokers")
+
+type brokerCatalog struct {
+	Services []brokerService `json:"services"`
+}
+
+type brokerService struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Bindable    bool         `json:"bindable"`
+	Plans       []brokerPlan `json:"plans"`
+}
+
+type brokerPlan struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type brokerOperation struct {
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+// brokerAsyncResponse is the body of 202 responses, identifying the
+// operation to be sent when polling last_operation.
+type brokerAsyncResponse struct {
+	Operation string `json:"operation"`
+}
+
+// brokerClient talks to service brokers implementing the Open Service Broker
+// API. The tsuru service is matched by name against the services in the
+// broker catalog, instances are identified by their names and bindings by
+// their ids, falling back to the name of the bound app.
+type brokerClient struct {
+	serviceName string
+	endpoint    string
+	username    string
+	password    string
+}
+
+func (c *brokerClient) doRequest(method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	u := strings.TrimRight(c.endpoint, "/") + "/" + strings.Trim(path, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Broker-API-Version", brokerAPIVersion)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Close = true
+	t0 := time.Now()
+	resp, err := net.Dial5Full300ClientNoKeepAlive.Do(req)
+	requestLatencies.WithLabelValues(c.serviceName).Observe(time.Since(t0).Seconds())
+	if err != nil {
+		requestErrors.WithLabelValues(c.serviceName).Inc()
+	}
+	return resp, err
+}
+
+func (c *brokerClient) responseError(resp *http.Response, format string, args ...interface{}) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	err := errors.Errorf("invalid response from broker (%d): %s", resp.StatusCode, string(data))
+	return log.WrapError(errors.Wrapf(err, format, args...))
+}
+
+func (c *brokerClient) catalog() (*brokerService, error) {
+	resp, err := c.doRequest("GET", "/v2/catalog", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.responseError(resp, "Failed to get the catalog of %q", c.serviceName)
+	}
+	var catalog brokerCatalog
+	err = json.NewDecoder(resp.Body).Decode(&catalog)
+	if err != nil {
+		return nil, err
+	}
+	for i := range catalog.Services {
+		if catalog.Services[i].Name == c.serviceName {
+			return &catalog.Services[i], nil
+		}
+	}
+	return nil, errors.Errorf("service %q not found in the broker catalog", c.serviceName)
+}
+
+// resolvePlan returns the catalog service along with the id of the named
+// plan, the first plan in the catalog is used when no plan is given.
+func (c *brokerClient) resolvePlan(planName string) (*brokerService, string, error) {
+	svc, err := c.catalog()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, p := range svc.Plans {
+		if planName == "" || p.Name == planName {
+			return svc, p.ID, nil
+		}
+	}
+	if planName == "" {
+		return nil, "", errors.Errorf("service %q has no plans in the broker catalog", c.serviceName)
+	}
+	return nil, "", ErrInvalidPlan
+}
+
+func (c *brokerClient) instancePath(instance *ServiceInstance) string {
+	return "/v2/service_instances/" + url.PathEscape(instance.GetIdentifier())
+}
+
+func (c *brokerClient) bindingPath(instance *ServiceInstance, app bind.App) string {
+	bindingID := app.GetName()
+	if b := instance.BindingFor(app.GetName()); b != nil {
+		bindingID = b.ID
+	}
+	return c.instancePath(instance) + "/service_bindings/" + url.PathEscape(bindingID)
+}
+
+func (c *brokerClient) idsQuery(instance *ServiceInstance) (url.Values, error) {
+	svc, planID, err := c.resolvePlan(instance.PlanName)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{"service_id": {svc.ID}, "plan_id": {planID}}, nil
+}
+
+func (c *brokerClient) Create(instance *ServiceInstance, user, requestID string) error {
+	svc, planID, err := c.resolvePlan(instance.PlanName)
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"service_id":        svc.ID,
+		"plan_id":           planID,
+		"organization_guid": instance.TeamOwner,
+		"space_guid":        instance.TeamOwner,
+		"context": map[string]string{
+			"platform": "tsuru",
+			"team":     instance.TeamOwner,
+			"user":     user,
+		},
+	}
+	if len(instance.Parameters) > 0 {
+		body["parameters"] = instance.Parameters
+	}
+	query := url.Values{"accepts_incomplete": {"true"}}
+	resp, err := c.doRequest("PUT", c.instancePath(instance), query, body)
+	if err != nil {
+		return log.WrapError(errors.Wrapf(err, "Failed to create the instance %s", instance.Name))
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusAccepted:
+		instance.State = InstanceStatePending
+		instance.Operation = c.asyncOperation(resp)
+		return nil
+	case http.StatusConflict:
+		return ErrInstanceAlreadyExistsInAPI
+	}
+	return c.responseError(resp, "Failed to create the instance %s", instance.Name)
+}
+
+func (c *brokerClient) UpdatePlan(instance *ServiceInstance, plan, requestID string) error {
+	svc, planID, err := c.resolvePlan(plan)
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"service_id": svc.ID,
+		"plan_id":    planID,
+	}
+	query := url.Values{"accepts_incomplete": {"true"}}
+	resp, err := c.doRequest("PATCH", c.instancePath(instance), query, body)
+	if err != nil {
+		return log.WrapError(errors.Wrapf(err, "Failed to change the plan of the instance %s", instance.Name))
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusAccepted:
+		op, err := c.waitOperation(instance, c.asyncOperation(resp))
+		if err != nil {
+			return err
+		}
+		if op.State == "failed" {
+			return errors.Errorf("Failed to change the plan of the instance %s: %s", instance.Name, op.Description)
+		}
+		return nil
+	case http.StatusGone, http.StatusNotFound:
+		return ErrInstanceNotFoundInAPI
+	}
+	return c.responseError(resp, "Failed to change the plan of the instance %s", instance.Name)
+}
+
+func (c *brokerClient) Destroy(instance *ServiceInstance, requestID string) error {
+	query, err := c.idsQuery(instance)
+	if err != nil {
+		return err
+	}
+	query.Set("accepts_incomplete", "true")
+	resp, err := c.doRequest("DELETE", c.instancePath(instance), query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusAccepted:
+		op, err := c.waitOperation(instance, c.asyncOperation(resp))
+		if err == ErrInstanceNotFoundInAPI {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if op.State == "failed" {
+			return errors.Errorf("Failed to destroy the instance %s: %s", instance.Name, op.Description)
+		}
+		return nil
+	case http.StatusGone:
+		return ErrInstanceNotFoundInAPI
+	}
+	return c.responseError(resp, "Failed to destroy the instance %s", instance.Name)
+}
+
+// waitOperation polls last_operation until the broker finishes the
+// operation on the instance, backing off between attempts like
+// WaitProvisioning does. The finished operation is returned, either
+// succeeded or failed. ErrInstanceNotFoundInAPI is returned when the
+// instance is removed by the broker.
+func (c *brokerClient) waitOperation(instance *ServiceInstance, operation string) (*brokerOperation, error) {
+	interval := provisionInitialInterval
+	deadline := time.Now().Add(provisionTimeout)
+	for {
+		op, err := c.lastOperation(instance, operation)
+		if err != nil {
+			return nil, err
+		}
+		if op.State == "succeeded" || op.State == "failed" {
+			return op, nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return nil, errors.Errorf("timeout after %v waiting for the broker to finish the operation on the instance %s", provisionTimeout, instance.Name)
+		}
+		time.Sleep(interval)
+		interval *= 2
+		if interval > provisionMaxInterval {
+			interval = provisionMaxInterval
+		}
+	}
+}
+
+// asyncOperation returns the operation sent by the broker in a 202 response,
+// if any.
+func (c *brokerClient) asyncOperation(resp *http.Response) string {
+	var async brokerAsyncResponse
+	json.NewDecoder(resp.Body).Decode(&async)
+	return async.Operation
+}
+
+// lastOperation returns the state of the last operation ran by the broker on
+// the instance. ErrInstanceNotFoundInAPI is returned when the broker answers
+// with 410, which means the instance was removed.
+func (c *brokerClient) lastOperation(instance *ServiceInstance, operation string) (*brokerOperation, error) {
+	query, err := c.idsQuery(instance)
+	if err != nil {
+		return nil, err
+	}
+	if operation != "" {
+		query.Set("operation", operation)
+	}
+	resp, err := c.doRequest("GET", c.instancePath(instance)+"/last_operation", query, nil)
+	if err != nil {
+		return nil, log.WrapError(errors.Wrapf(err, "Failed to get status of instance %s", instance.Name))
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusGone:
+		return nil, ErrInstanceNotFoundInAPI
+	default:
+		return nil, c.responseError(resp, "Failed to get status of instance %s", instance.Name)
+	}
+	var op brokerOperation
+	err = json.NewDecoder(resp.Body).Decode(&op)
+	if err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+func (c *brokerClient) BindApp(instance *ServiceInstance, app bind.App) (map[string]string, error) {
+	return c.bind(instance, app, c.bindingPath(instance, app))
+}
+
+// RotateCredentials creates a new binding in the broker, which gets its own
+// credentials, the previous binding is kept until revoked.
+func (c *brokerClient) RotateCredentials(instance *ServiceInstance, app bind.App, bindingID string) (map[string]string, error) {
+	return c.bind(instance, app, c.instancePath(instance)+"/service_bindings/"+url.PathEscape(bindingID))
+}
+
+// RevokeCredentials removes the broker binding identified by bindingID.
+func (c *brokerClient) RevokeCredentials(instance *ServiceInstance, app bind.App, bindingID string) error {
+	return c.unbind(instance, app, c.instancePath(instance)+"/service_bindings/"+url.PathEscape(bindingID))
+}
+
+func (c *brokerClient) bind(instance *ServiceInstance, app bind.App, path string) (map[string]string, error) {
+	svc, planID, err := c.resolvePlan(instance.PlanName)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{
+		"service_id": svc.ID,
+		"plan_id":    planID,
+		"app_guid":   app.GetName(),
+		"bind_resource": map[string]string{
+			"app_guid": app.GetName(),
+		},
+	}
+	resp, err := c.doRequest("PUT", path, nil, body)
+	if err != nil {
+		return nil, log.WrapError(errors.Wrapf(err, `Failed to bind app %q to service instance "%s/%s"`, app.GetName(), instance.ServiceName, instance.Name))
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusConflict:
+		return nil, ErrAppAlreadyBound
+	case http.StatusNotFound, http.StatusGone:
+		return nil, ErrInstanceNotFoundInAPI
+	case http.StatusUnprocessableEntity:
+		return nil, ErrInstanceNotReady
+	default:
+		return nil, c.responseError(resp, `Failed to bind the instance "%s/%s" to the app %q`, instance.ServiceName, instance.Name, app.GetName())
+	}
+	var result struct {
+		Credentials map[string]interface{} `json:"credentials"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	envs := make(map[string]string, len(result.Credentials))
+	for k, v := range result.Credentials {
+		if str, ok := v.(string); ok {
+			envs[k] = str
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		envs[k] = string(data)
+	}
+	return envs, nil
+}
+
+// BindUnit is a no-op, the Open Service Broker API has no concept of units.
+func (c *brokerClient) BindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error {
+	return nil
+}
+
+func (c *brokerClient) UnbindApp(instance *ServiceInstance, app bind.App) error {
+	return c.unbind(instance, app, c.bindingPath(instance, app))
+}
+
+func (c *brokerClient) unbind(instance *ServiceInstance, app bind.App, path string) error {
+	query, err := c.idsQuery(instance)
+	if err != nil {
+		return err
+	}
+	resp, err := c.doRequest("DELETE", path, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusGone:
+		return ErrInstanceNotFoundInAPI
+	}
+	return c.responseError(resp, "Failed to unbind the app %q from the instance %s", app.GetName(), instance.Name)
+}
+
+// UnbindUnit is a no-op, the Open Service Broker API has no concept of units.
+func (c *brokerClient) UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error {
+	return nil
+}
+
+// Status maps the last operation of the instance to the statuses used by
+// tsuru services: in progress operations are pending, succeeded ones are up
+// and failed ones are down. Any other state is reported as an error.
+func (c *brokerClient) Status(instance *ServiceInstance, requestID string) (string, error) {
+	op, err := c.lastOperation(instance, instance.Operation)
+	if err != nil {
+		return "", err
+	}
+	switch op.State {
+	case "in progress":
+		return instanceStatusPending, nil
+	case "succeeded":
+		return instanceStatusUp, nil
+	case "failed":
+		return instanceStatusDown, nil
+	}
+	return "", errors.Errorf("Failed to get status of instance %s: unknown operation state %q", instance.Name, op.State)
+}
+
+func (c *brokerClient) Info(instance *ServiceInstance, requestID string) ([]map[string]string, error) {
+	return nil, nil
+}
+
+func (c *brokerClient) Plans(requestID string) ([]Plan, error) {
+	svc, err := c.catalog()
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]Plan, len(svc.Plans))
+	for i, p := range svc.Plans {
+		plans[i] = Plan{Name: p.Name, Description: p.Description}
+	}
+	return plans, nil
+}
+
+func (c *brokerClient) Parameters(requestID string) ([]Parameter, error) {
+	return nil, nil
+}
+
+// Backups are not part of the Open Service Broker API.
+func (c *brokerClient) ListBackups(instance *ServiceInstance, requestID string) ([]Backup, error) {
+	return nil, ErrBackupNotSupported
+}
+
+func (c *brokerClient) CreateBackup(instance *ServiceInstance, description, requestID string) (*Backup, error) {
+	return nil, ErrBackupNotSupported
+}
+
+func (c *brokerClient) RestoreBackup(instance *ServiceInstance, backupID, requestID string) error {
+	return ErrBackupNotSupported
+}
+
+func (c *brokerClient) Proxy(path string, w http.ResponseWriter, r *http.Request) error {
+	return errBrokerProxyNotSupported
+}
@@ -0,0 +1,312 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// fakeBroker is a minimal Open Service Broker implementation that provisions
+// and deprovisions instances asynchronously, finishing the operation on the
+// first last_operation poll.
+type fakeBroker struct {
+	sync.Mutex
+	instances  map[string]map[string]interface{}
+	bindings   map[string]bool
+	pending    map[string]bool
+	deleting   map[string]bool
+	calls      []string
+	operations []string
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		instances: make(map[string]map[string]interface{}),
+		bindings:  make(map[string]bool),
+		pending:   make(map[string]bool),
+		deleting:  make(map[string]bool),
+	}
+}
+
+func (b *fakeBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.Lock()
+	defer b.Unlock()
+	if r.Header.Get("X-Broker-API-Version") == "" {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	b.calls = append(b.calls, r.Method+" "+r.URL.Path)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if r.URL.Path == "/v2/catalog" {
+		w.Write([]byte(`{"services": [{"id": "svc-1", "name": "mysql", "bindable": true, "plans": [
+			{"id": "plan-small", "name": "small", "description": "small plan"},
+			{"id": "plan-large", "name": "large", "description": "large plan"}
+		]}]}`))
+		return
+	}
+	if len(parts) < 3 || parts[1] != "service_instances" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	id := parts[2]
+	switch {
+	case len(parts) == 3 && r.Method == "PUT":
+		if _, ok := b.instances[id]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		b.instances[id] = body
+		b.pending[id] = true
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"operation": "provision-` + id + `"}`))
+	case len(parts) == 3 && r.Method == "PATCH":
+		if _, ok := b.instances[id]; !ok {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		b.instances[id]["plan_id"] = body["plan_id"]
+		b.pending[id] = true
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"operation": "update-` + id + `"}`))
+	case len(parts) == 3 && r.Method == "DELETE":
+		if _, ok := b.instances[id]; !ok {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		b.pending[id] = true
+		b.deleting[id] = true
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"operation": "deprovision-` + id + `"}`))
+	case len(parts) == 4 && parts[3] == "last_operation":
+		b.operations = append(b.operations, r.URL.Query().Get("operation"))
+		if b.pending[id] {
+			delete(b.pending, id)
+			json.NewEncoder(w).Encode(map[string]string{"state": "in progress"})
+			return
+		}
+		if b.deleting[id] {
+			delete(b.deleting, id)
+			delete(b.instances, id)
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"state": "succeeded"})
+	case len(parts) == 5 && parts[3] == "service_bindings":
+		key := id + "/" + parts[4]
+		if r.Method == "PUT" {
+			b.bindings[key] = true
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"credentials": {"DATABASE_HOST": "10.0.0.1", "DATABASE_PORT": 3306}}`))
+			return
+		}
+		if !b.bindings[key] {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		delete(b.bindings, key)
+		w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *S) TestBrokerClientPlans(c *check.C) {
+	ts := httptest.NewServer(newFakeBroker())
+	defer ts.Close()
+	client := &brokerClient{serviceName: "mysql", endpoint: ts.URL}
+	plans, err := client.Plans("")
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []Plan{
+		{Name: "small", Description: "small plan"},
+		{Name: "large", Description: "large plan"},
+	})
+}
+
+func (s *S) TestBrokerClientServiceNotInCatalog(c *check.C) {
+	ts := httptest.NewServer(newFakeBroker())
+	defer ts.Close()
+	client := &brokerClient{serviceName: "redis", endpoint: ts.URL}
+	_, err := client.Plans("")
+	c.Assert(err, check.ErrorMatches, `service "redis" not found in the broker catalog`)
+}
+
+func (s *S) TestGetClientBroker(c *check.C) {
+	service := Service{Name: "mysql", Password: "abcde", APIType: BrokerAPIType, Endpoint: map[string]string{"production": "broker.com"}}
+	cli, err := service.getClient("production")
+	c.Assert(err, check.IsNil)
+	c.Assert(cli, check.DeepEquals, &brokerClient{
+		serviceName: "mysql",
+		endpoint:    "http://broker.com",
+		username:    "mysql",
+		password:    "abcde",
+	})
+	service.APIType = "soap"
+	_, err = service.getClient("production")
+	c.Assert(err, check.Equals, ErrInvalidAPIType)
+}
+
+func (s *BindSuite) TestBrokerServiceFlow(c *check.C) {
+	broker := newFakeBroker()
+	ts := httptest.NewServer(broker)
+	defer ts.Close()
+	srvc := Service{Name: "mysql", APIType: BrokerAPIType, Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	instance := ServiceInstance{Name: "my-mysql", PlanName: "large", TeamOwner: s.team.Name}
+	err = CreateServiceInstance(instance, &srvc, &s.user, "")
+	c.Assert(err, check.IsNil)
+	si, err := GetServiceInstance("mysql", "my-mysql")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.State, check.Equals, InstanceStatePending)
+	c.Assert(si.Operation, check.Equals, "provision-my-mysql")
+	broker.Lock()
+	c.Assert(broker.instances["my-mysql"]["plan_id"], check.Equals, "plan-large")
+	c.Assert(broker.instances["my-mysql"]["service_id"], check.Equals, "svc-1")
+	broker.Unlock()
+	defer s.setFastProvisioning()()
+	err = WaitProvisioning(si, nil, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.Operation, check.Equals, "")
+	app := provisiontest.NewFakeApp("painkiller", "python", 1)
+	err = si.BindApp(app, false, nil)
+	c.Assert(err, check.IsNil)
+	envs := app.GetInstances("mysql")
+	c.Assert(envs, check.HasLen, 1)
+	c.Assert(envs[0].Envs, check.DeepEquals, map[string]string{"DATABASE_HOST": "10.0.0.1", "DATABASE_PORT": "3306"})
+	err = s.conn.ServiceInstances().Find(bson.M{"name": "my-mysql"}).One(si)
+	c.Assert(err, check.IsNil)
+	err = si.UnbindApp(app, false, nil)
+	c.Assert(err, check.IsNil)
+	broker.Lock()
+	c.Assert(broker.bindings, check.HasLen, 0)
+	broker.Unlock()
+	err = s.conn.ServiceInstances().Find(bson.M{"name": "my-mysql"}).One(si)
+	c.Assert(err, check.IsNil)
+	err = DeleteInstance(si, "")
+	c.Assert(err, check.IsNil)
+	broker.Lock()
+	defer broker.Unlock()
+	c.Assert(broker.instances, check.HasLen, 0)
+	c.Assert(broker.operations, check.DeepEquals, []string{
+		"provision-my-mysql", "provision-my-mysql",
+		"deprovision-my-mysql", "deprovision-my-mysql",
+	})
+}
+
+func (s *S) TestBrokerClientStatusError(c *check.C) {
+	broker := newFakeBroker()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/last_operation") {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("broker is down"))
+			return
+		}
+		broker.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	client := &brokerClient{serviceName: "mysql", endpoint: ts.URL}
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql"}
+	_, err := client.Status(&instance, "")
+	c.Assert(err, check.ErrorMatches, `Failed to get status of instance my-mysql: invalid response from broker \(500\): broker is down`)
+}
+
+func (s *S) TestBrokerClientStatusUnknownState(c *check.C) {
+	broker := newFakeBroker()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/last_operation") {
+			w.Write([]byte(`{"state": "unknown"}`))
+			return
+		}
+		broker.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	client := &brokerClient{serviceName: "mysql", endpoint: ts.URL}
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql"}
+	status, err := client.Status(&instance, "")
+	c.Assert(err, check.ErrorMatches, `Failed to get status of instance my-mysql: unknown operation state "unknown"`)
+	c.Assert(status, check.Equals, "")
+}
+
+func (s *S) TestBrokerClientUpdatePlanAsync(c *check.C) {
+	old := provisionInitialInterval
+	provisionInitialInterval = 0
+	defer func() { provisionInitialInterval = old }()
+	broker := newFakeBroker()
+	broker.instances["my-mysql"] = map[string]interface{}{"plan_id": "plan-small"}
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PATCH" {
+			query = r.URL.RawQuery
+		}
+		broker.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	client := &brokerClient{serviceName: "mysql", endpoint: ts.URL}
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", PlanName: "small"}
+	err := client.UpdatePlan(&instance, "large", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(query, check.Equals, "accepts_incomplete=true")
+	broker.Lock()
+	defer broker.Unlock()
+	c.Assert(broker.instances["my-mysql"]["plan_id"], check.Equals, "plan-large")
+	c.Assert(broker.operations, check.DeepEquals, []string{"update-my-mysql", "update-my-mysql"})
+}
+
+func (s *S) TestBrokerClientUpdatePlanAsyncFailure(c *check.C) {
+	old := provisionInitialInterval
+	provisionInitialInterval = 0
+	defer func() { provisionInitialInterval = old }()
+	broker := newFakeBroker()
+	broker.instances["my-mysql"] = map[string]interface{}{"plan_id": "plan-small"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/last_operation") {
+			w.Write([]byte(`{"state": "failed", "description": "not enough capacity"}`))
+			return
+		}
+		broker.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	client := &brokerClient{serviceName: "mysql", endpoint: ts.URL}
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", PlanName: "small"}
+	err := client.UpdatePlan(&instance, "large", "")
+	c.Assert(err, check.ErrorMatches, "Failed to change the plan of the instance my-mysql: not enough capacity")
+}
+
+func (s *BindSuite) setFastProvisioning() func() {
+	old := provisionInitialInterval
+	provisionInitialInterval = 0
+	return func() { provisionInitialInterval = old }
+}
+
+func (s *S) TestBrokerClientRotateCredentials(c *check.C) {
+	broker := newFakeBroker()
+	ts := httptest.NewServer(broker)
+	defer ts.Close()
+	client := &brokerClient{serviceName: "mysql", endpoint: ts.URL}
+	instance := &ServiceInstance{Name: "my-mysql", ServiceName: "mysql", PlanName: "small"}
+	app := provisiontest.NewFakeApp("painkiller", "python", 0)
+	envs, err := client.RotateCredentials(instance, app, "new-binding")
+	c.Assert(err, check.IsNil)
+	c.Assert(envs, check.DeepEquals, map[string]string{"DATABASE_HOST": "10.0.0.1", "DATABASE_PORT": "3306"})
+	broker.Lock()
+	c.Assert(broker.bindings, check.DeepEquals, map[string]bool{"my-mysql/new-binding": true})
+	broker.Unlock()
+	err = client.RevokeCredentials(instance, app, "new-binding")
+	c.Assert(err, check.IsNil)
+	err = client.RevokeCredentials(instance, app, "new-binding")
+	c.Assert(err, check.Equals, ErrInstanceNotFoundInAPI)
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"net/url"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+)
+
+// Catalog holds structured metadata about a service, used by clients that
+// render the list of services available in tsuru.
+type Catalog struct {
+	DisplayName string
+	Categories  []string
+	IconURL     string
+	SLA         string
+	Costs       []PlanCost
+}
+
+// PlanCost is an estimate of how much using an instance of a plan costs.
+type PlanCost struct {
+	Plan     string
+	Amount   float64
+	Currency string
+	// Period is the time unit the amount refers to, like "month" or
+	// "hour".
+	Period string
+}
+
+// CostFor returns the cost estimate of the given plan, or nil if the catalog
+// doesn't include one.
+func (c *Catalog) CostFor(plan string) *PlanCost {
+	if c == nil {
+		return nil
+	}
+	for i := range c.Costs {
+		if c.Costs[i].Plan == plan {
+			return &c.Costs[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks whether the catalog metadata is consistent.
+func (c *Catalog) Validate() error {
+	if c.IconURL != "" {
+		u, err := url.Parse(c.IconURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid icon URL %q", c.IconURL)}
+		}
+	}
+	plans := make(map[string]bool, len(c.Costs))
+	for _, cost := range c.Costs {
+		if cost.Plan == "" {
+			return &tsuruErrors.ValidationError{Message: "plan name is required in cost estimates"}
+		}
+		if plans[cost.Plan] {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("duplicated cost estimate for plan %q", cost.Plan)}
+		}
+		plans[cost.Plan] = true
+		if cost.Amount < 0 {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("cost of plan %q must not be negative", cost.Plan)}
+		}
+		if cost.Currency == "" {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("currency is required in the cost of plan %q", cost.Plan)}
+		}
+	}
+	return nil
+}
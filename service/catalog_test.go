@@ -0,0 +1,71 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestCatalogValidate(c *check.C) {
+	tests := []struct {
+		catalog Catalog
+		err     string
+	}{
+		{Catalog{}, ""},
+		{Catalog{DisplayName: "MySQL", IconURL: "https://example.com/mysql.png", Costs: []PlanCost{
+			{Plan: "small", Amount: 10, Currency: "USD", Period: "month"},
+			{Plan: "large", Amount: 0, Currency: "USD"},
+		}}, ""},
+		{Catalog{IconURL: "mysql.png"}, `invalid icon URL "mysql.png"`},
+		{Catalog{IconURL: "ftp://example.com/mysql.png"}, `invalid icon URL "ftp://example.com/mysql.png"`},
+		{Catalog{Costs: []PlanCost{{Amount: 1, Currency: "USD"}}}, "plan name is required in cost estimates"},
+		{Catalog{Costs: []PlanCost{{Plan: "small", Amount: -1, Currency: "USD"}}}, `cost of plan "small" must not be negative`},
+		{Catalog{Costs: []PlanCost{{Plan: "small", Amount: 1}}}, `currency is required in the cost of plan "small"`},
+		{Catalog{Costs: []PlanCost{
+			{Plan: "small", Amount: 1, Currency: "USD"},
+			{Plan: "small", Amount: 2, Currency: "USD"},
+		}}, `duplicated cost estimate for plan "small"`},
+	}
+	for i, t := range tests {
+		err := t.catalog.Validate()
+		if t.err == "" {
+			c.Check(err, check.IsNil, check.Commentf("test %d", i))
+		} else {
+			c.Check(err, check.ErrorMatches, t.err, check.Commentf("test %d", i))
+		}
+	}
+}
+
+func (s *S) TestCatalogCostFor(c *check.C) {
+	var nilCatalog *Catalog
+	c.Assert(nilCatalog.CostFor("small"), check.IsNil)
+	catalog := &Catalog{Costs: []PlanCost{{Plan: "small", Amount: 10, Currency: "USD"}}}
+	c.Assert(catalog.CostFor("small"), check.DeepEquals, &PlanCost{Plan: "small", Amount: 10, Currency: "USD"})
+	c.Assert(catalog.CostFor("large"), check.IsNil)
+}
+
+func (s *S) TestGetPlansByServiceNameWithCatalogCosts(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name": "ignite", "description": "some value"}, {"name": "small", "description": "small plan"}]`))
+	}))
+	defer ts.Close()
+	srvc := Service{
+		Name:     "mysql",
+		Endpoint: map[string]string{"production": ts.URL},
+		Catalog:  &Catalog{Costs: []PlanCost{{Plan: "ignite", Amount: 99.9, Currency: "BRL", Period: "month"}}},
+	}
+	err := s.conn.Services().Insert(&srvc)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().RemoveId(srvc.Name)
+	plans, err := GetPlansByServiceName("mysql", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []Plan{
+		{Name: "ignite", Description: "some value", Cost: &PlanCost{Plan: "ignite", Amount: 99.9, Currency: "BRL", Period: "month"}},
+		{Name: "small", Description: "small plan"},
+	})
+}
@@ -26,6 +26,9 @@ var (
 	ErrInstanceAlreadyExistsInAPI = errors.New("instance already exists in the service API")
 	ErrInstanceNotFoundInAPI      = errors.New("instance does not exist in the service API")
 	ErrInstanceNotReady           = errors.New("instance is not ready yet")
+	ErrRotationNotSupported       = errors.New("service does not support credentials rotation")
+	ErrBackupNotSupported         = errors.New("service does not support backups")
+	ErrBackupNotFound             = errors.New("backup not found")
 
 	requestLatencies = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name: "tsuru_service_request_duration_seconds",
@@ -37,6 +40,15 @@ var (
 	}, []string{"service"})
 )
 
+// Instance statuses returned by Status. Any other value is a message sent by
+// the service API describing the status of the instance.
+const (
+	instanceStatusPending        = "pending"
+	instanceStatusUp             = "up"
+	instanceStatusDown           = "down"
+	instanceStatusNotImplemented = "not implemented for this service"
+)
+
 func init() {
 	prometheus.MustRegister(requestLatencies)
 	prometheus.MustRegister(requestErrors)
@@ -127,10 +139,17 @@ func (c *Client) Create(instance *ServiceInstance, user, requestID string) error
 	if instance.Description != "" {
 		params["description"] = []string{instance.Description}
 	}
+	for k, v := range instance.Parameters {
+		params[ParametersPrefix+k] = []string{v}
+	}
 	log.Debugf("Attempting to call creation of service instance for %q, params: %#v", instance.ServiceName, params)
 	resp, err = c.issueRequest("/resources", "POST", params)
 	if err == nil {
 		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusAccepted {
+			instance.State = InstanceStatePending
+			return nil
+		}
 		if resp.StatusCode < 300 {
 			return nil
 		}
@@ -161,6 +180,30 @@ func (c *Client) Destroy(instance *ServiceInstance, requestID string) error {
 	return err
 }
 
+// UpdatePlan asks the service API to move the instance to another plan.
+// The api should be prepared to receive the request,
+// like below:
+// PUT /resources/<name>/plan
+func (c *Client) UpdatePlan(instance *ServiceInstance, plan, requestID string) error {
+	log.Debugf("Attempting to change plan of service instance %q at %q api to %q", instance.Name, instance.ServiceName, plan)
+	params := map[string][]string{
+		"plan":      {plan},
+		"requestID": {requestID},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/plan", "PUT", params)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return ErrInstanceNotFoundInAPI
+		}
+	}
+	err = errors.Wrapf(c.buildErrorMessage(err, resp), "Failed to change the plan of the instance %s", instance.Name)
+	return log.WrapError(err)
+}
+
 func (c *Client) BindApp(instance *ServiceInstance, app bind.App) (map[string]string, error) {
 	log.Debugf("Calling bind of instance %q and %q app at %q API",
 		instance.Name, app.GetName(), instance.ServiceName)
@@ -168,6 +211,9 @@ func (c *Client) BindApp(instance *ServiceInstance, app bind.App) (map[string]st
 	params := map[string][]string{
 		"app-host": {app.GetIp()},
 	}
+	if b := instance.BindingFor(app.GetName()); b != nil {
+		params["binding-id"] = []string{b.ID}
+	}
 	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/bind-app", "POST", params)
 	if err != nil {
 		return nil, log.WrapError(errors.Wrapf(err, `Failed to bind app %q to service instance "%s/%s"`, app.GetName(), instance.ServiceName, instance.Name))
@@ -231,6 +277,9 @@ func (c *Client) UnbindApp(instance *ServiceInstance, app bind.App) error {
 	params := map[string][]string{
 		"app-host": {app.GetIp()},
 	}
+	if b := instance.BindingFor(app.GetName()); b != nil {
+		params["binding-id"] = []string{b.ID}
+	}
 	resp, err := c.issueRequest(url, "DELETE", params)
 	if err == nil {
 		defer resp.Body.Close()
@@ -267,6 +316,69 @@ func (c *Client) UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.U
 	return err
 }
 
+// RotateCredentials asks the service API for a new set of credentials for
+// the binding between the instance and the app. The new credentials are
+// identified by bindingID while the current ones remain valid until revoked.
+// The api should be prepared to receive the request,
+// like below:
+// POST /resources/<name>/bind-app/credentials
+func (c *Client) RotateCredentials(instance *ServiceInstance, app bind.App, bindingID string) (map[string]string, error) {
+	log.Debugf("Calling credentials rotation of instance %q and %q app at %q API", instance.Name, app.GetName(), instance.ServiceName)
+	params := map[string][]string{
+		"app-host":   {app.GetIp()},
+		"binding-id": {bindingID},
+	}
+	if b := instance.BindingFor(app.GetName()); b != nil {
+		params["previous-binding-id"] = []string{b.ID}
+	}
+	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/bind-app/credentials", "POST", params)
+	if err != nil {
+		return nil, log.WrapError(errors.Wrapf(err, `Failed to rotate credentials of app %q in service instance "%s/%s"`, app.GetName(), instance.ServiceName, instance.Name))
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, ErrRotationNotSupported
+	case http.StatusPreconditionFailed:
+		return nil, ErrInstanceNotReady
+	}
+	if resp.StatusCode > 299 {
+		err = errors.Wrapf(c.buildErrorMessage(nil, resp), `Failed to rotate credentials of app %q in service instance "%s/%s"`, app.GetName(), instance.ServiceName, instance.Name)
+		return nil, log.WrapError(err)
+	}
+	var result map[string]string
+	err = c.jsonFromResponse(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RevokeCredentials asks the service API to revoke the credentials
+// identified by bindingID, issued before a rotation.
+// The api should be prepared to receive the request,
+// like below:
+// DELETE /resources/<name>/bind-app/credentials
+func (c *Client) RevokeCredentials(instance *ServiceInstance, app bind.App, bindingID string) error {
+	log.Debugf("Calling credentials revocation of instance %q and %q app at %q API", instance.Name, app.GetName(), instance.ServiceName)
+	params := map[string][]string{
+		"app-host":   {app.GetIp()},
+		"binding-id": {bindingID},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/bind-app/credentials", "DELETE", params)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return ErrInstanceNotFoundInAPI
+		}
+	}
+	err = errors.Wrapf(c.buildErrorMessage(err, resp), `Failed to revoke credentials of app %q in service instance "%s/%s"`, app.GetName(), instance.ServiceName, instance.Name)
+	return log.WrapError(err)
+}
+
 func (c *Client) Status(instance *ServiceInstance, requestID string) (string, error) {
 	log.Debugf("Attempting to call status of service instance %q at %q api", instance.Name, instance.ServiceName)
 	var (
@@ -285,13 +397,13 @@ func (c *Client) Status(instance *ServiceInstance, requestID string) (string, er
 			data, err = ioutil.ReadAll(resp.Body)
 			return string(data), err
 		case http.StatusAccepted:
-			return "pending", nil
+			return instanceStatusPending, nil
 		case http.StatusNoContent:
-			return "up", nil
+			return instanceStatusUp, nil
 		case http.StatusNotFound:
-			return "not implemented for this service", nil
+			return instanceStatusNotImplemented, nil
 		case http.StatusInternalServerError:
-			return "down", nil
+			return instanceStatusDown, nil
 		}
 	}
 	err = errors.Wrapf(c.buildErrorMessage(err, resp), "Failed to get status of instance %s", instance.Name)
@@ -349,6 +461,119 @@ func (c *Client) Plans(requestID string) ([]Plan, error) {
 	return result, nil
 }
 
+// Parameters returns the schema of the parameters accepted by the service
+// when creating instances. Services are not required to implement it, in
+// which case they must answer with a 404 and a nil slice is returned.
+// The api should be prepared to receive the request,
+// like below:
+// GET /resources/parameters
+func (c *Client) Parameters(requestID string) ([]Parameter, error) {
+	params := map[string][]string{
+		"requestID": {requestID},
+	}
+	resp, err := c.issueRequest("/resources/parameters", "GET", params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = errors.Wrap(c.buildErrorMessage(nil, resp), "Failed to get the parameters of the service")
+		return nil, log.WrapError(err)
+	}
+	result := []Parameter{}
+	err = c.jsonFromResponse(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListBackups returns the backups of the instance kept by the service.
+// The api should be prepared to receive the request,
+// like below:
+// GET /resources/<name>/backups
+func (c *Client) ListBackups(instance *ServiceInstance, requestID string) ([]Backup, error) {
+	log.Debugf("Attempting to call backup list of service instance %q at %q api", instance.Name, instance.ServiceName)
+	params := map[string][]string{
+		"requestID": {requestID},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/backups", "GET", params)
+	if err != nil {
+		return nil, log.WrapError(errors.Wrapf(err, "Failed to list backups of the instance %s", instance.Name))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrBackupNotSupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = errors.Wrapf(c.buildErrorMessage(nil, resp), "Failed to list backups of the instance %s", instance.Name)
+		return nil, log.WrapError(err)
+	}
+	var result []Backup
+	err = c.jsonFromResponse(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CreateBackup asks the service to take a new backup of the instance.
+// The api should be prepared to receive the request,
+// like below:
+// POST /resources/<name>/backups
+func (c *Client) CreateBackup(instance *ServiceInstance, description, requestID string) (*Backup, error) {
+	log.Debugf("Attempting to call backup creation of service instance %q at %q api", instance.Name, instance.ServiceName)
+	params := map[string][]string{
+		"description": {description},
+		"requestID":   {requestID},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/backups", "POST", params)
+	if err != nil {
+		return nil, log.WrapError(errors.Wrapf(err, "Failed to create backup of the instance %s", instance.Name))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrBackupNotSupported
+	}
+	if resp.StatusCode > 299 {
+		err = errors.Wrapf(c.buildErrorMessage(nil, resp), "Failed to create backup of the instance %s", instance.Name)
+		return nil, log.WrapError(err)
+	}
+	var result Backup
+	err = c.jsonFromResponse(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RestoreBackup asks the service to restore the instance from the given
+// backup.
+// The api should be prepared to receive the request,
+// like below:
+// POST /resources/<name>/backups/<backup>/restore
+func (c *Client) RestoreBackup(instance *ServiceInstance, backupID, requestID string) error {
+	log.Debugf("Attempting to call backup restore of service instance %q at %q api", instance.Name, instance.ServiceName)
+	params := map[string][]string{
+		"requestID": {requestID},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/backups/"+url.PathEscape(backupID)+"/restore", "POST", params)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return ErrBackupNotFound
+		}
+	}
+	err = errors.Wrapf(c.buildErrorMessage(err, resp), "Failed to restore backup %s of the instance %s", backupID, instance.Name)
+	return log.WrapError(err)
+}
+
 // Proxy is a proxy between tsuru and the service.
 // This method allow customized service methods.
 func (c *Client) Proxy(path string, w http.ResponseWriter, r *http.Request) error {
@@ -630,3 +630,101 @@ func (s *S) TestProxyWithBodyAndHeaders(c *check.C) {
 	c.Assert(proxiedRequest.Host, check.Equals, tsUrl.Host)
 	c.Assert(string(readBodyStr), check.Equals, `{"bla": "bla"}`)
 }
+
+func (s *S) TestCreateAsync(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "his-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.Create(&instance, "my@user", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(instance.State, check.Equals, InstanceStatePending)
+}
+
+func (s *S) TestUpdatePlan(c *check.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "his-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.UpdatePlan(&instance, "large", "")
+	c.Assert(err, check.IsNil)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(h.url, check.Equals, "/resources/his-redis/plan")
+	c.Assert(h.method, check.Equals, "PUT")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, check.IsNil)
+	c.Assert(map[string][]string(v), check.DeepEquals, map[string][]string{"plan": {"large"}})
+}
+
+func (s *S) TestUpdatePlanNotFound(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(notFoundHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "his-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.UpdatePlan(&instance, "large", "")
+	c.Assert(err, check.Equals, ErrInstanceNotFoundInAPI)
+}
+
+func (s *S) TestCreateWithParameters(c *check.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{
+		Name:        "my-redis",
+		ServiceName: "redis",
+		TeamOwner:   "myteam",
+		Parameters:  map[string]string{"region": "us-east"},
+	}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.Create(&instance, "my@user", "")
+	c.Assert(err, check.IsNil)
+	h.Lock()
+	defer h.Unlock()
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, check.IsNil)
+	c.Assert(map[string][]string(v), check.DeepEquals, map[string][]string{
+		"name":              {"my-redis"},
+		"user":              {"my@user"},
+		"team":              {"myteam"},
+		"parameters.region": {"us-east"},
+	})
+}
+
+func (s *S) TestParameters(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/resources/parameters")
+		w.Write([]byte(`[{"name": "region", "required": true, "values": ["us-east", "sa-east"]}]`))
+	}))
+	defer ts.Close()
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	params, err := client.Parameters("")
+	c.Assert(err, check.IsNil)
+	c.Assert(params, check.DeepEquals, []Parameter{
+		{Name: "region", Required: true, Values: []string{"us-east", "sa-east"}},
+	})
+}
+
+func (s *S) TestParametersNotImplemented(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(notFoundHandler))
+	defer ts.Close()
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	params, err := client.Parameters("")
+	c.Assert(err, check.IsNil)
+	c.Assert(params, check.IsNil)
+}
+
+func (s *S) TestParametersFailure(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("something went wrong"))
+	}))
+	defer ts.Close()
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	params, err := client.Parameters("")
+	c.Assert(err, check.ErrorMatches, "Failed to get the parameters of the service: .*something went wrong.*")
+	c.Assert(params, check.IsNil)
+}
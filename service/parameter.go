@@ -0,0 +1,103 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+)
+
+// ParametersPrefix is the prefix used in form fields carrying service
+// instance parameters, both in tsuru API and in service API requests.
+const ParametersPrefix = "parameters."
+
+// Parameter describes a parameter accepted by a service when creating
+// instances, as published by the service API.
+type Parameter struct {
+	Name        string
+	Description string
+	Required    bool
+	Default     string
+	// Values lists the accepted values for the parameter, an empty list
+	// means any value is accepted.
+	Values []string
+}
+
+// GetParametersByServiceName returns the parameters schema published by the
+// service. Services that do not publish a schema return a nil slice.
+func GetParametersByServiceName(serviceName, requestID string) ([]Parameter, error) {
+	s := Service{Name: serviceName}
+	err := s.Get()
+	if err != nil {
+		return nil, err
+	}
+	return s.parameters(requestID)
+}
+
+func (s *Service) parameters(requestID string) ([]Parameter, error) {
+	endpoint, err := s.getClient("production")
+	if err != nil {
+		return nil, err
+	}
+	return endpoint.Parameters(requestID)
+}
+
+// ValidateParameters checks the given parameters against the schema,
+// filling in default values. Parameters are not validated when the schema is
+// nil.
+func ValidateParameters(params map[string]string, schema []Parameter) (map[string]string, error) {
+	if schema == nil {
+		return params, nil
+	}
+	known := make(map[string]Parameter, len(schema))
+	for _, p := range schema {
+		known[p.Name] = p
+	}
+	var unknown []string
+	for name := range params {
+		if _, ok := known[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, &tsuruErrors.ValidationError{Message: fmt.Sprintf("unknown parameters: %s", strings.Join(unknown, ", "))}
+	}
+	result := make(map[string]string, len(schema))
+	for _, p := range schema {
+		value, ok := params[p.Name]
+		if !ok || value == "" {
+			if p.Default == "" {
+				if p.Required {
+					return nil, &tsuruErrors.ValidationError{Message: fmt.Sprintf("parameter %q is required", p.Name)}
+				}
+				continue
+			}
+			value = p.Default
+		}
+		if len(p.Values) > 0 && !containsValue(p.Values, value) {
+			return nil, &tsuruErrors.ValidationError{
+				Message: fmt.Sprintf("invalid value %q for parameter %q, accepted values: %s", value, p.Name, strings.Join(p.Values, ", ")),
+			}
+		}
+		result[p.Name] = value
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestValidateParameters(c *check.C) {
+	schema := []Parameter{
+		{Name: "engine-version", Required: true, Values: []string{"5.6", "5.7"}},
+		{Name: "region", Default: "us-east"},
+		{Name: "backup-policy"},
+	}
+	params, err := ValidateParameters(map[string]string{"engine-version": "5.7"}, schema)
+	c.Assert(err, check.IsNil)
+	c.Assert(params, check.DeepEquals, map[string]string{"engine-version": "5.7", "region": "us-east"})
+	params, err = ValidateParameters(map[string]string{"engine-version": "5.6", "region": "sa-east", "backup-policy": "daily"}, schema)
+	c.Assert(err, check.IsNil)
+	c.Assert(params, check.DeepEquals, map[string]string{"engine-version": "5.6", "region": "sa-east", "backup-policy": "daily"})
+}
+
+func (s *S) TestValidateParametersErrors(c *check.C) {
+	schema := []Parameter{
+		{Name: "engine-version", Required: true, Values: []string{"5.6", "5.7"}},
+	}
+	_, err := ValidateParameters(map[string]string{"engine-version": "5.6", "zone": "a", "disk": "10"}, schema)
+	c.Assert(err, check.ErrorMatches, "unknown parameters: disk, zone")
+	_, err = ValidateParameters(map[string]string{}, schema)
+	c.Assert(err, check.ErrorMatches, `parameter "engine-version" is required`)
+	_, err = ValidateParameters(map[string]string{"engine-version": "8.0"}, schema)
+	c.Assert(err, check.ErrorMatches, `invalid value "8.0" for parameter "engine-version", accepted values: 5.6, 5.7`)
+}
+
+func (s *S) TestValidateParametersWithoutSchema(c *check.C) {
+	params, err := ValidateParameters(map[string]string{"anything": "goes"}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(params, check.DeepEquals, map[string]string{"anything": "goes"})
+}
+
+func (s *S) TestServiceParametersUnknownEndpoint(c *check.C) {
+	srv := Service{Name: "mysql"}
+	params, err := srv.parameters("")
+	c.Assert(err, check.ErrorMatches, "Unknown endpoint: production")
+	c.Assert(params, check.IsNil)
+}
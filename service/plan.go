@@ -8,6 +8,7 @@ package service
 type Plan struct {
 	Name        string
 	Description string
+	Cost        *PlanCost `json:",omitempty"`
 }
 
 func GetPlansByServiceName(serviceName, requestID string) ([]Plan, error) {
@@ -24,6 +25,11 @@ func GetPlansByServiceName(serviceName, requestID string) ([]Plan, error) {
 	if err != nil {
 		return nil, err
 	}
+	for i := range plans {
+		if cost := s.Catalog.CostFor(plans[i].Name); cost != nil {
+			plans[i].Cost = cost
+		}
+	}
 	return plans, nil
 }
 
@@ -0,0 +1,129 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	provisionInitialInterval = 2 * time.Second
+	provisionMaxInterval     = time.Minute
+	provisionTimeout         = 30 * time.Minute
+	// provisionLockExpireTimeout must be longer than provisionMaxInterval,
+	// as the lock is only updated between status checks.
+	provisionLockExpireTimeout = 5 * time.Minute
+)
+
+// WaitProvisioning polls the service API for the status of an instance
+// created asynchronously, backing off between attempts, until the instance
+// is up, the API reports it as down or the provisioning times out. Only an
+// explicit up status marks the instance as ready. The instance state is
+// updated in the database accordingly and progress is written to w.
+func WaitProvisioning(si *ServiceInstance, w io.Writer, requestID string) error {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	endpoint, err := si.Service().getClient("production")
+	if err != nil {
+		return si.finishProvisioning(w, err)
+	}
+	interval := provisionInitialInterval
+	deadline := time.Now().Add(provisionTimeout)
+	for {
+		err = si.updateData(bson.M{"$set": bson.M{"provisionlockupdatetime": time.Now().UTC()}})
+		if err != nil {
+			log.Errorf("[provision service instance] unable to update lock of %s/%s: %s", si.ServiceName, si.Name, err)
+		}
+		status, err := endpoint.Status(si, requestID)
+		switch {
+		case err != nil:
+			log.Errorf("[provision service instance] unable to get status of %s/%s: %s", si.ServiceName, si.Name, err)
+			fmt.Fprintf(w, "Unable to get the instance status: %s\n", err)
+		case status == instanceStatusUp:
+			return si.finishProvisioning(w, nil)
+		case status == instanceStatusDown:
+			return si.finishProvisioning(w, errors.New("service API reported the instance as down"))
+		case status == instanceStatusNotImplemented:
+			return si.finishProvisioning(w, errors.New("service API does not report the instance status"))
+		case status == instanceStatusPending:
+			fmt.Fprintf(w, "Instance %q is still being provisioned.\n", si.Name)
+		default:
+			fmt.Fprintf(w, "Instance %q is still being provisioned, service API reported: %s\n", si.Name, status)
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return si.finishProvisioning(w, errors.Errorf("timeout after %v waiting for the instance to be provisioned", provisionTimeout))
+		}
+		time.Sleep(interval)
+		interval *= 2
+		if interval > provisionMaxInterval {
+			interval = provisionMaxInterval
+		}
+	}
+}
+
+func (si *ServiceInstance) finishProvisioning(w io.Writer, provisionErr error) error {
+	si.State = InstanceStateReady
+	si.StateMessage = ""
+	si.Operation = ""
+	if provisionErr != nil {
+		si.State = InstanceStateFailed
+		si.StateMessage = provisionErr.Error()
+	}
+	err := si.updateData(bson.M{
+		"$set":   bson.M{"state": si.State, "statemessage": si.StateMessage},
+		"$unset": bson.M{"operation": "", "provisionlockupdatetime": ""},
+	})
+	if err != nil {
+		return err
+	}
+	if provisionErr != nil {
+		fmt.Fprintf(w, "Instance %q provisioning failed: %s\n", si.Name, provisionErr)
+		return errors.Wrap(ErrInstanceProvisionFailed, provisionErr.Error())
+	}
+	fmt.Fprintf(w, "Instance %q is ready.\n", si.Name)
+	return nil
+}
+
+// ClaimPendingServiceInstance atomically takes over the provisioning of a
+// pending instance whose lock is not being updated anymore, usually because
+// the API process polling it was restarted. It returns nil when there are no
+// instances left to claim.
+func ClaimPendingServiceInstance() (*ServiceInstance, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	now := time.Now().UTC()
+	query := bson.M{
+		"state": InstanceStatePending,
+		"$or": []bson.M{
+			{"provisionlockupdatetime": bson.M{"$exists": false}},
+			{"provisionlockupdatetime": bson.M{"$lt": now.Add(-provisionLockExpireTimeout)}},
+		},
+	}
+	var si ServiceInstance
+	_, err = conn.ServiceInstances().Find(query).Apply(mgo.Change{
+		Update:    bson.M{"$set": bson.M{"provisionlockupdatetime": now}},
+		ReturnNew: true,
+	}, &si)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &si, nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *InstanceSuite) provisioningServer(c *check.C, statuses ...int) *httptest.Server {
+	var calls int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		i := int(atomic.AddInt32(&calls, 1)) - 1
+		if i >= len(statuses) {
+			i = len(statuses) - 1
+		}
+		w.WriteHeader(statuses[i])
+	}))
+}
+
+func (s *InstanceSuite) setProvisionIntervals(timeout time.Duration) func() {
+	oldInitial, oldMax, oldTimeout := provisionInitialInterval, provisionMaxInterval, provisionTimeout
+	provisionInitialInterval = time.Millisecond
+	provisionMaxInterval = 5 * time.Millisecond
+	provisionTimeout = timeout
+	return func() {
+		provisionInitialInterval, provisionMaxInterval, provisionTimeout = oldInitial, oldMax, oldTimeout
+	}
+}
+
+func (s *InstanceSuite) TestCreateServiceInstanceAsync(c *check.C) {
+	ts := s.provisioningServer(c, http.StatusAccepted)
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	instance := ServiceInstance{Name: "instance", TeamOwner: s.team.Name}
+	err = CreateServiceInstance(instance, &srv, s.user, "")
+	c.Assert(err, check.IsNil)
+	si, err := GetServiceInstance("mongodb", "instance")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.State, check.Equals, InstanceStatePending)
+	c.Assert(si.CheckReady(), check.Equals, ErrInstanceNotReady)
+}
+
+func (s *InstanceSuite) TestWaitProvisioning(c *check.C) {
+	defer s.setProvisionIntervals(time.Minute)()
+	ts := s.provisioningServer(c, http.StatusAccepted, http.StatusAccepted, http.StatusNoContent)
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "instance", ServiceName: "mongodb", State: InstanceStatePending}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = WaitProvisioning(&si, &buf, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, `(?s).*still being provisioned.*Instance "instance" is ready.\n`)
+	dbInstance, err := GetServiceInstance("mongodb", "instance")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.State, check.Equals, InstanceStateReady)
+	c.Assert(dbInstance.CheckReady(), check.IsNil)
+}
+
+func (s *InstanceSuite) TestWaitProvisioningDown(c *check.C) {
+	defer s.setProvisionIntervals(time.Minute)()
+	ts := s.provisioningServer(c, http.StatusAccepted, http.StatusInternalServerError)
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "instance", ServiceName: "mongodb", State: InstanceStatePending}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	err = WaitProvisioning(&si, nil, "")
+	c.Assert(err, check.ErrorMatches, "service API reported the instance as down: service instance provisioning failed")
+	dbInstance, err := GetServiceInstance("mongodb", "instance")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.State, check.Equals, InstanceStateFailed)
+	c.Assert(dbInstance.StateMessage, check.Equals, "service API reported the instance as down")
+	c.Assert(dbInstance.CheckReady(), check.Equals, ErrInstanceProvisionFailed)
+}
+
+func (s *InstanceSuite) TestWaitProvisioningTimeout(c *check.C) {
+	defer s.setProvisionIntervals(20 * time.Millisecond)()
+	ts := s.provisioningServer(c, http.StatusAccepted)
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "instance", ServiceName: "mongodb", State: InstanceStatePending}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	err = WaitProvisioning(&si, nil, "")
+	c.Assert(err, check.ErrorMatches, "timeout after .* waiting for the instance to be provisioned: .*")
+	dbInstance, err := GetServiceInstance("mongodb", "instance")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.State, check.Equals, InstanceStateFailed)
+}
+
+func (s *InstanceSuite) TestBindAppInstanceNotReady(c *check.C) {
+	si := ServiceInstance{Name: "instance", ServiceName: "mongodb", State: InstanceStatePending}
+	err := si.BindApp(nil, false, nil)
+	c.Assert(err, check.Equals, ErrInstanceNotReady)
+}
+
+func (s *InstanceSuite) TestWaitProvisioningOnlyReadyWhenUp(c *check.C) {
+	defer s.setProvisionIntervals(time.Minute)()
+	ts := s.provisioningServer(c, http.StatusOK, http.StatusNoContent)
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "instance", ServiceName: "mongodb", State: InstanceStatePending}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = WaitProvisioning(&si, &buf, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, `(?s).*still being provisioned, service API reported: .*Instance "instance" is ready.\n`)
+}
+
+func (s *InstanceSuite) TestWaitProvisioningStatusNotImplemented(c *check.C) {
+	defer s.setProvisionIntervals(time.Minute)()
+	ts := s.provisioningServer(c, http.StatusNotFound)
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "instance", ServiceName: "mongodb", State: InstanceStatePending}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	err = WaitProvisioning(&si, nil, "")
+	c.Assert(err, check.ErrorMatches, "service API does not report the instance status: service instance provisioning failed")
+	dbInstance, err := GetServiceInstance("mongodb", "instance")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.State, check.Equals, InstanceStateFailed)
+}
+
+func (s *InstanceSuite) TestClaimPendingServiceInstance(c *check.C) {
+	err := s.conn.ServiceInstances().Insert(
+		ServiceInstance{Name: "pending", ServiceName: "mongodb", State: InstanceStatePending},
+		ServiceInstance{Name: "ready", ServiceName: "mongodb", State: InstanceStateReady},
+		ServiceInstance{Name: "legacy", ServiceName: "mongodb"},
+	)
+	c.Assert(err, check.IsNil)
+	si, err := ClaimPendingServiceInstance()
+	c.Assert(err, check.IsNil)
+	c.Assert(si, check.NotNil)
+	c.Assert(si.Name, check.Equals, "pending")
+	c.Assert(si.ProvisionLockUpdateTime.IsZero(), check.Equals, false)
+	si, err = ClaimPendingServiceInstance()
+	c.Assert(err, check.IsNil)
+	c.Assert(si, check.IsNil)
+}
+
+func (s *InstanceSuite) TestClaimPendingServiceInstanceExpiredLock(c *check.C) {
+	err := s.conn.ServiceInstances().Insert(
+		ServiceInstance{Name: "locked", ServiceName: "mongodb", State: InstanceStatePending, ProvisionLockUpdateTime: time.Now().UTC()},
+		ServiceInstance{Name: "expired", ServiceName: "mongodb", State: InstanceStatePending, ProvisionLockUpdateTime: time.Now().UTC().Add(-provisionLockExpireTimeout - time.Minute)},
+	)
+	c.Assert(err, check.IsNil)
+	si, err := ClaimPendingServiceInstance()
+	c.Assert(err, check.IsNil)
+	c.Assert(si, check.NotNil)
+	c.Assert(si.Name, check.Equals, "expired")
+	si, err = ClaimPendingServiceInstance()
+	c.Assert(err, check.IsNil)
+	c.Assert(si, check.IsNil)
+}
+
+func (s *InstanceSuite) TestWaitProvisioningReleasesLock(c *check.C) {
+	defer s.setProvisionIntervals(time.Minute)()
+	ts := s.provisioningServer(c, http.StatusNoContent)
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "instance", ServiceName: "mongodb", State: InstanceStatePending, ProvisionLockUpdateTime: time.Now().UTC()}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	err = WaitProvisioning(&si, nil, "")
+	c.Assert(err, check.IsNil)
+	dbInstance, err := GetServiceInstance("mongodb", "instance")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.State, check.Equals, InstanceStateReady)
+	c.Assert(dbInstance.ProvisionLockUpdateTime.IsZero(), check.Equals, true)
+}
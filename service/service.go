@@ -9,11 +9,16 @@ import (
 	"regexp"
 
 	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/bind"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"gopkg.in/mgo.v2/bson"
 )
 
+// BrokerAPIType is the APIType of services implementing the Open Service
+// Broker API.
+const BrokerAPIType = "osb"
+
 type Service struct {
 	Name         string `bson:"_id"`
 	Username     string
@@ -23,10 +28,36 @@ type Service struct {
 	Teams        []string
 	Doc          string
 	IsRestricted bool `bson:"is_restricted"`
+	// APIType selects the contract used to talk to the service endpoint,
+	// an empty value means tsuru's own service API.
+	APIType string   `bson:"api_type,omitempty"`
+	Catalog *Catalog `bson:",omitempty"`
+}
+
+// ServiceClient is implemented by the clients that talk to service APIs.
+type ServiceClient interface {
+	Create(instance *ServiceInstance, user, requestID string) error
+	UpdatePlan(instance *ServiceInstance, plan, requestID string) error
+	Destroy(instance *ServiceInstance, requestID string) error
+	BindApp(instance *ServiceInstance, app bind.App) (map[string]string, error)
+	BindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error
+	UnbindApp(instance *ServiceInstance, app bind.App) error
+	UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error
+	RotateCredentials(instance *ServiceInstance, app bind.App, bindingID string) (map[string]string, error)
+	RevokeCredentials(instance *ServiceInstance, app bind.App, bindingID string) error
+	Status(instance *ServiceInstance, requestID string) (string, error)
+	Info(instance *ServiceInstance, requestID string) ([]map[string]string, error)
+	Plans(requestID string) ([]Plan, error)
+	Parameters(requestID string) ([]Parameter, error)
+	ListBackups(instance *ServiceInstance, requestID string) ([]Backup, error)
+	CreateBackup(instance *ServiceInstance, description, requestID string) (*Backup, error)
+	RestoreBackup(instance *ServiceInstance, backupID, requestID string) error
+	Proxy(path string, w http.ResponseWriter, r *http.Request) error
 }
 
 var (
 	ErrServiceAlreadyExists = errors.New("Service already exists.")
+	ErrInvalidAPIType       = errors.New("invalid service API type")
 )
 
 func (s *Service) Get() error {
@@ -74,16 +105,29 @@ func (s *Service) Delete() error {
 	return err
 }
 
-func (s *Service) getClient(endpoint string) (cli *Client, err error) {
-	if e, ok := s.Endpoint[endpoint]; ok {
-		if p, _ := regexp.MatchString("^https?://", e); !p {
-			e = "http://" + e
-		}
-		cli = &Client{serviceName: s.Name, endpoint: e, username: s.GetUsername(), password: s.Password}
-	} else {
-		err = errors.New("Unknown endpoint: " + endpoint)
+func (s *Service) getClient(endpoint string) (ServiceClient, error) {
+	e, ok := s.Endpoint[endpoint]
+	if !ok {
+		return nil, errors.New("Unknown endpoint: " + endpoint)
+	}
+	if p, _ := regexp.MatchString("^https?://", e); !p {
+		e = "http://" + e
+	}
+	switch s.APIType {
+	case "":
+		return &Client{serviceName: s.Name, endpoint: e, username: s.GetUsername(), password: s.Password}, nil
+	case BrokerAPIType:
+		return &brokerClient{serviceName: s.Name, endpoint: e, username: s.GetUsername(), password: s.Password}, nil
 	}
-	return
+	return nil, ErrInvalidAPIType
+}
+
+// ValidateAPIType checks whether the given API type is supported.
+func ValidateAPIType(apiType string) error {
+	if apiType != "" && apiType != BrokerAPIType {
+		return ErrInvalidAPIType
+	}
+	return nil
 }
 
 func (s *Service) GetUsername() string {
@@ -180,6 +224,7 @@ type ServiceModel struct {
 	Instances        []string               `json:"instances"`
 	Plans            []string               `json:"plans"`
 	ServiceInstances []ServiceInstanceModel `json:"service_instances"`
+	Catalog          *Catalog               `json:"catalog,omitempty"`
 }
 
 // Proxy is a proxy between tsuru and the service.
@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/tsuru/tsuru/action"
@@ -32,9 +33,17 @@ var (
 	ErrUnitAlreadyBound          = errors.New("unit is already bound to this service instance")
 	ErrUnitNotBound              = errors.New("unit is not bound to this service instance")
 	ErrServiceInstanceBound      = errors.New("This service instance is bound to at least one app. Unbind them before removing it")
+	ErrInstanceProvisionFailed   = errors.New("service instance provisioning failed")
+	ErrInvalidPlan               = errors.New("invalid plan for this service")
 	instanceNameRegexp           = regexp.MustCompile(`^[A-Za-z][-a-zA-Z0-9_]+$`)
 )
 
+const (
+	InstanceStatePending = "pending"
+	InstanceStateReady   = "ready"
+	InstanceStateFailed  = "failed"
+)
+
 type ServiceInstance struct {
 	Name        string
 	Id          int
@@ -46,6 +55,20 @@ type ServiceInstance struct {
 	TeamOwner   string
 	Description string
 	Tags        []string
+	// State holds the provisioning state of instances created
+	// asynchronously. Instances created synchronously keep it empty and are
+	// considered ready.
+	State        string            `bson:",omitempty"`
+	StateMessage string            `bson:",omitempty"`
+	Parameters   map[string]string `bson:",omitempty"`
+	Bindings     []Binding         `bson:",omitempty"`
+	// Operation identifies the asynchronous operation running in service
+	// brokers while the instance is pending.
+	Operation string `bson:",omitempty"`
+	// ProvisionLockUpdateTime is periodically updated by the API process
+	// polling a pending instance, so other processes don't resume its
+	// provisioning while the lock is held.
+	ProvisionLockUpdateTime time.Time `bson:",omitempty" json:"-"`
 }
 
 // DeleteInstance deletes the service instance from the database.
@@ -88,9 +111,28 @@ func (si *ServiceInstance) MarshalJSON() ([]byte, error) {
 		"Info":        info,
 		"TeamOwner":   si.TeamOwner,
 	}
+	if len(si.Parameters) > 0 {
+		data["Parameters"] = si.Parameters
+	}
+	if si.State != "" {
+		data["State"] = si.State
+		data["StateMessage"] = si.StateMessage
+	}
 	return json.Marshal(&data)
 }
 
+// CheckReady returns an error when the instance is still being provisioned
+// or when its provisioning failed.
+func (si *ServiceInstance) CheckReady() error {
+	switch si.State {
+	case InstanceStatePending:
+		return ErrInstanceNotReady
+	case InstanceStateFailed:
+		return ErrInstanceProvisionFailed
+	}
+	return nil
+}
+
 func (si *ServiceInstance) Info(requestID string) (map[string]string, error) {
 	endpoint, err := si.Service().getClient("production")
 	if err != nil {
@@ -155,6 +197,31 @@ func (si *ServiceInstance) Update(updateData ServiceInstance) error {
 	return conn.ServiceInstances().Update(bson.M{"name": si.Name, "service_name": si.ServiceName}, updateData)
 }
 
+// ChangePlan moves the service instance to another plan offered by the
+// service.
+func (si *ServiceInstance) ChangePlan(planName, requestID string) error {
+	if err := si.CheckReady(); err != nil {
+		return err
+	}
+	plan, err := GetPlanByServiceNameAndPlanName(si.ServiceName, planName, requestID)
+	if err != nil {
+		return err
+	}
+	if plan.Name == "" {
+		return ErrInvalidPlan
+	}
+	endpoint, err := si.Service().getClient("production")
+	if err != nil {
+		return err
+	}
+	err = endpoint.UpdatePlan(si, plan.Name, requestID)
+	if err != nil {
+		return err
+	}
+	si.PlanName = plan.Name
+	return si.updateData(bson.M{"$set": bson.M{"plan_name": plan.Name}})
+}
+
 func (si *ServiceInstance) updateData(update bson.M) error {
 	conn, err := db.Conn()
 	if err != nil {
@@ -166,6 +233,9 @@ func (si *ServiceInstance) updateData(update bson.M) error {
 
 // BindApp makes the bind between the service instance and an app.
 func (si *ServiceInstance) BindApp(app bind.App, shouldRestart bool, writer io.Writer) error {
+	if err := si.CheckReady(); err != nil {
+		return err
+	}
 	args := bindPipelineArgs{
 		serviceInstance: si,
 		app:             app,
@@ -334,6 +404,14 @@ func CreateServiceInstance(instance ServiceInstance, service *Service, user *aut
 	}
 	instance.Teams = []string{instance.TeamOwner}
 	instance.Tags = processTags(instance.Tags)
+	schema, err := service.parameters(requestID)
+	if err != nil {
+		return err
+	}
+	instance.Parameters, err = ValidateParameters(instance.Parameters, schema)
+	if err != nil {
+		return err
+	}
 	actions := []*action.Action{&createServiceInstance, &insertServiceInstance}
 	pipeline := action.NewPipeline(actions...)
 	return pipeline.Execute(*service, instance, user.Email, requestID)
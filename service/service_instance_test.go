@@ -22,6 +22,7 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
@@ -337,8 +338,14 @@ func (s *InstanceSuite) TestDeleteInstanceWithApps(c *check.C) {
 func (s *InstanceSuite) TestCreateServiceInstance(c *check.C) {
 	var requests int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
-		atomic.AddInt32(&requests, 1)
+		if r.Method == "POST" {
+			atomic.AddInt32(&requests, 1)
+		}
 	}))
 	defer ts.Close()
 	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
@@ -359,8 +366,14 @@ func (s *InstanceSuite) TestCreateServiceInstance(c *check.C) {
 func (s *InstanceSuite) TestCreateServiceInstanceWithSameInstanceName(c *check.C) {
 	var requests int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
-		atomic.AddInt32(&requests, 1)
+		if r.Method == "POST" {
+			atomic.AddInt32(&requests, 1)
+		}
 	}))
 	defer ts.Close()
 	srv := []Service{
@@ -390,8 +403,14 @@ func (s *InstanceSuite) TestCreateServiceInstanceWithSameInstanceName(c *check.C
 func (s *InstanceSuite) TestCreateSpecifyOwner(c *check.C) {
 	var requests int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
-		atomic.AddInt32(&requests, 1)
+		if r.Method == "POST" {
+			atomic.AddInt32(&requests, 1)
+		}
 	}))
 	defer ts.Close()
 	team := auth.Team{Name: "owner"}
@@ -412,8 +431,14 @@ func (s *InstanceSuite) TestCreateSpecifyOwner(c *check.C) {
 func (s *InstanceSuite) TestCreateServiceInstanceNoTeamOwner(c *check.C) {
 	var requests int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
-		atomic.AddInt32(&requests, 1)
+		if r.Method == "POST" {
+			atomic.AddInt32(&requests, 1)
+		}
 	}))
 	defer ts.Close()
 	team := auth.Team{Name: "owner"}
@@ -429,6 +454,10 @@ func (s *InstanceSuite) TestCreateServiceInstanceNoTeamOwner(c *check.C) {
 
 func (s *InstanceSuite) TestCreateServiceInstanceNameShouldBeUnique(c *check.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
 	}))
 	defer ts.Close()
@@ -444,6 +473,10 @@ func (s *InstanceSuite) TestCreateServiceInstanceNameShouldBeUnique(c *check.C)
 
 func (s *InstanceSuite) TestCreateServiceInstanceEndpointFailure(c *check.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 	}))
 	defer ts.Close()
@@ -474,6 +507,10 @@ func (s *InstanceSuite) TestCreateServiceInstanceValidatesTheName(c *check.C) {
 		{"a@123", ErrInvalidInstanceName},
 	}
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
 	}))
 	defer ts.Close()
@@ -490,8 +527,14 @@ func (s *InstanceSuite) TestCreateServiceInstanceValidatesTheName(c *check.C) {
 func (s *InstanceSuite) TestCreateServiceInstanceRemovesDuplicatedAndEmptyTags(c *check.C) {
 	var requests int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
-		atomic.AddInt32(&requests, 1)
+		if r.Method == "POST" {
+			atomic.AddInt32(&requests, 1)
+		}
 	}))
 	defer ts.Close()
 	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
@@ -506,11 +549,63 @@ func (s *InstanceSuite) TestCreateServiceInstanceRemovesDuplicatedAndEmptyTags(c
 	c.Assert(si.Tags, check.DeepEquals, []string{"tag1"})
 }
 
+func (s *InstanceSuite) TestCreateServiceInstanceMissingRequiredParameter(c *check.C) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.Write([]byte(`[{"name": "engine-version", "required": true}]`))
+			return
+		}
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	instance := ServiceInstance{Name: "instance", TeamOwner: s.team.Name}
+	err = CreateServiceInstance(instance, &srv, s.user, "")
+	c.Assert(err, check.DeepEquals, &tsuruErrors.ValidationError{Message: `parameter "engine-version" is required`})
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(0))
+	_, err = GetServiceInstance("mongodb", "instance")
+	c.Assert(err, check.Equals, ErrServiceInstanceNotFound)
+}
+
+func (s *InstanceSuite) TestCreateServiceInstanceWithoutParametersUsesDefaults(c *check.C) {
+	var created string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.Write([]byte(`[{"name": "region", "default": "us-east"}]`))
+			return
+		}
+		r.ParseForm()
+		created = r.Form.Get(ParametersPrefix + "region")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	instance := ServiceInstance{Name: "instance", TeamOwner: s.team.Name}
+	err = CreateServiceInstance(instance, &srv, s.user, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(created, check.Equals, "us-east")
+	si, err := GetServiceInstance("mongodb", "instance")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.Parameters, check.DeepEquals, map[string]string{"region": "us-east"})
+}
+
 func (s *InstanceSuite) TestUpdateServiceInstance(c *check.C) {
 	var requests int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
-		atomic.AddInt32(&requests, 1)
+		if r.Method == "POST" {
+			atomic.AddInt32(&requests, 1)
+		}
 	}))
 	defer ts.Close()
 	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
@@ -535,8 +630,14 @@ func (s *InstanceSuite) TestUpdateServiceInstance(c *check.C) {
 func (s *InstanceSuite) TestUpdateServiceInstanceRemovesDuplicatedAndEmptyTags(c *check.C) {
 	var requests int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/parameters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
-		atomic.AddInt32(&requests, 1)
+		if r.Method == "POST" {
+			atomic.AddInt32(&requests, 1)
+		}
 	}))
 	defer ts.Close()
 	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
@@ -966,3 +1067,26 @@ func (s *InstanceSuite) TestUnbindAppMultipleApps(c *check.C) {
 	sort.Strings(siDB.Apps)
 	c.Assert(siDB.Apps, check.DeepEquals, []string{})
 }
+
+func (s *InstanceSuite) TestChangePlan(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/plans" {
+			w.Write([]byte(`[{"name": "small"}, {"name": "large"}]`))
+		}
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "instance", ServiceName: "mongodb", PlanName: "small"}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	err = si.ChangePlan("huge", "")
+	c.Assert(err, check.Equals, ErrInvalidPlan)
+	err = si.ChangePlan("large", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.PlanName, check.Equals, "large")
+	dbInstance, err := GetServiceInstance("mongodb", "instance")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.PlanName, check.Equals, "large")
+}